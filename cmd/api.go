@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"opcuaModbus/internal/clientopcua"
+	"strings"
+	"time"
+)
+
+// tagValue is value of tag for REST API
+type tagValue struct {
+	Device     string
+	Node       string
+	Alias      string `json:",omitempty"`
+	Type       string
+	Writable   bool
+	Value      interface{} `json:",omitempty"`
+	Quality    string
+	Status     string
+	SourceTime *time.Time `json:",omitempty"`
+	ServerTime *time.Time `json:",omitempty"`
+	Updated    *time.Time `json:",omitempty"`
+}
+
+// writeRequest is body of write of tag
+type writeRequest struct {
+	Value interface{} `json:"value"`
+}
+
+// apiRoutes is adding handlers of REST API of tags (only with configured tokens)
+func (a *httpAPI) apiRoutes(mux *http.ServeMux) {
+	if len(a.tokens) == 0 {
+		return
+	}
+	mux.HandleFunc("/api/tag", a.auth(a.tag))
+	mux.HandleFunc("/api/device", a.auth(a.device))
+}
+
+// auth is checking bearer token of request
+func (a *httpAPI) auth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		for _, t := range a.tokens {
+			if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				h(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+	}
+}
+
+// tag is reading (GET) or writing (PUT/POST) tag: ?device=plc1&tag=<node or alias>
+func (a *httpAPI) tag(w http.ResponseWriter, r *http.Request) {
+	dvc, node, err := a.findTag(r.URL.Query().Get("device"), r.URL.Query().Get("tag"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, tagStatus(dvc, node, dvc.Results.Snapshot()))
+
+	case http.MethodPut, http.MethodPost:
+		var req writeRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096))
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "bad request: "+err.Error())
+			return
+		}
+		tg := dvc.Tags[node]
+		if !tg.Writable() || dvc.Refused(node) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("tag %s is not writable", node))
+			return
+		}
+		v, err := clientopcua.ParseValue(tg.TypeData, req.Value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := writeTagValue(a.MBServer, dvc, node, v); err != nil {
+			a.logg.Error(dvc.State().Endpoint, "/", node, " write by REST API error: ", err)
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		a.logg.Info(dvc.State().Endpoint, "/", node, " written by REST API: ", v)
+		writeJSON(w, http.StatusOK, tagStatus(dvc, node, dvc.Results.Snapshot()))
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// device is snapshot of all tags of device: ?device=plc1
+func (a *httpAPI) device(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	name := r.URL.Query().Get("device")
+	for i := range a.PLCs {
+		dvc := &a.PLCs[i]
+		if dvc.Name != name {
+			continue
+		}
+		results := dvc.Results.Snapshot()
+		tags := make([]tagValue, 0, len(dvc.Nodes))
+		for _, n := range dvc.Nodes {
+			tags = append(tags, tagStatus(dvc, n, results))
+		}
+		writeJSON(w, http.StatusOK, tags)
+		return
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("unknown device %q", name))
+}
+
+// findTag is returns device & node of tag by node or alias (device is optional if tag is unique)
+func (a *httpAPI) findTag(device, tag string) (*clientopcua.DeviceOPCUA, string, error) {
+	if tag == "" {
+		return nil, "", fmt.Errorf("tag is required")
+	}
+	var found *clientopcua.DeviceOPCUA
+	var node string
+	for i := range a.PLCs {
+		if device != "" && a.PLCs[i].Name != device {
+			continue
+		}
+		n, _, ok := a.PLCs[i].FindTag(tag)
+		if !ok {
+			continue
+		}
+		if found != nil {
+			return nil, "", fmt.Errorf("tag %q is ambiguous, device is required", tag)
+		}
+		found, node = &a.PLCs[i], n
+	}
+	if found == nil {
+		return nil, "", fmt.Errorf("unknown tag %q", tag)
+	}
+	return found, node, nil
+}
+
+// tagStatus is returns last value of tag
+func tagStatus(dvc *clientopcua.DeviceOPCUA, node string, results map[string]clientopcua.NodeResult) tagValue {
+	tg := dvc.Tags[node]
+	tv := tagValue{
+		Device:   dvc.Name,
+		Node:     node,
+		Alias:    tg.Alias,
+		Type:     tg.TypeData,
+		Writable: tg.Writable() && !dvc.Refused(node),
+		Quality:  "bad",
+		Status:   "no data",
+	}
+	if res, ok := results[node]; ok {
+		tv.Value = clientopcua.JSONValue(res.Value)
+		tv.Quality = clientopcua.Quality(res.Status)
+		tv.Status = clientopcua.StatusName(res.Status)
+		if !res.SourceTime.IsZero() {
+			tv.SourceTime = &res.SourceTime
+		}
+		if !res.ServerTime.IsZero() {
+			tv.ServerTime = &res.ServerTime
+		}
+		tv.Updated = &res.Updated
+	}
+	return tv
+}
+
+// writeError is writing error response in JSON
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"strings"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagAPI(t *testing.T) {
+	logg := logrus.New()
+	mb := modbus.NewServer(logg, "", 0)
+	mb.AddDevice(5)
+	mb.AddDevice(6)
+
+	plc1 := clientopcua.DeviceOPCUA{Name: "plc1", MBUnitID: 5, Results: clientopcua.NewResults()}
+	plc1.AddTag("ns=3;s=Temp", clientopcua.Tag{Alias: "temp", TypeData: "float32", MBfunc: modbus.ReadInputRegisters, MBaddr: 1})
+	plc1.AddTag("ns=3;s=Setpoint", clientopcua.Tag{Alias: "sp", TypeData: "float32", MBfunc: modbus.ReadHoldingRegisters, MBaddr: 1, Write: true})
+	plc1.Results.Set("ns=3;s=Temp", &ua.DataValue{Value: ua.MustVariant(float32(21.5)), Status: ua.StatusOK})
+	plc2 := clientopcua.DeviceOPCUA{Name: "plc2", MBUnitID: 6, Results: clientopcua.NewResults()}
+	plc2.AddTag("ns=3;s=Temp", clientopcua.Tag{Alias: "temp", TypeData: "int16", MBfunc: modbus.ReadInputRegisters, MBaddr: 1})
+	plc2.AddTag("ns=3;s=Level", clientopcua.Tag{Alias: "level", TypeData: "int16", MBfunc: modbus.ReadHoldingRegisters, MBaddr: 1})
+
+	api := &httpAPI{MBServer: mb, PLCs: []clientopcua.DeviceOPCUA{plc1, plc2}, logg: logg, tokens: []string{"t0ken"}}
+	srv := httptest.NewServer(api.routes())
+	defer srv.Close()
+
+	do := func(method, path, body, token string) (*http.Response, map[string]interface{}) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var res map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&res)
+		return resp, res
+	}
+
+	resp, _ := do(http.MethodGet, "/api/tag?device=plc1&tag=temp", "", "")
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = do(http.MethodGet, "/api/tag?device=plc1&tag=temp", "", "bad")
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, res := do(http.MethodGet, "/api/tag?device=plc1&tag=temp", "", "t0ken")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "ns=3;s=Temp", res["Node"])
+	require.Equal(t, 21.5, res["Value"])
+	require.Equal(t, "good", res["Quality"])
+	require.Equal(t, false, res["Writable"])
+
+	resp, _ = do(http.MethodGet, "/api/tag?tag=ns%3D3%3Bs%3DTemp", "", "t0ken")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode) // ambiguous
+	resp, res = do(http.MethodGet, "/api/tag?tag=sp", "", "t0ken")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "bad", res["Quality"])
+	require.Equal(t, true, res["Writable"])
+
+	resp, res = do(http.MethodGet, "/api/tag?tag=level", "", "t0ken")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, false, res["Writable"]) // holding register without writable flag
+
+	resp, _ = do(http.MethodPut, "/api/tag?device=plc1&tag=temp", `{"value": 1}`, "t0ken")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = do(http.MethodPut, "/api/tag?tag=level", `{"value": 1}`, "t0ken")
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp, _ = do(http.MethodPut, "/api/tag?device=plc1&tag=sp", `{"value": "abc"}`, "t0ken")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, res = do(http.MethodPut, "/api/tag?device=plc1&tag=sp", `{"value": 42.5}`, "t0ken")
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.Equal(t, "not connected", res["error"])
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/device?device=plc1", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer t0ken")
+	r, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	var tags []tagValue
+	require.NoError(t, json.NewDecoder(r.Body).Decode(&tags))
+	r.Body.Close()
+	require.Len(t, tags, 2)
+
+	// without tokens API is disabled
+	srv2 := httptest.NewServer((&httpAPI{MBServer: mb, PLCs: api.PLCs, logg: logg}).routes())
+	defer srv2.Close()
+	r, err = http.Get(srv2.URL + "/api/tag?tag=sp")
+	require.NoError(t, err)
+	r.Body.Close()
+	require.Equal(t, http.StatusNotFound, r.StatusCode)
+}
+
+func TestParseValue(t *testing.T) {
+	for _, c := range []struct {
+		typ  string
+		v    interface{}
+		want interface{}
+	}{
+		{"bool", true, true},
+		{"bool", json.Number("0"), false},
+		{"float32", json.Number("1.5"), float32(1.5)},
+		{"real", "2.5", float32(2.5)},
+		{"int16", json.Number("-2"), int16(-2)},
+		{"word", json.Number("65535"), uint16(65535)},
+		{"dint", json.Number("-70000"), int32(-70000)},
+		{"uint64", json.Number("18446744073709551615"), uint64(18446744073709551615)},
+		{"double", 3.25, 3.25},
+	} {
+		v, err := clientopcua.ParseValue(c.typ, c.v)
+		require.NoError(t, err, c.typ)
+		require.Equal(t, c.want, v, c.typ)
+	}
+
+	for _, c := range []struct {
+		typ string
+		v   interface{}
+	}{
+		{"int16", json.Number("40000")},
+		{"uint16", json.Number("-1")},
+		{"int8", json.Number("200")},
+		{"int32", json.Number("1.5")},
+		{"string", "abc"},
+		{"bool", nil},
+	} {
+		_, err := clientopcua.ParseValue(c.typ, c.v)
+		require.Error(t, err, c.typ)
+	}
+}
+
+func TestTagWriteHandler(t *testing.T) {
+	logg := logrus.New()
+	mb := modbus.NewServer(logg, "", 0)
+	mb.AddDevice(5)
+
+	plc := clientopcua.DeviceOPCUA{Name: "plc1", MBUnitID: 5}
+	plc.AddTag("ns=3;s=Setpoint", clientopcua.Tag{TypeData: "float32", MBfunc: modbus.ReadHoldingRegisters, MBaddr: 10, Write: true})
+	plc.AddTag("ns=3;s=Run", clientopcua.Tag{TypeData: "bool", MBfunc: modbus.ReadCoils, MBaddr: 1, Write: true})
+	plc.AddTag("ns=3;s=Temp", clientopcua.Tag{TypeData: "int16", MBfunc: modbus.ReadInputRegisters, MBaddr: 10})
+	plc.AddTag("ns=3;s=Level", clientopcua.Tag{TypeData: "int16", MBfunc: modbus.ReadHoldingRegisters, MBaddr: 20})
+	h := tagWriteHandler(logg, mb, &plc)
+
+	require.Equal(t, modbus.IllegalDataAddress, h(modbus.WriteSingleRegister, 12, []uint16{1}))
+	require.Equal(t, modbus.IllegalDataAddress, h(modbus.WriteSingleRegister, 20, []uint16{1})) // not writable
+	require.Equal(t, modbus.IllegalDataAddress, h(modbus.WriteMultipleRegisters, 10, []uint16{1, 2, 3}))
+	require.Equal(t, modbus.IllegalDataAddress, h(modbus.WriteSingleCoil, 2, []uint16{1}))
+	// not connected
+	require.Equal(t, modbus.SlaveDeviceFailure, h(modbus.WriteSingleRegister, 11, []uint16{1}))
+	require.Equal(t, modbus.SlaveDeviceFailure, h(modbus.WriteSingleCoil, 1, []uint16{1}))
+
+	mb.WriteHoldingRegisters(5, 10, 0x3fc0)
+	regs := tagRegisters(mb, 5, plc.Tags["ns=3;s=Setpoint"], 11, []uint16{0x1234})
+	require.Equal(t, []uint16{0x3fc0, 0x1234}, regs)
+}
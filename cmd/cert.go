@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"opcuaModbus/internal/pki"
+	"os"
+	"strings"
+)
+
+// certCmd is subcommand managing client application instance certificates of devices
+//
+//	opcuaModbus -config config.toml cert print  [-device plc1]
+//	opcuaModbus -config config.toml cert renew  [-device plc1]
+//	opcuaModbus -config config.toml cert export [-device plc1] [-out cert.der]
+//
+// export writes DER certificate for trusting on the PLC side.
+func certCmd(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: cert print|renew|export [-device name] [-out file]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("cert", flag.ContinueOnError)
+	device := fs.String("device", "", "device name (all devices, if empty)")
+	out := fs.String("out", "", "export file (default: certificate file with .der extension)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	config, err := NewConfig(configFile)
+	if err != nil {
+		return err
+	}
+	plcs, err := config.plcs(config.resolver())
+	if err != nil {
+		return err
+	}
+
+	done := map[string]bool{}
+	for _, plc := range plcs {
+		if *device != "" && plc.Name != *device {
+			continue
+		}
+		certFile, keyFile, appURI := plc.Config.CertPaths()
+		if done[certFile] {
+			continue
+		}
+		done[certFile] = true
+
+		switch action {
+		case "print", "export":
+			// certificate is not created by reading actions
+			if _, err := os.Stat(certFile); errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("# %s (%s)\nno certificate\n", plc.Name, certFile)
+				continue
+			}
+		case "renew":
+			generated, err := pki.EnsureCertificate(certFile, keyFile, appURI, plc.Config.KeyPassword)
+			if err != nil {
+				return fmt.Errorf("%s: %w", plc.Name, err)
+			}
+			if !generated {
+				key, err := pki.LoadPrivateKey(keyFile, plc.Config.KeyPassword)
+				if err != nil {
+					return err
+				}
+				if err := pki.RenewCertificate(certFile, keyFile, appURI, key, plc.Config.KeyPassword); err != nil {
+					return err
+				}
+			}
+		default:
+			return errors.New("unknown action: " + action)
+		}
+
+		if action == "export" {
+			der, err := pki.LoadCertificate(certFile)
+			if err != nil {
+				return err
+			}
+			file := *out
+			if file == "" {
+				file = strings.TrimSuffix(certFile, ".pem") + ".der"
+			}
+			if err := os.WriteFile(file, der, 0644); err != nil {
+				return err
+			}
+			fmt.Println(plc.Name, "exported:", file)
+		}
+
+		der, err := pki.LoadCertificate(certFile)
+		if err != nil {
+			return err
+		}
+		desc, err := pki.Describe(der)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("# %s (%s)\n%s\n", plc.Name, certFile, desc)
+	}
+
+	if len(done) == 0 {
+		return errors.New("device not found: " + *device)
+	}
+	return nil
+}
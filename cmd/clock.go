@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"opcuaModbus/internal/clientopcua"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// startClock is periodically reading CurrentTime of server and writing server time
+// and drift of server clock to input registers of unit
+func startClock(ctx context.Context, logg *logrus.Logger, srvc *serv) {
+	dvc := srvc.OPCUAClients
+	ticker := time.NewTicker(dvc.ClockInterval())
+	defer ticker.Stop()
+
+	for {
+		c, err := dvc.SyncClock(ctx)
+		if err != nil {
+			logg.Debug(dvc.Config.Endpoint, " clock error: ", err)
+		} else {
+			srvc.writeClock(c)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeClock is writing clock registers of device
+func (srv *serv) writeClock(c clientopcua.ClockSnapshot) {
+	dvc := srv.OPCUAClients
+	for i, r := range c.Registers() {
+		srv.MBServer.WriteInputRegisters(dvc.MBUnitID, *dvc.Config.ClockRegister+uint16(i), r)
+	}
+}
@@ -2,20 +2,41 @@ package main
 
 import (
 	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"opcuaModbus/internal/clientmodbus"
 	"opcuaModbus/internal/clientopcua"
 	"opcuaModbus/internal/modbus"
+	"opcuaModbus/internal/mqtt"
+	"opcuaModbus/internal/pki"
+	"opcuaModbus/internal/secrets"
+	"opcuaModbus/internal/serveropcua"
+	"opcuaModbus/internal/sparkplug"
+	"opcuaModbus/internal/spool"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/gopcua/opcua/ua"
+	"gopkg.in/yaml.v3"
 )
 
 // Config ...
 type Config struct {
-	Logger  LoggerConf
-	Devices DevicesConf
-	Modbus  ModbusConf
+	Logger    LoggerConf
+	Devices   DevicesConf
+	Modbus    ModbusConf
+	Secrets   SecretsConf
+	PKI       PKIConf
+	HTTP      HTTPConf
+	MQTT      MQTTConf
+	Sparkplug SparkplugConf
+	OPCUA     OPCUAServerConf `toml:"opcua_server"`
+	Device    []DeviceConf    `toml:"device"`
 }
 
 // LoggerConf ...
@@ -26,12 +47,413 @@ type LoggerConf struct {
 // DevicesConf ...
 type DevicesConf struct {
 	Directory string
+	File      string // structured devices file (toml/yaml/json), instead of plc.tsv
+}
+
+// SecretsConf is configuration of encrypted secrets vault
+type SecretsConf struct {
+	Vault         string
+	MasterKeyFile string `toml:"master_key_file"`
+}
+
+// PKIConf is configuration of trust store of server certificates
+type PKIConf struct {
+	Directory string
+}
+
+// HTTPConf is configuration of embedded HTTP server of status API (port 0 - disabled)
+type HTTPConf struct {
+	Host string
+	Port int
+	// Tokens is bearer tokens of REST API of tags (secret references env:/file:/vault:), empty - API disabled
+	Tokens []string
+}
+
+// tokens is resolving tokens of REST API
+func (h HTTPConf) tokens(res *secrets.Resolver) ([]string, error) {
+	var tokens []string
+	for i, ref := range h.Tokens {
+		t, err := res.Resolve(ref)
+		if err != nil {
+			return nil, fmt.Errorf("http token %d: %w", i+1, err)
+		}
+		if t.Reveal() != "" {
+			tokens = append(tokens, t.Reveal())
+		}
+	}
+	return tokens, nil
+}
+
+// MQTTConf is configuration of MQTT publisher of data changes (empty broker - disabled)
+type MQTTConf struct {
+	Broker      string
+	ClientID    string `toml:"client_id"`
+	Username    string
+	Password    string // secret reference env:/file:/vault: or value
+	Topic       string // e.g. "plant/{device}/{tag}"
+	StatusTopic string `toml:"status_topic"`
+	QoS         byte   `toml:"qos"`
+	Retained    bool
+	Buffer      int       // store-and-forward buffer in memory, messages
+	Overflow    string    // drop_oldest (default), drop_newest
+	Spool       SpoolConf // store-and-forward queue on disk instead of buffer in memory
+}
+
+// SpoolConf is configuration of store-and-forward queue on disk (empty dir - buffer in memory)
+type SpoolConf struct {
+	Dir          string // subdirectory of device is created
+	SegmentSize  int64  `toml:"segment_size"` // bytes
+	MaxSize      int64  `toml:"max_size"`     // bytes of all segments of device
+	Sync         string // always, interval (default), never
+	SyncInterval string `toml:"sync_interval"`
+}
+
+// config is converting MQTTConf to mqtt.Config
+func (m MQTTConf) config(res *secrets.Resolver) (mqtt.Config, error) {
+	if m.QoS > 1 {
+		return mqtt.Config{}, fmt.Errorf("mqtt qos %d: only 0 and 1 are supported", m.QoS)
+	}
+	password, err := res.Resolve(m.Password)
+	if err != nil {
+		return mqtt.Config{}, fmt.Errorf("mqtt password: %w", err)
+	}
+	sc := spool.Config{
+		Dir:         strings.TrimSpace(m.Spool.Dir),
+		SegmentSize: m.Spool.SegmentSize,
+		MaxSize:     m.Spool.MaxSize,
+		Sync:        m.Spool.Sync,
+		Overflow:    m.Overflow,
+	}
+	if m.Spool.SyncInterval != "" {
+		if sc.SyncInterval, err = clientopcua.ParseInterval(m.Spool.SyncInterval); err != nil {
+			return mqtt.Config{}, fmt.Errorf("mqtt spool sync_interval: %w", err)
+		}
+	}
+	if err := sc.Check(); err != nil {
+		return mqtt.Config{}, fmt.Errorf("mqtt: %w", err)
+	}
+	return mqtt.Config{
+		Broker:      strings.TrimSpace(m.Broker),
+		ClientID:    m.ClientID,
+		Username:    m.Username,
+		Password:    password,
+		Topic:       m.Topic,
+		StatusTopic: m.StatusTopic,
+		QoS:         m.QoS,
+		Retained:    m.Retained,
+		Buffer:      m.Buffer,
+		Overflow:    sc.Overflow,
+		Spool:       sc,
+	}, nil
+}
+
+// SparkplugConf is configuration of Sparkplug B edge node (empty broker - disabled)
+type SparkplugConf struct {
+	Broker     string
+	ClientID   string `toml:"client_id"`
+	Username   string
+	Password   string // secret reference env:/file:/vault: or value
+	GroupID    string `toml:"group_id"`
+	EdgeNodeID string `toml:"edge_node_id"`
+}
+
+// config is converting SparkplugConf to sparkplug.Config
+func (s SparkplugConf) config(res *secrets.Resolver) (sparkplug.Config, error) {
+	if strings.TrimSpace(s.Broker) == "" {
+		return sparkplug.Config{}, nil
+	}
+	for name, id := range map[string]string{"group_id": s.GroupID, "edge_node_id": s.EdgeNodeID} {
+		if id == "" || strings.ContainsAny(id, "/+#") {
+			return sparkplug.Config{}, fmt.Errorf("sparkplug %s %q: must be not empty, without / + #", name, id)
+		}
+	}
+	password, err := res.Resolve(s.Password)
+	if err != nil {
+		return sparkplug.Config{}, fmt.Errorf("sparkplug password: %w", err)
+	}
+	return sparkplug.Config{
+		Broker:     strings.TrimSpace(s.Broker),
+		ClientID:   s.ClientID,
+		Username:   s.Username,
+		Password:   password,
+		GroupID:    s.GroupID,
+		EdgeNodeID: s.EdgeNodeID,
+	}, nil
+}
+
+// OPCUAServerConf is configuration of OPC UA server of registers of units (port 0 - disabled)
+type OPCUAServerConf struct {
+	Host            string
+	Port            int
+	EndpointURL     string `toml:"endpoint_url"`
+	ApplicationURI  string `toml:"application_uri"`
+	ApplicationName string `toml:"application_name"`
+	// Writes is allowing writes of clients to variables of writable tags (default false - read only)
+	Writes bool
+}
+
+// config is converting OPCUAServerConf to serveropcua.Config
+func (o OPCUAServerConf) config() (serveropcua.Config, error) {
+	if o.Port < 0 || o.Port > 65535 {
+		return serveropcua.Config{}, fmt.Errorf("opcua server port %d: must be 0..65535", o.Port)
+	}
+	if o.EndpointURL != "" && !strings.HasPrefix(o.EndpointURL, "opc.tcp://") {
+		return serveropcua.Config{}, fmt.Errorf("opcua server endpoint %q: must be opc.tcp://host:port", o.EndpointURL)
+	}
+	return serveropcua.Config{
+		Host:            strings.TrimSpace(o.Host),
+		Port:            o.Port,
+		EndpointURL:     strings.TrimSpace(o.EndpointURL),
+		ApplicationURI:  o.ApplicationURI,
+		ApplicationName: o.ApplicationName,
+		Writes:          o.Writes,
+	}, nil
 }
 
 // ModbusConf ...
 type ModbusConf struct {
 	Host string
 	Port int
+	// Routes is forwarding of requests to units, which are not devices of gateway, to downstream devices
+	Routes []RouteConf `toml:"route"`
+}
+
+// RouteConf is configuration of route of unit to downstream Modbus TCP or RTU over TCP device
+type RouteConf struct {
+	Unit          int
+	Address       string // host:port
+	Protocol      string // tcp (default) or rtu
+	TargetUnit    *int   `toml:"target_unit"` // unit id on downstream device, default - unit
+	Timeout       string
+	MaxConcurrent int    `toml:"max_concurrent"`
+	IdleTimeout   string `toml:"idle_timeout"` // unused connection is closed after it
+}
+
+// route is converting RouteConf to modbus.Route
+func (r RouteConf) route() (modbus.Route, error) {
+	if r.Unit < 1 || r.Unit > 247 {
+		return modbus.Route{}, fmt.Errorf("route unit %d: must be 1..247", r.Unit)
+	}
+	if _, _, err := net.SplitHostPort(strings.TrimSpace(r.Address)); err != nil {
+		return modbus.Route{}, fmt.Errorf("route unit %d: %w", r.Unit, err)
+	}
+	protocol := strings.ToLower(strings.TrimSpace(r.Protocol))
+	switch protocol {
+	case "", modbus.ProtocolTCP:
+		protocol = modbus.ProtocolTCP
+	case modbus.ProtocolRTU:
+	default:
+		return modbus.Route{}, fmt.Errorf("route unit %d: unknown protocol %q", r.Unit, r.Protocol)
+	}
+	target := r.Unit
+	if r.TargetUnit != nil {
+		target = *r.TargetUnit
+	}
+	if target < 0 || target > 255 {
+		return modbus.Route{}, fmt.Errorf("route unit %d: target unit %d: must be 0..255", r.Unit, target)
+	}
+	var timeout time.Duration
+	if r.Timeout != "" {
+		var err error
+		if timeout, err = clientopcua.ParseInterval(r.Timeout); err != nil {
+			return modbus.Route{}, fmt.Errorf("route unit %d: timeout: %w", r.Unit, err)
+		}
+	}
+	var idle time.Duration
+	if r.IdleTimeout != "" {
+		var err error
+		if idle, err = clientopcua.ParseInterval(r.IdleTimeout); err != nil {
+			return modbus.Route{}, fmt.Errorf("route unit %d: idle timeout: %w", r.Unit, err)
+		}
+	}
+	return modbus.Route{
+		Unit:          modbus.UnitID(r.Unit),
+		Address:       strings.TrimSpace(r.Address),
+		Protocol:      protocol,
+		TargetUnit:    modbus.UnitID(target),
+		Timeout:       timeout,
+		MaxConcurrent: r.MaxConcurrent,
+		IdleTimeout:   idle,
+	}, nil
+}
+
+// DevicesFile is structured devices configuration (toml/yaml/json)
+type DevicesFile struct {
+	Device []DeviceConf `toml:"device" yaml:"device" json:"device"`
+}
+
+// DeviceConf is configuration of OPCUA device with named fields
+type DeviceConf struct {
+	Name string `toml:"name,omitempty" yaml:"name,omitempty" json:"name,omitempty"`
+	// Kind is "opcua" (default) or "modbus" - Modbus TCP device polled by gateway
+	Kind     string `toml:"kind,omitempty" yaml:"kind,omitempty" json:"kind,omitempty"`
+	Host     string `toml:"host" yaml:"host" json:"host"`
+	Port     int    `toml:"port" yaml:"port" json:"port"`
+	Policy   string `toml:"policy,omitempty" yaml:"policy,omitempty" json:"policy,omitempty"`
+	Mode     string `toml:"mode,omitempty" yaml:"mode,omitempty" json:"mode,omitempty"`
+	Auth     string `toml:"auth,omitempty" yaml:"auth,omitempty" json:"auth,omitempty"`
+	Username string `toml:"username,omitempty" yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `toml:"password,omitempty" yaml:"password,omitempty" json:"password,omitempty"`
+	// Password & KeyPassword (passphrase of private key) can be env:NAME, file:/path, vault:name
+	KeyPassword string `toml:"key_password,omitempty" yaml:"key_password,omitempty" json:"key_password,omitempty"`
+	UnitID      int    `toml:"unit_id" yaml:"unit_id" json:"unit_id"`
+	// client application instance certificate, generated if none exists
+	CertFile       string `toml:"cert_file,omitempty" yaml:"cert_file,omitempty" json:"cert_file,omitempty"`
+	KeyFile        string `toml:"key_file,omitempty" yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	ApplicationURI string `toml:"application_uri,omitempty" yaml:"application_uri,omitempty" json:"application_uri,omitempty"`
+	// X.509 user certificate (auth = "Certificate")
+	UserCertFile    string `toml:"user_cert_file,omitempty" yaml:"user_cert_file,omitempty" json:"user_cert_file,omitempty"`
+	UserKeyFile     string `toml:"user_key_file,omitempty" yaml:"user_key_file,omitempty" json:"user_key_file,omitempty"`
+	UserKeyPassword string `toml:"user_key_password,omitempty" yaml:"user_key_password,omitempty" json:"user_key_password,omitempty"`
+	// ReadMode is "subscribe" (default) or "poll" - batched Read every PollInterval
+	ReadMode     string `toml:"read_mode,omitempty" yaml:"read_mode,omitempty" json:"read_mode,omitempty"`
+	PollInterval string `toml:"poll_interval,omitempty" yaml:"poll_interval,omitempty" json:"poll_interval,omitempty"`
+	// MaxItemsPerSubscription is limit of monitored items per subscription, if server does not report it
+	MaxItemsPerSubscription uint32 `toml:"max_items_per_subscription,omitempty" yaml:"max_items_per_subscription,omitempty" json:"max_items_per_subscription,omitempty"`
+	// BackupEndpoints is endpoints of redundant servers ("host:port" or "opc.tcp://host:port")
+	BackupEndpoints []string `toml:"backup_endpoints,omitempty" yaml:"backup_endpoints,omitempty" json:"backup_endpoints,omitempty"`
+	MinServiceLevel uint8    `toml:"min_service_level,omitempty" yaml:"min_service_level,omitempty" json:"min_service_level,omitempty"`
+	FailoverTimeout string   `toml:"failover_timeout,omitempty" yaml:"failover_timeout,omitempty" json:"failover_timeout,omitempty"`
+	// RefuseInvalidTags is not mapping tags which do not match DataType/ValueRank/AccessLevel of nodes
+	RefuseInvalidTags bool `toml:"refuse_invalid_tags,omitempty" yaml:"refuse_invalid_tags,omitempty" json:"refuse_invalid_tags,omitempty"`
+	// ClockRegister is input registers of server time (Unix seconds) and drift of server clock (ms)
+	ClockRegister *uint16 `toml:"clock_register,omitempty" yaml:"clock_register,omitempty" json:"clock_register,omitempty"`
+	ClockInterval string  `toml:"clock_interval,omitempty" yaml:"clock_interval,omitempty" json:"clock_interval,omitempty"`
+	// PublishIntervals is publishing intervals of subscriptions by name, e.g. fast = "100ms"
+	PublishIntervals map[string]string `toml:"publish_intervals,omitempty" yaml:"publish_intervals,omitempty" json:"publish_intervals,omitempty"`
+	TagsFile         string            `toml:"tags_file,omitempty" yaml:"tags_file,omitempty" json:"tags_file,omitempty"`
+	Tags             []TagConf         `toml:"tag,omitempty" yaml:"tag,omitempty" json:"tag,omitempty"`
+	// Events is subscription to Alarms & Conditions events
+	Events *EventsConf `toml:"events,omitempty" yaml:"events,omitempty" json:"events,omitempty"`
+	// Methods is OPC UA methods called by writes of master
+	Methods []MethodConf `toml:"method,omitempty" yaml:"method,omitempty" json:"method,omitempty"`
+	// SlaveID is unit id of Modbus TCP device, tags are read in blocks of MaxRegisters/MaxBits
+	// with MaxGap unused addresses between tags, failed read is repeated Retries times
+	SlaveID      int    `toml:"slave_id,omitempty" yaml:"slave_id,omitempty" json:"slave_id,omitempty"`
+	Timeout      string `toml:"timeout,omitempty" yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Retries      *int   `toml:"retries,omitempty" yaml:"retries,omitempty" json:"retries,omitempty"`
+	MaxRegisters uint16 `toml:"max_registers,omitempty" yaml:"max_registers,omitempty" json:"max_registers,omitempty"`
+	MaxBits      uint16 `toml:"max_bits,omitempty" yaml:"max_bits,omitempty" json:"max_bits,omitempty"`
+	MaxGap       uint16 `toml:"max_gap,omitempty" yaml:"max_gap,omitempty" json:"max_gap,omitempty"`
+}
+
+// isModbus is true for Modbus TCP device
+func (d DeviceConf) isModbus() bool {
+	return strings.EqualFold(strings.TrimSpace(d.Kind), clientmodbus.Kind)
+}
+
+// MethodConf is configuration of method called by write to coil or holding register
+type MethodConf struct {
+	Name           string   `toml:"name,omitempty" yaml:"name,omitempty" json:"name,omitempty"`
+	Object         string   `toml:"object" yaml:"object" json:"object"`
+	Method         string   `toml:"method" yaml:"method" json:"method"`
+	Trigger        string   `toml:"trigger" yaml:"trigger" json:"trigger"` // coil or holding
+	Address        uint16   `toml:"address" yaml:"address" json:"address"`
+	ArgsAddress    uint16   `toml:"args_address,omitempty" yaml:"args_address,omitempty" json:"args_address,omitempty"`
+	Args           []string `toml:"args,omitempty" yaml:"args,omitempty" json:"args,omitempty"`
+	StatusRegister *uint16  `toml:"status_register,omitempty" yaml:"status_register,omitempty" json:"status_register,omitempty"`
+	OutputsAddress *uint16  `toml:"outputs_address,omitempty" yaml:"outputs_address,omitempty" json:"outputs_address,omitempty"`
+}
+
+// method is converting method config
+func (m MethodConf) method() (clientopcua.Method, error) {
+	mt := clientopcua.Method{
+		Name:        m.Name,
+		Object:      strings.TrimSpace(m.Object),
+		Method:      strings.TrimSpace(m.Method),
+		Trigger:     modbus.StringToUint8(m.Trigger),
+		TriggerAddr: m.Address,
+		ArgsAddr:    m.ArgsAddress,
+		Args:        m.Args,
+		StatusAddr:  m.StatusRegister,
+		OutputsAddr: m.OutputsAddress,
+	}
+	if mt.Name == "" {
+		mt.Name = mt.Method
+	}
+	if mt.Object == "" || mt.Method == "" {
+		return mt, fmt.Errorf("method %s: object and method required", mt.Name)
+	}
+	if mt.Trigger != modbus.ReadCoils && mt.Trigger != modbus.ReadHoldingRegisters {
+		return mt, fmt.Errorf("method %s: trigger must be coil or holding", mt.Name)
+	}
+	for _, a := range m.Args {
+		if clientopcua.RegisterCount(a) == 0 {
+			return mt, fmt.Errorf("method %s: unsupported argument type %q", mt.Name, a)
+		}
+	}
+	return mt, nil
+}
+
+// EventsConf is configuration of event subscription of device
+type EventsConf struct {
+	Notifier string      `toml:"notifier,omitempty" yaml:"notifier,omitempty" json:"notifier,omitempty"`
+	Interval string      `toml:"interval,omitempty" yaml:"interval,omitempty" json:"interval,omitempty"`
+	Where    string      `toml:"where,omitempty" yaml:"where,omitempty" json:"where,omitempty"`
+	Alarms   []AlarmConf `toml:"alarm" yaml:"alarm" json:"alarm"`
+}
+
+// AlarmConf is mapping of condition to ModBus addresses
+type AlarmConf struct {
+	Condition        string  `toml:"condition,omitempty" yaml:"condition,omitempty" json:"condition,omitempty"`
+	Source           string  `toml:"source,omitempty" yaml:"source,omitempty" json:"source,omitempty"`
+	ActiveCoil       *uint16 `toml:"active_coil,omitempty" yaml:"active_coil,omitempty" json:"active_coil,omitempty"`
+	AckedDiscrete    *uint16 `toml:"acked_discrete,omitempty" yaml:"acked_discrete,omitempty" json:"acked_discrete,omitempty"`
+	SeverityRegister *uint16 `toml:"severity_register,omitempty" yaml:"severity_register,omitempty" json:"severity_register,omitempty"`
+	AckCoil          *uint16 `toml:"ack_coil,omitempty" yaml:"ack_coil,omitempty" json:"ack_coil,omitempty"`
+}
+
+// events is converting events config of device
+func (e *EventsConf) events() (*clientopcua.Events, error) {
+	if e == nil {
+		return nil, nil
+	}
+	ev := &clientopcua.Events{Notifier: strings.TrimSpace(e.Notifier), Where: e.Where}
+	if e.Interval != "" {
+		var err error
+		if ev.Interval, err = clientopcua.ParseInterval(e.Interval); err != nil {
+			return nil, fmt.Errorf("events interval: %w", err)
+		}
+	}
+	if _, err := clientopcua.ParseWhere(e.Where); err != nil {
+		return nil, err
+	}
+	for _, a := range e.Alarms {
+		if a.Condition == "" && a.Source == "" {
+			return nil, fmt.Errorf("alarm without condition and source")
+		}
+		ev.Alarms = append(ev.Alarms, clientopcua.Alarm{
+			Condition:        a.Condition,
+			Source:           a.Source,
+			ActiveCoil:       a.ActiveCoil,
+			AckedDiscrete:    a.AckedDiscrete,
+			SeverityRegister: a.SeverityRegister,
+			AckCoil:          a.AckCoil,
+		})
+	}
+	return ev, nil
+}
+
+// TagConf is configuration of device tag with named fields
+type TagConf struct {
+	Node     string `toml:"node" yaml:"node" json:"node"`
+	Alias    string `toml:"alias,omitempty" yaml:"alias,omitempty" json:"alias,omitempty"`
+	Type     string `toml:"type" yaml:"type" json:"type"`
+	Function string `toml:"function" yaml:"function" json:"function"`
+	Address  uint16 `toml:"address" yaml:"address" json:"address"`
+	// Units is engineering units of value in OPC UA server of gateway, e.g. "°C"
+	Units string `toml:"units,omitempty" yaml:"units,omitempty" json:"units,omitempty"`
+	// Writable is allowing writes of masters to node of coil or holding register tag (default read only)
+	Writable bool `toml:"writable,omitempty" yaml:"writable,omitempty" json:"writable,omitempty"`
+	// monitored item: subscription (name or publishing interval), sampling interval ("100ms"),
+	// queue size, discard oldest, deadband type (absolute/percent), deadband, trigger (status/value/timestamp)
+	Subscription     string  `toml:"subscription,omitempty" yaml:"subscription,omitempty" json:"subscription,omitempty"`
+	SamplingInterval string  `toml:"sampling_interval,omitempty" yaml:"sampling_interval,omitempty" json:"sampling_interval,omitempty"`
+	QueueSize        uint32  `toml:"queue_size,omitempty" yaml:"queue_size,omitempty" json:"queue_size,omitempty"`
+	DiscardOldest    *bool   `toml:"discard_oldest,omitempty" yaml:"discard_oldest,omitempty" json:"discard_oldest,omitempty"`
+	DeadbandType     string  `toml:"deadband_type,omitempty" yaml:"deadband_type,omitempty" json:"deadband_type,omitempty"`
+	Deadband         float64 `toml:"deadband,omitempty" yaml:"deadband,omitempty" json:"deadband,omitempty"`
+	Trigger          string  `toml:"trigger,omitempty" yaml:"trigger,omitempty" json:"trigger,omitempty"`
 }
 
 // NewConfig is parsing config file.
@@ -39,11 +461,419 @@ func NewConfig(path string) (conf Config, err error) {
 	if _, err := toml.DecodeFile(path, &conf); err != nil {
 		return Config{}, err
 	}
+	if conf.Devices.File != "" {
+		devices, err := readDevicesFile(conf.Devices.File)
+		if err != nil {
+			return Config{}, err
+		}
+		conf.Device = append(conf.Device, devices...)
+	}
 	return conf, nil
 }
 
+// resolver is returns resolver of secrets references
+func (conf Config) resolver() *secrets.Resolver {
+	return &secrets.Resolver{
+		VaultFile:     conf.Secrets.Vault,
+		MasterKeyFile: conf.Secrets.MasterKeyFile,
+	}
+}
+
+// plcs is returns devices from structured config, if defined, else from plc.tsv
+func (conf Config) plcs(res *secrets.Resolver) (plcs []clientopcua.DeviceOPCUA, err error) {
+	if len(conf.Device) == 0 {
+		plcs, err = readConfPlcs(conf.Devices.Directory, res)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, d := range conf.Device {
+		if d.isModbus() {
+			continue
+		}
+		plc, err := d.device(conf.Devices.Directory, res)
+		if err != nil {
+			return nil, fmt.Errorf("device %d (%s): %w", i, d.Name, err)
+		}
+		plcs = append(plcs, plc)
+	}
+
+	if conf.PKI.Directory != "" {
+		store, err := pki.NewStore(conf.PKI.Directory)
+		if err != nil {
+			return nil, err
+		}
+		for i := range plcs {
+			plcs[i].TrustStore = store
+		}
+	}
+	return plcs, nil
+}
+
+// sources is returns Modbus TCP devices from structured config, if defined, else from plc.tsv
+func (conf Config) sources() ([]*clientmodbus.DeviceModbus, error) {
+	devices := conf.Device
+	if len(devices) == 0 {
+		var err error
+		if devices, err = readDevicesTSV(conf.Devices.Directory); err != nil {
+			return nil, err
+		}
+	}
+
+	var sources []*clientmodbus.DeviceModbus
+	for i, d := range devices {
+		if !d.isModbus() {
+			continue
+		}
+		dvc, err := d.modbusDevice(conf.Devices.Directory)
+		if err != nil {
+			return nil, fmt.Errorf("device %d (%s): %w", i, d.Name, err)
+		}
+		sources = append(sources, dvc)
+	}
+	return sources, nil
+}
+
+// readDevicesFile is reads structured devices config, format by file extension
+func readDevicesFile(path string) ([]DeviceConf, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var df DevicesFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &df)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &df)
+	case ".json":
+		err = json.Unmarshal(data, &df)
+	default:
+		return nil, fmt.Errorf("unknown format devices file: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return df.Device, nil
+}
+
+// device is converts DeviceConf to clientopcua.DeviceOPCUA
+func (d DeviceConf) device(dir string, res *secrets.Resolver) (clientopcua.DeviceOPCUA, error) {
+	if strings.TrimSpace(d.Host) == "" || d.Port == 0 {
+		return clientopcua.DeviceOPCUA{}, fmt.Errorf("empty host or port")
+	}
+	if d.TagsFile == "" && len(d.Tags) == 0 {
+		return clientopcua.DeviceOPCUA{}, fmt.Errorf("no tags")
+	}
+	if d.UnitID < 1 || d.UnitID > 247 {
+		return clientopcua.DeviceOPCUA{}, fmt.Errorf("unit id %d: must be 1..247", d.UnitID)
+	}
+	password, err := res.Resolve(d.Password)
+	if err != nil {
+		return clientopcua.DeviceOPCUA{}, fmt.Errorf("password: %w", err)
+	}
+	keyPassword, err := res.Resolve(d.KeyPassword)
+	if err != nil {
+		return clientopcua.DeviceOPCUA{}, fmt.Errorf("key password: %w", err)
+	}
+	userKeyPassword, err := res.Resolve(d.UserKeyPassword)
+	if err != nil {
+		return clientopcua.DeviceOPCUA{}, fmt.Errorf("user key password: %w", err)
+	}
+
+	publish := map[string]time.Duration{}
+	for n, v := range d.PublishIntervals {
+		if publish[n], err = clientopcua.ParseInterval(v); err != nil {
+			return clientopcua.DeviceOPCUA{}, fmt.Errorf("publish interval %s: %w", n, err)
+		}
+	}
+
+	var pollInterval time.Duration
+	if d.PollInterval != "" {
+		if pollInterval, err = clientopcua.ParseInterval(d.PollInterval); err != nil {
+			return clientopcua.DeviceOPCUA{}, fmt.Errorf("poll interval: %w", err)
+		}
+	}
+
+	var failoverTimeout time.Duration
+	if d.FailoverTimeout != "" {
+		if failoverTimeout, err = clientopcua.ParseInterval(d.FailoverTimeout); err != nil {
+			return clientopcua.DeviceOPCUA{}, fmt.Errorf("failover timeout: %w", err)
+		}
+	}
+
+	var clockInterval time.Duration
+	if d.ClockInterval != "" {
+		if clockInterval, err = clientopcua.ParseInterval(d.ClockInterval); err != nil {
+			return clientopcua.DeviceOPCUA{}, fmt.Errorf("clock interval: %w", err)
+		}
+	}
+
+	events, err := d.Events.events()
+	if err != nil {
+		return clientopcua.DeviceOPCUA{}, err
+	}
+	var methods []clientopcua.Method
+	for _, mc := range d.Methods {
+		m, err := mc.method()
+		if err != nil {
+			return clientopcua.DeviceOPCUA{}, err
+		}
+		methods = append(methods, m)
+	}
+
+	endpoint := "opc.tcp://" + strings.TrimSpace(d.Host) + ":" + strconv.Itoa(d.Port)
+	var endpoints []string
+	if len(d.BackupEndpoints) > 0 {
+		endpoints = append(endpoints, endpoint)
+		for _, e := range d.BackupEndpoints {
+			endpoints = append(endpoints, clientopcua.Endpoint(e))
+		}
+	}
+
+	plc := clientopcua.DeviceOPCUA{
+		Name:   d.name(),
+		Status: clientopcua.Configured,
+		Config: clientopcua.Config{
+			Endpoint:                endpoint,
+			Policy:                  correctPolicy(d.Policy),
+			Mode:                    correctMode(d.Mode),
+			Auth:                    correctAuth(d.Auth),
+			Username:                strings.TrimSpace(d.Username),
+			Password:                password,
+			KeyPassword:             keyPassword,
+			CertFile:                d.CertFile,
+			KeyFile:                 d.KeyFile,
+			ApplicationURI:          d.ApplicationURI,
+			UserCertFile:            d.UserCertFile,
+			UserKeyFile:             d.UserKeyFile,
+			UserKeyPassword:         userKeyPassword,
+			PublishIntervals:        publish,
+			ReadMode:                correctReadMode(d.ReadMode),
+			PollInterval:            pollInterval,
+			MaxItemsPerSubscription: d.MaxItemsPerSubscription,
+			Endpoints:               endpoints,
+			MinServiceLevel:         d.MinServiceLevel,
+			FailoverTimeout:         failoverTimeout,
+			RefuseInvalidTags:       d.RefuseInvalidTags,
+			ClockRegister:           d.ClockRegister,
+			ClockInterval:           clockInterval,
+		},
+		MBUnitID: modbus.UnitID(d.UnitID),
+		Events:   events,
+		Methods:  methods,
+	}
+
+	if d.TagsFile != "" {
+		plc.FileTags = tagsPath(dir, d.TagsFile)
+		return plc, nil
+	}
+
+	for _, t := range d.Tags {
+		tg, err := t.tag()
+		if err != nil {
+			return clientopcua.DeviceOPCUA{}, fmt.Errorf("tag %q: %w", t.Node, err)
+		}
+		plc.AddTag(t.Node, tg)
+	}
+	plc.Status = clientopcua.ReadTags
+
+	return plc, nil
+}
+
+// name is name of device: configured or host:port
+func (d DeviceConf) name() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	if d.isModbus() {
+		return net.JoinHostPort(strings.TrimSpace(d.Host), strconv.Itoa(d.Port))
+	}
+	return strings.TrimSpace(d.Host) + ":" + strconv.Itoa(d.Port)
+}
+
+// tagsPath is path of tags tsv-file, relative path is relative to dir of config
+func tagsPath(dir, file string) string {
+	if filepath.IsAbs(file) || dir == "" {
+		return file
+	}
+	return filepath.Join(dir, file)
+}
+
+// modbusDevice is converts DeviceConf of Modbus TCP device to clientmodbus.DeviceModbus
+func (d DeviceConf) modbusDevice(dir string) (*clientmodbus.DeviceModbus, error) {
+	if strings.TrimSpace(d.Host) == "" || d.Port == 0 {
+		return nil, fmt.Errorf("empty host or port")
+	}
+	if d.TagsFile == "" && len(d.Tags) == 0 {
+		return nil, fmt.Errorf("no tags")
+	}
+	if d.SlaveID < 0 || d.SlaveID > 255 {
+		return nil, fmt.Errorf("slave id %d: must be 0..255", d.SlaveID)
+	}
+	if d.UnitID < 1 || d.UnitID > 247 {
+		return nil, fmt.Errorf("unit id %d: must be 1..247", d.UnitID)
+	}
+
+	var err error
+	var pollInterval, timeout time.Duration
+	if d.PollInterval != "" {
+		if pollInterval, err = clientopcua.ParseInterval(d.PollInterval); err != nil {
+			return nil, fmt.Errorf("poll interval: %w", err)
+		}
+	}
+	if d.Timeout != "" {
+		if timeout, err = clientopcua.ParseInterval(d.Timeout); err != nil {
+			return nil, fmt.Errorf("timeout: %w", err)
+		}
+	}
+	retries := clientmodbus.DefaultRetries
+	if d.Retries != nil {
+		retries = *d.Retries
+	}
+
+	address := net.JoinHostPort(strings.TrimSpace(d.Host), strconv.Itoa(d.Port))
+	dvc := &clientmodbus.DeviceModbus{
+		Name: d.name(),
+		Config: clientmodbus.Config{
+			Address:      address,
+			UnitID:       modbus.UnitID(d.SlaveID),
+			PollInterval: pollInterval,
+			Timeout:      timeout,
+			Retries:      retries,
+			MaxRegisters: d.MaxRegisters,
+			MaxBits:      d.MaxBits,
+			MaxGap:       d.MaxGap,
+		},
+		MBUnitID: modbus.UnitID(d.UnitID),
+	}
+
+	if d.TagsFile != "" {
+		// tags tsv has same columns as tags of OPC UA device, node is address on device
+		tsv := clientopcua.DeviceOPCUA{FileTags: tagsPath(dir, d.TagsFile)}
+		if err := tsv.ReadTagsTSV(); err != nil {
+			return nil, err
+		}
+		for _, n := range tsv.Nodes {
+			if err := dvc.AddTag(n, tsv.Tags[n]); err != nil {
+				return nil, err
+			}
+		}
+		return dvc, nil
+	}
+
+	for _, t := range d.Tags {
+		tg, err := t.tag()
+		if err != nil {
+			return nil, fmt.Errorf("tag %q: %w", t.Node, err)
+		}
+		if err := dvc.AddTag(t.Node, tg); err != nil {
+			return nil, err
+		}
+	}
+	return dvc, nil
+}
+
+// tag is converts TagConf to clientopcua.Tag
+func (t TagConf) tag() (clientopcua.Tag, error) {
+	fn := modbus.StringToUint8(t.Function)
+	if t.Node == "" || fn == 0 {
+		return clientopcua.Tag{}, fmt.Errorf("bad node or function")
+	}
+
+	// monitoring parameters as optional tags tsv columns
+	cols := []string{t.Subscription, t.SamplingInterval, "", "", t.DeadbandType, "", t.Trigger}
+	if t.QueueSize != 0 {
+		cols[2] = strconv.FormatUint(uint64(t.QueueSize), 10)
+	}
+	if t.DiscardOldest != nil {
+		cols[3] = strconv.FormatBool(*t.DiscardOldest)
+	}
+	if t.Deadband != 0 {
+		cols[5] = strconv.FormatFloat(t.Deadband, 'g', -1, 64)
+	}
+	mon, err := clientopcua.ParseMonitoring(cols)
+	if err != nil {
+		return clientopcua.Tag{}, err
+	}
+
+	return clientopcua.Tag{
+		Alias:      strings.TrimSpace(t.Alias),
+		TypeData:   t.Type,
+		MBfunc:     fn,
+		MBaddr:     t.Address,
+		Monitoring: mon,
+		Units:      strings.TrimSpace(t.Units),
+		Write:      t.Writable,
+	}, nil
+}
+
+// tagConf is converts clientopcua.Tag to TagConf (only not default monitoring parameters)
+func tagConf(node string, tg clientopcua.Tag) TagConf {
+	t := TagConf{
+		Node:     node,
+		Alias:    tg.Alias,
+		Type:     tg.TypeData,
+		Function: modbus.FunctionName(tg.MBfunc),
+		Address:  tg.MBaddr,
+		Units:    tg.Units,
+		Writable: tg.Write,
+	}
+
+	m, def := tg.Monitoring, clientopcua.DefaultMonitoring()
+	if m.Subscription != def.Subscription {
+		t.Subscription = m.Subscription
+	}
+	if m.SamplingInterval != 0 {
+		t.SamplingInterval = m.SamplingInterval.String()
+	}
+	if m.QueueSize != def.QueueSize {
+		t.QueueSize = m.QueueSize
+	}
+	if m.DiscardOldest != def.DiscardOldest {
+		t.DiscardOldest = &m.DiscardOldest
+	}
+	switch m.DeadbandType {
+	case ua.DeadbandTypeAbsolute:
+		t.DeadbandType = "absolute"
+	case ua.DeadbandTypePercent:
+		t.DeadbandType = "percent"
+	}
+	t.Deadband = m.DeadbandValue
+	switch m.Trigger {
+	case ua.DataChangeTriggerStatus:
+		t.Trigger = "status"
+	case ua.DataChangeTriggerStatusValueTimestamp:
+		t.Trigger = "timestamp"
+	}
+	return t
+}
+
 // readConfPlcs is reads PLCs config from tsv-file
-func readConfPlcs(path string) (Plcs []clientopcua.DeviceOPCUA, err error) {
+func readConfPlcs(path string, res *secrets.Resolver) (Plcs []clientopcua.DeviceOPCUA, err error) {
+	devices, err := readDevicesTSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, d := range devices {
+		if d.isModbus() {
+			continue
+		}
+		plc, err := d.device(path, res)
+		if err != nil {
+			return nil, fmt.Errorf("plc.tsv device %d (%s:%d): %w", i, d.Host, d.Port, err)
+		}
+		Plcs = append(Plcs, plc)
+	}
+
+	return Plcs, nil
+}
+
+// readDevicesTSV is reads plc.tsv to DeviceConf (tags are not read)
+func readDevicesTSV(path string) (devices []DeviceConf, err error) {
 	file, err := os.Open(path + "/plc.tsv")
 	if err != nil {
 		return nil, err
@@ -53,6 +883,7 @@ func readConfPlcs(path string) (Plcs []clientopcua.DeviceOPCUA, err error) {
 	reader := csv.NewReader(file)
 	reader.Comma = '\t'
 	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
 
 	records, err := reader.ReadAll()
 	if err != nil {
@@ -60,41 +891,127 @@ func readConfPlcs(path string) (Plcs []clientopcua.DeviceOPCUA, err error) {
 	}
 
 	for _, r := range records {
-		if len(r) < 10 {
+		if len(r) < 11 {
 			continue
 		}
-		endpoint := "opc.tcp://" + strings.TrimSpace(r[2]) + ":" + strings.TrimSpace(r[3])
-		policy := correctPolicy(r[4])
-		mode := correctMode(r[5])
-		auth := correctAuth(r[6])
-		unitid := unitID(r[9])
-		fileTags := path + "/" + strings.TrimSpace(r[10])
-
-		plc := clientopcua.DeviceOPCUA{
-			FileTags: fileTags,
-			Status:   clientopcua.Configured,
-			Config: clientopcua.Config{
-				Endpoint: endpoint,
-				Policy:   policy,
-				Mode:     mode,
-				Auth:     auth,
-				Username: strings.TrimSpace(r[7]),
-				Password: strings.TrimSpace(r[8]),
-			},
-			MBUnitID: unitid,
+		port, _ := strconv.Atoi(strings.TrimSpace(r[3]))
+
+		if strings.EqualFold(strings.TrimSpace(r[1]), clientmodbus.Kind) {
+			// Modbus TCP device: columns 4-7 are slave id, timeout, retries, max registers per read
+			d := DeviceConf{
+				Kind:     clientmodbus.Kind,
+				Host:     strings.TrimSpace(r[2]),
+				Port:     port,
+				SlaveID:  unitID(r[4]),
+				Timeout:  strings.TrimSpace(r[5]),
+				UnitID:   unitID(r[9]),
+				TagsFile: strings.TrimSpace(r[10]),
+			}
+			if retries, err := strconv.Atoi(strings.TrimSpace(r[6])); err == nil {
+				d.Retries = &retries
+			}
+			if n, err := strconv.ParseUint(strings.TrimSpace(r[7]), 10, 16); err == nil {
+				d.MaxRegisters = uint16(n)
+			}
+			if len(r) > 17 {
+				d.PollInterval = strings.TrimSpace(r[17])
+			}
+			devices = append(devices, d)
+			continue
 		}
 
-		Plcs = append(Plcs, plc)
+		d := DeviceConf{
+			Host:     strings.TrimSpace(r[2]),
+			Port:     port,
+			Policy:   correctPolicy(r[4]),
+			Mode:     correctMode(r[5]),
+			Auth:     correctAuth(r[6]),
+			Username: strings.TrimSpace(r[7]),
+			Password: strings.TrimSpace(r[8]),
+			UnitID:   unitID(r[9]),
+			TagsFile: strings.TrimSpace(r[10]),
+		}
+		if len(r) > 11 {
+			d.KeyPassword = strings.TrimSpace(r[11])
+		}
+		if len(r) > 13 {
+			d.CertFile = strings.TrimSpace(r[12])
+			d.KeyFile = strings.TrimSpace(r[13])
+		}
+		if len(r) > 15 {
+			d.UserCertFile = strings.TrimSpace(r[14])
+			d.UserKeyFile = strings.TrimSpace(r[15])
+		}
+		if len(r) > 16 {
+			d.ReadMode = strings.TrimSpace(r[16])
+		}
+		if len(r) > 17 {
+			d.PollInterval = strings.TrimSpace(r[17])
+		}
+		if len(r) > 18 {
+			for _, e := range strings.Split(r[18], ",") {
+				if e = strings.TrimSpace(e); e != "" {
+					d.BackupEndpoints = append(d.BackupEndpoints, e)
+				}
+			}
+		}
+		devices = append(devices, d)
 	}
 
-	return Plcs, nil
+	return devices, nil
+}
+
+// convertTSV is converts plc.tsv and tags tsv-files to structured devices config
+func convertTSV(dir string) (DevicesFile, error) {
+	devices, err := readDevicesTSV(dir)
+	if err != nil {
+		return DevicesFile{}, err
+	}
+
+	for i, d := range devices {
+		plc := clientopcua.DeviceOPCUA{FileTags: tagsPath(dir, d.TagsFile)}
+		if err := plc.ReadTagsTSV(); err != nil {
+			return DevicesFile{}, err
+		}
+		for _, n := range plc.Nodes {
+			devices[i].Tags = append(devices[i].Tags, tagConf(n, plc.Tags[n]))
+		}
+		devices[i].Name = d.name()
+		devices[i].TagsFile = ""
+	}
+
+	return DevicesFile{Device: devices}, nil
+}
+
+// writeDevicesFile is writes structured devices config, format by file extension
+func writeDevicesFile(path string, df DevicesFile) error {
+	var (
+		data []byte
+		err  error
+	)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		var b strings.Builder
+		err = toml.NewEncoder(&b).Encode(df)
+		data = []byte(b.String())
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(df)
+	case ".json":
+		data, err = json.MarshalIndent(df, "", "  ")
+	default:
+		return fmt.Errorf("unknown format devices file: %s", path)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
 }
 
-// unitID is converts to type modbus.UnitID
-func unitID(u string) modbus.UnitID {
+// unitID is converts column of unit id to int, range is checked by device
+func unitID(u string) int {
 	u = strings.TrimSpace(u)
 	id, _ := strconv.Atoi(u)
-	return modbus.UnitID(id)
+	return id
 }
 
 // correctPolicy is correcting string Security Policy OPC UA
@@ -129,6 +1046,17 @@ func correctMode(m string) string {
 	}
 }
 
+// correctReadMode is correcting read mode of device: subscribe or poll
+func correctReadMode(m string) string {
+	m = strings.TrimSpace(m)
+	switch strings.ToLower(m) {
+	case "poll", "polling", "mode=poll":
+		return clientopcua.ModePoll
+	default:
+		return clientopcua.ModeSubscribe
+	}
+}
+
 // correctAuth is correcting string Authorization Mode OPC UA
 func correctAuth(a string) string {
 	a = strings.TrimSpace(a)
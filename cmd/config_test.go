@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"opcuaModbus/internal/clientmodbus"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"opcuaModbus/internal/secrets"
+	"opcuaModbus/internal/spool"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestStructuredConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	plcTSV := "#\t#\thost\tport\tpolicy\tmode\tauth\tuser\tpass\tunit\ttags\n" +
+		"1\tplc\t127.0.0.1\t4840\tnone\tnone\tanonymous\t\t\t3\ttags.tsv\n"
+	tagsTSV := "1\tt\tns=3;s=Temp\tfloat32\tinput\t10\t500ms\t100\t5\tfalse\tabsolute\t0.5\tstatus\n" +
+		"2\tt\tns=3;s=Run\tbool\tcoil\t1\t\t\t\t\t\t\t\ttrue\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plc.tsv"), []byte(plcTSV), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tags.tsv"), []byte(tagsTSV), 0644))
+
+	df, err := convertTSV(dir)
+	require.NoError(t, err)
+	require.Len(t, df.Device, 1)
+	require.Len(t, df.Device[0].Tags, 2)
+
+	for _, ext := range []string{".toml", ".yaml", ".json"} {
+		file := filepath.Join(dir, "devices"+ext)
+		require.NoError(t, writeDevicesFile(file, df))
+
+		devices, err := readDevicesFile(file)
+		require.NoError(t, err, ext)
+		require.Equal(t, df.Device, devices, ext)
+
+		plcs, err := Config{Device: devices}.plcs(&secrets.Resolver{})
+		require.NoError(t, err, ext)
+		require.Len(t, plcs, 1)
+		require.Equal(t, "opc.tcp://127.0.0.1:4840", plcs[0].Config.Endpoint)
+		require.Equal(t, clientopcua.ReadTags, plcs[0].Status)
+		require.Equal(t, []string{"ns=3;s=Temp", "ns=3;s=Run"}, plcs[0].Nodes)
+		require.Equal(t, uint16(10), plcs[0].Tags["ns=3;s=Temp"].MBaddr)
+		require.Equal(t, "t", plcs[0].Tags["ns=3;s=Temp"].Alias)
+		require.False(t, plcs[0].Tags["ns=3;s=Temp"].Write)
+		require.True(t, plcs[0].Tags["ns=3;s=Run"].Writable())
+
+		mon := plcs[0].Tags["ns=3;s=Temp"].Monitoring
+		require.Equal(t, "500ms", mon.Subscription)
+		require.Equal(t, 100*time.Millisecond, mon.SamplingInterval)
+		require.Equal(t, uint32(5), mon.QueueSize)
+		require.False(t, mon.DiscardOldest)
+		require.Equal(t, 0.5, mon.DeadbandValue)
+		require.Equal(t, clientopcua.DefaultMonitoring(), plcs[0].Tags["ns=3;s=Run"].Monitoring)
+
+		groups, err := plcs[0].SubscriptionGroups()
+		require.NoError(t, err)
+		require.Len(t, groups, 2)
+		require.Equal(t, 500*time.Millisecond, groups[0].Interval)
+		require.Equal(t, clientopcua.DefaultPublishInterval, groups[1].Interval)
+	}
+
+	plcs, err := readConfPlcs(dir, &secrets.Resolver{})
+	require.NoError(t, err)
+	require.Len(t, plcs, 1)
+	require.Equal(t, clientopcua.Configured, plcs[0].Status)
+	require.Equal(t, dir+"/tags.tsv", plcs[0].FileTags)
+}
+
+func TestBackupEndpoints(t *testing.T) {
+	d := DeviceConf{
+		Host:            "10.0.0.1",
+		Port:            4840,
+		UnitID:          1,
+		BackupEndpoints: []string{"10.0.0.2:4840", "opc.tcp://plc-b:4841"},
+		FailoverTimeout: "5s",
+		Tags:            []TagConf{{Node: "ns=3;s=Temp", Type: "float32", Function: "input", Address: 1}},
+	}
+	plc, err := d.device("", &secrets.Resolver{})
+	require.NoError(t, err)
+	require.True(t, plc.Redundant())
+	require.Equal(t, []string{"opc.tcp://10.0.0.1:4840", "opc.tcp://10.0.0.2:4840", "opc.tcp://plc-b:4841"}, plc.Config.Endpoints)
+	require.Equal(t, 5*time.Second, plc.FailoverTimeout())
+
+	require.Equal(t, "opc.tcp://10.0.0.2:4840", plc.NextEndpoint())
+	require.Equal(t, "opc.tcp://plc-b:4841", plc.NextEndpoint())
+	require.Equal(t, "opc.tcp://10.0.0.1:4840", plc.NextEndpoint())
+	require.Equal(t, clientopcua.ReadTags, plc.Status)
+	require.Equal(t, 3, plc.Failovers)
+}
+
+func TestEventsConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "devices.toml")
+	conf := `
+[[device]]
+host = "127.0.0.1"
+port = 4840
+unit_id = 1
+tags_file = "tags.tsv"
+
+[device.events]
+interval = "500ms"
+where = "Severity >= 500 and SourceName = 'Boiler1' and OfType i=2915"
+
+[[device.events.alarm]]
+condition = "HighTemp"
+source = "Boiler1"
+active_coil = 100
+acked_discrete = 100
+severity_register = 100
+ack_coil = 200
+`
+	require.NoError(t, os.WriteFile(file, []byte(conf), 0644))
+
+	devices, err := readDevicesFile(file)
+	require.NoError(t, err)
+	plcs, err := Config{Device: devices}.plcs(&secrets.Resolver{})
+	require.NoError(t, err)
+	require.Len(t, plcs, 1)
+
+	ev := plcs[0].Events
+	require.NotNil(t, ev)
+	require.Equal(t, 500*time.Millisecond, ev.EventInterval())
+	require.True(t, ev.Acknowledgeable())
+	require.Equal(t, 0, ev.AckAlarm(200))
+	require.Equal(t, -1, ev.AckAlarm(100))
+
+	filter, err := ev.EventFilter()
+	require.NoError(t, err)
+	require.Len(t, filter.WhereClause.Elements, 5)
+
+	active := true
+	require.Equal(t, 0, ev.Match(clientopcua.Event{ConditionName: "HighTemp", SourceName: "Boiler1", Active: &active}))
+	require.Equal(t, -1, ev.Match(clientopcua.Event{ConditionName: "LowTemp", SourceName: "Boiler1"}))
+
+	_, err = clientopcua.ParseWhere("Severity ~ 5")
+	require.Error(t, err)
+}
+
+func TestClockConfig(t *testing.T) {
+	addr := uint16(500)
+	d := DeviceConf{
+		Host:          "10.0.0.1",
+		Port:          4840,
+		UnitID:        1,
+		ClockRegister: &addr,
+		ClockInterval: "1m",
+		Tags:          []TagConf{{Node: "ns=3;s=Temp", Type: "float32", Function: "input", Address: 1}},
+	}
+	plc, err := d.device("", &secrets.Resolver{})
+	require.NoError(t, err)
+	require.Equal(t, uint16(500), *plc.Config.ClockRegister)
+	require.Equal(t, time.Minute, plc.ClockInterval())
+
+	c := clientopcua.ClockSnapshot{ServerTime: time.Unix(0x12345678, 0), Drift: -1500 * time.Millisecond}
+	require.Equal(t, []uint16{0x1234, 0x5678, 0xffff, 0xfa24}, c.Registers())
+}
+
+func TestModbusDevices(t *testing.T) {
+	dir := t.TempDir()
+	plcTSV := "#\t#\thost\tport\tpolicy\tmode\tauth\tuser\tpass\tunit\ttags\n" +
+		"1\tplc\t127.0.0.1\t4840\tnone\tnone\tanonymous\t\t\t3\ttags.tsv\n" +
+		"2\tmodbus\t10.0.0.5\t502\t17\t500ms\t3\t60\t\t4\tmb.tsv\t\t\t\t\t\t\t2s\n"
+	tagsTSV := "1\tt\tns=3;s=Temp\tfloat32\tinput\t10\n"
+	mbTSV := "1\ttemp\tholding:100\tfloat32\tinput\t10\n" +
+		"2\trun\tcoil:5\tbool\tdiscrete\t1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plc.tsv"), []byte(plcTSV), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tags.tsv"), []byte(tagsTSV), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mb.tsv"), []byte(mbTSV), 0644))
+
+	conf := Config{Devices: DevicesConf{Directory: dir}}
+	plcs, err := conf.plcs(&secrets.Resolver{})
+	require.NoError(t, err)
+	require.Len(t, plcs, 1)
+
+	sources, err := conf.sources()
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	src := sources[0]
+	require.Equal(t, "10.0.0.5:502", src.Name)
+	require.Equal(t, clientmodbus.Config{
+		Address:      "10.0.0.5:502",
+		UnitID:       17,
+		PollInterval: 2 * time.Second,
+		Timeout:      500 * time.Millisecond,
+		Retries:      3,
+		MaxRegisters: 60,
+	}, src.Config)
+	require.Equal(t, modbus.UnitID(4), src.MBUnitID)
+	require.Equal(t, []string{"holding:100", "coil:5"}, src.Nodes)
+	require.Equal(t, "temp", src.Tags["holding:100"].Alias)
+
+	// structured config
+	_, err = DeviceConf{Kind: "modbus", Host: "10.0.0.5", Port: 502, Tags: []TagConf{{Node: "100", Type: "int16", Function: "input", Address: 1}}}.modbusDevice("")
+	require.Error(t, err)
+	conf = Config{Device: []DeviceConf{{
+		Name: "meter", Kind: "modbus", Host: "10.0.0.6", Port: 502, UnitID: 5,
+		Tags: []TagConf{{Node: "input:0", Type: "uint32", Function: "input", Address: 1}},
+	}}}
+	sources, err = conf.sources()
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	require.Equal(t, clientmodbus.DefaultRetries, sources[0].Config.Retries)
+	plcs, err = conf.plcs(&secrets.Resolver{})
+	require.NoError(t, err)
+	require.Empty(t, plcs)
+
+	// unit id out of range, invalid device of plc.tsv is not skipped
+	_, err = DeviceConf{Kind: "modbus", Host: "10.0.0.6", Port: 502, UnitID: 300, Tags: []TagConf{{Node: "input:0", Type: "uint32", Function: "input", Address: 1}}}.modbusDevice("")
+	require.Error(t, err)
+	_, err = DeviceConf{Host: "10.0.0.1", Port: 4840, UnitID: 248, Tags: []TagConf{{Node: "ns=3;s=Temp", Type: "float32", Function: "input", Address: 1}}}.device("", &secrets.Resolver{})
+	require.Error(t, err)
+	plcTSV = "1\tplc\t127.0.0.1\t4840\tnone\tnone\tanonymous\t\t\t3\ttags.tsv\n" +
+		"2\tplc\t127.0.0.2\t4840\tnone\tnone\tanonymous\t\t\t0\ttags.tsv\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plc.tsv"), []byte(plcTSV), 0644))
+	_, err = Config{Devices: DevicesConf{Directory: dir}}.plcs(&secrets.Resolver{})
+	require.ErrorContains(t, err, "127.0.0.2:4840")
+}
+
+func TestRouteConfig(t *testing.T) {
+	target := 0
+	r, err := RouteConf{Unit: 20, Address: "10.0.0.7:502", Protocol: "RTU", TargetUnit: &target, Timeout: "250ms", MaxConcurrent: 3, IdleTimeout: "10s"}.route()
+	require.NoError(t, err)
+	require.Equal(t, modbus.Route{Unit: 20, Address: "10.0.0.7:502", Protocol: modbus.ProtocolRTU, Timeout: 250 * time.Millisecond, MaxConcurrent: 3, IdleTimeout: 10 * time.Second}, r)
+
+	r, err = RouteConf{Unit: 21, Address: "10.0.0.8:502"}.route()
+	require.NoError(t, err)
+	require.Equal(t, modbus.ProtocolTCP, r.Protocol)
+	require.Equal(t, modbus.UnitID(21), r.TargetUnit)
+
+	for _, rc := range []RouteConf{
+		{Unit: 0, Address: "10.0.0.8:502"},
+		{Unit: 21, Address: "10.0.0.8"},
+		{Unit: 21, Address: "10.0.0.8:502", Protocol: "udp"},
+		{Unit: 21, Address: "10.0.0.8:502", Timeout: "soon"},
+		{Unit: 21, Address: "10.0.0.8:502", IdleTimeout: "later"},
+	} {
+		_, err = rc.route()
+		require.Error(t, err, rc)
+	}
+}
+
+func TestMQTTSpoolConfig(t *testing.T) {
+	conf, err := MQTTConf{Broker: "tcp://localhost:1883"}.config(&secrets.Resolver{})
+	require.NoError(t, err)
+	require.Equal(t, spool.DropOldest, conf.Overflow)
+	require.Empty(t, conf.Spool.Dir)
+
+	conf, err = MQTTConf{Broker: "tcp://localhost:1883", Overflow: "drop_newest", Spool: SpoolConf{Dir: " /var/lib/gw ", SegmentSize: 1 << 20, MaxSize: 64 << 20, Sync: "always", SyncInterval: "500"}}.config(&secrets.Resolver{})
+	require.NoError(t, err)
+	require.Equal(t, spool.Config{Dir: "/var/lib/gw", SegmentSize: 1 << 20, MaxSize: 64 << 20, Sync: spool.SyncAlways, SyncInterval: 500 * time.Millisecond, Overflow: spool.DropNewest}, conf.Spool)
+	require.Equal(t, spool.DropNewest, conf.Overflow)
+
+	for _, mc := range []MQTTConf{
+		{Overflow: "drop_all"},
+		{Spool: SpoolConf{Dir: "/var/lib/gw", Sync: "sometimes"}},
+		{Spool: SpoolConf{Dir: "/var/lib/gw", SegmentSize: 1 << 20, MaxSize: 1 << 20}},
+		{Spool: SpoolConf{Dir: "/var/lib/gw", SyncInterval: "soon"}},
+	} {
+		_, err = mc.config(&secrets.Resolver{})
+		require.Error(t, err, mc)
+	}
+}
+
+func TestConvertTSV(t *testing.T) {
+	dir, tags := t.TempDir(), t.TempDir()
+	tagsTSV := "1\tt\t10\tint16\tholding\t10\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tags, "tags.tsv"), []byte(tagsTSV), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "local.tsv"), []byte(tagsTSV), 0644))
+	// tags file of OPC UA device is absolute, of Modbus TCP device - relative to dir of plc.tsv
+	plcTSV := "1\tplc\t127.0.0.1\t4840\tnone\tnone\tanonymous\t\t\t3\t" + filepath.Join(tags, "tags.tsv") + "\n" +
+		"2\tmodbus\t::1\t502\t1\t1s\t3\t100\t\t4\tlocal.tsv\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plc.tsv"), []byte(plcTSV), 0644))
+
+	df, err := convertTSV(dir)
+	require.NoError(t, err)
+	require.Len(t, df.Device, 2)
+	require.Equal(t, "127.0.0.1:4840", df.Device[0].Name)
+	require.Equal(t, "[::1]:502", df.Device[1].Name)
+	for _, d := range df.Device {
+		require.Len(t, d.Tags, 1)
+		require.Empty(t, d.TagsFile)
+	}
+
+	require.Equal(t, "plc1", DeviceConf{Name: "plc1", Host: "127.0.0.1", Port: 4840}.name())
+	require.Equal(t, filepath.Join(dir, "tags.tsv"), tagsPath(dir, "tags.tsv"))
+	require.Equal(t, "/etc/tags.tsv", tagsPath(dir, "/etc/tags.tsv"))
+}
+
+func TestDevicesSchema(t *testing.T) {
+	schema, err := jsonschema.Compile(filepath.Join("..", "configs", "devices.schema.json"))
+	require.NoError(t, err)
+
+	examples, err := filepath.Glob(filepath.Join("..", "configs", "devices.example.*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, examples)
+	for _, file := range examples {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err, file)
+		var doc interface{}
+		require.NoError(t, yaml.Unmarshal(data, &doc), file)
+		// schema validates values decoded from JSON
+		js, err := json.Marshal(doc)
+		require.NoError(t, err, file)
+		dec := json.NewDecoder(bytes.NewReader(js))
+		dec.UseNumber()
+		var v interface{}
+		require.NoError(t, dec.Decode(&v), file)
+		require.NoError(t, schema.Validate(v), file)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// convertCmd is subcommand converting plc.tsv & tags tsv-files to structured config
+//
+//	opcuaModbus convert -dir ./confPLC -out devices.yaml
+func convertCmd(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	dir := fs.String("dir", "./confPLC", "directory with plc.tsv and tags tsv-files")
+	out := fs.String("out", "devices.toml", "output file (.toml, .yaml, .json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	df, err := convertTSV(*dir)
+	if err != nil {
+		return err
+	}
+	if err := writeDevicesFile(*out, df); err != nil {
+		return err
+	}
+
+	fmt.Printf("converted %d devices to %s\n", len(df.Device), *out)
+	return nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/logger"
+	"opcuaModbus/internal/modbus"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// dashboardInterval is interval of updates of dashboard
+const dashboardInterval = time.Second
+
+//go:embed web/dashboard.html
+var dashboardHTML []byte
+
+// recentLog is hook of logger keeping recent warnings & errors for dashboard
+type recentLog struct {
+	mu      sync.Mutex
+	size    int
+	entries []logEntry
+}
+
+// logEntry is warning or error of logger
+type logEntry struct {
+	Time    time.Time
+	Level   string
+	Message string
+}
+
+func newRecentLog(size int) *recentLog {
+	return &recentLog{size: size}
+}
+
+// Levels is levels of entries kept by hook
+func (l *recentLog) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel}
+}
+
+// Fire is keeping entry, oldest entries are dropped
+func (l *recentLog) Fire(e *logrus.Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	msg := e.Message
+	if e.Logger != nil {
+		msg = logger.Redacted(e.Logger, msg)
+	}
+	l.entries = append(l.entries, logEntry{Time: e.Time, Level: e.Level.String(), Message: msg})
+	if len(l.entries) > l.size {
+		l.entries = l.entries[len(l.entries)-l.size:]
+	}
+	return nil
+}
+
+// Match is returns recent entries containing any of keys, newest first
+func (l *recentLog) Match(keys ...string) []logEntry {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var res []logEntry
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		for _, k := range keys {
+			if k != "" && strings.Contains(l.entries[i].Message, k) {
+				res = append(res, l.entries[i])
+				break
+			}
+		}
+	}
+	return res
+}
+
+// dashboard is state of devices & register maps of units
+type dashboard struct {
+	Time    time.Time
+	States  []string
+	Devices []dashDevice
+	Units   []dashUnit
+}
+
+type dashDevice struct {
+	Name      string
+	Status    string
+	Endpoint  string
+	Error     string
+	UnitID    modbus.UnitID
+	Ready     bool
+	Failovers int
+	Errors    []logEntry
+}
+
+type dashUnit struct {
+	UnitID  modbus.UnitID
+	Ready   bool
+	Entries []dashEntry
+}
+
+// dashEntry is coil or registers of tag (or unmapped address, Node is empty)
+type dashEntry struct {
+	Table     string
+	Address   uint16
+	Registers []uint16
+	Device    string      `json:",omitempty"`
+	Node      string      `json:",omitempty"`
+	Type      string      `json:",omitempty"`
+	Value     interface{} `json:",omitempty"`
+	Quality   string      `json:",omitempty"`
+	Status    string      `json:",omitempty"`
+	Updated   *time.Time  `json:",omitempty"`
+}
+
+// tables is names of ModBus tables by read function
+var tables = map[uint8]string{
+	modbus.ReadCoils:            "coil",
+	modbus.ReadDiscreteInputs:   "discrete",
+	modbus.ReadHoldingRegisters: "holding",
+	modbus.ReadInputRegisters:   "input",
+}
+
+// dashboardPage is page of dashboard
+func (a *httpAPI) dashboardPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(dashboardHTML)
+}
+
+// dashboardEvents is stream of dashboard state (Server-Sent Events)
+func (a *httpAPI) dashboardEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ticker := time.NewTicker(dashboardInterval)
+	defer ticker.Stop()
+	for {
+		data, err := json.Marshal(a.dashboard())
+		if err != nil {
+			a.logg.Error("dashboard error: ", err)
+			return
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dashboard is building state of devices & units
+func (a *httpAPI) dashboard() dashboard {
+	db := dashboard{Time: time.Now()}
+	for s := clientopcua.Configured; s <= clientopcua.Polling; s++ {
+		db.States = append(db.States, s.String())
+	}
+
+	byUnit := map[modbus.UnitID][]*clientopcua.DeviceOPCUA{}
+	for i := range a.PLCs {
+		dvc := &a.PLCs[i]
+		byUnit[dvc.MBUnitID] = append(byUnit[dvc.MBUnitID], dvc)
+		st := dvc.State()
+		db.Devices = append(db.Devices, dashDevice{
+			Name:      dvc.Name,
+			Status:    st.Status.String(),
+			Endpoint:  st.Endpoint,
+			Error:     st.Error,
+			UnitID:    dvc.MBUnitID,
+			Ready:     a.MBServer.Ready(dvc.MBUnitID),
+			Failovers: st.Failovers,
+			Errors:    a.recent.Match(st.Endpoint, dvc.Name),
+		})
+	}
+
+	for _, u := range a.MBServer.Units() {
+		data, ok := a.MBServer.Snapshot(u.UnitID)
+		if !ok {
+			continue
+		}
+		db.Units = append(db.Units, dashUnit{UnitID: u.UnitID, Ready: u.Ready, Entries: unitEntries(data, byUnit[u.UnitID])})
+	}
+	return db
+}
+
+// unitEntries is entries of tags of devices mapped to unit and of unmapped addresses
+func unitEntries(data modbus.UnitData, devices []*clientopcua.DeviceOPCUA) []dashEntry {
+	bits := map[string]map[uint16]bool{"coil": data.Coils, "discrete": data.DiscreteInputs}
+	regs := map[string]map[uint16]uint16{"holding": data.HoldingRegisters, "input": data.InputRegisters}
+	used := map[string]map[uint16]bool{"coil": {}, "discrete": {}, "holding": {}, "input": {}}
+
+	var entries []dashEntry
+	for _, dvc := range devices {
+		results := dvc.Results.Snapshot()
+		for _, node := range dvc.Nodes {
+			tg := dvc.Tags[node]
+			table, ok := tables[tg.MBfunc]
+			if !ok {
+				continue
+			}
+			e := dashEntry{Table: table, Address: tg.MBaddr, Device: dvc.Name, Node: node, Type: tg.TypeData, Quality: "bad", Status: "no data"}
+
+			n := 1
+			if _, bit := bits[table]; !bit {
+				if n = clientopcua.RegisterCount(tg.TypeData); n == 0 {
+					n = 1
+				}
+			}
+			for i := 0; i < n; i++ {
+				addr := tg.MBaddr + uint16(i)
+				used[table][addr] = true
+				if b, bit := bits[table]; bit {
+					e.Registers = append(e.Registers, uint16(boolValue(b[addr])))
+				} else {
+					e.Registers = append(e.Registers, regs[table][addr])
+				}
+			}
+
+			if res, ok := results[node]; ok {
+				e.Value = clientopcua.JSONValue(res.Value)
+				e.Quality = clientopcua.Quality(res.Status)
+				e.Status = clientopcua.StatusName(res.Status)
+				e.Updated = &res.Updated
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	for table, m := range bits {
+		for addr, v := range m {
+			if !used[table][addr] {
+				entries = append(entries, dashEntry{Table: table, Address: addr, Registers: []uint16{uint16(boolValue(v))}})
+			}
+		}
+	}
+	for table, m := range regs {
+		for addr, v := range m {
+			if !used[table][addr] {
+				entries = append(entries, dashEntry{Table: table, Address: addr, Registers: []uint16{v}})
+			}
+		}
+	}
+
+	order := map[string]int{"coil": 0, "discrete": 1, "holding": 2, "input": 3}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Table != b.Table {
+			return order[a.Table] < order[b.Table]
+		}
+		return a.Address < b.Address
+	})
+	return entries
+}
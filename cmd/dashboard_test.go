@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/logger"
+	"opcuaModbus/internal/modbus"
+	"strings"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboard(t *testing.T) {
+	logg := logrus.New()
+	recent := newRecentLog(3)
+	logg.AddHook(recent)
+	logger.Redact(logg, "secret")
+	logg.Error("opc.tcp://10.0.0.1:4840 failed connect: password secret")
+	logg.Info("opc.tcp://10.0.0.1:4840 status: Connected")
+	logg.Warn("opc.tcp://10.0.0.2:4840 failed connect")
+	logg.Warn("opc.tcp://10.0.0.1:4840 tag mismatch")
+	require.Len(t, recent.Match("opc.tcp://10.0.0.1:4840"), 2)
+	require.Equal(t, "opc.tcp://10.0.0.1:4840 tag mismatch", recent.Match("opc.tcp://10.0.0.1:4840")[0].Message)
+	require.Empty(t, recent.Match("secret"))
+	require.Len(t, recent.Match("******"), 1)
+
+	mb := modbus.NewServer(logg, "", 0)
+	mb.AddDevice(5)
+	mb.WriteInputRegisters(5, 1, 0x41ac)
+	mb.WriteInputRegisters(5, 2, 0x0000)
+	mb.WriteInputRegisters(5, 10, 7)
+	mb.WriteCoils(5, 3, true)
+
+	plc := clientopcua.DeviceOPCUA{
+		Name:     "plc1",
+		Status:   clientopcua.Subscribed,
+		Config:   clientopcua.Config{Endpoint: "opc.tcp://10.0.0.1:4840"},
+		MBUnitID: 5,
+		Results:  clientopcua.NewResults(),
+	}
+	plc.AddTag("ns=3;s=Temp", clientopcua.Tag{TypeData: "float32", MBfunc: modbus.ReadInputRegisters, MBaddr: 1})
+	plc.AddTag("ns=3;s=Run", clientopcua.Tag{TypeData: "bool", MBfunc: modbus.ReadCoils, MBaddr: 3})
+	plc.Results.Set("ns=3;s=Temp", &ua.DataValue{Value: ua.MustVariant(float32(21.5)), Status: ua.StatusOK})
+
+	api := &httpAPI{MBServer: mb, PLCs: []clientopcua.DeviceOPCUA{plc}, logg: logg, recent: recent}
+	db := api.dashboard()
+	require.Len(t, db.Devices, 1)
+	require.Equal(t, "Subscribed", db.Devices[0].Status)
+	require.Len(t, db.Devices[0].Errors, 2)
+	require.Len(t, db.Units, 1)
+
+	entries := db.Units[0].Entries
+	require.Len(t, entries, 3)
+	require.Equal(t, dashEntry{Table: "coil", Address: 3, Registers: []uint16{1}, Device: "plc1", Node: "ns=3;s=Run", Type: "bool", Quality: "bad", Status: "no data"}, entries[0])
+	require.Equal(t, "ns=3;s=Temp", entries[1].Node)
+	require.Equal(t, []uint16{0x41ac, 0}, entries[1].Registers)
+	require.Equal(t, float32(21.5), entries[1].Value)
+	require.Equal(t, "good", entries[1].Quality)
+	require.Equal(t, dashEntry{Table: "input", Address: 10, Registers: []uint16{7}}, entries[2])
+
+	srv := httptest.NewServer(api.routes())
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/dashboard/events", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "data: "))
+	var ev dashboard
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev))
+	require.Len(t, ev.Units, 1)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+	"github.com/sirupsen/logrus"
+)
+
+// eventHandle is client handle of event monitored item
+const eventHandle = 1
+
+// startEvents is subscribing to Alarms & Conditions events of device,
+// alarms are written to coils (active), discrete inputs (acknowledged) and input registers (severity)
+func startEvents(ctx context.Context, logg *logrus.Logger, srvc *serv) {
+	dvc := srvc.OPCUAClients
+	ev := dvc.Events
+
+	req, err := ev.MonitorRequest(eventHandle)
+	if err != nil {
+		logg.Error(dvc.Config.Endpoint, " events error: ", err)
+		return
+	}
+
+	notifyCh := make(chan *opcua.PublishNotificationData, 100)
+	sub, err := dvc.Client.SubscribeWithContext(ctx, &opcua.SubscriptionParameters{Interval: ev.EventInterval()}, notifyCh)
+	if err != nil {
+		logg.Error(dvc.Config.Endpoint, " events subscription error: ", err)
+		return
+	}
+	defer func() { _ = sub.Cancel(context.Background()) }()
+
+	res, err := sub.MonitorWithContext(ctx, ua.TimestampsToReturnBoth, req)
+	if err == nil && len(res.Results) == 1 && res.Results[0].StatusCode != ua.StatusOK {
+		err = res.Results[0].StatusCode
+	}
+	if err != nil {
+		logg.Error(dvc.Config.Endpoint, " events monitored item error: ", err)
+		return
+	}
+	if err := dvc.ConditionRefresh(ctx, sub.SubscriptionID); err != nil {
+		logg.Debug(dvc.Config.Endpoint, " condition refresh error: ", err)
+	}
+	logg.Debug(dvc.Config.Endpoint, " events subscribed, alarms: ", len(ev.Alarms))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-notifyCh:
+			if msg.Error != nil {
+				logg.Debug(dvc.Config.Endpoint, " events error: ", msg.Error)
+				continue
+			}
+			list, ok := msg.Value.(*ua.EventNotificationList)
+			if !ok {
+				continue
+			}
+			for _, f := range list.Events {
+				if f.ClientHandle != eventHandle {
+					continue
+				}
+				srvc.writeAlarm(clientopcua.ParseEvent(f.EventFields))
+			}
+		}
+	}
+}
+
+// writeAlarm is writing state of alarm of event to ModBus registers
+func (srv *serv) writeAlarm(e clientopcua.Event) {
+	dvc := srv.OPCUAClients
+	i := dvc.Events.Match(e)
+	if i < 0 {
+		return
+	}
+	dvc.Events.Remember(i, e)
+
+	a := dvc.Events.Alarms[i]
+	if a.ActiveCoil != nil && e.Active != nil {
+		srv.MBServer.WriteCoils(dvc.MBUnitID, *a.ActiveCoil, *e.Active)
+	}
+	if a.AckedDiscrete != nil && e.Acked != nil {
+		srv.MBServer.WriteDiscreteInputs(dvc.MBUnitID, *a.AckedDiscrete, *e.Acked)
+	}
+	if a.SeverityRegister != nil {
+		srv.MBServer.WriteInputRegisters(dvc.MBUnitID, *a.SeverityRegister, e.Severity)
+	}
+}
+
+// ackHandler is handler of writes to acknowledge coils of alarms:
+// 1 calls Acknowledge of condition, coil is reset after call
+func ackHandler(logg *logrus.Logger, mb *modbus.MBServer, dvc *clientopcua.DeviceOPCUA) modbus.WriteHandler {
+	return func(function uint8, address uint16, values []uint16) modbus.Exception {
+		if function != modbus.WriteSingleCoil && function != modbus.WriteMultipleCoils {
+			return modbus.IllegalDataAddress
+		}
+		alarms := make([]int, len(values))
+		for i := range values {
+			if alarms[i] = dvc.Events.AckAlarm(address + uint16(i)); alarms[i] < 0 {
+				return modbus.IllegalDataAddress
+			}
+		}
+
+		for i, v := range values {
+			if v == 0 {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := dvc.Acknowledge(ctx, alarms[i], "acknowledged by ModBus master")
+			cancel()
+			if err != nil {
+				logg.Error(dvc.State().Endpoint, " acknowledge alarm ", alarms[i], " error: ", err)
+				return modbus.SlaveDeviceFailure
+			}
+			logg.Info(dvc.State().Endpoint, " alarm ", alarms[i], " acknowledged by ModBus master")
+		}
+		for i := range values {
+			mb.WriteCoils(dvc.MBUnitID, address+uint16(i), false)
+		}
+		return modbus.Success
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"opcuaModbus/internal/clientmodbus"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"opcuaModbus/internal/mqtt"
+	"opcuaModbus/internal/serveropcua"
+	"opcuaModbus/internal/sparkplug"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// httpAPI is HTTP status & health API of gateway
+type httpAPI struct {
+	MBServer  *modbus.MBServer
+	PLCs      []clientopcua.DeviceOPCUA
+	logg      *logrus.Logger
+	recent    *recentLog                 // recent warnings & errors for dashboard (nil - not kept)
+	tokens    []string                   // tokens of REST API of tags (empty - API disabled)
+	MQTT      map[string]*mqtt.Publisher // MQTT publishers by device
+	Sparkplug *sparkplug.EdgeNode        // nil - Sparkplug disabled
+	Sources   []*clientmodbus.DeviceModbus
+	// OPCUAServer is OPC UA server of units, nil - disabled
+	OPCUAServer *serveropcua.Server
+}
+
+// deviceStatus is state of OPCUA device for /devices
+type deviceStatus struct {
+	Name          string
+	Status        string
+	Endpoint      string
+	Error         string
+	UnitID        modbus.UnitID
+	Ready         bool
+	Failovers     int
+	Subscribed    int
+	Subscriptions []subscriptionStatus         `json:",omitempty"`
+	Poll          *clientopcua.PollStats       `json:",omitempty"`
+	Limits        *clientopcua.OperationLimits `json:",omitempty"`
+	Clock         *clientopcua.ClockSnapshot   `json:",omitempty"`
+	BadNodes      map[string]string            `json:",omitempty"`
+	TagIssues     map[string]string            `json:",omitempty"`
+	ResolveErrors map[string]string            `json:",omitempty"`
+	Nodes         []nodeStatus
+	Config        clientopcua.Config
+}
+
+// subscriptionStatus is counters of subscription
+type subscriptionStatus struct {
+	ID        uint32
+	Items     int
+	Delivered uint64
+	Dropped   uint64
+}
+
+// nodeStatus is last result of tag
+type nodeStatus struct {
+	Node       string
+	Type       string
+	Function   uint8
+	Address    uint16
+	Value      interface{} `json:",omitempty"`
+	Quality    string
+	Status     string
+	SourceTime *time.Time `json:",omitempty"`
+	Updated    *time.Time `json:",omitempty"`
+}
+
+// unitsStatus is state of ModBus server for /modbus/units
+type unitsStatus struct {
+	Units   []modbus.UnitStatus
+	Clients []modbus.ClientStatus
+}
+
+// startHTTP is starting HTTP server of status API, server is stopped on cancel of ctx
+func startHTTP(ctx context.Context, logg *logrus.Logger, conf HTTPConf, api *httpAPI) {
+	addr := net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port))
+	srv := &http.Server{Addr: addr, Handler: api.routes(), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutCtx)
+	}()
+
+	logg.Info("http server listen: ", addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logg.Error("http server error: ", err)
+	}
+}
+
+// routes is handlers of status API, metrics, dashboard & REST API
+func (a *httpAPI) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", a.healthz)
+	mux.HandleFunc("/readyz", a.readyz)
+	mux.HandleFunc("/devices", a.devices)
+	mux.HandleFunc("/modbus/units", a.units)
+	mux.HandleFunc("/metrics", a.metrics)
+	mux.HandleFunc("/dashboard", a.dashboardPage)
+	mux.HandleFunc("/dashboard/events", a.dashboardEvents)
+	a.apiRoutes(mux)
+	return mux
+}
+
+// healthz is liveness: process is serving requests
+func (a *httpAPI) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz is readiness: all units of devices are populated with data
+func (a *httpAPI) readyz(w http.ResponseWriter, r *http.Request) {
+	var notReady []string
+	for i := range a.PLCs {
+		if !a.MBServer.Ready(a.PLCs[i].MBUnitID) {
+			notReady = append(notReady, a.PLCs[i].Name)
+		}
+	}
+	if len(notReady) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "not ready", "devices": notReady})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// devices is state, diagnostics and last node results of devices
+func (a *httpAPI) devices(w http.ResponseWriter, r *http.Request) {
+	list := make([]deviceStatus, 0, len(a.PLCs))
+	for i := range a.PLCs {
+		list = append(list, a.deviceStatus(&a.PLCs[i]))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// units is units of ModBus server and connected masters
+func (a *httpAPI) units(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, unitsStatus{Units: a.MBServer.Units(), Clients: a.MBServer.Clients()})
+}
+
+func (a *httpAPI) deviceStatus(dvc *clientopcua.DeviceOPCUA) deviceStatus {
+	st := dvc.State()
+	ds := deviceStatus{
+		Name:      dvc.Name,
+		Status:    st.Status.String(),
+		Endpoint:  st.Endpoint,
+		Error:     st.Error,
+		UnitID:    dvc.MBUnitID,
+		Ready:     a.MBServer.Ready(dvc.MBUnitID),
+		Failovers: st.Failovers,
+		Config:    dvc.ConfigSnapshot(),
+	}
+	if lim, ok := dvc.LimitsSnapshot(); ok {
+		ds.Limits = &lim
+	}
+
+	for _, sub := range dvc.SubscriptionsSnapshot() {
+		ds.Subscriptions = append(ds.Subscriptions, subscriptionStatus{
+			ID:        sub.SubscriptionID(),
+			Items:     sub.Subscribed(),
+			Delivered: sub.Delivered(),
+			Dropped:   sub.Dropped(),
+		})
+		ds.Subscribed += sub.Subscribed()
+	}
+	if ps, ok := dvc.PollSnapshot(); ok {
+		ds.Poll = &ps
+	}
+	if c, ok := dvc.ClockSnapshot(); ok {
+		ds.Clock = &c
+	}
+	if bad := dvc.BadNodesSnapshot(); len(bad) > 0 {
+		ds.BadNodes = map[string]string{}
+		for n, sc := range bad {
+			ds.BadNodes[n] = clientopcua.StatusName(sc)
+		}
+	}
+	if issues := dvc.TagIssuesSnapshot(); len(issues) > 0 {
+		ds.TagIssues = issues
+	}
+	if errs := dvc.ResolveErrorsSnapshot(); len(errs) > 0 {
+		ds.ResolveErrors = map[string]string{}
+		for n, err := range errs {
+			ds.ResolveErrors[n] = err.Error()
+		}
+	}
+
+	results := dvc.Results.Snapshot()
+	ds.Nodes = make([]nodeStatus, 0, len(dvc.Nodes))
+	for _, n := range dvc.Nodes {
+		tg := dvc.Tags[n]
+		ns := nodeStatus{Node: n, Type: tg.TypeData, Function: tg.MBfunc, Address: tg.MBaddr, Quality: "bad", Status: "no data"}
+		if res, ok := results[n]; ok {
+			ns.Value = clientopcua.JSONValue(res.Value)
+			ns.Quality = clientopcua.Quality(res.Status)
+			ns.Status = clientopcua.StatusName(res.Status)
+			if !res.SourceTime.IsZero() {
+				ns.SourceTime = &res.SourceTime
+			}
+			ns.Updated = &res.Updated
+		}
+		ds.Nodes = append(ds.Nodes, ns)
+	}
+	sort.Slice(ds.Nodes, func(i, j int) bool { return ds.Nodes[i].Node < ds.Nodes[j].Node })
+	return ds
+}
+
+// writeJSON is writing response in JSON
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
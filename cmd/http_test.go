@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	logg := logrus.New()
+	mb := modbus.NewServer(logg, "", 0)
+	mb.AddDevice(5)
+
+	plc := clientopcua.DeviceOPCUA{
+		Name:     "plc1",
+		Status:   clientopcua.Connected,
+		Config:   clientopcua.Config{Endpoint: "opc.tcp://10.0.0.1:4840", Password: "pass"},
+		MBUnitID: 5,
+		Results:  clientopcua.NewResults(),
+	}
+	plc.AddTag("ns=3;s=Temp", clientopcua.Tag{TypeData: "float32", MBfunc: modbus.ReadInputRegisters, MBaddr: 1})
+	plc.AddTag("ns=3;s=Bad", clientopcua.Tag{TypeData: "int16", MBfunc: modbus.ReadInputRegisters, MBaddr: 3})
+	plc.Results.Set("ns=3;s=Temp", &ua.DataValue{Value: ua.MustVariant(float32(21.5)), Status: ua.StatusOK})
+	plc.Results.Set("ns=3;s=Bad", &ua.DataValue{Status: ua.StatusBadNodeIDUnknown})
+
+	srv := httptest.NewServer((&httpAPI{MBServer: mb, PLCs: []clientopcua.DeviceOPCUA{plc}, logg: logg}).routes())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	mb.SetReady(5, true)
+	resp, err = http.Get(srv.URL + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/devices")
+	require.NoError(t, err)
+	var devices []map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&devices))
+	resp.Body.Close()
+	require.Len(t, devices, 1)
+	require.Equal(t, "Connected", devices[0]["Status"])
+	require.Equal(t, true, devices[0]["Ready"])
+	require.NotEqual(t, "pass", devices[0]["Config"].(map[string]interface{})["Password"])
+	nodes := devices[0]["Nodes"].([]interface{})
+	require.Len(t, nodes, 2)
+	require.Equal(t, "bad", nodes[0].(map[string]interface{})["Quality"])
+	require.Equal(t, "BadNodeIDUnknown", nodes[0].(map[string]interface{})["Status"])
+	require.Equal(t, 21.5, nodes[1].(map[string]interface{})["Value"])
+	require.Equal(t, "good", nodes[1].(map[string]interface{})["Quality"])
+
+	resp, err = http.Get(srv.URL + "/modbus/units")
+	require.NoError(t, err)
+	var units unitsStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&units))
+	resp.Body.Close()
+	require.Len(t, units.Units, 1)
+	require.Equal(t, modbus.UnitID(5), units.Units[0].UnitID)
+}
+
+func TestMetrics(t *testing.T) {
+	logg := logrus.New()
+	mb := modbus.NewServer(logg, "", 0)
+	mb.AddDevice(5)
+	mb.SetReady(5, true)
+
+	plc := clientopcua.DeviceOPCUA{Name: "plc1", Status: clientopcua.Polling, MBUnitID: 5, Counters: clientopcua.NewCounters()}
+	plc.Counters.DataChange()
+	plc.Counters.DataChange()
+	plc.Counters.ConversionError(`ns=3;s="Temp"`)
+
+	srv := httptest.NewServer((&httpAPI{MBServer: mb, PLCs: []clientopcua.DeviceOPCUA{plc}, logg: logg}).routes())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	out := string(body)
+	require.Contains(t, out, "# TYPE opcuamodbus_modbus_request_duration_seconds histogram\n")
+	require.Contains(t, out, "opcuamodbus_modbus_connections 0\n")
+	require.Contains(t, out, `opcuamodbus_modbus_unit_ready{unit="5"} 1`+"\n")
+	require.Contains(t, out, `opcuamodbus_opcua_status{device="plc1"} 6`+"\n")
+	require.Contains(t, out, `opcuamodbus_opcua_data_changes_total{device="plc1"} 2`+"\n")
+	require.Contains(t, out, `opcuamodbus_tag_conversion_errors_total{device="plc1",tag="ns=3;s=\"Temp\""} 1`+"\n")
+}
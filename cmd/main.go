@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -9,23 +10,41 @@ import (
 	"opcuaModbus/internal/clientopcua"
 	"opcuaModbus/internal/logger"
 	"opcuaModbus/internal/modbus"
+	"opcuaModbus/internal/mqtt"
+	"opcuaModbus/internal/serveropcua"
+	"opcuaModbus/internal/sparkplug"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gopcua/opcua"
-	"github.com/gopcua/opcua/monitor"
-	"github.com/gopcua/opcua/stats"
+	"github.com/gopcua/opcua/ua"
 	"github.com/sirupsen/logrus"
 )
 
 type serv struct {
 	MBServer     *modbus.MBServer
 	OPCUAClients *clientopcua.DeviceOPCUA
+	MQTT         *mqtt.Publisher     // nil - not published
+	Sparkplug    *sparkplug.EdgeNode // nil - Sparkplug disabled
+	// last is last values of tags read by polling, only changes are published (nil - all reads)
+	last *lastValues
+	// retrying is 1 while failed initial read is retried
+	retrying int32
 }
 
 var configFile string
 
+// subcommands is utility commands, e.g. opcuaModbus -config config.toml cert print
+var subcommands = map[string]func(args []string) error{
+	"convert": convertCmd,
+	"secret":  secretCmd,
+	"cert":    certCmd,
+	"trust":   trustCmd,
+}
+
 func init() {
 	flag.StringVar(&configFile, "config", "../configs/config.toml", "path to configuration file")
 }
@@ -33,6 +52,13 @@ func init() {
 func main() {
 	flag.Parse()
 
+	if cmd, ok := subcommands[flag.Arg(0)]; ok {
+		if err := cmd(flag.Args()[1:]); err != nil {
+			log.Fatalf("%s: %v", flag.Arg(0), err)
+		}
+		return
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
@@ -44,216 +70,552 @@ func main() {
 	logg := logger.New(config.Logger.File, config.Logger.Level)
 
 	MBServer := modbus.NewServer(logg, config.Modbus.Host, config.Modbus.Port)
+	for _, rc := range config.Modbus.Routes {
+		r, err := rc.route()
+		if err != nil {
+			logg.Error("error modbus config: ", err)
+			return
+		}
+		MBServer.AddRoute(r)
+	}
 
 	go MBServer.Listen()
 
-	PLCs, err := readConfPlcs(config.Devices.Directory)
+	secretsRes := config.resolver()
+	PLCs, err := config.plcs(secretsRes)
+	tokens, tokensErr := config.HTTP.tokens(secretsRes)
+	mqttConf, mqttErr := config.MQTT.config(secretsRes)
+	spConf, spErr := config.Sparkplug.config(secretsRes)
+	uaConf, uaErr := config.OPCUA.config()
+	logger.Redact(logg, secretsRes.Values()...)
 	if err != nil {
 		logg.Error("error plc list: ", err)
 		return
 	}
-	if len(PLCs) < 1 {
+	sources, err := config.sources()
+	if err != nil {
+		logg.Error("error modbus devices: ", err)
+		return
+	}
+	if tokensErr != nil {
+		logg.Error("error http config: ", tokensErr)
+		return
+	}
+	if mqttErr != nil {
+		logg.Error("error mqtt config: ", mqttErr)
+		return
+	}
+	if spErr != nil {
+		logg.Error("error sparkplug config: ", spErr)
+		return
+	}
+	if uaErr != nil {
+		logg.Error("error opcua server config: ", uaErr)
+		return
+	}
+	if len(PLCs)+len(sources) < 1 {
 		logg.Error("error plc list: empty data")
 		return
 	}
 
 	for i := range PLCs {
+		PLCs[i].Results = clientopcua.NewResults()
+		PLCs[i].Counters = clientopcua.NewCounters()
 		MBServer.AddDevice(PLCs[i].MBUnitID)
+		if PLCs[i].Events != nil && PLCs[i].Events.Acknowledgeable() {
+			MBServer.AddWriteHandler(PLCs[i].MBUnitID, ackHandler(logg, MBServer, &PLCs[i]))
+		}
+		if len(PLCs[i].Methods) > 0 {
+			MBServer.AddWriteHandler(PLCs[i].MBUnitID, methodHandler(logg, MBServer, &PLCs[i]))
+		}
+		MBServer.AddWriteHandler(PLCs[i].MBUnitID, tagWriteHandler(logg, MBServer, &PLCs[i]))
 	}
 
-	go mon(PLCs)
+	for _, src := range sources {
+		MBServer.AddDevice(src.MBUnitID)
+	}
 
-	ticker := time.NewTicker(1 * time.Minute)
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				ticker.Stop()
+	// publishers is MQTT publishers by device
+	publishers := map[string]*mqtt.Publisher{}
+	if mqttConf.Broker != "" {
+		for i := range PLCs {
+			p, err := mqtt.New(mqttConf, PLCs[i].Name, strconv.Itoa(int(PLCs[i].MBUnitID)), logg)
+			if err != nil {
+				logg.Error("error mqtt ", PLCs[i].Name, ": ", err)
 				return
+			}
+			publishers[PLCs[i].Name] = p
+			go p.Start(ctx)
+		}
+		for _, src := range sources {
+			p, err := mqtt.New(mqttConf, src.Name, strconv.Itoa(int(src.MBUnitID)), logg)
+			if err != nil {
+				logg.Error("error mqtt ", src.Name, ": ", err)
+				return
+			}
+			publishers[src.Name] = p
+			go p.Start(ctx)
+		}
+	}
 
-			case <-ticker.C:
-				for i := range PLCs {
-					if PLCs[i].Status == clientopcua.Configured {
-						err := PLCs[i].ReadTagsTSV()
-						if err != nil {
-							PLCs[i].Error = "error read tsv"
-							logg.Debug(PLCs[i].Config.Endpoint, " error: ", err)
-						}
-						logg.Debug(PLCs[i].Config.Endpoint, " status: ", PLCs[i].Status)
-					}
+	var edge *sparkplug.EdgeNode
+	if spConf.Broker != "" {
+		edge = sparkplug.New(spConf, logg)
+		go edge.Start(ctx)
+		// devices are registered once, online state is set by Birth/Death of runDevice
+		for i := range PLCs {
+			if PLCs[i].State().Status == clientopcua.Configured {
+				if err := PLCs[i].ReadTagsTSV(); err != nil {
+					// device is registered by supervisor after tags are read
+					logg.Error(PLCs[i].Config.Endpoint, " sparkplug: error read tsv: ", err)
+					continue
+				}
+			}
+			addSparkplugDevice(logg, edge, MBServer, &PLCs[i])
+		}
+	}
 
-					if PLCs[i].Status == clientopcua.ReadTags {
-						err := PLCs[i].ClientOptions(ctx, logg)
-						if err != nil {
-							PLCs[i].Error = "error options"
-							logg.Debug(PLCs[i].Config.Endpoint, " error: ", err)
-						}
-						logg.Debug(PLCs[i].Config.Endpoint, " status: ", PLCs[i].Status)
-					}
+	for _, src := range sources {
+		go startSource(ctx, logg, &source{MBServer: MBServer, Device: src, MQTT: publishers[src.Name], Sparkplug: edge})
+	}
 
-					if PLCs[i].Status == clientopcua.ReadyOptions {
-						client := opcua.NewClient(PLCs[i].Config.Endpoint, PLCs[i].Options...)
-						PLCs[i].Client = client
+	var uaServer *serveropcua.Server
+	if uaConf.Port > 0 {
+		if uaServer, err = startOPCUAServer(ctx, logg, uaConf, MBServer, PLCs, sources); err != nil {
+			logg.Error("error opcua server: ", err)
+			return
+		}
+	}
 
-						if err := PLCs[i].Client.Connect(ctx); err != nil {
-							PLCs[i].Error = "failed connect"
-							logg.Debug(PLCs[i].Config.Endpoint, " failed connect: ", err)
-							continue
-						}
-						defer PLCs[i].Client.Close()
-						PLCs[i].Status = clientopcua.Connected
-						tm := PLCs[i].ReadTime(ctx)
-						logg.Debug(PLCs[i].Config.Endpoint, " status: ", PLCs[i].Status, " /", tm)
+	if config.HTTP.Port > 0 {
+		recent := newRecentLog(200)
+		logg.AddHook(recent)
+		go startHTTP(ctx, logg, config.HTTP, &httpAPI{MBServer: MBServer, PLCs: PLCs, logg: logg, recent: recent, tokens: tokens, MQTT: publishers, Sparkplug: edge, Sources: sources, OPCUAServer: uaServer})
+	}
+
+	ticker := time.NewTicker(1 * time.Minute)
+	// wake is starting supervisor cycle immediately (after failover)
+	wake := make(chan struct{}, 1)
+	supervise := func() {
+		for i := range PLCs {
+			if PLCs[i].State().Status == clientopcua.Configured {
+				err := PLCs[i].ReadTagsTSV()
+				if err != nil {
+					PLCs[i].SetError("error read tsv")
+					logg.Error(PLCs[i].Config.Endpoint, " error: ", err)
+				} else if edge != nil {
+					addSparkplugDevice(logg, edge, MBServer, &PLCs[i])
+				}
+				logg.Debug(PLCs[i].Config.Endpoint, " status: ", PLCs[i].State().Status)
+			}
+
+			if PLCs[i].State().Status == clientopcua.ReadTags {
+				err := PLCs[i].ClientOptions(ctx, logg)
+				if err != nil {
+					PLCs[i].SetError("error options")
+					logg.Debug(PLCs[i].Config.Endpoint, " error: ", err)
+					if PLCs[i].Redundant() {
+						logg.Info(PLCs[i].Name, " switch to backup endpoint ", PLCs[i].NextEndpoint())
 					}
+				}
+				logg.Debug(PLCs[i].Config.Endpoint, " status: ", PLCs[i].State().Status)
+			}
+
+			if PLCs[i].State().Status == clientopcua.ReadyOptions {
+				PLCs[i].SetClient(opcua.NewClient(PLCs[i].Config.Endpoint, PLCs[i].Options...))
 
-					if PLCs[i].Status == clientopcua.Connected {
-						mntr, err := monitor.NewNodeMonitor(PLCs[i].Client)
-						PLCs[i].Monitor = mntr
-						if err != nil {
-							logg.Debug(PLCs[i].Config.Endpoint, " error: ", err)
-							continue
+				if err := PLCs[i].Client.Connect(ctx); err != nil {
+					PLCs[i].SetError("failed connect")
+					logg.Debug(PLCs[i].Config.Endpoint, " failed connect: ", PLCs[i].ConnectError(err))
+					if PLCs[i].Redundant() {
+						logg.Info(PLCs[i].Name, " switch to backup endpoint ", PLCs[i].NextEndpoint())
+					}
+					continue
+				}
+				PLCs[i].SetStatus(clientopcua.Connected)
+				tm := PLCs[i].ReadTime(ctx)
+				logg.Debug(PLCs[i].Config.Endpoint, " status: ", PLCs[i].State().Status, " /", tm)
+				lim := PLCs[i].ReadOperationLimits(ctx)
+				logg.Debug(PLCs[i].Config.Endpoint, fmt.Sprintf(" operation limits: %+v", lim))
+				if PLCs[i].Redundant() {
+					logg.Debug(PLCs[i].Config.Endpoint, " redundancy: ", PLCs[i].Redundancy(ctx))
+				}
+				for node, err := range PLCs[i].ResolveNodes(ctx) {
+					logg.Error(PLCs[i].Config.Endpoint, "/", node, " resolve error: ", err)
+				}
+				if issues, err := PLCs[i].ValidateTags(ctx); err != nil {
+					logg.Error(PLCs[i].Config.Endpoint, " validate tags error: ", err)
+				} else {
+					for node, msg := range issues {
+						if PLCs[i].Refused(node) {
+							logg.Error(PLCs[i].Config.Endpoint, "/", node, " tag refused: ", msg)
+						} else {
+							logg.Warn(PLCs[i].Config.Endpoint, "/", node, " tag mismatch: ", msg)
 						}
+					}
+				}
+			}
 
-						PLCs[i].Monitor.SetErrorHandler(func(c *opcua.Client, sub *monitor.Subscription, err error) {
-							e := fmt.Sprintf("error: sub=%d err=%s", sub.SubscriptionID(), err)
-							logg.Error(e)
-						})
+			// device is started once: running is cleared when runDevice returns
+			if PLCs[i].State().Status == clientopcua.Connected && PLCs[i].StartRun() {
+				Serv := &serv{
+					MBServer:     MBServer,
+					OPCUAClients: &PLCs[i],
+					MQTT:         publishers[PLCs[i].Name],
+					Sparkplug:    edge,
+					last:         newLastValues(),
+				}
+				go runDevice(ctx, logg, Serv, wake)
+			}
 
-						Serv := &serv{
-							MBServer:     MBServer,
-							OPCUAClients: &PLCs[i],
-						}
+			st := PLCs[i].State()
+			logg.Debug(PLCs[i].Config.Endpoint, " status: ", st.Status, " / error: ", st.Error)
+			if len(PLCs[i].SubscriptionsSnapshot()) > 0 {
+				logg.Debug(PLCs[i].Config.Endpoint, " subscribed ", PLCs[i].Subscribed(), " tags")
+			}
 
-						go startCallbackSub(ctx, logg, Serv)
-					}
+			ticker.Reset(1 * time.Minute)
+		}
+	}
 
-					logg.Debug(PLCs[i].Config.Endpoint, " status: ", PLCs[i].Status, " / error: ", PLCs[i].Error)
-					if PLCs[i].Subscrip != nil {
-						logg.Debug(PLCs[i].Config.Endpoint, " subscribed ", PLCs[i].Subscrip.Subscribed(), " tags")
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				for i := range PLCs {
+					if PLCs[i].Client != nil {
+						PLCs[i].Client.Close()
 					}
-
-					ticker.Reset(1 * time.Minute)
 				}
+				return
+
+			case <-ticker.C:
+				supervise()
+			case <-wake:
+				supervise()
 			}
 		}
 	}()
 
 	<-ctx.Done()
+	MBServer.CloseRoutes()
 }
 
-func mon(plcs []clientopcua.DeviceOPCUA) {
-	tic := time.NewTicker(1 * time.Minute)
-	for {
-		<-tic.C
-		for i, plc := range plcs {
-			if plc.Client != nil {
-				st := plc.Client.State()
-				fmt.Println(i, st)
+// initialRetryMin, initialRetryMax is delays between retries of failed initial read
+const (
+	initialRetryMin = time.Second
+	initialRetryMax = time.Minute
+)
+
+// initialRead is reading all tags of device to ModBus registers, then unit is ready.
+// Failed read is retried in background with backoff until success or ctx is done.
+func initialRead(ctx context.Context, logg *logrus.Logger, srvc *serv) {
+	if readInitial(ctx, logg, srvc) {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&srvc.retrying, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&srvc.retrying, 0)
+		delay := initialRetryMin
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			if readInitial(ctx, logg, srvc) {
+				return
+			}
+			if delay *= 2; delay > initialRetryMax {
+				delay = initialRetryMax
 			}
 		}
-		// cl := stats.Client()
-		// er := stats.Error()
-		// sb := stats.Subscription()
-		// fmt.Printf("-client :    %+v\n", cl)
-		// fmt.Printf("-error  :    %+v\n", er)
-		// fmt.Printf("-subscr :    %+v\n", sb)
-	}
+	}()
 }
 
-func mosub(sub *monitor.Subscription) {
-	tic := time.NewTicker(1 * time.Minute)
-	for {
-		<-tic.C
-		sb, _ := sub.Stats()
+// readInitial is one initial read of all tags, true - unit is ready
+func readInitial(ctx context.Context, logg *logrus.Logger, srvc *serv) bool {
+	dvc := srvc.OPCUAClients
+	n, err := dvc.InitialRead(ctx, srvc.handlerRead)
+	if err != nil {
+		dvc.SetError("error initial read")
+		logg.Error(dvc.Config.Endpoint, " initial read error: ", err)
+		return false
+	}
+	logg.Debug(dvc.Config.Endpoint, " initial read: ", n, "/", len(dvc.Nodes), " tags")
+	srvc.setReady(true)
+	return true
+}
 
-		fmt.Printf("-sub :    %+v\n", sb)
+// watchSession is tracking session of device: unit is not ready while disconnected,
+// all tags are read again when session is restored. Returns reason of failover
+// (session lost longer than FailoverTimeout or low ServiceLevel) for redundant device.
+func watchSession(ctx context.Context, logg *logrus.Logger, srvc *serv) string {
+	dvc := srvc.OPCUAClients
+	tic := time.NewTicker(time.Second)
+	defer tic.Stop()
+
+	connected := true
+	var lost time.Time
+	for n := 0; ; n++ {
+		select {
+		case <-ctx.Done():
+			srvc.setReady(false)
+			return ""
+		case <-tic.C:
+		}
 
-		stats.Reset()
+		st := dvc.Client.State()
+		switch {
+		case st != opcua.Connected && connected:
+			connected = false
+			lost = time.Now()
+			srvc.setReady(false)
+			logg.Debug(dvc.Config.Endpoint, " session lost: ", st)
+		case st == opcua.Connected && !connected:
+			connected = true
+			logg.Debug(dvc.Config.Endpoint, " session restored")
+			dvc.Counters.Reconnect()
+			initialRead(ctx, logg, srvc)
+		}
 
-		//s *Subscription) Stats()
+		if !dvc.Redundant() {
+			continue
+		}
+		if !connected && time.Since(lost) > dvc.FailoverTimeout() {
+			return fmt.Sprintf("session lost for %s", time.Since(lost).Round(time.Second))
+		}
+		if connected && n%5 == 0 {
+			if reason := dvc.LowServiceLevel(ctx); reason != "" {
+				return reason
+			}
+		}
 	}
 }
 
-func startCallbackSub(ctx context.Context, logg *logrus.Logger, srvc *serv) {
-	if len(srvc.OPCUAClients.Nodes) < 1 {
-		srvc.OPCUAClients.Error = "empty Nodes"
-		logg.Debug(srvc.OPCUAClients.Config.Endpoint + " Nodes empty")
-		return
+// runDevice is reading tags of connected device (subscription or polling) until failover:
+// then reading is stopped, client is closed and supervisor connects next endpoint.
+// If reading is not started, client is closed and supervisor connects again on next cycle.
+// Run of device is stopped (StopRun) before supervisor is woken, so it can start device again.
+func runDevice(ctx context.Context, logg *logrus.Logger, srvc *serv, wake chan<- struct{}) {
+	dvc := srvc.OPCUAClients
+	devCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	var startErr error
+	go func() {
+		defer close(done)
+		if dvc.Config.ReadMode == clientopcua.ModePoll {
+			startErr = startPolling(devCtx, logg, srvc)
+		} else {
+			startErr = startCallbackSub(devCtx, logg, srvc)
+		}
+		if startErr != nil {
+			cancel()
+		}
+	}()
+
+	if dvc.Events != nil {
+		go startEvents(devCtx, logg, srvc)
+	}
+	if dvc.Config.ClockRegister != nil {
+		go startClock(devCtx, logg, srvc)
 	}
 
-	if srvc.OPCUAClients.Subscrip != nil {
+	reason := watchSession(devCtx, logg, srvc)
+	if reason == "" {
+		if ctx.Err() != nil {
+			dvc.StopRun()
+			return
+		}
+		// reading is not started: clean restart by supervisor
+		<-done
+		if dvc.Client != nil {
+			dvc.Client.Close()
+		}
+		dvc.SetStatus(clientopcua.ReadyOptions)
+		logg.Warn(dvc.Config.Endpoint, " reading not started: ", startErr, ", reconnect on next cycle")
+		dvc.StopRun()
 		return
 	}
 
-	sub, err := srvc.OPCUAClients.Monitor.Subscribe(
-		ctx,
-		&opcua.SubscriptionParameters{
-			Interval: 3 * time.Second,
-		},
-		srvc.handlerOPCUA,
-		srvc.OPCUAClients.Nodes[0])
-	if err != nil {
-		srvc.OPCUAClients.Subscrip = nil
-		srvc.OPCUAClients.Error = "error subscribe"
-		logg.Error(srvc.OPCUAClients.Config.Endpoint, " error: ", err)
-		return
+	srvc.setReady(false)
+	cancel()
+	<-done
+	if dvc.Client != nil {
+		dvc.Client.Close()
+	}
+	old := dvc.Config.Endpoint
+	dvc.SetError("failover: " + reason)
+	logg.Warn(dvc.Name, " failover from ", old, " (", reason, ") to ", dvc.NextEndpoint())
+	dvc.StopRun()
+	select {
+	case wake <- struct{}{}:
+	default:
 	}
+}
 
-	go mosub(sub)
-	srvc.OPCUAClients.Subscrip = sub
-	go func() {
-		<-ctx.Done()
-		_ = sub.Unsubscribe(ctx)
-		srvc.OPCUAClients.Subscrip = nil
-		srvc.OPCUAClients.Status = clientopcua.ReadyOptions
-	}()
+// startPolling is polling tags until ctx is done, returns error if polling is not started
+func startPolling(ctx context.Context, logg *logrus.Logger, srvc *serv) error {
+	dvc := srvc.OPCUAClients
+	if len(dvc.Nodes) < 1 {
+		dvc.SetError("empty Nodes")
+		return errors.New("empty nodes")
+	}
+
+	initialRead(ctx, logg, srvc)
+
+	dvc.SetStatus(clientopcua.Polling)
+	dvc.Poll(ctx, logg, srvc.handlerRead)
+	dvc.SetStatus(clientopcua.ReadyOptions)
+	return nil
+}
 
-	for i := 1; i < len(srvc.OPCUAClients.Nodes); i++ {
-		err = sub.AddNodes(srvc.OPCUAClients.Nodes[i])
+// startCallbackSub is subscribing tags until ctx is done, returns error if no subscription is created
+func startCallbackSub(ctx context.Context, logg *logrus.Logger, srvc *serv) error {
+	dvc := srvc.OPCUAClients
+	if len(dvc.Nodes) < 1 {
+		dvc.SetError("empty Nodes")
+		return errors.New("empty nodes")
+	}
+
+	initialRead(ctx, logg, srvc)
+
+	groups, err := dvc.SubscriptionGroups()
+	if err != nil {
+		dvc.SetError("error subscribe")
+		return err
+	}
+
+	lim := dvc.OperationLimits(ctx)
+	parts := lim.Split(groups)
+	batch := lim.MonitorBatch()
+	for _, g := range parts {
+		sub, err := dvc.Subscribe(
+			ctx,
+			&opcua.SubscriptionParameters{
+				Interval: g.Interval,
+			},
+			srvc.handlerOPCUA,
+			func(err error) {
+				logg.Error(dvc.Config.Endpoint, " ", err)
+			})
 		if err != nil {
-			logg.Error(srvc.OPCUAClients.Config.Endpoint, "/", srvc.OPCUAClients.Nodes[i], " error: ", err)
+			dvc.SetError("error subscribe")
+			logg.Error(dvc.Config.Endpoint, " subscription ", g.Name, " error: ", err)
+			continue
+		}
+
+		dvc.AddSubscription(sub)
+
+		calls, errs := dvc.AddMonitoredItems(ctx, sub, g.Nodes, batch)
+		for _, node := range g.Nodes {
+			if err, ok := errs[node]; ok {
+				logg.Error(dvc.Config.Endpoint, "/", node, " error: ", err)
+			}
 		}
+		logg.Debug(dvc.Config.Endpoint, " subscription ", g.Name, " (", g.Interval, ") id ", sub.SubscriptionID(), ": ",
+			len(g.Nodes)-len(errs), "/", len(g.Nodes), " tags in ", calls, " calls of max ", batch)
+	}
+	if len(parts) > len(groups) {
+		logg.Info(dvc.Config.Endpoint, " ", len(dvc.Nodes), " tags split into ", len(parts),
+			" subscriptions, max ", lim.MaxMonitoredItemsPerSubscription, " items per subscription")
+	}
+	if len(dvc.SubscriptionsSnapshot()) == 0 {
+		return errors.New("no subscriptions")
 	}
 
-	srvc.OPCUAClients.Status = clientopcua.Subscribed
+	dvc.SetStatus(clientopcua.Subscribed)
 
 	<-ctx.Done()
+	for _, sub := range dvc.TakeSubscriptions() {
+		_ = sub.Unsubscribe(ctx)
+	}
+	dvc.SetStatus(clientopcua.ReadyOptions)
+	return nil
 }
 
-func (srv *serv) handlerOPCUA(s *monitor.Subscription, msg *monitor.DataChangeMessage) {
-	unitid := srv.OPCUAClients.MBUnitID
-	tag := srv.OPCUAClients.Tags[msg.NodeID.String()]
-	val := msg.Value.Value()
+// handlerOPCUA is handler of data changes of subscriptions, value with any status (bad, uncertain
+// without value too) is published
+func (srv *serv) handlerOPCUA(node string, dv *ua.DataValue) {
+	srv.OPCUAClients.Counters.DataChange()
+	srv.OPCUAClients.Results.Set(node, dv)
+	srv.publish(node, dv)
+	srv.writeTag(node, value(dv))
+}
 
-	switch tag.MBfunc {
+// handlerRead is handler of Read results (initial read & polling), changes of value or status are published
+func (srv *serv) handlerRead(node string, dv *ua.DataValue) {
+	if dv == nil {
+		return
+	}
+	if srv.last.changed(node, dv) {
+		srv.publish(node, dv)
+	}
+	srv.writeTag(node, value(dv))
+}
+
+// value is returns value of data value, nil if it has no value (e.g. bad status)
+func value(dv *ua.DataValue) interface{} {
+	if dv.Value == nil {
+		return nil
+	}
+	return dv.Value.Value()
+}
+
+// writeTag is writing value of tag to ModBus Server registers, nil value is skipped
+func (srv *serv) writeTag(node string, val interface{}) {
+	if val == nil {
+		return
+	}
+	tag := srv.OPCUAClients.Tags[node]
+	if srv.OPCUAClients.Refused(node) {
+		return
+	}
+	if !writeValue(srv.MBServer, srv.OPCUAClients.MBUnitID, tag.MBfunc, tag.MBaddr, val) {
+		srv.OPCUAClients.Counters.ConversionError(node)
+		if tag.MBfunc == modbus.ReadCoils || tag.MBfunc == modbus.ReadDiscreteInputs {
+			log.Println("err tag : ", node)
+		}
+	}
+}
+
+// writeValue is writing value to coil, discrete input or registers of unit, false - value can't be converted
+func writeValue(mb *modbus.MBServer, unitid modbus.UnitID, function uint8, addr uint16, val interface{}) bool {
+	switch function {
 	case modbus.ReadCoils:
-		if v, ok := val.(bool); ok {
-			srv.MBServer.WriteCoils(unitid, tag.MBaddr, v)
-			return
+		v, ok := val.(bool)
+		if ok {
+			mb.WriteCoils(unitid, addr, v)
 		}
-		log.Println("err tag : ", msg.NodeID)
+		return ok
 
 	case modbus.ReadDiscreteInputs:
-		if v, ok := val.(bool); ok {
-			srv.MBServer.WriteDiscreteInputs(unitid, tag.MBaddr, v)
-			return
+		v, ok := val.(bool)
+		if ok {
+			mb.WriteDiscreteInputs(unitid, addr, v)
 		}
-		log.Println("err tag : ", msg.NodeID)
+		return ok
 
 	case modbus.ReadHoldingRegisters:
 		regs := toRegisters(val)
 		for i, r := range regs {
-			srv.MBServer.WriteHoldingRegisters(unitid, tag.MBaddr+uint16(i), r)
+			mb.WriteHoldingRegisters(unitid, addr+uint16(i), r)
 		}
+		return len(regs) > 0
 
 	case modbus.ReadInputRegisters:
 		regs := toRegisters(val)
 		for i, r := range regs {
-			srv.MBServer.WriteInputRegisters(unitid, tag.MBaddr+uint16(i), r)
+			mb.WriteInputRegisters(unitid, addr+uint16(i), r)
 		}
-
-	default:
+		return len(regs) > 0
 	}
+	return true
 }
 
 // toRegisters is convert data to slice bytes
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/sirupsen/logrus"
+)
+
+// methodTimeout is timeout of method call
+const methodTimeout = 30 * time.Second
+
+// methodHandler is handler of writes to triggers and input arguments of methods:
+// arguments are stored in holding registers, trigger (coil 1 or holding register != 0)
+// starts call, trigger is reset when call is done and results are written
+func methodHandler(logg *logrus.Logger, mb *modbus.MBServer, dvc *clientopcua.DeviceOPCUA) modbus.WriteHandler {
+	return func(function uint8, address uint16, values []uint16) modbus.Exception {
+		coils := function == modbus.WriteSingleCoil || function == modbus.WriteMultipleCoils
+
+		// every address must be served: trigger or argument of method
+		var calls []clientopcua.Method
+		for i, v := range values {
+			addr := address + uint16(i)
+			m, trigger, ok := findMethod(dvc.Methods, coils, addr)
+			if !ok {
+				return modbus.IllegalDataAddress
+			}
+			if trigger && v != 0 {
+				calls = append(calls, m)
+			}
+		}
+
+		for i, v := range values {
+			if coils {
+				mb.WriteCoils(dvc.MBUnitID, address+uint16(i), v != 0)
+			} else {
+				mb.WriteHoldingRegisters(dvc.MBUnitID, address+uint16(i), v)
+			}
+		}
+		for _, m := range calls {
+			go callMethod(logg, mb, dvc, m)
+		}
+		return modbus.Success
+	}
+}
+
+// findMethod is returns method of trigger or argument address
+func findMethod(methods []clientopcua.Method, coils bool, addr uint16) (m clientopcua.Method, trigger, ok bool) {
+	for _, m := range methods {
+		if (m.Trigger == modbus.ReadCoils) == coils && m.TriggerAddr == addr {
+			return m, true, true
+		}
+		if !coils && addr >= m.ArgsAddr && int(addr) < int(m.ArgsAddr)+m.ArgsCount() {
+			return m, false, true
+		}
+	}
+	return m, false, false
+}
+
+// callMethod is calling method with arguments from holding registers, writing results & resetting trigger
+func callMethod(logg *logrus.Logger, mb *modbus.MBServer, dvc *clientopcua.DeviceOPCUA, m clientopcua.Method) {
+	unit := dvc.MBUnitID
+	regs := make([]uint16, m.ArgsCount())
+	mb.Devices[unit].RWHoldingRegisters.RLock()
+	for i := range regs {
+		regs[i] = mb.Devices[unit].HoldingRegisters[m.ArgsAddr+uint16(i)]
+	}
+	mb.Devices[unit].RWHoldingRegisters.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), methodTimeout)
+	defer cancel()
+	res, err := dvc.CallMethod(ctx, m, regs)
+
+	status := ua.StatusOK
+	switch {
+	case err != nil:
+		status = ua.StatusBadCommunicationError
+		if sc, ok := err.(ua.StatusCode); ok {
+			status = sc
+		}
+		logg.Error(dvc.State().Endpoint, " method ", m.Name, " error: ", err)
+	default:
+		status = res.StatusCode
+		logg.Info(dvc.State().Endpoint, " method ", m.Name, " called by ModBus master: ", status)
+	}
+
+	if m.StatusAddr != nil {
+		for i, r := range toRegisters(uint32(status)) {
+			mb.WriteInputRegisters(unit, *m.StatusAddr+uint16(i), r)
+		}
+	}
+	if m.OutputsAddr != nil && res != nil {
+		addr := *m.OutputsAddr
+		for _, out := range res.OutputArguments {
+			v := out.Value()
+			if b, ok := v.(bool); ok {
+				v = uint16(0)
+				if b {
+					v = uint16(1)
+				}
+			}
+			for _, r := range toRegisters(v) {
+				mb.WriteInputRegisters(unit, addr, r)
+				addr++
+			}
+		}
+	}
+
+	if m.Trigger == modbus.ReadCoils {
+		mb.WriteCoils(unit, m.TriggerAddr, false)
+	} else {
+		mb.WriteHoldingRegisters(unit, m.TriggerAddr, 0)
+	}
+}
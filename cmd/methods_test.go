@@ -0,0 +1,65 @@
+package main
+
+import (
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMethods(t *testing.T) {
+	status := uint16(320)
+	mc := MethodConf{
+		Name:           "start batch",
+		Object:         "ns=3;s=Line1",
+		Method:         "ns=3;s=Line1.StartBatch",
+		Trigger:        "coil",
+		Address:        300,
+		ArgsAddress:    310,
+		Args:           []string{"uint32", "float32"},
+		StatusRegister: &status,
+	}
+	m, err := mc.method()
+	require.NoError(t, err)
+	require.Equal(t, modbus.ReadCoils, m.Trigger)
+	require.Equal(t, 4, m.ArgsCount())
+
+	_, err = MethodConf{Object: "i=1", Method: "i=2", Trigger: "input"}.method()
+	require.Error(t, err)
+	_, err = MethodConf{Object: "i=1", Method: "i=2", Trigger: "coil", Args: []string{"string"}}.method()
+	require.Error(t, err)
+
+	v, err := clientopcua.FromRegisters("float32", toRegisters(float32(1.5)))
+	require.NoError(t, err)
+	require.Equal(t, float32(1.5), v)
+	v, err = clientopcua.FromRegisters("int16", []uint16{0xFFFF})
+	require.NoError(t, err)
+	require.Equal(t, int16(-1), v)
+
+	logg := logrus.New()
+	mb := modbus.NewServer(logg, "", 0)
+	mb.AddDevice(1)
+	dvc := &clientopcua.DeviceOPCUA{MBUnitID: 1, Methods: []clientopcua.Method{m}}
+	h := methodHandler(logg, mb, dvc)
+
+	require.Equal(t, modbus.Success, h(modbus.WriteMultipleRegisters, 310, []uint16{0, 7, 0x3FC0, 0}))
+	require.Equal(t, uint16(7), mb.Devices[1].HoldingRegisters[311])
+	require.Equal(t, modbus.IllegalDataAddress, h(modbus.WriteSingleRegister, 314, []uint16{1}))
+	require.Equal(t, modbus.IllegalDataAddress, h(modbus.WriteSingleCoil, 301, []uint16{1}))
+
+	// device is not connected: call fails, status is written, trigger is reset
+	require.Equal(t, modbus.Success, h(modbus.WriteSingleCoil, 300, []uint16{1}))
+	require.Eventually(t, func() bool {
+		mb.Devices[1].RWCoils.RLock()
+		defer mb.Devices[1].RWCoils.RUnlock()
+		return !mb.Devices[1].Coils[300]
+	}, time.Second, 10*time.Millisecond)
+	mb.Devices[1].RWInputRegisters.RLock()
+	defer mb.Devices[1].RWInputRegisters.RUnlock()
+	require.Equal(t, toRegisters(uint32(ua.StatusBadCommunicationError)),
+		[]uint16{mb.Devices[1].InputRegisters[320], mb.Devices[1].InputRegisters[321]})
+}
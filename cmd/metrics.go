@@ -0,0 +1,288 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"opcuaModbus/internal/modbus"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gopcua/opcua/stats"
+)
+
+// metricsPrefix is prefix of names of metrics
+const metricsPrefix = "opcuamodbus_"
+
+// metrics is /metrics in Prometheus text exposition format
+func (a *httpAPI) metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	a.writeModbusMetrics(w)
+	a.writeDeviceMetrics(w)
+	a.writeSparkplugMetrics(w)
+	a.writeOPCUAServerMetrics(w)
+	writeExpvarMetrics(w, "gopcua_client", "gopcua client counters", stats.Client())
+	writeExpvarMetrics(w, "gopcua_errors", "gopcua errors by type", stats.Error())
+	writeExpvarMetrics(w, "gopcua_subscription", "gopcua subscription counters", stats.Subscription())
+}
+
+func (a *httpAPI) writeModbusMetrics(w io.Writer) {
+	st := a.MBServer.Stats()
+
+	metricHeader(w, "modbus_requests_total", "ModBus requests by unit and function code", "counter")
+	for _, rc := range st.Requests {
+		metric(w, "modbus_requests_total", labels("unit", strconv.Itoa(int(rc.Unit)), "function", strconv.Itoa(int(rc.Function))), float64(rc.Count))
+	}
+
+	metricHeader(w, "modbus_exceptions_total", "ModBus exception responses by code", "counter")
+	codes := make([]int, 0, len(st.Exceptions))
+	for ex := range st.Exceptions {
+		codes = append(codes, int(ex))
+	}
+	sort.Ints(codes)
+	for _, c := range codes {
+		metric(w, "modbus_exceptions_total", labels("code", strconv.Itoa(c)), float64(st.Exceptions[modbus.Exception(c)]))
+	}
+
+	metricHeader(w, "modbus_connections", "active ModBus TCP connections", "gauge")
+	metric(w, "modbus_connections", "", float64(st.Connections))
+
+	metricHeader(w, "modbus_request_duration_seconds", "latency of ModBus requests", "histogram")
+	for i, b := range st.Latency.Buckets {
+		metric(w, "modbus_request_duration_seconds_bucket", labels("le", formatFloat(b)), float64(st.Latency.Counts[i]))
+	}
+	metric(w, "modbus_request_duration_seconds_bucket", labels("le", "+Inf"), float64(st.Latency.Count))
+	metric(w, "modbus_request_duration_seconds_sum", "", st.Latency.Sum)
+	metric(w, "modbus_request_duration_seconds_count", "", float64(st.Latency.Count))
+
+	metricHeader(w, "modbus_unit_ready", "unit is populated with data of device", "gauge")
+	for _, u := range a.MBServer.Units() {
+		metric(w, "modbus_unit_ready", labels("unit", strconv.Itoa(int(u.UnitID))), boolValue(u.Ready))
+	}
+
+	routes := a.MBServer.Routes()
+	if len(routes) == 0 {
+		return
+	}
+	metricHeader(w, "modbus_route_forwarded_total", "responses of downstream devices relayed by route", "counter")
+	for _, r := range routes {
+		metric(w, "modbus_route_forwarded_total", labels("unit", strconv.Itoa(int(r.Unit))), float64(r.Forwarded))
+	}
+	metricHeader(w, "modbus_route_failures_total", "requests of route answered with gateway exception 0x0A/0x0B", "counter")
+	for _, r := range routes {
+		metric(w, "modbus_route_failures_total", labels("unit", strconv.Itoa(int(r.Unit))), float64(r.Failures))
+	}
+	metricHeader(w, "modbus_route_in_flight", "requests of route in progress", "gauge")
+	for _, r := range routes {
+		metric(w, "modbus_route_in_flight", labels("unit", strconv.Itoa(int(r.Unit))), float64(r.InFlight))
+	}
+}
+
+func (a *httpAPI) writeDeviceMetrics(w io.Writer) {
+	type sample struct {
+		labels string
+		value  float64
+	}
+	series := map[string][]sample{}
+	add := func(name, lbl string, v float64) {
+		series[name] = append(series[name], sample{lbl, v})
+	}
+
+	for i := range a.PLCs {
+		dvc := &a.PLCs[i]
+		dev := labels("device", dvc.Name)
+		cnt := dvc.Counters.Snapshot()
+
+		st := dvc.State()
+
+		add("opcua_status", dev, float64(st.Status))
+		add("opcua_data_changes_total", dev, float64(cnt.DataChanges))
+		add("opcua_reconnects_total", dev, float64(cnt.Reconnects))
+		add("opcua_failovers_total", dev, float64(st.Failovers))
+		for _, sub := range dvc.SubscriptionsSnapshot() {
+			lbl := labels("device", dvc.Name, "subscription", strconv.FormatUint(uint64(sub.SubscriptionID()), 10))
+			add("opcua_subscription_items", lbl, float64(sub.Subscribed()))
+			add("opcua_subscription_delivered_total", lbl, float64(sub.Delivered()))
+			add("opcua_subscription_dropped_total", lbl, float64(sub.Dropped()))
+		}
+		if ps, ok := dvc.PollSnapshot(); ok {
+			add("opcua_poll_cycles_total", dev, float64(ps.Cycles))
+			add("opcua_poll_overruns_total", dev, float64(ps.Overruns))
+			add("opcua_poll_errors_total", dev, float64(ps.Errors))
+			add("opcua_poll_cycle_seconds", dev, ps.LastCycle.Seconds())
+		}
+		if c, ok := dvc.ClockSnapshot(); ok && !c.Updated.IsZero() {
+			add("opcua_clock_drift_seconds", dev, c.Drift.Seconds())
+		}
+		if p, ok := a.MQTT[dvc.Name]; ok {
+			ms := p.Stats()
+			add("mqtt_connected", dev, boolValue(ms.Connected))
+			add("mqtt_published_total", dev, float64(ms.Published))
+			add("mqtt_dropped_total", dev, float64(ms.Dropped))
+			add("mqtt_buffered", dev, float64(ms.Buffered))
+			add("mqtt_buffered_bytes", dev, float64(ms.BufferedBytes))
+			add("mqtt_spool_segments", dev, float64(ms.Segments))
+		}
+		nodes := make([]string, 0, len(cnt.ConversionErrors))
+		for n := range cnt.ConversionErrors {
+			nodes = append(nodes, n)
+		}
+		sort.Strings(nodes)
+		for _, n := range nodes {
+			add("tag_conversion_errors_total", labels("device", dvc.Name, "tag", n), float64(cnt.ConversionErrors[n]))
+		}
+	}
+
+	for _, src := range a.Sources {
+		dev := labels("device", src.Name)
+		st := src.Stats()
+		add("modbus_source_connected", dev, boolValue(st.Connected))
+		add("modbus_source_cycles_total", dev, float64(st.Cycles))
+		add("modbus_source_errors_total", dev, float64(st.Errors))
+		add("modbus_source_retries_total", dev, float64(st.Retries))
+		add("modbus_source_cycle_seconds", dev, st.LastCycle.Seconds())
+		if p, ok := a.MQTT[src.Name]; ok {
+			ms := p.Stats()
+			add("mqtt_connected", dev, boolValue(ms.Connected))
+			add("mqtt_published_total", dev, float64(ms.Published))
+			add("mqtt_dropped_total", dev, float64(ms.Dropped))
+			add("mqtt_buffered", dev, float64(ms.Buffered))
+			add("mqtt_buffered_bytes", dev, float64(ms.BufferedBytes))
+			add("mqtt_spool_segments", dev, float64(ms.Segments))
+		}
+	}
+
+	for _, m := range []struct{ name, help, typ string }{
+		{"opcua_status", "state of device: 1 Configured, 2 ReadTags, 3 ReadyOptions, 4 Connected, 5 Subscribed, 6 Polling", "gauge"},
+		{"opcua_data_changes_total", "data change notifications received from server", "counter"},
+		{"opcua_reconnects_total", "sessions restored after loss", "counter"},
+		{"opcua_failovers_total", "switches between redundant endpoints", "counter"},
+		{"opcua_subscription_items", "monitored items of subscription", "gauge"},
+		{"opcua_subscription_delivered_total", "publish notifications delivered by subscription", "counter"},
+		{"opcua_subscription_dropped_total", "publish notifications dropped by subscription", "counter"},
+		{"opcua_poll_cycles_total", "polling cycles", "counter"},
+		{"opcua_poll_overruns_total", "polling cycles longer than poll interval", "counter"},
+		{"opcua_poll_errors_total", "polling cycles with read error", "counter"},
+		{"opcua_poll_cycle_seconds", "duration of last polling cycle", "gauge"},
+		{"opcua_clock_drift_seconds", "server time minus gateway time", "gauge"},
+		{"modbus_source_connected", "Modbus TCP device answered in last polling cycle", "gauge"},
+		{"modbus_source_cycles_total", "polling cycles of Modbus TCP device", "counter"},
+		{"modbus_source_errors_total", "polling cycles of Modbus TCP device with read error", "counter"},
+		{"modbus_source_retries_total", "repeated reads of Modbus TCP device", "counter"},
+		{"modbus_source_cycle_seconds", "duration of last polling cycle of Modbus TCP device", "gauge"},
+		{"mqtt_connected", "MQTT publisher of device is connected to broker", "gauge"},
+		{"mqtt_published_total", "messages published to MQTT broker", "counter"},
+		{"mqtt_dropped_total", "messages dropped on overflow of store-and-forward buffer", "counter"},
+		{"mqtt_buffered", "messages in store-and-forward buffer", "gauge"},
+		{"mqtt_buffered_bytes", "bytes of messages in store-and-forward queue on disk", "gauge"},
+		{"mqtt_spool_segments", "segment files of store-and-forward queue on disk", "gauge"},
+		{"tag_conversion_errors_total", "values of tags which can't be converted to ModBus registers", "counter"},
+	} {
+		if len(series[m.name]) == 0 {
+			continue
+		}
+		metricHeader(w, m.name, m.help, m.typ)
+		for _, s := range series[m.name] {
+			metric(w, m.name, s.labels, s.value)
+		}
+	}
+}
+
+func (a *httpAPI) writeSparkplugMetrics(w io.Writer) {
+	if a.Sparkplug == nil {
+		return
+	}
+	st := a.Sparkplug.Stats()
+	metricHeader(w, "sparkplug_connected", "Sparkplug edge node is connected to broker", "gauge")
+	metric(w, "sparkplug_connected", "", boolValue(st.Connected))
+	metricHeader(w, "sparkplug_bdseq", "birth/death sequence number of current connection", "gauge")
+	metric(w, "sparkplug_bdseq", "", float64(st.BdSeq))
+	metricHeader(w, "sparkplug_births_total", "NBIRTH messages (connections and rebirth requests)", "counter")
+	metric(w, "sparkplug_births_total", "", float64(st.Births))
+	metricHeader(w, "sparkplug_messages_total", "Sparkplug messages published", "counter")
+	metric(w, "sparkplug_messages_total", "", float64(st.Messages))
+	metricHeader(w, "sparkplug_commands_total", "NCMD and DCMD commands received", "counter")
+	metric(w, "sparkplug_commands_total", "", float64(st.Commands))
+}
+
+func (a *httpAPI) writeOPCUAServerMetrics(w io.Writer) {
+	if a.OPCUAServer == nil {
+		return
+	}
+	st := a.OPCUAServer.Stats()
+	metricHeader(w, "opcua_server_sessions", "sessions of clients of OPC UA server", "gauge")
+	metric(w, "opcua_server_sessions", "", float64(st.Sessions))
+	metricHeader(w, "opcua_server_subscriptions", "subscriptions of clients of OPC UA server", "gauge")
+	metric(w, "opcua_server_subscriptions", "", float64(st.Subscriptions))
+	metricHeader(w, "opcua_server_reads_total", "values of variables read by clients and sampled for subscriptions", "counter")
+	metric(w, "opcua_server_reads_total", "", float64(st.Reads))
+	metricHeader(w, "opcua_server_writes_total", "values of variables written by clients", "counter")
+	metric(w, "opcua_server_writes_total", "", float64(st.Writes))
+	metricHeader(w, "opcua_server_write_errors_total", "failed writes of variables to units", "counter")
+	metric(w, "opcua_server_write_errors_total", "", float64(st.WriteErrors))
+	metricHeader(w, "opcua_server_publishes_total", "notification messages sent to clients", "counter")
+	metric(w, "opcua_server_publishes_total", "", float64(st.Publishes))
+}
+
+// writeExpvarMetrics is writing integer counters of expvar map as gauges with label "name"
+func writeExpvarMetrics(w io.Writer, name, help string, m *expvar.Map) {
+	type kv struct {
+		key   string
+		value float64
+	}
+	var values []kv
+	m.Do(func(e expvar.KeyValue) {
+		v, err := strconv.ParseFloat(e.Value.String(), 64)
+		if err != nil {
+			return
+		}
+		values = append(values, kv{e.Key, v})
+	})
+	if len(values) == 0 {
+		return
+	}
+	metricHeader(w, name, help, "gauge")
+	for _, v := range values {
+		metric(w, name, labels("name", v.key), v.value)
+	}
+}
+
+func metricHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, typ)
+}
+
+func metric(w io.Writer, name, labels string, v float64) {
+	fmt.Fprintf(w, "%s%s%s %s\n", metricsPrefix, name, labels, formatFloat(v))
+}
+
+// labels is formatting label pairs: labels("unit", "1") is {unit="1"}
+func labels(kv ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kv[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(kv[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
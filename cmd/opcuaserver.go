@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"opcuaModbus/internal/clientmodbus"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"opcuaModbus/internal/serveropcua"
+
+	"github.com/sirupsen/logrus"
+)
+
+// startOPCUAServer is starting OPC UA server of units with variables of tags of devices
+func startOPCUAServer(ctx context.Context, logg *logrus.Logger, conf serveropcua.Config, mb *modbus.MBServer,
+	PLCs []clientopcua.DeviceOPCUA, sources []*clientmodbus.DeviceModbus) (*serveropcua.Server, error) {
+	srv := serveropcua.New(conf, mb, logg)
+	n := 0
+	for _, v := range opcuaVariables(logg, PLCs, sources) {
+		if err := srv.AddVariable(v); err != nil {
+			logg.Error("opcua server unit ", v.Unit, "/", v.Name, " error: ", err)
+			continue
+		}
+		n++
+	}
+	if err := srv.Start(ctx); err != nil {
+		return nil, err
+	}
+	logg.Info("opcua server variables: ", n)
+	return srv, nil
+}
+
+// opcuaVariables is variables of tags of OPC UA devices (tags tsv-files are read at start) and of
+// Modbus TCP devices, browse name of variable is alias or node of tag
+func opcuaVariables(logg *logrus.Logger, PLCs []clientopcua.DeviceOPCUA, sources []*clientmodbus.DeviceModbus) []serveropcua.Variable {
+	var vars []serveropcua.Variable
+	for i := range PLCs {
+		dvc := &PLCs[i]
+		if dvc.State().Status == clientopcua.Configured {
+			if err := dvc.ReadTagsTSV(); err != nil {
+				logg.Error(dvc.Config.Endpoint, " opcua server: error read tsv: ", err)
+				continue
+			}
+		}
+		for _, node := range dvc.Nodes {
+			tg := dvc.Tags[node]
+			vars = append(vars, serveropcua.Variable{Unit: dvc.MBUnitID, Name: tagName(node, tg.Alias), Tag: tg, Description: dvc.Name})
+		}
+	}
+	for _, dvc := range sources {
+		for _, node := range dvc.Nodes {
+			tg := dvc.Tags[node]
+			vars = append(vars, serveropcua.Variable{
+				Unit:        dvc.MBUnitID,
+				Name:        tagName(node, tg.Alias),
+				Tag:         tg.Tag,
+				Description: dvc.Name,
+				ReadOnly:    !tg.Writable(),
+			})
+		}
+	}
+	return vars
+}
+
+// tagName is alias of tag or node
+func tagName(node, alias string) string {
+	if alias != "" {
+		return alias
+	}
+	return node
+}
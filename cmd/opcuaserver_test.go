@@ -0,0 +1,49 @@
+package main
+
+import (
+	"opcuaModbus/internal/clientmodbus"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"opcuaModbus/internal/serveropcua"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOPCUAServer(t *testing.T) {
+	_, err := OPCUAServerConf{Port: 70000}.config()
+	require.Error(t, err)
+	_, err = OPCUAServerConf{Port: 4840, EndpointURL: "http://gw:4840"}.config()
+	require.Error(t, err)
+	conf, err := OPCUAServerConf{Host: " 0.0.0.0 ", Port: 4840}.config()
+	require.NoError(t, err)
+	require.Equal(t, serveropcua.Config{Host: "0.0.0.0", Port: 4840}, conf)
+	conf, err = OPCUAServerConf{Port: 4840, Writes: true}.config()
+	require.NoError(t, err)
+	require.True(t, conf.Writes)
+
+	tg, err := TagConf{Node: "ns=3;s=Temp", Type: "float32", Function: "input", Units: " °C "}.tag()
+	require.NoError(t, err)
+	require.Equal(t, "°C", tg.Units)
+	require.Equal(t, "°C", tagConf("ns=3;s=Temp", tg).Units)
+
+	plc := clientopcua.DeviceOPCUA{
+		Name:     "plc1",
+		MBUnitID: 1,
+		Status:   clientopcua.ReadTags,
+		Nodes:    []string{"ns=3;s=Temp"},
+		Tags:     map[string]clientopcua.Tag{"ns=3;s=Temp": {Alias: "temp", TypeData: "float32", MBfunc: modbus.ReadInputRegisters}},
+	}
+	src := &clientmodbus.DeviceModbus{Name: "meter", MBUnitID: 2}
+	require.NoError(t, src.AddTag("holding:0", clientopcua.Tag{TypeData: "int16", MBfunc: modbus.ReadHoldingRegisters, MBaddr: 5, Write: true}))
+	require.NoError(t, src.AddTag("input:0", clientopcua.Tag{TypeData: "int16", MBfunc: modbus.ReadHoldingRegisters, MBaddr: 6}))
+
+	vars := opcuaVariables(logrus.New(), []clientopcua.DeviceOPCUA{plc}, []*clientmodbus.DeviceModbus{src})
+	require.Len(t, vars, 3)
+	require.Equal(t, serveropcua.Variable{Unit: 1, Name: "temp", Tag: plc.Tags["ns=3;s=Temp"], Description: "plc1"}, vars[0])
+	require.Equal(t, "holding:0", vars[1].Name)
+	require.False(t, vars[1].ReadOnly)
+	require.Equal(t, "input:0", vars[2].Name)
+	require.True(t, vars[2].ReadOnly)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/mqtt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+// publish is publishing data value of tag to MQTT broker and Sparkplug edge node (if configured)
+func (srv *serv) publish(node string, dv *ua.DataValue) {
+	if dv == nil {
+		return
+	}
+	srv.publishSparkplug(node, dv)
+	srv.publishMQTT(node, dv)
+}
+
+// publishMQTT is publishing data value of tag to MQTT broker (if configured)
+func (srv *serv) publishMQTT(node string, dv *ua.DataValue) {
+	if srv.MQTT == nil {
+		return
+	}
+	dvc := srv.OPCUAClients
+	tag := node
+	if a := dvc.Tags[node].Alias; a != "" {
+		tag = a
+	}
+
+	p := mqtt.Payload{
+		Quality:   clientopcua.Quality(dv.Status),
+		Status:    clientopcua.StatusName(dv.Status),
+		Timestamp: time.Now(),
+	}
+	if dv.Value != nil {
+		p.Value = clientopcua.JSONValue(dv.Value.Value())
+	}
+	if !dv.SourceTimestamp.IsZero() {
+		p.SourceTime = &dv.SourceTimestamp
+	}
+	if !dv.ServerTimestamp.IsZero() {
+		p.ServerTime = &dv.ServerTimestamp
+	}
+	_ = srv.MQTT.PublishValue(tag, node, p)
+}
+
+// lastValues is last values & statuses of tags read by polling (and initial read), only changes are published
+type lastValues struct {
+	mu    sync.Mutex
+	nodes map[string]lastValue
+}
+
+type lastValue struct {
+	value  interface{}
+	status ua.StatusCode
+}
+
+func newLastValues() *lastValues {
+	return &lastValues{nodes: map[string]lastValue{}}
+}
+
+// changed is storing value & status of tag, returns true if they differ from last ones
+// (nil lastValues - every value is changed)
+func (l *lastValues) changed(node string, dv *ua.DataValue) bool {
+	if l == nil {
+		return true
+	}
+	v := lastValue{status: dv.Status}
+	if dv.Value != nil {
+		v.value = dv.Value.Value()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if old, ok := l.nodes[node]; ok && old.status == v.status && reflect.DeepEqual(old.value, v.value) {
+		return false
+	}
+	l.nodes[node] = v
+	return true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"opcuaModbus/internal/mqtt"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLastValues(t *testing.T) {
+	dv := func(v interface{}, st ua.StatusCode) *ua.DataValue {
+		return &ua.DataValue{Value: ua.MustVariant(v), Status: st}
+	}
+
+	last := newLastValues()
+	require.True(t, last.changed("ns=3;s=Temp", dv(float32(21.5), ua.StatusOK)))
+	require.False(t, last.changed("ns=3;s=Temp", dv(float32(21.5), ua.StatusOK)))
+	require.True(t, last.changed("ns=3;s=Temp", dv(float32(21.5), ua.StatusUncertain)), "status changed")
+	require.True(t, last.changed("ns=3;s=Temp", dv(float32(22), ua.StatusUncertain)), "value changed")
+	require.True(t, last.changed("ns=3;s=Level", dv(float32(22), ua.StatusUncertain)), "other tag")
+	require.True(t, last.changed("ns=3;s=Run", &ua.DataValue{Status: ua.StatusBadNodeIDUnknown}))
+	require.False(t, last.changed("ns=3;s=Run", &ua.DataValue{Status: ua.StatusBadNodeIDUnknown}))
+
+	var all *lastValues
+	require.True(t, all.changed("ns=3;s=Temp", dv(float32(21.5), ua.StatusOK)))
+	require.True(t, all.changed("ns=3;s=Temp", dv(float32(21.5), ua.StatusOK)))
+}
+
+func TestHandlerReadStatus(t *testing.T) {
+	mb := modbus.NewServer(logrus.New(), "127.0.0.1", 0)
+	mb.AddDevice(3)
+	pub, err := mqtt.New(mqtt.Config{Broker: "tcp://127.0.0.1:1"}, "plc1", "3", logrus.New())
+	require.NoError(t, err)
+	srv := &serv{
+		MBServer: mb,
+		OPCUAClients: &clientopcua.DeviceOPCUA{
+			MBUnitID: 3,
+			Results:  clientopcua.NewResults(),
+			Nodes:    []string{"ns=3;s=Level"},
+			Tags:     map[string]clientopcua.Tag{"ns=3;s=Level": {TypeData: "uint16", MBfunc: modbus.ReadInputRegisters, MBaddr: 5}},
+		},
+		MQTT: pub,
+		last: newLastValues(),
+	}
+
+	// polling: good -> bad (no value) -> bad -> good
+	srv.handlerRead("ns=3;s=Level", &ua.DataValue{Value: ua.MustVariant(uint16(7)), Status: ua.StatusOK})
+	srv.handlerRead("ns=3;s=Level", &ua.DataValue{Status: ua.StatusBadCommunicationError})
+	srv.handlerRead("ns=3;s=Level", &ua.DataValue{Status: ua.StatusBadCommunicationError})
+	regs, _ := mb.Read(3, modbus.ReadInputRegisters, 5, 1)
+	require.Equal(t, []uint16{7}, regs, "bad value is not written")
+	srv.handlerRead("ns=3;s=Level", &ua.DataValue{Value: ua.MustVariant(uint16(7)), Status: ua.StatusOK})
+	require.Equal(t, 3, pub.Stats().Buffered, "good, bad and good are published")
+
+	// subscription: data change with bad status
+	srv.handlerOPCUA("ns=3;s=Level", &ua.DataValue{Status: ua.StatusBadNoCommunication})
+	require.Equal(t, 4, pub.Stats().Buffered)
+	res, _ := srv.OPCUAClients.Results.Get("ns=3;s=Level")
+	require.Equal(t, ua.StatusBadNoCommunication, res.Status)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"opcuaModbus/internal/secrets"
+	"os"
+	"sort"
+	"strings"
+)
+
+// secretCmd is subcommand managing encrypted secrets vault
+//
+//	opcuaModbus secret -vault secrets.vault set plc1   (value from stdin)
+//	opcuaModbus secret -vault secrets.vault list
+//	opcuaModbus secret -vault secrets.vault delete plc1
+//
+// master key is read from -master-key-file or OPCUAMODBUS_MASTER_KEY.
+func secretCmd(args []string) error {
+	fs := flag.NewFlagSet("secret", flag.ContinueOnError)
+	vaultFile := fs.String("vault", "secrets.vault", "vault file")
+	keyFile := fs.String("master-key-file", "", "file with master key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := secrets.MasterKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	vault, err := secrets.OpenVault(*vaultFile, key)
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "set":
+		name := fs.Arg(1)
+		if name == "" {
+			return errors.New("empty name")
+		}
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && value == "" {
+			return err
+		}
+		vault[name] = strings.TrimRight(value, "\r\n")
+		return secrets.SaveVault(*vaultFile, key, vault)
+
+	case "delete":
+		delete(vault, fs.Arg(1))
+		return secrets.SaveVault(*vaultFile, key, vault)
+
+	case "list":
+		names := make([]string, 0, len(vault))
+		for n := range vault {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Println(n)
+		}
+		return nil
+
+	default:
+		return errors.New("usage: secret [-vault file] set|delete|list [name]")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"opcuaModbus/internal/clientmodbus"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"opcuaModbus/internal/mqtt"
+	"opcuaModbus/internal/sparkplug"
+	"reflect"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// source is Modbus TCP device mapped to ModBus server and published northbound
+type source struct {
+	MBServer  *modbus.MBServer
+	Device    *clientmodbus.DeviceModbus
+	MQTT      *mqtt.Publisher     // nil - not published
+	Sparkplug *sparkplug.EdgeNode // nil - Sparkplug disabled
+}
+
+// startSource is polling Modbus TCP device until ctx is done
+func startSource(ctx context.Context, logg *logrus.Logger, src *source) {
+	dvc := src.Device
+	if src.Sparkplug != nil {
+		src.Sparkplug.AddDevice(sparkplug.DeviceID(dvc.Name), sourceMetrics(dvc), nil)
+	}
+	// one connection to device for polling and writes of masters
+	client := dvc.Client()
+	defer client.Close()
+	src.MBServer.AddWriteHandler(dvc.MBUnitID, sourceWriteHandler(logg, src.MBServer, dvc, client))
+
+	// last is last values of tags, only changes are published
+	last := map[string]interface{}{}
+	dvc.Poll(ctx, logg, client, func(node string, v interface{}) {
+		tag := dvc.Tags[node]
+		if !writeValue(src.MBServer, dvc.MBUnitID, tag.MBfunc, tag.MBaddr, v) {
+			logg.Debug(dvc.Name, "/", node, " can't convert ", v, " to ", modbus.FunctionName(tag.MBfunc))
+		}
+		if old, ok := last[node]; ok && reflect.DeepEqual(old, v) {
+			return
+		}
+		last[node] = v
+		src.publish(node, v)
+	}, func(ready bool) {
+		src.MBServer.SetReady(dvc.MBUnitID, ready)
+		if src.Sparkplug == nil {
+			return
+		}
+		if ready {
+			src.Sparkplug.Birth(sparkplug.DeviceID(dvc.Name))
+		} else {
+			src.Sparkplug.Death(sparkplug.DeviceID(dvc.Name))
+		}
+	})
+}
+
+// sourceWriteHandler is handler of writes of master (ModBus master, OPC UA server of gateway) to coils &
+// holding registers of tags of Modbus device: value of tag is written to device by function of tag on device
+// (coil of unit to holding register of device as 1/0, register of unit to coil of device as != 0),
+// ModBus registers are updated after successful write
+func sourceWriteHandler(logg *logrus.Logger, mb *modbus.MBServer, dvc *clientmodbus.DeviceModbus, client *clientmodbus.Client) modbus.WriteHandler {
+	return func(function uint8, address uint16, values []uint16) modbus.Exception {
+		coils := function == modbus.WriteSingleCoil || function == modbus.WriteMultipleCoils
+		table := modbus.ReadHoldingRegisters
+		if coils {
+			table = modbus.ReadCoils
+		}
+
+		// every address must be served by writable tags
+		start, end := int(address), int(address)+len(values)
+		covered := make([]bool, len(values))
+		var nodes []string
+		for _, n := range dvc.Nodes {
+			tg := dvc.Tags[n]
+			cnt := tg.Registers()
+			if tg.MBfunc != table || !tg.Writable() || int(tg.MBaddr)+cnt <= start || int(tg.MBaddr) >= end {
+				continue
+			}
+			nodes = append(nodes, n)
+			for a := int(tg.MBaddr); a < int(tg.MBaddr)+cnt; a++ {
+				if a >= start && a < end {
+					covered[a-start] = true
+				}
+			}
+		}
+		for _, c := range covered {
+			if !c {
+				return modbus.IllegalDataAddress
+			}
+		}
+
+		for _, n := range nodes {
+			tg := dvc.Tags[n]
+			// registers of tag in unit: value of coil or holding registers
+			var regs []uint16
+			if coils {
+				regs = []uint16{values[int(tg.MBaddr)-start]}
+			} else {
+				regs = tagRegisters(mb, dvc.MBUnitID, tg.Tag, address, values)
+			}
+
+			var err error
+			if tg.Function == modbus.ReadCoils {
+				err = client.WriteCoils(tg.Address, []bool{nonZero(regs)})
+			} else {
+				dev := regs
+				if coils {
+					// bool of coil is 1/0 in last (low) register of tag on device
+					dev = make([]uint16, tg.Count())
+					if nonZero(regs) {
+						dev[len(dev)-1] = 1
+					}
+				}
+				err = client.WriteRegisters(tg.Address, dev)
+			}
+			if err == nil {
+				if coils {
+					mb.WriteCoils(dvc.MBUnitID, tg.MBaddr, nonZero(regs))
+				} else {
+					for i, r := range regs {
+						mb.WriteHoldingRegisters(dvc.MBUnitID, tg.MBaddr+uint16(i), r)
+					}
+				}
+			}
+			if err != nil {
+				logg.Error(dvc.Name, "/", n, " write by master error: ", err)
+				return modbus.SlaveDeviceFailure
+			}
+			logg.Info(dvc.Name, "/", n, " written by master: ", values)
+		}
+		return modbus.Success
+	}
+}
+
+// nonZero is true if any register is not 0
+func nonZero(regs []uint16) bool {
+	for _, r := range regs {
+		if r != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// publish is publishing changed value of tag to MQTT broker and Sparkplug edge node (if configured)
+func (src *source) publish(node string, v interface{}) {
+	name := node
+	if a := src.Device.Tags[node].Alias; a != "" {
+		name = a
+	}
+	if src.MQTT != nil {
+		_ = src.MQTT.PublishValue(name, node, mqtt.Payload{
+			Value:     clientopcua.JSONValue(v),
+			Quality:   "good",
+			Status:    "Good",
+			Timestamp: time.Now(),
+		})
+	}
+	if src.Sparkplug != nil {
+		q := sparkplug.QualityGood
+		src.Sparkplug.Data(sparkplug.DeviceID(src.Device.Name), sparkplug.Metric{Name: name, Timestamp: time.Now(), Value: v, Quality: &q})
+	}
+}
+
+// sourceMetrics is Sparkplug metric definitions of tags of Modbus device, alias is index of tag + 1
+func sourceMetrics(dvc *clientmodbus.DeviceModbus) []sparkplug.Metric {
+	var defs []sparkplug.Metric
+	for i, node := range dvc.Nodes {
+		tag := dvc.Tags[node]
+		dt := sparkplug.TypeOf(tag.TypeData)
+		if tag.Function == modbus.ReadCoils || tag.Function == modbus.ReadDiscreteInputs {
+			dt = sparkplug.Boolean
+		}
+		if dt == 0 {
+			continue
+		}
+		name := node
+		if tag.Alias != "" {
+			name = tag.Alias
+		}
+		defs = append(defs, sparkplug.Metric{Name: name, Alias: uint64(i + 1), DataType: dt})
+	}
+	return defs
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+	"opcuaModbus/internal/clientmodbus"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceWriteHandler(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	device := modbus.NewServer(logrus.New(), "127.0.0.1", ln.Addr().(*net.TCPAddr).Port)
+	device.AddDevice(7)
+	device.AddWriteHandler(7, func(function uint8, address uint16, values []uint16) modbus.Exception {
+		for i, v := range values {
+			switch function {
+			case modbus.WriteMultipleRegisters:
+				device.WriteHoldingRegisters(7, address+uint16(i), v)
+			case modbus.WriteMultipleCoils:
+				device.WriteCoils(7, address+uint16(i), v != 0)
+			default:
+				return modbus.IllegalFunction
+			}
+		}
+		return modbus.Success
+	})
+	go device.Listen()
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+
+	mb := modbus.NewServer(logrus.New(), "127.0.0.1", 0)
+	mb.AddDevice(30)
+	dvc := &clientmodbus.DeviceModbus{Name: "io", MBUnitID: 30, Config: clientmodbus.Config{Address: addr, UnitID: 7}}
+	// coil of unit -> holding register of device, holding register of unit -> coil of device
+	require.NoError(t, dvc.AddTag("holding:10", clientopcua.Tag{TypeData: "bool", MBfunc: modbus.ReadCoils, MBaddr: 1, Write: true}))
+	require.NoError(t, dvc.AddTag("coil:3", clientopcua.Tag{TypeData: "uint16", MBfunc: modbus.ReadHoldingRegisters, MBaddr: 20, Write: true}))
+	require.NoError(t, dvc.AddTag("holding:11", clientopcua.Tag{TypeData: "uint16", MBfunc: modbus.ReadHoldingRegisters, MBaddr: 21, Write: true}))
+	client := dvc.Client()
+	defer client.Close()
+	handler := sourceWriteHandler(logrus.New(), mb, dvc, client)
+
+	require.Equal(t, modbus.Success, handler(modbus.WriteSingleCoil, 1, []uint16{1}))
+	require.Equal(t, modbus.Success, handler(modbus.WriteSingleRegister, 20, []uint16{5}))
+	require.Equal(t, modbus.Success, handler(modbus.WriteSingleRegister, 21, []uint16{0x1234}))
+
+	regs, _ := device.Read(7, modbus.ReadHoldingRegisters, 10, 2)
+	require.Equal(t, []uint16{1, 0x1234}, regs)
+	bits, _ := device.Read(7, modbus.ReadCoils, 3, 1)
+	require.Equal(t, []uint16{1}, bits)
+	unit, _ := mb.Read(30, modbus.ReadCoils, 1, 1)
+	require.Equal(t, []uint16{1}, unit)
+	unit, _ = mb.Read(30, modbus.ReadHoldingRegisters, 20, 2)
+	require.Equal(t, []uint16{5, 0x1234}, unit)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"opcuaModbus/internal/sparkplug"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/sirupsen/logrus"
+)
+
+// qualities is Sparkplug quality codes by quality of OPC UA status
+var qualities = map[string]int32{
+	"good":      sparkplug.QualityGood,
+	"uncertain": sparkplug.QualityUncertain,
+	"bad":       sparkplug.QualityBad,
+}
+
+// metricName is name of Sparkplug metric of tag: alias or node
+func metricName(dvc *clientopcua.DeviceOPCUA, node string) string {
+	if a := dvc.Tags[node].Alias; a != "" {
+		return a
+	}
+	return node
+}
+
+// sparkplugMetrics is metric definitions of tags of device, alias of metric is index of tag + 1
+func sparkplugMetrics(dvc *clientopcua.DeviceOPCUA) []sparkplug.Metric {
+	var defs []sparkplug.Metric
+	for i, node := range dvc.Nodes {
+		dt := sparkplug.TypeOf(dvc.Tags[node].TypeData)
+		if dt == 0 {
+			continue
+		}
+		defs = append(defs, sparkplug.Metric{Name: metricName(dvc, node), Alias: uint64(i + 1), DataType: dt})
+	}
+	return defs
+}
+
+// sparkplugCommand is handler of DCMD: metrics are written to tags of device
+func sparkplugCommand(logg *logrus.Logger, mb *modbus.MBServer, dvc *clientopcua.DeviceOPCUA) sparkplug.CommandHandler {
+	return func(device string, metrics []sparkplug.Metric) {
+		for _, m := range metrics {
+			node, tag, ok := dvc.FindTag(m.Name)
+			if !ok {
+				logg.Warn("sparkplug DCMD ", device, ": unknown metric ", m.Name)
+				continue
+			}
+			var raw interface{} = m.Value
+			switch v := m.Value.(type) {
+			case int64, uint64:
+				raw = json.Number(fmt.Sprint(v))
+			}
+			v, err := clientopcua.ParseValue(tag.TypeData, raw)
+			if err == nil {
+				err = writeTagValue(mb, dvc, node, v)
+			}
+			if err != nil {
+				logg.Error("sparkplug DCMD ", device, "/", m.Name, " error: ", err)
+				continue
+			}
+			logg.Info("sparkplug DCMD ", device, "/", m.Name, " = ", v)
+		}
+	}
+}
+
+// addSparkplugDevice is registering Sparkplug device of tags of device, called once after tags are read:
+// registering again is resetting online state and last values of metrics
+func addSparkplugDevice(logg *logrus.Logger, edge *sparkplug.EdgeNode, mb *modbus.MBServer, dvc *clientopcua.DeviceOPCUA) {
+	edge.AddDevice(sparkplug.DeviceID(dvc.Name), sparkplugMetrics(dvc), sparkplugCommand(logg, mb, dvc))
+}
+
+// setReady is setting ready state of ModBus unit of device, Sparkplug device is born or dead
+func (srv *serv) setReady(ready bool) {
+	dvc := srv.OPCUAClients
+	srv.MBServer.SetReady(dvc.MBUnitID, ready)
+	if srv.Sparkplug == nil {
+		return
+	}
+	if ready {
+		srv.Sparkplug.Birth(sparkplug.DeviceID(dvc.Name))
+	} else {
+		srv.Sparkplug.Death(sparkplug.DeviceID(dvc.Name))
+	}
+}
+
+// publishSparkplug is publishing data value of tag as Sparkplug metric (DDATA)
+func (srv *serv) publishSparkplug(node string, dv *ua.DataValue) {
+	if srv.Sparkplug == nil {
+		return
+	}
+	q := qualities[clientopcua.Quality(dv.Status)]
+	m := sparkplug.Metric{
+		Name:      metricName(srv.OPCUAClients, node),
+		Timestamp: dv.SourceTimestamp,
+		Quality:   &q,
+	}
+	if dv.Value != nil {
+		m.Value = dv.Value.Value()
+	}
+	srv.Sparkplug.Data(sparkplug.DeviceID(srv.OPCUAClients.Name), m)
+}
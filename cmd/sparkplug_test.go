@@ -0,0 +1,36 @@
+package main
+
+import (
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/secrets"
+	"opcuaModbus/internal/sparkplug"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSparkplug(t *testing.T) {
+	conf, err := SparkplugConf{}.config(&secrets.Resolver{})
+	require.NoError(t, err)
+	require.Empty(t, conf.Broker)
+	_, err = SparkplugConf{Broker: "tcp://localhost:1883", GroupID: "plant"}.config(&secrets.Resolver{})
+	require.Error(t, err)
+	_, err = SparkplugConf{Broker: "tcp://localhost:1883", GroupID: "plant/1", EdgeNodeID: "gw1"}.config(&secrets.Resolver{})
+	require.Error(t, err)
+	conf, err = SparkplugConf{Broker: " tcp://localhost:1883 ", GroupID: "plant", EdgeNodeID: "gw1"}.config(&secrets.Resolver{})
+	require.NoError(t, err)
+	require.Equal(t, "tcp://localhost:1883", conf.Broker)
+
+	dvc := &clientopcua.DeviceOPCUA{
+		Nodes: []string{"ns=3;s=Temp", "ns=3;s=Name", "ns=3;s=Run"},
+		Tags: map[string]clientopcua.Tag{
+			"ns=3;s=Temp": {Alias: "temp", TypeData: "float32"},
+			"ns=3;s=Name": {TypeData: "string"},
+			"ns=3;s=Run":  {TypeData: "bool"},
+		},
+	}
+	require.Equal(t, []sparkplug.Metric{
+		{Name: "temp", Alias: 1, DataType: sparkplug.Float},
+		{Name: "ns=3;s=Run", Alias: 3, DataType: sparkplug.Boolean},
+	}, sparkplugMetrics(dvc))
+}
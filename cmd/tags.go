@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tagWriteTimeout is timeout of write of tag to server
+const tagWriteTimeout = 5 * time.Second
+
+// tagWriteHandler is handler of writes of master to coils & holding registers of writable tags:
+// registers are converted to value of tag type and written to node,
+// ModBus registers are updated after successful write
+func tagWriteHandler(logg *logrus.Logger, mb *modbus.MBServer, dvc *clientopcua.DeviceOPCUA) modbus.WriteHandler {
+	return func(function uint8, address uint16, values []uint16) modbus.Exception {
+		coils := function == modbus.WriteSingleCoil || function == modbus.WriteMultipleCoils
+		table := modbus.ReadHoldingRegisters
+		if coils {
+			table = modbus.ReadCoils
+		}
+
+		// every address must be served by writable tags
+		start, end := int(address), int(address)+len(values)
+		covered := make([]bool, len(values))
+		var nodes []string
+		for _, n := range dvc.Nodes {
+			tg := dvc.Tags[n]
+			cnt := tg.Registers()
+			if tg.MBfunc != table || !tg.Writable() || cnt == 0 || int(tg.MBaddr)+cnt <= start || int(tg.MBaddr) >= end {
+				continue
+			}
+			nodes = append(nodes, n)
+			for a := int(tg.MBaddr); a < int(tg.MBaddr)+cnt; a++ {
+				if a >= start && a < end {
+					covered[a-start] = true
+				}
+			}
+		}
+		for _, c := range covered {
+			if !c {
+				return modbus.IllegalDataAddress
+			}
+		}
+
+		for _, n := range nodes {
+			tg := dvc.Tags[n]
+			var v interface{}
+			if coils {
+				v = values[int(tg.MBaddr)-start] != 0
+			} else {
+				var err error
+				if v, err = clientopcua.FromRegisters(tg.TypeData, tagRegisters(mb, dvc.MBUnitID, tg, address, values)); err != nil {
+					logg.Error(dvc.State().Endpoint, "/", n, " write by ModBus master error: ", err)
+					return modbus.IllegalDataValue
+				}
+			}
+			if err := writeTagValue(mb, dvc, n, v); err != nil {
+				logg.Error(dvc.State().Endpoint, "/", n, " write by ModBus master error: ", err)
+				return modbus.SlaveDeviceFailure
+			}
+			logg.Info(dvc.State().Endpoint, "/", n, " written by ModBus master: ", v)
+		}
+		return modbus.Success
+	}
+}
+
+// tagRegisters is returns holding registers of tag: current values overlaid with written values
+func tagRegisters(mb *modbus.MBServer, unit modbus.UnitID, tg clientopcua.Tag, address uint16, values []uint16) []uint16 {
+	regs := make([]uint16, tg.Registers())
+	mb.Devices[unit].RWHoldingRegisters.RLock()
+	for i := range regs {
+		regs[i] = mb.Devices[unit].HoldingRegisters[tg.MBaddr+uint16(i)]
+	}
+	mb.Devices[unit].RWHoldingRegisters.RUnlock()
+
+	for i, v := range values {
+		if a := int(address) + i - int(tg.MBaddr); a >= 0 && a < len(regs) {
+			regs[a] = v
+		}
+	}
+	return regs
+}
+
+// writeTagValue is writing value of tag to server and then to ModBus registers of tag
+// (write path of ModBus masters and REST API)
+func writeTagValue(mb *modbus.MBServer, dvc *clientopcua.DeviceOPCUA, node string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), tagWriteTimeout)
+	defer cancel()
+	if err := dvc.WriteTag(ctx, node, v); err != nil {
+		return err
+	}
+	(&serv{MBServer: mb, OPCUAClients: dvc}).writeTag(node, v)
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"opcuaModbus/internal/pki"
+)
+
+// trustCmd is subcommand managing trust store of server certificates ([pki] directory)
+//
+//	opcuaModbus -config config.toml trust list
+//	opcuaModbus -config config.toml trust accept <thumbprint>   rejected/ -> trusted/
+//	opcuaModbus -config config.toml trust reject <thumbprint>   trusted/ -> rejected/
+//	opcuaModbus -config config.toml trust add <cert file>
+func trustCmd(args []string) error {
+	config, err := NewConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if config.PKI.Directory == "" {
+		return errors.New("[pki] directory not configured")
+	}
+	store, err := pki.NewStore(config.PKI.Directory)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	arg := ""
+	if len(args) > 1 {
+		arg = args[1]
+	}
+
+	var file string
+	switch args[0] {
+	case "list":
+		for _, sub := range []string{pki.Rejected, pki.Trusted, pki.Issuers} {
+			list, err := store.List(sub)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s:\n", sub)
+			for _, e := range list {
+				fmt.Printf("  %s  %s  (until %s)\n", e.Thumbprint, e.Subject, e.NotAfter.Format("2006-01-02"))
+			}
+		}
+		return nil
+	case "accept":
+		file, err = store.Trust(arg)
+	case "reject":
+		file, err = store.Reject(arg)
+	case "add":
+		file, err = store.Add(arg)
+	default:
+		return errors.New("usage: trust list|accept <thumbprint>|reject <thumbprint>|add <file>")
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(file)
+	return nil
+}
@@ -0,0 +1,224 @@
+package clientmodbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"opcuaModbus/internal/modbus"
+	"sync"
+	"time"
+)
+
+// limits of quantity in one read or write request
+const (
+	MaxReadRegisters  = 125
+	MaxReadBits       = 2000
+	MaxWriteRegisters = 123
+	MaxWriteBits      = 1968
+)
+
+// ExceptionError is exception response of device
+type ExceptionError struct {
+	Function  uint8
+	Exception modbus.Exception
+}
+
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("exception %s (0x%02x), function %d", e.Exception, uint8(e.Exception), e.Function)
+}
+
+// Client is Modbus TCP master of one device (unit), connection is opened on first request
+// and closed on error, requests are serialized
+type Client struct {
+	Address string // host:port
+	UnitID  modbus.UnitID
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	tid  uint16
+}
+
+// NewClient is creating client of device
+func NewClient(address string, unit modbus.UnitID, timeout time.Duration) *Client {
+	return &Client{Address: address, UnitID: unit, Timeout: timeout}
+}
+
+// ReadRegisters is reading holding or input registers
+func (c *Client) ReadRegisters(function uint8, address, quantity uint16) ([]uint16, error) {
+	if function != modbus.ReadHoldingRegisters && function != modbus.ReadInputRegisters {
+		return nil, fmt.Errorf("function %d is not read of registers", function)
+	}
+	if quantity == 0 || quantity > MaxReadRegisters {
+		return nil, fmt.Errorf("quantity of registers %d: must be 1..%d", quantity, MaxReadRegisters)
+	}
+	data, err := c.Request(readPDU(function, address, quantity))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 1+2*int(quantity) || int(data[0]) != 2*int(quantity) {
+		return nil, fmt.Errorf("bad length of response: %d bytes for %d registers", len(data), quantity)
+	}
+	regs := make([]uint16, quantity)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(data[1+2*i:])
+	}
+	return regs, nil
+}
+
+// ReadBits is reading coils or discrete inputs
+func (c *Client) ReadBits(function uint8, address, quantity uint16) ([]bool, error) {
+	if function != modbus.ReadCoils && function != modbus.ReadDiscreteInputs {
+		return nil, fmt.Errorf("function %d is not read of bits", function)
+	}
+	if quantity == 0 || quantity > MaxReadBits {
+		return nil, fmt.Errorf("quantity of bits %d: must be 1..%d", quantity, MaxReadBits)
+	}
+	data, err := c.Request(readPDU(function, address, quantity))
+	if err != nil {
+		return nil, err
+	}
+	n := (int(quantity) + 7) / 8
+	if len(data) != 1+n || int(data[0]) != n {
+		return nil, fmt.Errorf("bad length of response: %d bytes for %d bits", len(data), quantity)
+	}
+	bits := make([]bool, quantity)
+	for i := range bits {
+		bits[i] = data[1+i/8]&(1<<(i%8)) != 0
+	}
+	return bits, nil
+}
+
+// WriteRegisters is writing holding registers (function WriteMultipleRegisters)
+func (c *Client) WriteRegisters(address uint16, values []uint16) error {
+	if len(values) == 0 || len(values) > MaxWriteRegisters {
+		return fmt.Errorf("quantity of registers %d: must be 1..%d", len(values), MaxWriteRegisters)
+	}
+	pdu := writePDU(modbus.WriteMultipleRegisters, address, uint16(len(values)), 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(pdu[6+2*i:], v)
+	}
+	return c.write(pdu)
+}
+
+// WriteCoils is writing coils (function WriteMultipleCoils)
+func (c *Client) WriteCoils(address uint16, values []bool) error {
+	if len(values) == 0 || len(values) > MaxWriteBits {
+		return fmt.Errorf("quantity of bits %d: must be 1..%d", len(values), MaxWriteBits)
+	}
+	pdu := writePDU(modbus.WriteMultipleCoils, address, uint16(len(values)), (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			pdu[6+i/8] |= 1 << (i % 8)
+		}
+	}
+	return c.write(pdu)
+}
+
+// write is sending write request, response is echo of address and quantity
+func (c *Client) write(pdu []byte) error {
+	data, err := c.Request(pdu)
+	if err != nil {
+		return err
+	}
+	if len(data) != 4 || binary.BigEndian.Uint16(data) != binary.BigEndian.Uint16(pdu[1:]) ||
+		binary.BigEndian.Uint16(data[2:]) != binary.BigEndian.Uint16(pdu[3:]) {
+		return fmt.Errorf("bad response of write: % x", data)
+	}
+	return nil
+}
+
+// Request is sending request PDU (function & data) and returns data of response PDU,
+// exception response is *ExceptionError
+func (c *Client) Request(pdu []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		conn, err := net.DialTimeout("tcp", c.Address, c.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+
+	resp, err := c.exchange(pdu)
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return nil, err
+	}
+	if resp[0] == pdu[0]|0x80 {
+		if len(resp) < 2 {
+			return nil, fmt.Errorf("bad exception response")
+		}
+		return nil, &ExceptionError{Function: pdu[0], Exception: modbus.Exception(resp[1])}
+	}
+	if resp[0] != pdu[0] {
+		return nil, fmt.Errorf("function of response %d, expected %d", resp[0], pdu[0])
+	}
+	return resp[1:], nil
+}
+
+// Close is closing connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// exchange is writing request ADU and reading response PDU of same transaction, c.mu is locked
+func (c *Client) exchange(pdu []byte) ([]byte, error) {
+	if c.Timeout > 0 {
+		_ = c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+	c.tid++
+	adu := make([]byte, 7, 7+len(pdu))
+	binary.BigEndian.PutUint16(adu[0:], c.tid)
+	binary.BigEndian.PutUint16(adu[4:], uint16(len(pdu)+1))
+	adu[6] = byte(c.UnitID)
+	adu = append(adu, pdu...)
+	if _, err := c.conn.Write(adu); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 2 || length > 254 {
+		return nil, fmt.Errorf("bad length of response: %d", length)
+	}
+	resp := make([]byte, length-1)
+	if _, err := io.ReadFull(c.conn, resp); err != nil {
+		return nil, err
+	}
+	if tid := binary.BigEndian.Uint16(header[0:]); tid != c.tid {
+		return nil, fmt.Errorf("transaction id of response %d, expected %d", tid, c.tid)
+	}
+	return resp, nil
+}
+
+func readPDU(function uint8, address, quantity uint16) []byte {
+	pdu := []byte{function, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], quantity)
+	return pdu
+}
+
+// writePDU is header of write request with n bytes of values
+func writePDU(function uint8, address, quantity uint16, n int) []byte {
+	pdu := make([]byte, 6+n)
+	pdu[0] = function
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], quantity)
+	pdu[5] = byte(n)
+	return pdu
+}
@@ -0,0 +1,173 @@
+// Package clientmodbus is polling Modbus TCP devices (southbound): tags of device are read
+// in blocks and mapped to units of ModBus server of gateway like tags of OPC UA devices
+package clientmodbus
+
+import (
+	"fmt"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind is kind of Modbus TCP device in plc.tsv (column 1) and devices config
+const Kind = "modbus"
+
+// defaults of Config
+const (
+	DefaultPollInterval = time.Second
+	DefaultTimeout      = time.Second
+	DefaultRetries      = 1
+)
+
+// Config is configuration of polling of device
+type Config struct {
+	Address      string        // host:port
+	UnitID       modbus.UnitID // unit id of device (slave id)
+	PollInterval time.Duration
+	Timeout      time.Duration // timeout of request
+	Retries      int           // retries of failed request (not of exception)
+	MaxRegisters uint16        // max registers per read, 0 - 125
+	MaxBits      uint16        // max coils/discrete inputs per read, 0 - 2000
+	MaxGap       uint16        // max unused registers/bits between tags in one read
+}
+
+// Tag is tag of Modbus device: source Function & Address on device, MBfunc & MBaddr in ModBus server
+type Tag struct {
+	clientopcua.Tag
+	Function uint8
+	Address  uint16
+}
+
+// Count is number of registers (or bits) of tag on device
+func (tg Tag) Count() uint16 {
+	if tg.Function == modbus.ReadCoils || tg.Function == modbus.ReadDiscreteInputs {
+		return 1
+	}
+	return uint16(clientopcua.RegisterCount(tg.TypeData))
+}
+
+// Writable is true if tag is mapped to coils or holding registers of unit and of device
+func (tg Tag) Writable() bool {
+	return tg.Tag.Writable() && (tg.Function == modbus.ReadCoils || tg.Function == modbus.ReadHoldingRegisters)
+}
+
+// Stats is diagnostics of polling
+type Stats struct {
+	Connected bool
+	Cycles    uint64
+	Errors    uint64
+	Retries   uint64
+	LastCycle time.Duration
+	LastError string
+}
+
+// DeviceModbus is Modbus TCP device mapped to unit MBUnitID of ModBus server
+type DeviceModbus struct {
+	Name     string
+	Config   Config
+	MBUnitID modbus.UnitID
+	Nodes    []string // tags in order of configuration ("holding:100")
+	Tags     map[string]Tag
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// ParseAddress is parsing address of tag on device: "function:address", e.g. "holding:100", "coil:5", "4:10"
+func ParseAddress(s string) (uint8, uint16, error) {
+	f, a, ok := strings.Cut(strings.TrimSpace(s), ":")
+	fn := modbus.StringToUint8(f)
+	if !ok || fn == 0 {
+		return 0, 0, fmt.Errorf("address %q: expected function:address, e.g. holding:100", s)
+	}
+	addr, err := strconv.ParseUint(strings.TrimSpace(a), 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("address %q: %w", s, err)
+	}
+	return fn, uint16(addr), nil
+}
+
+// AddTag is adding tag with address on device node ("holding:100") mapped to tg.MBfunc & tg.MBaddr
+func (dvc *DeviceModbus) AddTag(node string, tg clientopcua.Tag) error {
+	fn, addr, err := ParseAddress(node)
+	if err != nil {
+		return err
+	}
+	t := Tag{Tag: tg, Function: fn, Address: addr}
+	if t.Count() == 0 {
+		return fmt.Errorf("tag %q: unsupported type %q", node, tg.TypeData)
+	}
+	if dvc.Tags == nil {
+		dvc.Tags = map[string]Tag{}
+	}
+	if _, ok := dvc.Tags[node]; !ok {
+		dvc.Nodes = append(dvc.Nodes, node)
+	}
+	dvc.Tags[node] = t
+	return nil
+}
+
+// Block is one read request: Count registers (or bits) of Function from Address, covering Nodes
+type Block struct {
+	Function uint8
+	Address  uint16
+	Count    uint16
+	Nodes    []string
+}
+
+// Blocks is grouping tags in read requests: tags of same function are read in one request
+// while block is not longer than MaxRegisters/MaxBits and gap between tags is not over MaxGap
+func (dvc *DeviceModbus) Blocks() []Block {
+	nodes := append([]string(nil), dvc.Nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := dvc.Tags[nodes[i]], dvc.Tags[nodes[j]]
+		if a.Function != b.Function {
+			return a.Function < b.Function
+		}
+		return a.Address < b.Address
+	})
+
+	var blocks []Block
+	for _, n := range nodes {
+		tg := dvc.Tags[n]
+		end := uint32(tg.Address) + uint32(tg.Count())
+		if len(blocks) > 0 {
+			b := &blocks[len(blocks)-1]
+			bEnd := uint32(b.Address) + uint32(b.Count)
+			if b.Function == tg.Function && uint32(tg.Address) <= bEnd+uint32(dvc.Config.MaxGap) &&
+				end-uint32(b.Address) <= uint32(dvc.maxCount(tg.Function)) {
+				if end > bEnd {
+					b.Count = uint16(end - uint32(b.Address))
+				}
+				b.Nodes = append(b.Nodes, n)
+				continue
+			}
+		}
+		blocks = append(blocks, Block{Function: tg.Function, Address: tg.Address, Count: tg.Count(), Nodes: []string{n}})
+	}
+	return blocks
+}
+
+// Stats is returns copy of diagnostics
+func (dvc *DeviceModbus) Stats() Stats {
+	dvc.mu.Lock()
+	defer dvc.mu.Unlock()
+	return dvc.stats
+}
+
+func (dvc *DeviceModbus) maxCount(function uint8) uint16 {
+	if function == modbus.ReadCoils || function == modbus.ReadDiscreteInputs {
+		if dvc.Config.MaxBits == 0 || dvc.Config.MaxBits > MaxReadBits {
+			return MaxReadBits
+		}
+		return dvc.Config.MaxBits
+	}
+	if dvc.Config.MaxRegisters == 0 || dvc.Config.MaxRegisters > MaxReadRegisters {
+		return MaxReadRegisters
+	}
+	return dvc.Config.MaxRegisters
+}
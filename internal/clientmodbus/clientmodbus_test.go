@@ -0,0 +1,212 @@
+package clientmodbus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddress(t *testing.T) {
+	fn, addr, err := ParseAddress("holding:100")
+	require.NoError(t, err)
+	require.Equal(t, modbus.ReadHoldingRegisters, fn)
+	require.Equal(t, uint16(100), addr)
+
+	fn, addr, err = ParseAddress(" 2:7 ")
+	require.NoError(t, err)
+	require.Equal(t, modbus.ReadDiscreteInputs, fn)
+	require.Equal(t, uint16(7), addr)
+
+	for _, s := range []string{"100", "memory:1", "coil:70000", "coil:"} {
+		_, _, err = ParseAddress(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	dvc := &DeviceModbus{Config: Config{MaxRegisters: 6, MaxGap: 2}}
+	for node, typ := range map[string]string{
+		"holding:0":  "float32",
+		"holding:2":  "int16",
+		"holding:5":  "uint16",  // gap 2
+		"holding:7":  "float32", // block longer than 6
+		"holding:20": "int16",   // gap 11
+		"input:0":    "int16",
+		"coil:1":     "bool",
+		"coil:3":     "bool",
+	} {
+		require.NoError(t, dvc.AddTag(node, clientopcua.Tag{TypeData: typ, MBfunc: modbus.ReadInputRegisters}))
+	}
+	require.Error(t, dvc.AddTag("holding:30", clientopcua.Tag{TypeData: "string"}))
+
+	var got []Block
+	for _, b := range dvc.Blocks() {
+		got = append(got, Block{Function: b.Function, Address: b.Address, Count: b.Count})
+	}
+	require.Equal(t, []Block{
+		{Function: modbus.ReadCoils, Address: 1, Count: 3},
+		{Function: modbus.ReadHoldingRegisters, Address: 0, Count: 6},
+		{Function: modbus.ReadHoldingRegisters, Address: 7, Count: 2},
+		{Function: modbus.ReadHoldingRegisters, Address: 20, Count: 1},
+		{Function: modbus.ReadInputRegisters, Address: 0, Count: 1},
+	}, got)
+}
+
+// slave is ModBus server of gateway as Modbus TCP device
+func slave(t *testing.T, unit modbus.UnitID) (*modbus.MBServer, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	mb := modbus.NewServer(logrus.New(), "127.0.0.1", port)
+	mb.AddDevice(unit)
+	go mb.Listen()
+	addr := ln.Addr().String()
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	return mb, addr
+}
+
+func TestClient(t *testing.T) {
+	mb, addr := slave(t, 7)
+	mb.WriteHoldingRegisters(7, 10, 0x1234)
+	mb.WriteHoldingRegisters(7, 11, 0x5678)
+	mb.WriteCoils(7, 3, true)
+
+	c := NewClient(addr, 7, time.Second)
+	defer c.Close()
+	regs, err := c.ReadRegisters(modbus.ReadHoldingRegisters, 10, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint16{0x1234, 0x5678}, regs)
+
+	bits, err := c.ReadBits(modbus.ReadCoils, 3, 1)
+	require.NoError(t, err)
+	require.Equal(t, []bool{true}, bits)
+
+	_, err = c.ReadRegisters(modbus.ReadHoldingRegisters, 12, 1)
+	var ex *ExceptionError
+	require.True(t, errors.As(err, &ex))
+	require.Equal(t, modbus.IllegalDataAddress, ex.Exception)
+
+	_, err = c.ReadRegisters(modbus.ReadCoils, 0, 1)
+	require.Error(t, err)
+	_, err = c.ReadRegisters(modbus.ReadInputRegisters, 0, MaxReadRegisters+1)
+	require.Error(t, err)
+}
+
+func TestClientWrite(t *testing.T) {
+	mb, addr := slave(t, 7)
+	mb.AddWriteHandler(7, func(function uint8, address uint16, values []uint16) modbus.Exception {
+		for i, v := range values {
+			switch function {
+			case modbus.WriteMultipleRegisters:
+				mb.WriteHoldingRegisters(7, address+uint16(i), v)
+			case modbus.WriteMultipleCoils:
+				mb.WriteCoils(7, address+uint16(i), v != 0)
+			default:
+				return modbus.IllegalFunction
+			}
+		}
+		return modbus.Success
+	})
+
+	c := NewClient(addr, 7, time.Second)
+	defer c.Close()
+	require.NoError(t, c.WriteRegisters(20, []uint16{0xABCD, 0x0102}))
+	regs, err := c.ReadRegisters(modbus.ReadHoldingRegisters, 20, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint16{0xABCD, 0x0102}, regs)
+
+	require.NoError(t, c.WriteCoils(8, []bool{true, false, true, true, false, false, false, false, true}))
+	bits, ex := mb.Read(7, modbus.ReadCoils, 8, 9)
+	require.Equal(t, modbus.Success, ex)
+	require.Equal(t, []uint16{1, 0, 1, 1, 0, 0, 0, 0, 1}, bits)
+
+	require.Error(t, c.WriteRegisters(0, nil))
+	require.Error(t, c.WriteCoils(0, make([]bool, MaxWriteBits+1)))
+}
+
+func TestPoll(t *testing.T) {
+	mb, addr := slave(t, 7)
+	mb.WriteHoldingRegisters(7, 100, 0x41AC) // 21.5
+	mb.WriteHoldingRegisters(7, 101, 0x0000)
+	mb.WriteInputRegisters(7, 5, 0xFFFF)
+	mb.WriteCoils(7, 1, true)
+
+	dvc := &DeviceModbus{Name: "plc", Config: Config{Address: addr, UnitID: 7, PollInterval: 50 * time.Millisecond}}
+	require.NoError(t, dvc.AddTag("holding:100", clientopcua.Tag{TypeData: "float32"}))
+	require.NoError(t, dvc.AddTag("input:5", clientopcua.Tag{TypeData: "int16"}))
+	require.NoError(t, dvc.AddTag("coil:1", clientopcua.Tag{TypeData: "bool"}))
+
+	var mu sync.Mutex
+	values := map[string]interface{}{}
+	var states []bool
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client := dvc.Client()
+		defer client.Close()
+		dvc.Poll(ctx, logrus.New(), client, func(node string, v interface{}) {
+			mu.Lock()
+			values[node] = v
+			mu.Unlock()
+		}, func(ready bool) {
+			mu.Lock()
+			states = append(states, ready)
+			mu.Unlock()
+		})
+	}()
+
+	require.Eventually(t, func() bool { return dvc.Stats().Cycles >= 2 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	require.Equal(t, map[string]interface{}{"holding:100": float32(21.5), "input:5": int16(-1), "coil:1": true}, values)
+	require.Equal(t, []bool{true, false}, states)
+	st := dvc.Stats()
+	require.True(t, st.Connected)
+	require.Zero(t, st.Errors)
+}
+
+func TestPollRetries(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dvc := &DeviceModbus{Name: "plc", Config: Config{Address: addr, PollInterval: time.Hour, Timeout: 100 * time.Millisecond, Retries: 2}}
+	require.NoError(t, dvc.AddTag("holding:0", clientopcua.Tag{TypeData: "int16"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client := dvc.Client()
+		defer client.Close()
+		dvc.Poll(ctx, logrus.New(), client, func(string, interface{}) {}, func(bool) { t.Error("device is not ready") })
+	}()
+	require.Eventually(t, func() bool { return dvc.Stats().Cycles == 1 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	st := dvc.Stats()
+	require.False(t, st.Connected)
+	require.Equal(t, uint64(1), st.Errors)
+	require.Equal(t, uint64(2), st.Retries)
+	require.NotEmpty(t, st.LastError)
+}
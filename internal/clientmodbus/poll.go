@@ -0,0 +1,140 @@
+package clientmodbus
+
+import (
+	"context"
+	"errors"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Handler is handler of values of tags read from device
+type Handler func(node string, v interface{})
+
+// Client is creating client of device with Config.Timeout (DefaultTimeout if not set),
+// one client is shared by polling and writes of masters
+func (dvc *DeviceModbus) Client() *Client {
+	timeout := dvc.Config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return NewClient(dvc.Config.Address, dvc.Config.UnitID, timeout)
+}
+
+// Poll is reading all tags of device by client in blocks every Config.PollInterval (first cycle immediately)
+// until ctx is done. Failed request is repeated Config.Retries times. ready is called on change of
+// state of device: ready after cycle without errors, not ready when no block is read.
+// Client is not closed by Poll.
+func (dvc *DeviceModbus) Poll(ctx context.Context, logg *logrus.Logger, client *Client, handler Handler, ready func(bool)) {
+	conf := dvc.Config
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = DefaultPollInterval
+	}
+	if conf.Retries < 0 {
+		conf.Retries = 0
+	}
+
+	blocks := dvc.Blocks()
+	logg.Debug(dvc.Name, " polling ", len(dvc.Nodes), " tags in ", len(blocks), " reads every ", conf.PollInterval)
+
+	ticker := time.NewTicker(conf.PollInterval)
+	defer ticker.Stop()
+	isReady := false
+	defer func() {
+		if isReady {
+			ready(false)
+		}
+	}()
+	for {
+		start := time.Now()
+		failed := 0
+		var lastErr error
+		for _, b := range blocks {
+			if err := dvc.readBlock(ctx, client, b, conf.Retries, handler); err != nil {
+				failed++
+				lastErr = err
+				logg.Debug(dvc.Name, " read ", modbus.FunctionName(b.Function), ":", b.Address, "/", b.Count, " error: ", err)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		dvc.record(time.Since(start), failed < len(blocks), lastErr)
+
+		switch {
+		case failed == 0 && !isReady:
+			isReady = true
+			ready(true)
+		case failed == len(blocks) && isReady:
+			isReady = false
+			ready(false)
+			logg.Warn(dvc.Name, " device is not responding: ", lastErr)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readBlock is reading block with retries and calling handler for every tag of block
+func (dvc *DeviceModbus) readBlock(ctx context.Context, client *Client, b Block, retries int, handler Handler) error {
+	var (
+		regs []uint16
+		bits []bool
+		err  error
+	)
+	for attempt := 0; attempt <= retries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if attempt > 0 {
+			dvc.mu.Lock()
+			dvc.stats.Retries++
+			dvc.mu.Unlock()
+		}
+		if b.Function == modbus.ReadCoils || b.Function == modbus.ReadDiscreteInputs {
+			bits, err = client.ReadBits(b.Function, b.Address, b.Count)
+		} else {
+			regs, err = client.ReadRegisters(b.Function, b.Address, b.Count)
+		}
+		var ex *ExceptionError
+		if err == nil || errors.As(err, &ex) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, n := range b.Nodes {
+		tg := dvc.Tags[n]
+		off := tg.Address - b.Address
+		if bits != nil {
+			handler(n, bits[off])
+			continue
+		}
+		v, err := clientopcua.FromRegisters(tg.TypeData, regs[off:off+tg.Count()])
+		if err != nil {
+			continue
+		}
+		handler(n, v)
+	}
+	return nil
+}
+
+func (dvc *DeviceModbus) record(d time.Duration, connected bool, err error) {
+	dvc.mu.Lock()
+	defer dvc.mu.Unlock()
+	dvc.stats.Cycles++
+	dvc.stats.LastCycle = d
+	dvc.stats.Connected = connected
+	if err != nil {
+		dvc.stats.Errors++
+		dvc.stats.LastError = err.Error()
+	}
+}
@@ -0,0 +1,110 @@
+package clientopcua
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"opcuaModbus/internal/pki"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// certificateAuthOptions is applying X.509 user certificate authentication
+func (dvc *DeviceOPCUA) certificateAuthOptions(endpnt *ua.EndpointDescription) error {
+	if dvc.Config.UserCertFile == "" || dvc.Config.UserKeyFile == "" {
+		return errors.New("auth Certificate: user certificate or key file not configured")
+	}
+	if !endpointHasToken(endpnt, ua.UserTokenTypeCertificate) {
+		return errors.New("auth Certificate: endpoint does not accept user certificate token")
+	}
+
+	der, err := pki.LoadCertificate(dvc.Config.UserCertFile)
+	if err != nil {
+		return fmt.Errorf("auth Certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("auth Certificate: %s: %w", dvc.Config.UserCertFile, err)
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("auth Certificate: user certificate %s is not valid now (%s - %s)",
+			dvc.Config.UserCertFile, cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+	}
+
+	key, err := pki.LoadPrivateKey(dvc.Config.UserKeyFile, dvc.Config.UserKeyPassword)
+	if err != nil {
+		return fmt.Errorf("auth Certificate: %w", err)
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || pub.N.Cmp(key.N) != 0 {
+		return fmt.Errorf("auth Certificate: key %s does not match certificate %s",
+			dvc.Config.UserKeyFile, dvc.Config.UserCertFile)
+	}
+
+	// gopcua signs the user token with the key of the secure channel:
+	// without security it is the user key, else the application instance key,
+	// so with security the user key must be the application key.
+	if dvc.Config.Policy == "None" {
+		dvc.Options = append(dvc.Options, opcua.PrivateKey(key))
+	} else {
+		appKey, err := pki.LoadPrivateKey(dvc.appKeyFile(), dvc.Config.KeyPassword)
+		if err != nil {
+			return fmt.Errorf("auth Certificate: %w", err)
+		}
+		if appKey.N.Cmp(key.N) != 0 {
+			return fmt.Errorf("auth Certificate: security policy %s: user token is signed with application key %s, "+
+				"server rejects user certificate %s (use policy None or application certificate & key as user certificate & key)",
+				dvc.Config.Policy, dvc.appKeyFile(), dvc.Config.UserCertFile)
+		}
+	}
+
+	dvc.Options = append(dvc.Options, opcua.AuthCertificate(der))
+	return nil
+}
+
+func (dvc *DeviceOPCUA) appKeyFile() string {
+	_, keyFile, _ := dvc.Config.CertPaths()
+	return keyFile
+}
+
+// endpointHasToken is checking that endpoint accepts user token type
+func endpointHasToken(endpnt *ua.EndpointDescription, t ua.UserTokenType) bool {
+	for _, tok := range endpnt.UserIdentityTokens {
+		if tok.TokenType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectError is explaining connection error, if server rejects the user token
+func (dvc *DeviceOPCUA) ConnectError(err error) error {
+	var code ua.StatusCode
+	if !errors.As(err, &code) {
+		return err
+	}
+
+	switch code {
+	case ua.StatusBadIdentityTokenRejected, ua.StatusBadIdentityTokenInvalid,
+		ua.StatusBadUserSignatureInvalid, ua.StatusBadUserAccessDenied,
+		ua.StatusBadCertificateUntrusted, ua.StatusBadCertificateInvalid,
+		ua.StatusBadCertificateUseNotAllowed, ua.StatusBadCertificateTimeInvalid,
+		ua.StatusBadCertificateRevoked, ua.StatusBadSecurityChecksFailed:
+	default:
+		return err
+	}
+
+	switch dvc.Config.Auth {
+	case "Certificate":
+		return fmt.Errorf("server rejected user certificate %s (check it is trusted by the server): %w",
+			dvc.Config.UserCertFile, err)
+	case "UserName":
+		return fmt.Errorf("server rejected user %s: %w", dvc.Config.Username, err)
+	default:
+		return fmt.Errorf("server rejected connection: %w", err)
+	}
+}
@@ -0,0 +1,69 @@
+package clientopcua
+
+import (
+	"errors"
+	"fmt"
+	"opcuaModbus/internal/pki"
+	"path/filepath"
+	"testing"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointHasToken(t *testing.T) {
+	endpnt := &ua.EndpointDescription{UserIdentityTokens: []*ua.UserTokenPolicy{
+		{TokenType: ua.UserTokenTypeAnonymous},
+		{TokenType: ua.UserTokenTypeCertificate},
+	}}
+	require.True(t, endpointHasToken(endpnt, ua.UserTokenTypeCertificate))
+	require.True(t, endpointHasToken(endpnt, ua.UserTokenTypeAnonymous))
+	require.False(t, endpointHasToken(endpnt, ua.UserTokenTypeUserName))
+	require.False(t, endpointHasToken(&ua.EndpointDescription{}, ua.UserTokenTypeAnonymous))
+}
+
+func TestConnectError(t *testing.T) {
+	rejected := fmt.Errorf("activate session: %w", ua.StatusBadIdentityTokenRejected)
+	for _, tc := range []struct {
+		auth string
+		err  error
+		want string
+	}{
+		{auth: "Certificate", err: rejected, want: "server rejected user certificate user.pem"},
+		{auth: "UserName", err: ua.StatusBadUserAccessDenied, want: "server rejected user operator"},
+		{auth: "Anonymous", err: ua.StatusBadCertificateUntrusted, want: "server rejected connection"},
+		{auth: "Certificate", err: ua.StatusBadTimeout, want: ua.StatusBadTimeout.Error()},
+		{auth: "Certificate", err: errors.New("connection refused"), want: "connection refused"},
+	} {
+		dvc := DeviceOPCUA{Config: Config{Auth: tc.auth, Username: "operator", UserCertFile: "user.pem"}}
+		err := dvc.ConnectError(tc.err)
+		require.ErrorContains(t, err, tc.want, tc.auth)
+		require.ErrorIs(t, err, tc.err, tc.auth)
+	}
+}
+
+func TestCertificateAuthOptions(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app", "user"} {
+		_, err := pki.EnsureCertificate(filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key"), "urn:test:"+name, "")
+		require.NoError(t, err)
+	}
+	endpnt := &ua.EndpointDescription{UserIdentityTokens: []*ua.UserTokenPolicy{{TokenType: ua.UserTokenTypeCertificate}}}
+	conf := func(policy, user string) Config {
+		return Config{Policy: policy, Auth: "Certificate",
+			CertFile: filepath.Join(dir, "app.pem"), KeyFile: filepath.Join(dir, "app.key"),
+			UserCertFile: filepath.Join(dir, user+".pem"), UserKeyFile: filepath.Join(dir, user+".key")}
+	}
+
+	// without security user token is signed with user key
+	dvc := DeviceOPCUA{Config: conf("None", "user")}
+	require.NoError(t, dvc.certificateAuthOptions(endpnt))
+	require.Len(t, dvc.Options, 2)
+
+	// with security user token is signed with application key
+	dvc = DeviceOPCUA{Config: conf("Basic256Sha256", "user")}
+	require.ErrorContains(t, dvc.certificateAuthOptions(endpnt), "signed with application key")
+	dvc = DeviceOPCUA{Config: conf("Basic256Sha256", "app")}
+	require.NoError(t, dvc.certificateAuthOptions(endpnt))
+	require.Len(t, dvc.Options, 1)
+}
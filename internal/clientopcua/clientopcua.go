@@ -5,14 +5,19 @@ import (
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"opcuaModbus/internal/modbus"
+	"opcuaModbus/internal/pki"
+	"opcuaModbus/internal/secrets"
 	"opcuaModbus/utilities"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gopcua/opcua"
-	"github.com/gopcua/opcua/monitor"
 	"github.com/gopcua/opcua/ua"
 	"github.com/sirupsen/logrus"
 )
@@ -26,13 +31,21 @@ const (
 	ReadyOptions                   // Опции применены
 	Connected                      // Подключен
 	Subscribed                     // Подписано
+	Polling                        // Опрашивается
 )
 
 // Tag is config for tags device
 type Tag struct {
-	TypeData string
-	MBfunc   uint8
-	MBaddr   uint16
+	// Alias is name of tag (column 1 of tags tsv), e.g. for REST API
+	Alias      string
+	TypeData   string
+	MBfunc     uint8
+	MBaddr     uint16
+	Monitoring Monitoring
+	// Units is engineering units of value, e.g. "°C" (EngineeringUnits of OPC UA server of gateway)
+	Units string
+	// Write is allowing writes to node of tag by masters (column 13 of tags tsv), see Writable
+	Write bool
 }
 
 // Config is configuration of connection to OPCUA Server
@@ -42,22 +55,84 @@ type Config struct {
 	Mode     string
 	Auth     string
 	Username string
-	Password string
+	Password secrets.Secret
+	// KeyPassword is passphrase of encrypted private key
+	KeyPassword secrets.Secret
+	// client application instance certificate
+	CertFile       string
+	KeyFile        string
+	ApplicationURI string
+	// X.509 user certificate (Auth = "Certificate")
+	UserCertFile    string
+	UserKeyFile     string
+	UserKeyPassword secrets.Secret
+	// PublishIntervals is publishing intervals of subscriptions by name
+	PublishIntervals map[string]time.Duration
+	// ReadMode is "subscribe" (default) or "poll"
+	ReadMode     string
+	PollInterval time.Duration
+	// MaxItemsPerSubscription is limit of monitored items per subscription (0 - from server)
+	MaxItemsPerSubscription uint32
+	// Endpoints is primary & backup endpoints of redundant server, Endpoint is active one
+	Endpoints []string
+	// MinServiceLevel is ServiceLevel of server below which device is switched to backup (0 - not checked)
+	MinServiceLevel byte
+	FailoverTimeout time.Duration
+	// ClockRegister is input registers of server time & drift (nil - not mapped)
+	ClockRegister *uint16
+	ClockInterval time.Duration
+	// RefuseInvalidTags is not mapping tags which do not match nodes of server (see ValidateTags)
+	RefuseInvalidTags bool
 }
 
 // DeviceOPCUA is client OPCUA
 type DeviceOPCUA struct {
-	Status   Status
-	Config   Config
-	Client   *opcua.Client
-	Options  []opcua.Option
-	Monitor  *monitor.NodeMonitor
-	Subscrip *monitor.Subscription
-	Nodes    []string
-	Tags     map[string]Tag
-	MBUnitID modbus.UnitID
-	Error    string
-	FileTags string
+	Name      string
+	Status    Status
+	Config    Config
+	Client    *opcua.Client
+	Options   []opcua.Option
+	Subscrip  []*Subscription
+	Nodes     []string
+	Tags      map[string]Tag
+	MBUnitID  modbus.UnitID
+	Error     string
+	FileTags  string
+	PollStats *PollStats
+	// TrustStore is verifying server certificate (nil - without verification)
+	TrustStore *pki.Store
+	// Limits is OperationLimits of server, read on connect
+	Limits *OperationLimits
+	// BadNodes is nodes unknown to server (by initial read), they are not subscribed
+	BadNodes map[string]ua.StatusCode
+	// Methods is OPC UA methods called by writes of master
+	Methods []Method
+	// Events is subscription to alarms of device (nil - not subscribed)
+	Events *Events
+	// Failovers is number of switches between redundant endpoints
+	Failovers int
+	// Clock is server time & drift of server clock
+	Clock *Clock
+	// Results is last values of nodes (nil - not stored)
+	Results *Results
+	// Counters is counters of data changes, reconnects & conversion errors (nil - not counted)
+	Counters *Counters
+	// TagIssues is mismatches of tags with nodes of server by tag
+	TagIssues map[string]string
+	// ResolveErrors is errors of resolving tags addressed by namespace uri or browse path
+	ResolveErrors map[string]error
+	nodeIDs       map[string]*ua.NodeID // resolved node ids by tag
+	tagNodes      map[string]string     // tags by resolved node id
+	mu            *sync.RWMutex         // lock of state, see lock
+	running       int32                 // reading of device is started, see StartRun
+}
+
+// Subscribed is returns number of monitored items in all subscriptions
+func (dvc *DeviceOPCUA) Subscribed() (n int) {
+	for _, sub := range dvc.SubscriptionsSnapshot() {
+		n += sub.Subscribed()
+	}
+	return n
 }
 
 func (s Status) String() string {
@@ -72,6 +147,8 @@ func (s Status) String() string {
 		return "Connected"
 	case 5:
 		return "Subscribed"
+	case 6:
+		return "Polling"
 	default:
 		return ""
 	}
@@ -90,30 +167,91 @@ func (dvc *DeviceOPCUA) ClientOptions(ctx context.Context, logg *logrus.Logger)
 		return fmt.Errorf("Policy Mode does not match Endpoint")
 	}
 
+	if dvc.TrustStore != nil && dvc.Config.Policy != "None" {
+		if err := dvc.TrustStore.Verify(endpnt.ServerCertificate, endpointHost(dvc.Config.Endpoint)); err != nil {
+			return err
+		}
+	}
+
+	dvc.Options = nil
 	dvc.Options = append(dvc.Options, opcua.AutoReconnect(true))
 
 	dvc.Options = append(dvc.Options, opcua.SecurityPolicy(dvc.Config.Policy))
 	dvc.Options = append(dvc.Options, opcua.SecurityModeString(dvc.Config.Mode))
 	if dvc.Config.Policy != "None" {
-		dvc.Options = append(dvc.Options, opcua.CertificateFile("cert.pem"))
-		dvc.Options = append(dvc.Options, opcua.PrivateKeyFile("key.pem"))
+		if err := dvc.certificateOptions(logg); err != nil {
+			return err
+		}
 	}
 
 	var authToken ua.UserTokenType
 	switch dvc.Config.Auth {
 	case "UserName":
 		authToken = ua.UserTokenTypeUserName
-		dvc.Options = append(dvc.Options, opcua.AuthUsername(dvc.Config.Username, dvc.Config.Password))
+		dvc.Options = append(dvc.Options, opcua.AuthUsername(dvc.Config.Username, dvc.Config.Password.Reveal()))
 	case "Certificate":
 		authToken = ua.UserTokenTypeCertificate
-		//		opts = append(opts, opcua.AuthCertificate(cert))
+		if err := dvc.certificateAuthOptions(endpnt); err != nil {
+			return err
+		}
 	default:
 		authToken = ua.UserTokenTypeAnonymous
 		dvc.Options = append(dvc.Options, opcua.AuthAnonymous())
 	}
 	dvc.Options = append(dvc.Options, opcua.SecurityFromEndpoint(endpnt, authToken))
 
-	dvc.Status = ReadyOptions
+	dvc.SetStatus(ReadyOptions)
+	return nil
+}
+
+// endpointHost is returns host of endpoint opc.tcp://host:port
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// CertPaths is returns certificate, private key files & ApplicationURI (with defaults)
+func (c Config) CertPaths() (certFile, keyFile, appURI string) {
+	certFile, keyFile, appURI = c.CertFile, c.KeyFile, c.ApplicationURI
+	if certFile == "" {
+		certFile = "cert.pem"
+	}
+	if keyFile == "" {
+		keyFile = "key.pem"
+	}
+	if appURI == "" {
+		appURI = pki.DefaultApplicationURI()
+	}
+	return certFile, keyFile, appURI
+}
+
+// certificateOptions is applying client certificate & private key, generates self-signed if none exists
+func (dvc *DeviceOPCUA) certificateOptions(logg *logrus.Logger) error {
+	certFile, keyFile, appURI := dvc.Config.CertPaths()
+	generated, err := pki.EnsureCertificate(certFile, keyFile, appURI, dvc.Config.KeyPassword)
+	if err != nil {
+		return err
+	}
+	if generated {
+		logg.Info(dvc.Config.Endpoint, " generated self-signed certificate: ", certFile)
+	}
+
+	cert, err := pki.LoadCertificate(certFile)
+	if err != nil {
+		return err
+	}
+	key, err := pki.LoadPrivateKey(keyFile, dvc.Config.KeyPassword)
+	if err != nil {
+		return err
+	}
+
+	dvc.Options = append(dvc.Options, opcua.ApplicationName(pki.ApplicationName))
+	dvc.Options = append(dvc.Options, opcua.Certificate(cert))
+	dvc.Options = append(dvc.Options, opcua.ApplicationURI(appURI))
+	dvc.Options = append(dvc.Options, opcua.PrivateKey(key))
 	return nil
 }
 
@@ -122,7 +260,7 @@ func recordEnpointParam(endpoints []*ua.EndpointDescription) {
 	fmt.Println(enp)
 }
 
-//getOptions getting configuration of connection to OPCUA Server
+// getOptions getting configuration of connection to OPCUA Server
 func getOptions(endpoints []*ua.EndpointDescription) (out string) {
 	var policy, mode, auth []string
 	var user bool
@@ -175,6 +313,18 @@ func (dvc *DeviceOPCUA) ReadTime(ctx context.Context) string {
 	return "failed read time"
 }
 
+// AddTag is adding a tag to the device (tags defined in structured config)
+func (dvc *DeviceOPCUA) AddTag(name string, tg Tag) {
+	if dvc.Tags == nil {
+		dvc.Tags = make(map[string]Tag)
+	}
+	if _, ok := dvc.Tags[name]; !ok {
+		dvc.Nodes = append(dvc.Nodes, name)
+	}
+	dvc.Tags[name] = tg
+}
+
+// ReadTagsTSV is reads tags of device from tsv-file
 func (dvc *DeviceOPCUA) ReadTagsTSV() error {
 	file, err := os.Open(dvc.FileTags)
 	if err != nil {
@@ -185,20 +335,25 @@ func (dvc *DeviceOPCUA) ReadTagsTSV() error {
 	reader := csv.NewReader(file)
 	reader.Comma = '\t'
 	reader.Comment = '#'
-
-	records, err := reader.ReadAll()
-	if err != nil {
-		return err
-	}
+	reader.FieldsPerRecord = -1
 
 	tags := make(map[string]Tag)
 	nodes := []string{}
-	for _, r := range records {
-		if len(r) != 6 {
+	for {
+		r, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(r) < 6 {
 			continue
 		}
+		line, _ := reader.FieldPos(0)
 		tg := Tag{}
 		name := r[2]
+		tg.Alias = strings.TrimSpace(r[1])
 		tg.TypeData = r[3]
 		tg.MBfunc = modbus.StringToUint8(r[4])
 		a, err := strconv.Atoi(r[5])
@@ -206,6 +361,14 @@ func (dvc *DeviceOPCUA) ReadTagsTSV() error {
 			continue
 		}
 		tg.MBaddr = uint16(a)
+		if tg.Monitoring, err = ParseMonitoring(r[6:]); err != nil {
+			return fmt.Errorf("%s:%d: tag %s: %w", dvc.FileTags, line, name, err)
+		}
+		if len(r) > 13 && strings.TrimSpace(r[13]) != "" {
+			if tg.Write, err = strconv.ParseBool(strings.TrimSpace(r[13])); err != nil {
+				return fmt.Errorf("%s:%d: tag %s: writable: %w", dvc.FileTags, line, name, err)
+			}
+		}
 		nodes = append(nodes, name)
 		tags[name] = tg
 	}
@@ -215,7 +378,7 @@ func (dvc *DeviceOPCUA) ReadTagsTSV() error {
 
 	dvc.Nodes = append(dvc.Nodes, nodes...)
 	dvc.Tags = tags
-	dvc.Status = ReadTags
+	dvc.SetStatus(ReadTags)
 
 	return nil
 }
@@ -0,0 +1,47 @@
+package clientopcua
+
+import (
+	"opcuaModbus/internal/modbus"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTagsTSV(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tags.tsv")
+	tsv := "#\talias\tnode\ttype\tfunction\taddress\n" +
+		"1\ttemp\tns=3;s=Temp\tfloat32\tinput\t10\tfast\t100\n" +
+		"2\t\tns=3;s=Run\tbool\tcoil\tx\n" +
+		"3\t\tns=3;s=Level\tint16\tholding\t20\t\t\t\t\t\t\t\ttrue\n"
+	require.NoError(t, os.WriteFile(file, []byte(tsv), 0644))
+
+	dvc := DeviceOPCUA{FileTags: file}
+	require.NoError(t, dvc.ReadTagsTSV())
+	require.Equal(t, []string{"ns=3;s=Temp", "ns=3;s=Level"}, dvc.Nodes)
+	require.Equal(t, ReadTags, dvc.Status)
+	tg := dvc.Tags["ns=3;s=Temp"]
+	require.Equal(t, "temp", tg.Alias)
+	require.Equal(t, modbus.ReadInputRegisters, tg.MBfunc)
+	require.Equal(t, uint16(10), tg.MBaddr)
+	require.Equal(t, "fast", tg.Monitoring.Subscription)
+	require.Equal(t, 100*time.Millisecond, tg.Monitoring.SamplingInterval)
+	require.False(t, tg.Writable())
+	require.True(t, dvc.Tags["ns=3;s=Level"].Writable())
+
+	// invalid monitoring column is reported with line and node
+	tsv += "4\t\tns=3;s=Flow\tfloat32\tinput\t30\t\t\t\t\tabsolut\n"
+	require.NoError(t, os.WriteFile(file, []byte(tsv), 0644))
+	dvc = DeviceOPCUA{FileTags: file}
+	err := dvc.ReadTagsTSV()
+	require.ErrorContains(t, err, "tags.tsv:5: tag ns=3;s=Flow")
+	require.Empty(t, dvc.Nodes)
+
+	// invalid writable column
+	tsv = "1\t\tns=3;s=Level\tint16\tholding\t20\t\t\t\t\t\t\t\tyes\n"
+	require.NoError(t, os.WriteFile(file, []byte(tsv), 0644))
+	dvc = DeviceOPCUA{FileTags: file}
+	require.ErrorContains(t, dvc.ReadTagsTSV(), "tags.tsv:1: tag ns=3;s=Level: writable")
+}
@@ -0,0 +1,102 @@
+package clientopcua
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// DefaultClockInterval is interval of reading CurrentTime of server
+const DefaultClockInterval = 10 * time.Second
+
+// ClockRegisters is number of input registers of clock: server time (Unix seconds, uint32)
+// and drift of server clock from host clock (milliseconds, int32)
+const ClockRegisters = 4
+
+// Clock is last reading of server time
+type Clock struct {
+	mu         sync.Mutex
+	ServerTime time.Time
+	Drift      time.Duration // server time - host time
+	Updated    time.Time
+	LastError  string
+}
+
+// ClockSnapshot is copy of Clock for status
+type ClockSnapshot struct {
+	ServerTime time.Time
+	Drift      time.Duration
+	Updated    time.Time
+	LastError  string
+}
+
+// Snapshot is returns copy of clock
+func (c *Clock) Snapshot() ClockSnapshot {
+	if c == nil {
+		return ClockSnapshot{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClockSnapshot{ServerTime: c.ServerTime, Drift: c.Drift, Updated: c.Updated, LastError: c.LastError}
+}
+
+// ClockInterval is returns Config.ClockInterval or default
+func (dvc *DeviceOPCUA) ClockInterval() time.Duration {
+	if dvc.Config.ClockInterval > 0 {
+		return dvc.Config.ClockInterval
+	}
+	return DefaultClockInterval
+}
+
+// SyncClock is reading ServerStatus.CurrentTime and computing drift against host clock
+// (host time is middle of request)
+func (dvc *DeviceOPCUA) SyncClock(ctx context.Context) (ClockSnapshot, error) {
+	c := dvc.clock()
+
+	start := time.Now()
+	resp, err := dvc.Client.ReadWithContext(ctx, &ua.ReadRequest{
+		NodesToRead: []*ua.ReadValueID{{
+			NodeID:      ua.NewNumericNodeID(0, id.Server_ServerStatus_CurrentTime),
+			AttributeID: ua.AttributeIDValue,
+		}},
+	})
+	host := start.Add(time.Since(start) / 2)
+
+	var server time.Time
+	if err == nil {
+		if len(resp.Results) != 1 || resp.Results[0].Status != ua.StatusOK || resp.Results[0].Value == nil {
+			err = fmt.Errorf("current time not available")
+		} else if server, _ = resp.Results[0].Value.Value().(time.Time); server.IsZero() {
+			err = fmt.Errorf("bad current time: %v", resp.Results[0].Value.Value())
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.LastError = err.Error()
+		return ClockSnapshot{}, err
+	}
+	c.ServerTime = server
+	c.Drift = server.Sub(host)
+	c.Updated = host
+	c.LastError = ""
+	return ClockSnapshot{ServerTime: c.ServerTime, Drift: c.Drift, Updated: c.Updated}, nil
+}
+
+// Registers is returns clock registers: server time (Unix seconds, uint32) and drift (ms, int32)
+func (s ClockSnapshot) Registers() []uint16 {
+	sec := uint32(s.ServerTime.Unix())
+	drift := s.Drift.Milliseconds()
+	if drift > 1<<31-1 {
+		drift = 1<<31 - 1
+	} else if drift < -1<<31 {
+		drift = -1 << 31
+	}
+	d := uint32(int32(drift))
+	return []uint16{uint16(sec >> 16), uint16(sec), uint16(d >> 16), uint16(d)}
+}
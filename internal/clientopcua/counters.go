@@ -0,0 +1,69 @@
+package clientopcua
+
+import "sync"
+
+// Counters is counters of device for metrics
+type Counters struct {
+	mu               sync.Mutex
+	dataChanges      uint64
+	reconnects       uint64
+	conversionErrors map[string]uint64
+}
+
+// CountersSnapshot is copy of counters of device
+type CountersSnapshot struct {
+	DataChanges      uint64
+	Reconnects       uint64
+	ConversionErrors map[string]uint64 // by tag
+}
+
+// NewCounters is creating counters of device
+func NewCounters() *Counters {
+	return &Counters{conversionErrors: map[string]uint64{}}
+}
+
+// DataChange is counting data change notification
+func (c *Counters) DataChange() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.dataChanges++
+	c.mu.Unlock()
+}
+
+// Reconnect is counting restored session
+func (c *Counters) Reconnect() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.reconnects++
+	c.mu.Unlock()
+}
+
+// ConversionError is counting value of tag which can't be converted to ModBus registers
+func (c *Counters) ConversionError(node string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.conversionErrors[node]++
+	c.mu.Unlock()
+}
+
+// Snapshot is returns copy of counters
+func (c *Counters) Snapshot() CountersSnapshot {
+	snap := CountersSnapshot{ConversionErrors: map[string]uint64{}}
+	if c == nil {
+		return snap
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snap.DataChanges = c.dataChanges
+	snap.Reconnects = c.reconnects
+	for n, v := range c.conversionErrors {
+		snap.ConversionErrors[n] = v
+	}
+	return snap
+}
@@ -0,0 +1,391 @@
+package clientopcua
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// DefaultEventInterval is publishing interval of event subscription
+const DefaultEventInterval = time.Second
+
+// Events is subscription to Alarms & Conditions events of device
+type Events struct {
+	Notifier string        // node of event notifier, Server by default
+	Interval time.Duration // publishing interval
+	Where    string        // where-clause, e.g. "Severity >= 500 and OfType i=2915"
+	Alarms   []Alarm
+
+	mu         sync.Mutex
+	conditions []condition // last event of condition by alarm
+}
+
+// Alarm is mapping of condition (by ConditionName and/or SourceNode) to ModBus:
+// coil - active, discrete input - acknowledged, input register - severity,
+// ack coil - written 1 by master calls Acknowledge
+type Alarm struct {
+	Condition        string
+	Source           string // node id or SourceName
+	ActiveCoil       *uint16
+	AckedDiscrete    *uint16
+	SeverityRegister *uint16
+	AckCoil          *uint16
+}
+
+// Event is fields of event selected by event filter
+type Event struct {
+	EventID       []byte
+	SourceNode    string
+	SourceName    string
+	Severity      uint16
+	ConditionName string
+	ConditionID   *ua.NodeID
+	Active        *bool
+	Acked         *bool
+}
+
+type condition struct {
+	id      *ua.NodeID
+	eventID []byte
+}
+
+// selected fields of event filter, order is order of Event fields
+var eventFields = []struct {
+	typ  uint32
+	path string
+}{
+	{id.BaseEventType, "EventId"},
+	{id.BaseEventType, "SourceNode"},
+	{id.BaseEventType, "SourceName"},
+	{id.BaseEventType, "Severity"},
+	{id.ConditionType, "ConditionName"},
+	{id.AlarmConditionType, "ActiveState/Id"},
+	{id.AcknowledgeableConditionType, "AckedState/Id"},
+	{id.ConditionType, ""}, // ConditionId
+}
+
+// EventFilter is returns filter of event monitored item: selected fields & where-clause
+func (ev *Events) EventFilter() (*ua.EventFilter, error) {
+	f := &ua.EventFilter{}
+	for _, s := range eventFields {
+		op := &ua.SimpleAttributeOperand{
+			TypeDefinitionID: ua.NewNumericNodeID(0, s.typ),
+			AttributeID:      ua.AttributeIDValue,
+		}
+		if s.path == "" {
+			op.AttributeID = ua.AttributeIDNodeID
+		} else {
+			for _, n := range strings.Split(s.path, "/") {
+				op.BrowsePath = append(op.BrowsePath, &ua.QualifiedName{Name: n})
+			}
+		}
+		f.SelectClauses = append(f.SelectClauses, op)
+	}
+
+	where, err := ParseWhere(ev.Where)
+	if err != nil {
+		return nil, err
+	}
+	f.WhereClause = where
+	return f, nil
+}
+
+// MonitorRequest is returns request of event monitored item with client handle
+func (ev *Events) MonitorRequest(handle uint32) (*ua.MonitoredItemCreateRequest, error) {
+	notifier := ua.NewNumericNodeID(0, id.Server)
+	if ev.Notifier != "" {
+		var err error
+		if notifier, err = ua.ParseNodeID(ev.Notifier); err != nil {
+			return nil, fmt.Errorf("event notifier: %w", err)
+		}
+	}
+	filter, err := ev.EventFilter()
+	if err != nil {
+		return nil, err
+	}
+	return &ua.MonitoredItemCreateRequest{
+		ItemToMonitor: &ua.ReadValueID{
+			NodeID:       notifier,
+			AttributeID:  ua.AttributeIDEventNotifier,
+			DataEncoding: &ua.QualifiedName{},
+		},
+		MonitoringMode: ua.MonitoringModeReporting,
+		RequestedParameters: &ua.MonitoringParameters{
+			ClientHandle:  handle,
+			QueueSize:     1000,
+			DiscardOldest: true,
+			Filter:        ua.NewExtensionObject(filter),
+		},
+	}, nil
+}
+
+// whereOperators is operators of where-clause
+var whereOperators = []struct {
+	s  string
+	op ua.FilterOperator
+}{
+	{">=", ua.FilterOperatorGreaterThanOrEqual},
+	{"<=", ua.FilterOperatorLessThanOrEqual},
+	{"=", ua.FilterOperatorEquals},
+	{">", ua.FilterOperatorGreaterThan},
+	{"<", ua.FilterOperatorLessThan},
+	{" like ", ua.FilterOperatorLike},
+}
+
+// ParseWhere is parsing where-clause: conditions joined by "and",
+// condition is "<field> <op> <value>" (op: = > < >= <= like, value: number or 'string')
+// or "OfType <event type node id>". Field is property of BaseEventType, e.g. Severity, SourceName.
+func ParseWhere(s string) (*ua.ContentFilter, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var conds []*ua.ContentFilterElement
+	for _, c := range splitFold(s, " and ") {
+		c = strings.TrimSpace(c)
+		if strings.HasPrefix(strings.ToLower(c), "oftype ") {
+			nid, err := ua.ParseNodeID(strings.TrimSpace(c[len("oftype "):]))
+			if err != nil {
+				return nil, fmt.Errorf("where %q: %w", c, err)
+			}
+			conds = append(conds, &ua.ContentFilterElement{
+				FilterOperator: ua.FilterOperatorOfType,
+				FilterOperands: []*ua.ExtensionObject{literal(nid)},
+			})
+			continue
+		}
+
+		el, err := parseCondition(c)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, el)
+	}
+
+	if len(conds) == 1 {
+		return &ua.ContentFilter{Elements: conds}, nil
+	}
+	// first element is root: And(cond0, And(cond1, ...)), conditions follow And elements
+	n := len(conds)
+	var elements []*ua.ContentFilterElement
+	for i := 0; i < n-1; i++ {
+		second := uint32(i + 1)
+		if i == n-2 {
+			second = uint32(2*n - 2)
+		}
+		elements = append(elements, &ua.ContentFilterElement{
+			FilterOperator: ua.FilterOperatorAnd,
+			FilterOperands: []*ua.ExtensionObject{
+				ua.NewExtensionObject(&ua.ElementOperand{Index: uint32(n - 1 + i)}),
+				ua.NewExtensionObject(&ua.ElementOperand{Index: second}),
+			},
+		})
+	}
+	return &ua.ContentFilter{Elements: append(elements, conds...)}, nil
+}
+
+func parseCondition(c string) (*ua.ContentFilterElement, error) {
+	lc := strings.ToLower(c)
+	for _, o := range whereOperators {
+		i := strings.Index(lc, o.s)
+		if i <= 0 {
+			continue
+		}
+		field := strings.TrimSpace(c[:i])
+		value := strings.TrimSpace(c[i+len(o.s):])
+		if field == "" || value == "" {
+			break
+		}
+
+		var v interface{}
+		switch {
+		case len(value) > 1 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'"):
+			v = value[1 : len(value)-1]
+		default:
+			if n, err := strconv.ParseInt(value, 10, 32); err == nil {
+				v = int32(n)
+			} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+				v = f
+			} else {
+				return nil, fmt.Errorf("where %q: bad value %s", c, value)
+			}
+		}
+
+		op := &ua.SimpleAttributeOperand{
+			TypeDefinitionID: ua.NewNumericNodeID(0, id.BaseEventType),
+			AttributeID:      ua.AttributeIDValue,
+		}
+		for _, n := range strings.Split(field, "/") {
+			op.BrowsePath = append(op.BrowsePath, &ua.QualifiedName{Name: n})
+		}
+		return &ua.ContentFilterElement{
+			FilterOperator: o.op,
+			FilterOperands: []*ua.ExtensionObject{ua.NewExtensionObject(op), literal(v)},
+		}, nil
+	}
+	return nil, fmt.Errorf("where %q: unknown condition", c)
+}
+
+func literal(v interface{}) *ua.ExtensionObject {
+	return ua.NewExtensionObject(&ua.LiteralOperand{Value: ua.MustVariant(v)})
+}
+
+// splitFold is splitting s by separator, case insensitive
+func splitFold(s, sep string) []string {
+	var parts []string
+	ls := strings.ToLower(s)
+	for {
+		i := strings.Index(ls, sep)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s, ls = s[i+len(sep):], ls[i+len(sep):]
+	}
+}
+
+// ParseEvent is converting fields of event (in order of EventFilter) to Event
+func ParseEvent(fields []*ua.Variant) Event {
+	var e Event
+	get := func(i int) interface{} {
+		if i < len(fields) && fields[i] != nil {
+			return fields[i].Value()
+		}
+		return nil
+	}
+
+	e.EventID, _ = get(0).([]byte)
+	if n, ok := get(1).(*ua.NodeID); ok {
+		e.SourceNode = n.String()
+	}
+	e.SourceName, _ = get(2).(string)
+	e.Severity, _ = get(3).(uint16)
+	switch v := get(4).(type) {
+	case string:
+		e.ConditionName = v
+	case *ua.LocalizedText:
+		e.ConditionName = v.Text
+	}
+	if b, ok := get(5).(bool); ok {
+		e.Active = &b
+	}
+	if b, ok := get(6).(bool); ok {
+		e.Acked = &b
+	}
+	e.ConditionID, _ = get(7).(*ua.NodeID)
+	return e
+}
+
+// Match is returns index of alarm of event (-1 - not mapped)
+func (ev *Events) Match(e Event) int {
+	for i, a := range ev.Alarms {
+		if a.Condition != "" && a.Condition != e.ConditionName {
+			continue
+		}
+		if a.Source != "" && a.Source != e.SourceNode && a.Source != e.SourceName {
+			continue
+		}
+		if a.Condition == "" && a.Source == "" {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// Remember is storing condition & event id of alarm for Acknowledge
+func (ev *Events) Remember(alarm int, e Event) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if ev.conditions == nil {
+		ev.conditions = make([]condition, len(ev.Alarms))
+	}
+	if e.ConditionID != nil && len(e.EventID) > 0 {
+		ev.conditions[alarm] = condition{id: e.ConditionID, eventID: e.EventID}
+	}
+}
+
+// Acknowledgeable is checking that alarms have acknowledge coils
+func (ev *Events) Acknowledgeable() bool {
+	for _, a := range ev.Alarms {
+		if a.AckCoil != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// AckAlarm is returns index of alarm with acknowledge coil address (-1 - none)
+func (ev *Events) AckAlarm(address uint16) int {
+	for i, a := range ev.Alarms {
+		if a.AckCoil != nil && *a.AckCoil == address {
+			return i
+		}
+	}
+	return -1
+}
+
+// Acknowledge is calling Acknowledge method of last condition of alarm
+func (dvc *DeviceOPCUA) Acknowledge(ctx context.Context, alarm int, comment string) error {
+	ev := dvc.Events
+	ev.mu.Lock()
+	var c condition
+	if alarm < len(ev.conditions) {
+		c = ev.conditions[alarm]
+	}
+	ev.mu.Unlock()
+
+	if c.id == nil {
+		return fmt.Errorf("no condition of alarm %d", alarm)
+	}
+	client := dvc.client()
+	if client == nil {
+		return fmt.Errorf("not connected")
+	}
+	res, err := client.CallWithContext(ctx, &ua.CallMethodRequest{
+		ObjectID: c.id,
+		MethodID: ua.NewNumericNodeID(0, id.AcknowledgeableConditionType_Acknowledge),
+		InputArguments: []*ua.Variant{
+			ua.MustVariant(c.eventID),
+			ua.MustVariant(ua.NewLocalizedText(comment)),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != ua.StatusOK {
+		return res.StatusCode
+	}
+	return nil
+}
+
+// ConditionRefresh is requesting current state of conditions into subscription
+func (dvc *DeviceOPCUA) ConditionRefresh(ctx context.Context, subscriptionID uint32) error {
+	res, err := dvc.Client.CallWithContext(ctx, &ua.CallMethodRequest{
+		ObjectID:       ua.NewNumericNodeID(0, id.ConditionType),
+		MethodID:       ua.NewNumericNodeID(0, id.ConditionType_ConditionRefresh),
+		InputArguments: []*ua.Variant{ua.MustVariant(subscriptionID)},
+	})
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != ua.StatusOK {
+		return res.StatusCode
+	}
+	return nil
+}
+
+// EventInterval is returns publishing interval of event subscription
+func (ev *Events) EventInterval() time.Duration {
+	if ev.Interval > 0 {
+		return ev.Interval
+	}
+	return DefaultEventInterval
+}
@@ -0,0 +1,118 @@
+package clientopcua
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// DefaultFailoverTimeout is time without session before switching to backup endpoint
+const DefaultFailoverTimeout = 10 * time.Second
+
+// Endpoint is returns endpoint url: "host:port" is completed to "opc.tcp://host:port"
+func Endpoint(s string) string {
+	s = strings.TrimSpace(s)
+	if s != "" && !strings.Contains(s, "://") {
+		s = "opc.tcp://" + s
+	}
+	return s
+}
+
+// Redundant is checking that device has backup endpoints
+func (dvc *DeviceOPCUA) Redundant() bool {
+	return len(dvc.Config.Endpoints) > 1
+}
+
+// NextEndpoint is switching device to next endpoint of Config.Endpoints,
+// options & status are reset, so connection is established again
+func (dvc *DeviceOPCUA) NextEndpoint() string {
+	mu := dvc.lock()
+	mu.Lock()
+	defer mu.Unlock()
+	next := 0
+	for i, e := range dvc.Config.Endpoints {
+		if e == dvc.Config.Endpoint {
+			next = (i + 1) % len(dvc.Config.Endpoints)
+			break
+		}
+	}
+
+	dvc.Config.Endpoint = dvc.Config.Endpoints[next]
+	dvc.Options = nil
+	dvc.Client = nil
+	dvc.Limits = nil
+	dvc.BadNodes = nil
+	dvc.Status = ReadTags
+	dvc.Failovers++
+	return dvc.Config.Endpoint
+}
+
+// FailoverTimeout is returns Config.FailoverTimeout or default
+func (dvc *DeviceOPCUA) FailoverTimeout() time.Duration {
+	if dvc.Config.FailoverTimeout > 0 {
+		return dvc.Config.FailoverTimeout
+	}
+	return DefaultFailoverTimeout
+}
+
+// ServiceLevel is reads ServiceLevel of server (0-255, >= 200 healthy)
+func (dvc *DeviceOPCUA) ServiceLevel(ctx context.Context) (byte, error) {
+	resp, err := dvc.Client.ReadWithContext(ctx, &ua.ReadRequest{
+		NodesToRead: []*ua.ReadValueID{{
+			NodeID:      ua.NewNumericNodeID(0, id.Server_ServiceLevel),
+			AttributeID: ua.AttributeIDValue,
+		}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Status != ua.StatusOK || resp.Results[0].Value == nil {
+		return 0, fmt.Errorf("service level not available")
+	}
+	lvl, ok := resp.Results[0].Value.Value().(byte)
+	if !ok {
+		return 0, fmt.Errorf("bad type of service level: %T", resp.Results[0].Value.Value())
+	}
+	return lvl, nil
+}
+
+// LowServiceLevel is checking ServiceLevel of server against Config.MinServiceLevel
+// (not checked if MinServiceLevel is 0), returns reason of failover
+func (dvc *DeviceOPCUA) LowServiceLevel(ctx context.Context) string {
+	if dvc.Config.MinServiceLevel == 0 {
+		return ""
+	}
+	lvl, err := dvc.ServiceLevel(ctx)
+	if err != nil || lvl >= dvc.Config.MinServiceLevel {
+		return ""
+	}
+	return fmt.Sprintf("service level %d < %d", lvl, dvc.Config.MinServiceLevel)
+}
+
+// Redundancy is reads redundancy support of server (none, cold, warm, hot, transparent...)
+func (dvc *DeviceOPCUA) Redundancy(ctx context.Context) string {
+	v, err := dvc.Client.Node(ua.NewNumericNodeID(0, id.Server_ServerRedundancy_RedundancySupport)).Value()
+	if err != nil || v == nil {
+		return "unknown"
+	}
+	switch n, _ := v.Value().(int32); ua.RedundancySupport(n) {
+	case ua.RedundancySupportNone:
+		return "none"
+	case ua.RedundancySupportCold:
+		return "cold"
+	case ua.RedundancySupportWarm:
+		return "warm"
+	case ua.RedundancySupportHot:
+		return "hot"
+	case ua.RedundancySupportTransparent:
+		return "transparent"
+	case ua.RedundancySupportHotAndMirrored:
+		return "hot and mirrored"
+	default:
+		return "unknown"
+	}
+}
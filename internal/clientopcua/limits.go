@@ -0,0 +1,126 @@
+package clientopcua
+
+import (
+	"context"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// DefaultMaxNodesPerRead is batch size of Read, if server does not limit it
+const DefaultMaxNodesPerRead = 1000
+
+// DefaultMaxMonitoredItemsPerCall is batch size of CreateMonitoredItems, if server does not limit it
+const DefaultMaxMonitoredItemsPerCall = 1000
+
+// OperationLimits is limits of server (0 - not limited)
+type OperationLimits struct {
+	MaxNodesPerRead                  uint32
+	MaxMonitoredItemsPerCall         uint32
+	MaxMonitoredItemsPerSubscription uint32
+}
+
+// maxMonitoredItemsPerSubscription is browse path of ServerCapabilities property
+// (OPC UA 1.05, node id is not known by gopcua v0.3)
+const maxMonitoredItemsPerSubscription = "ServerCapabilities.MaxMonitoredItemsPerSubscription"
+
+// ReadOperationLimits is reading OperationLimits of server, limits not provided by server are 0.
+// Config.MaxItemsPerSubscription overrides limit of monitored items per subscription.
+func (dvc *DeviceOPCUA) ReadOperationLimits(ctx context.Context) OperationLimits {
+	var lim OperationLimits
+
+	req := &ua.ReadRequest{}
+	for _, n := range []uint32{
+		id.Server_ServerCapabilities_OperationLimits_MaxNodesPerRead,
+		id.Server_ServerCapabilities_OperationLimits_MaxMonitoredItemsPerCall,
+	} {
+		req.NodesToRead = append(req.NodesToRead, &ua.ReadValueID{
+			NodeID:      ua.NewNumericNodeID(0, n),
+			AttributeID: ua.AttributeIDValue,
+		})
+	}
+	if resp, err := dvc.Client.ReadWithContext(ctx, req); err == nil && len(resp.Results) == 2 {
+		lim.MaxNodesPerRead = limitValue(resp.Results[0])
+		lim.MaxMonitoredItemsPerCall = limitValue(resp.Results[1])
+	}
+
+	server := dvc.Client.Node(ua.NewNumericNodeID(0, id.Server))
+	if nid, err := server.TranslateBrowsePathInNamespaceToNodeIDWithContext(ctx, 0, maxMonitoredItemsPerSubscription); err == nil {
+		if v, err := dvc.Client.Node(nid).Value(); err == nil && v != nil {
+			lim.MaxMonitoredItemsPerSubscription, _ = v.Value().(uint32)
+		}
+	}
+	if dvc.Config.MaxItemsPerSubscription > 0 {
+		lim.MaxMonitoredItemsPerSubscription = dvc.Config.MaxItemsPerSubscription
+	}
+
+	mu := dvc.lock()
+	mu.Lock()
+	dvc.Limits = &lim
+	mu.Unlock()
+	return lim
+}
+
+func limitValue(dv *ua.DataValue) uint32 {
+	if dv == nil || dv.Status != ua.StatusOK || dv.Value == nil {
+		return 0
+	}
+	n, _ := dv.Value.Value().(uint32)
+	return n
+}
+
+// OperationLimits is returns limits read on connect (reads them once)
+func (dvc *DeviceOPCUA) OperationLimits(ctx context.Context) OperationLimits {
+	if lim, ok := dvc.LimitsSnapshot(); ok {
+		return lim
+	}
+	return dvc.ReadOperationLimits(ctx)
+}
+
+// ReadBatch is number of nodes in one Read call
+func (lim OperationLimits) ReadBatch() int {
+	if lim.MaxNodesPerRead == 0 {
+		return DefaultMaxNodesPerRead
+	}
+	return int(lim.MaxNodesPerRead)
+}
+
+// MonitorBatch is number of monitored items in one CreateMonitoredItems call
+func (lim OperationLimits) MonitorBatch() int {
+	if lim.MaxMonitoredItemsPerCall == 0 {
+		return DefaultMaxMonitoredItemsPerCall
+	}
+	return int(lim.MaxMonitoredItemsPerCall)
+}
+
+// Split is splitting subscription groups by limit of monitored items per subscription,
+// parts of group have the same name & publishing interval
+func (lim OperationLimits) Split(groups []SubscriptionGroup) []SubscriptionGroup {
+	max := int(lim.MaxMonitoredItemsPerSubscription)
+	if max == 0 {
+		return groups
+	}
+	var out []SubscriptionGroup
+	for _, g := range groups {
+		for _, part := range chunks(g.Nodes, max) {
+			out = append(out, SubscriptionGroup{Name: g.Name, Interval: g.Interval, Nodes: part})
+		}
+	}
+	return out
+}
+
+// chunks is splitting nodes into parts of size n
+func chunks(nodes []string, n int) [][]string {
+	if n <= 0 || len(nodes) <= n {
+		return [][]string{nodes}
+	}
+	var out [][]string
+	for start := 0; start < len(nodes); start += n {
+		end := start + n
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		out = append(out, nodes[start:end])
+	}
+	return out
+}
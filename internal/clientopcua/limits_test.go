@@ -0,0 +1,71 @@
+package clientopcua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationLimitsBatch(t *testing.T) {
+	require.Equal(t, DefaultMaxNodesPerRead, OperationLimits{}.ReadBatch())
+	require.Equal(t, 50, OperationLimits{MaxNodesPerRead: 50}.ReadBatch())
+	require.Equal(t, DefaultMaxMonitoredItemsPerCall, OperationLimits{}.MonitorBatch())
+	require.Equal(t, 20, OperationLimits{MaxMonitoredItemsPerCall: 20}.MonitorBatch())
+}
+
+func TestLimitValue(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		dv   *ua.DataValue
+		want uint32
+	}{
+		{name: "nil", dv: nil},
+		{name: "bad status", dv: &ua.DataValue{Status: ua.StatusBadNodeIDUnknown, Value: ua.MustVariant(uint32(10))}},
+		{name: "no value", dv: &ua.DataValue{Status: ua.StatusOK}},
+		{name: "wrong type", dv: &ua.DataValue{Status: ua.StatusOK, Value: ua.MustVariant(int32(10))}},
+		{name: "limit", dv: &ua.DataValue{Status: ua.StatusOK, Value: ua.MustVariant(uint32(10))}, want: 10},
+	} {
+		require.Equal(t, tc.want, limitValue(tc.dv), tc.name)
+	}
+}
+
+func TestOperationLimitsSplit(t *testing.T) {
+	groups := []SubscriptionGroup{
+		{Name: "fast", Interval: 100 * time.Millisecond, Nodes: []string{"a", "b", "c", "d", "e"}},
+		{Name: "default", Interval: DefaultPublishInterval, Nodes: []string{"f", "g"}},
+	}
+	for _, tc := range []struct {
+		max  uint32
+		want []SubscriptionGroup
+	}{
+		{max: 0, want: groups},
+		{max: 5, want: groups},
+		{max: 2, want: []SubscriptionGroup{
+			{Name: "fast", Interval: 100 * time.Millisecond, Nodes: []string{"a", "b"}},
+			{Name: "fast", Interval: 100 * time.Millisecond, Nodes: []string{"c", "d"}},
+			{Name: "fast", Interval: 100 * time.Millisecond, Nodes: []string{"e"}},
+			{Name: "default", Interval: DefaultPublishInterval, Nodes: []string{"f", "g"}},
+		}},
+		{max: 1, want: []SubscriptionGroup{
+			{Name: "fast", Interval: 100 * time.Millisecond, Nodes: []string{"a"}},
+			{Name: "fast", Interval: 100 * time.Millisecond, Nodes: []string{"b"}},
+			{Name: "fast", Interval: 100 * time.Millisecond, Nodes: []string{"c"}},
+			{Name: "fast", Interval: 100 * time.Millisecond, Nodes: []string{"d"}},
+			{Name: "fast", Interval: 100 * time.Millisecond, Nodes: []string{"e"}},
+			{Name: "default", Interval: DefaultPublishInterval, Nodes: []string{"f"}},
+			{Name: "default", Interval: DefaultPublishInterval, Nodes: []string{"g"}},
+		}},
+	} {
+		require.Equal(t, tc.want, OperationLimits{MaxMonitoredItemsPerSubscription: tc.max}.Split(groups), tc.max)
+	}
+}
+
+func TestChunks(t *testing.T) {
+	nodes := []string{"a", "b", "c"}
+	require.Equal(t, [][]string{nodes}, chunks(nodes, 0))
+	require.Equal(t, [][]string{nodes}, chunks(nodes, 3))
+	require.Equal(t, [][]string{{"a", "b"}, {"c"}}, chunks(nodes, 2))
+	require.Equal(t, [][]string{{"a"}, {"b"}, {"c"}}, chunks(nodes, 1))
+}
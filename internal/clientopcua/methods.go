@@ -0,0 +1,186 @@
+package clientopcua
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+// Method is OPC UA method called by write of master to trigger coil or holding register.
+// Input arguments are read from holding registers from ArgsAddr (types in Args),
+// status code (2 input registers) and output arguments (input registers) are written back.
+type Method struct {
+	Name        string
+	Object      string // node of object
+	Method      string // node of method
+	Trigger     uint8  // modbus.ReadCoils or modbus.ReadHoldingRegisters
+	TriggerAddr uint16
+	ArgsAddr    uint16
+	Args        []string // types of input arguments
+	StatusAddr  *uint16  // input registers of status code
+	OutputsAddr *uint16  // input registers of output arguments
+}
+
+// RegisterCount is returns number of registers of value of type (0 - unsupported)
+func RegisterCount(typ string) int {
+	switch strings.ToLower(strings.TrimSpace(typ)) {
+	case "bool", "boolean", "byte", "sbyte", "int8", "uint8", "int16", "uint16", "word":
+		return 1
+	case "int32", "dint", "uint32", "dword", "float32", "float", "real":
+		return 2
+	case "int64", "uint64", "float64", "double", "lreal":
+		return 4
+	default:
+		return 0
+	}
+}
+
+// ArgsCount is returns number of holding registers of input arguments
+func (m Method) ArgsCount() int {
+	n := 0
+	for _, a := range m.Args {
+		n += RegisterCount(a)
+	}
+	return n
+}
+
+// FromRegisters is converting registers (big-endian words) to value of type
+func FromRegisters(typ string, regs []uint16) (interface{}, error) {
+	n := RegisterCount(typ)
+	if n == 0 {
+		return nil, fmt.Errorf("unsupported argument type %q", typ)
+	}
+	if len(regs) < n {
+		return nil, fmt.Errorf("%s: not enough registers", typ)
+	}
+	var u uint64
+	for _, r := range regs[:n] {
+		u = u<<16 | uint64(r)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(typ)) {
+	case "bool", "boolean":
+		return u != 0, nil
+	case "byte", "uint8":
+		return byte(u), nil
+	case "sbyte", "int8":
+		return int8(u), nil
+	case "int16":
+		return int16(u), nil
+	case "uint16", "word":
+		return uint16(u), nil
+	case "int32", "dint":
+		return int32(u), nil
+	case "uint32", "dword":
+		return uint32(u), nil
+	case "float32", "float", "real":
+		return math.Float32frombits(uint32(u)), nil
+	case "int64":
+		return int64(u), nil
+	case "uint64":
+		return u, nil
+	default:
+		return math.Float64frombits(u), nil
+	}
+}
+
+// ToRegisters is converting value to registers (big-endian words) of type, inverse of FromRegisters
+func ToRegisters(typ string, v interface{}) ([]uint16, error) {
+	n := RegisterCount(typ)
+	if n == 0 {
+		return nil, fmt.Errorf("unsupported type %q", typ)
+	}
+	var u uint64
+	switch v := v.(type) {
+	case bool:
+		if v {
+			u = 1
+		}
+	case int8:
+		u = uint64(uint8(v))
+	case uint8:
+		u = uint64(v)
+	case int16:
+		u = uint64(uint16(v))
+	case uint16:
+		u = uint64(v)
+	case int32:
+		u = uint64(uint32(v))
+	case uint32:
+		u = uint64(v)
+	case int64:
+		u = uint64(v)
+	case uint64:
+		u = v
+	case float32:
+		u = uint64(math.Float32bits(v))
+	case float64:
+		u = math.Float64bits(v)
+		if n == 2 {
+			u = uint64(math.Float32bits(float32(v)))
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported value %T", typ, v)
+	}
+
+	regs := make([]uint16, n)
+	for i := n - 1; i >= 0; i-- {
+		regs[i] = uint16(u)
+		u >>= 16
+	}
+	return regs, nil
+}
+
+// CallMethod is calling method with input arguments from registers
+func (dvc *DeviceOPCUA) CallMethod(ctx context.Context, m Method, regs []uint16) (*ua.CallMethodResult, error) {
+	client := dvc.client()
+	if client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	obj, err := dvc.resolveNode(ctx, m.Object)
+	if err != nil {
+		return nil, fmt.Errorf("object: %w", err)
+	}
+	meth, err := dvc.resolveNode(ctx, m.Method)
+	if err != nil {
+		return nil, fmt.Errorf("method: %w", err)
+	}
+
+	req := &ua.CallMethodRequest{ObjectID: obj, MethodID: meth}
+	for _, typ := range m.Args {
+		v, err := FromRegisters(typ, regs)
+		if err != nil {
+			return nil, err
+		}
+		req.InputArguments = append(req.InputArguments, ua.MustVariant(v))
+		regs = regs[RegisterCount(typ):]
+	}
+	return client.CallWithContext(ctx, req)
+}
+
+// resolveNode is resolving node id, namespace uri or browse path (as tag nodes)
+func (dvc *DeviceOPCUA) resolveNode(ctx context.Context, node string) (*ua.NodeID, error) {
+	switch {
+	case strings.HasPrefix(node, "nsu="):
+		ns, err := dvc.Client.NamespaceArrayWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		eid, err := ua.ParseExpandedNodeID(node, ns)
+		if err != nil {
+			return nil, err
+		}
+		return eid.NodeID, nil
+	case IsBrowsePath(node):
+		start, segs, err := parseBrowsePath(node)
+		if err != nil {
+			return nil, err
+		}
+		return dvc.browsePath(ctx, start, segs)
+	default:
+		return ua.ParseNodeID(node)
+	}
+}
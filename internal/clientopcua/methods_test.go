@@ -0,0 +1,96 @@
+package clientopcua
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterCount(t *testing.T) {
+	for typ, want := range map[string]int{
+		"bool": 1, "Boolean": 1, "byte": 1, "int8": 1, "int16": 1, " word ": 1,
+		"int32": 2, "dint": 2, "dword": 2, "float32": 2, "REAL": 2,
+		"int64": 4, "uint64": 4, "float64": 4, "lreal": 4,
+		"string": 0, "": 0,
+	} {
+		require.Equal(t, want, RegisterCount(typ), typ)
+	}
+	m := Method{Args: []string{"int16", "float32", "float64", "string"}}
+	require.Equal(t, 7, m.ArgsCount())
+}
+
+func TestFromRegisters(t *testing.T) {
+	for _, tc := range []struct {
+		typ  string
+		regs []uint16
+		want interface{}
+		err  bool
+	}{
+		{typ: "bool", regs: []uint16{0}, want: false},
+		{typ: "boolean", regs: []uint16{2}, want: true},
+		{typ: "byte", regs: []uint16{0x01ff}, want: byte(0xff)},
+		{typ: "int8", regs: []uint16{0xffff}, want: int8(-1)},
+		{typ: "int16", regs: []uint16{0xfff6}, want: int16(-10)},
+		{typ: "word", regs: []uint16{0xfff6}, want: uint16(0xfff6)},
+		{typ: "dint", regs: []uint16{0xffff, 0xfffe}, want: int32(-2)},
+		{typ: "uint32", regs: []uint16{0x1234, 0x5678, 0x9abc}, want: uint32(0x12345678)},
+		{typ: "real", regs: []uint16{0x41a4, 0x0000}, want: float32(20.5)},
+		{typ: "int64", regs: []uint16{0xffff, 0xffff, 0xffff, 0xff85}, want: int64(-123)},
+		{typ: "uint64", regs: []uint16{0x0001, 0x0002, 0x0003, 0x0004}, want: uint64(0x0001000200030004)},
+		{typ: "lreal", regs: []uint16{0x4035, 0x0000, 0x0000, 0x0000}, want: 21.0},
+		{typ: "float32", regs: []uint16{0x41a4}, err: true},
+		{typ: "string", regs: []uint16{0x4142}, err: true},
+	} {
+		v, err := FromRegisters(tc.typ, tc.regs)
+		if tc.err {
+			require.Error(t, err, tc.typ)
+			continue
+		}
+		require.NoError(t, err, tc.typ)
+		require.Equal(t, tc.want, v, tc.typ)
+	}
+}
+
+func TestToRegisters(t *testing.T) {
+	for _, tc := range []struct {
+		typ  string
+		in   interface{}
+		want []uint16
+		err  bool
+	}{
+		{typ: "bool", in: true, want: []uint16{1}},
+		{typ: "bool", in: false, want: []uint16{0}},
+		{typ: "int8", in: int8(-1), want: []uint16{0x00ff}},
+		{typ: "int16", in: int16(-10), want: []uint16{0xfff6}},
+		{typ: "word", in: uint16(0xfff6), want: []uint16{0xfff6}},
+		{typ: "dint", in: int32(-2), want: []uint16{0xffff, 0xfffe}},
+		{typ: "uint32", in: uint32(0x12345678), want: []uint16{0x1234, 0x5678}},
+		{typ: "real", in: float32(20.5), want: []uint16{0x41a4, 0x0000}},
+		{typ: "float32", in: 20.5, want: []uint16{0x41a4, 0x0000}},
+		{typ: "lreal", in: 21.0, want: []uint16{0x4035, 0, 0, 0}},
+		{typ: "int64", in: int64(-123), want: []uint16{0xffff, 0xffff, 0xffff, 0xff85}},
+		{typ: "uint64", in: uint64(0x0001000200030004), want: []uint16{1, 2, 3, 4}},
+		{typ: "int16", in: "10", err: true},
+		{typ: "string", in: int16(1), err: true},
+	} {
+		regs, err := ToRegisters(tc.typ, tc.in)
+		if tc.err {
+			require.Error(t, err, tc.typ)
+			continue
+		}
+		require.NoError(t, err, tc.typ)
+		require.Equal(t, tc.want, regs, tc.typ)
+	}
+
+	// inverse of FromRegisters
+	for typ, v := range map[string]interface{}{
+		"int16": int16(-300), "uint16": uint16(40000), "int32": int32(-70000), "float32": float32(-1.25),
+		"int64": int64(-1) << 40, "float64": 3.5, "bool": true,
+	} {
+		regs, err := ToRegisters(typ, v)
+		require.NoError(t, err, typ)
+		back, err := FromRegisters(typ, regs)
+		require.NoError(t, err, typ)
+		require.Equal(t, v, back, typ)
+	}
+}
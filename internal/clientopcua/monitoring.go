@@ -0,0 +1,241 @@
+package clientopcua
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// DefaultPublishInterval is publishing interval of subscription "default"
+const DefaultPublishInterval = 3 * time.Second
+
+// Monitoring is parameters of monitored item of tag
+type Monitoring struct {
+	Subscription     string        // group of tags in one subscription (name or publishing interval, e.g. "500ms")
+	SamplingInterval time.Duration // 0 - fastest (as publishing interval)
+	QueueSize        uint32
+	DiscardOldest    bool
+	DeadbandType     ua.DeadbandType
+	DeadbandValue    float64
+	Trigger          ua.DataChangeTrigger
+}
+
+// DefaultMonitoring is monitoring parameters by default
+func DefaultMonitoring() Monitoring {
+	return Monitoring{
+		Subscription:  "default",
+		QueueSize:     10,
+		DiscardOldest: true,
+		Trigger:       ua.DataChangeTriggerStatusValue,
+	}
+}
+
+// ParseMonitoring is parsing optional tags tsv columns:
+// subscription, sampling interval, queue size, discard oldest, deadband type, deadband value, trigger
+func ParseMonitoring(cols []string) (Monitoring, error) {
+	m := DefaultMonitoring()
+	col := func(i int) string {
+		if i < len(cols) {
+			return strings.TrimSpace(cols[i])
+		}
+		return ""
+	}
+
+	var err error
+	if v := col(0); v != "" {
+		m.Subscription = v
+	}
+	if v := col(1); v != "" {
+		if m.SamplingInterval, err = ParseInterval(v); err != nil {
+			return m, fmt.Errorf("sampling interval: %w", err)
+		}
+	}
+	if v := col(2); v != "" {
+		q, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return m, fmt.Errorf("queue size: %w", err)
+		}
+		m.QueueSize = uint32(q)
+	}
+	if v := col(3); v != "" {
+		if m.DiscardOldest, err = strconv.ParseBool(v); err != nil {
+			return m, fmt.Errorf("discard oldest: %w", err)
+		}
+	}
+	if m.DeadbandType, err = ParseDeadbandType(col(4)); err != nil {
+		return m, err
+	}
+	if v := col(5); v != "" {
+		if m.DeadbandValue, err = strconv.ParseFloat(v, 64); err != nil {
+			return m, fmt.Errorf("deadband: %w", err)
+		}
+	}
+	if m.Trigger, err = ParseTrigger(col(6)); err != nil {
+		return m, err
+	}
+
+	return m, nil
+}
+
+// ParseInterval is parsing duration ("100ms", "1s") or milliseconds ("100")
+func ParseInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if ms, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// ParseDeadbandType is parsing deadband type: none, absolute, percent
+func ParseDeadbandType(s string) (ua.DeadbandType, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none":
+		return ua.DeadbandTypeNone, nil
+	case "absolute", "abs":
+		return ua.DeadbandTypeAbsolute, nil
+	case "percent", "%":
+		return ua.DeadbandTypePercent, nil
+	default:
+		return 0, fmt.Errorf("unknown deadband type %q", s)
+	}
+}
+
+// ParseTrigger is parsing data change trigger: status, value (status/value), timestamp (status/value/timestamp)
+func ParseTrigger(s string) (ua.DataChangeTrigger, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "status":
+		return ua.DataChangeTriggerStatus, nil
+	case "", "value", "statusvalue":
+		return ua.DataChangeTriggerStatusValue, nil
+	case "timestamp", "statusvaluetimestamp":
+		return ua.DataChangeTriggerStatusValueTimestamp, nil
+	default:
+		return 0, fmt.Errorf("unknown trigger %q", s)
+	}
+}
+
+// Parameters is returns monitoring parameters of monitored item
+func (m Monitoring) Parameters() *ua.MonitoringParameters {
+	p := &ua.MonitoringParameters{
+		SamplingInterval: float64(m.SamplingInterval) / float64(time.Millisecond),
+		QueueSize:        m.QueueSize,
+		DiscardOldest:    m.DiscardOldest,
+	}
+	if m.DeadbandType != ua.DeadbandTypeNone || m.Trigger != ua.DataChangeTriggerStatusValue {
+		p.Filter = ua.NewExtensionObject(&ua.DataChangeFilter{
+			Trigger:       m.Trigger,
+			DeadbandType:  uint32(m.DeadbandType),
+			DeadbandValue: m.DeadbandValue,
+		})
+	}
+	return p
+}
+
+// SubscriptionGroup is tags of one subscription
+type SubscriptionGroup struct {
+	Name     string
+	Interval time.Duration // publishing interval
+	Nodes    []string
+}
+
+// SubscriptionGroups is grouping device tags into subscriptions.
+// Publishing interval is taken from Config.PublishIntervals by name of group,
+// or from name of group if it is a duration ("500ms").
+func (dvc *DeviceOPCUA) SubscriptionGroups() ([]SubscriptionGroup, error) {
+	idx := map[string]int{}
+	var groups []SubscriptionGroup
+	for _, n := range dvc.Nodes {
+		name := dvc.Tags[n].Monitoring.Subscription
+		if name == "" {
+			name = "default"
+		}
+		i, ok := idx[name]
+		if !ok {
+			interval, err := dvc.publishInterval(name)
+			if err != nil {
+				return nil, err
+			}
+			i = len(groups)
+			idx[name] = i
+			groups = append(groups, SubscriptionGroup{Name: name, Interval: interval})
+		}
+		groups[i].Nodes = append(groups[i].Nodes, n)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Interval < groups[j].Interval })
+	return groups, nil
+}
+
+func (dvc *DeviceOPCUA) publishInterval(name string) (time.Duration, error) {
+	if d, ok := dvc.Config.PublishIntervals[name]; ok {
+		return d, nil
+	}
+	if name == "default" {
+		return DefaultPublishInterval, nil
+	}
+	d, err := ParseInterval(name)
+	if err != nil {
+		return 0, fmt.Errorf("subscription %q: unknown publishing interval", name)
+	}
+	return d, nil
+}
+
+// MonitorRequest is returns request of monitored item of value of node (client handle is set on create)
+func (dvc *DeviceOPCUA) MonitorRequest(node string) (*ua.MonitoredItemCreateRequest, error) {
+	id, err := dvc.NodeID(node)
+	if err != nil {
+		return nil, err
+	}
+	req := opcua.NewMonitoredItemCreateRequestWithDefaults(id, ua.AttributeIDValue, 0)
+	req.RequestedParameters = dvc.Tags[node].Monitoring.Parameters()
+	return req, nil
+}
+
+// AddMonitoredItems is adding monitored items of nodes to subscription
+// in batches of CreateMonitoredItems calls (nodes in BadNodes and refused are skipped),
+// returns number of calls and errors by node (status of item or error of call of its batch)
+func (dvc *DeviceOPCUA) AddMonitoredItems(ctx context.Context, sub *Subscription, nodes []string, batch int) (int, map[string]error) {
+	errs := map[string]error{}
+	var reqs []*ua.MonitoredItemCreateRequest
+	var reqNodes []string
+	for _, node := range nodes {
+		req, err := dvc.MonitorRequest(node)
+		if err != nil {
+			errs[node] = err
+			continue
+		}
+		if st, ok := dvc.badNode(node); ok {
+			errs[node] = st
+			continue
+		}
+		if dvc.Refused(node) {
+			msg, _ := dvc.tagIssue(node)
+			errs[node] = fmt.Errorf("refused: %s", msg)
+			continue
+		}
+		reqs = append(reqs, req)
+		reqNodes = append(reqNodes, node)
+	}
+
+	if batch <= 0 {
+		batch = DefaultMaxMonitoredItemsPerCall
+	}
+	calls := 0
+	for start := 0; start < len(reqs); start += batch {
+		end := start + batch
+		if end > len(reqs) {
+			end = len(reqs)
+		}
+		calls++
+		for node, err := range sub.create(ctx, reqNodes[start:end], reqs[start:end]) {
+			errs[node] = fmt.Errorf("batch %d-%d: %w", start, end-1, err)
+		}
+	}
+	return calls, errs
+}
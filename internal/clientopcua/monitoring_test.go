@@ -0,0 +1,183 @@
+package clientopcua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInterval(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want time.Duration
+		err  bool
+	}{
+		{in: "100", want: 100 * time.Millisecond},
+		{in: " 2.5 ", want: 2500 * time.Microsecond},
+		{in: "0", want: 0},
+		{in: "500ms", want: 500 * time.Millisecond},
+		{in: "1m30s", want: 90 * time.Second},
+		{in: "", err: true},
+		{in: "soon", err: true},
+		{in: "10 s", err: true},
+	} {
+		d, err := ParseInterval(tc.in)
+		if tc.err {
+			require.Error(t, err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.want, d, tc.in)
+	}
+}
+
+func TestParseTrigger(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want ua.DataChangeTrigger
+		err  bool
+	}{
+		{in: "", want: ua.DataChangeTriggerStatusValue},
+		{in: "value", want: ua.DataChangeTriggerStatusValue},
+		{in: "StatusValue", want: ua.DataChangeTriggerStatusValue},
+		{in: " status ", want: ua.DataChangeTriggerStatus},
+		{in: "timestamp", want: ua.DataChangeTriggerStatusValueTimestamp},
+		{in: "StatusValueTimestamp", want: ua.DataChangeTriggerStatusValueTimestamp},
+		{in: "always", err: true},
+	} {
+		tr, err := ParseTrigger(tc.in)
+		if tc.err {
+			require.Error(t, err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.want, tr, tc.in)
+	}
+}
+
+func TestParseDeadbandType(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want ua.DeadbandType
+		err  bool
+	}{
+		{in: "", want: ua.DeadbandTypeNone},
+		{in: "None", want: ua.DeadbandTypeNone},
+		{in: "absolute", want: ua.DeadbandTypeAbsolute},
+		{in: "abs", want: ua.DeadbandTypeAbsolute},
+		{in: "Percent", want: ua.DeadbandTypePercent},
+		{in: "%", want: ua.DeadbandTypePercent},
+		{in: "absolut", err: true},
+	} {
+		d, err := ParseDeadbandType(tc.in)
+		if tc.err {
+			require.Error(t, err, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.want, d, tc.in)
+	}
+}
+
+func TestParseMonitoring(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cols []string
+		want Monitoring
+		err  bool
+	}{
+		{name: "defaults", cols: nil, want: DefaultMonitoring()},
+		{name: "empty columns", cols: []string{"", " ", "", "", "", "", ""}, want: DefaultMonitoring()},
+		{
+			name: "all columns",
+			cols: []string{"fast", "100", "5", "false", "absolute", "0.5", "timestamp"},
+			want: Monitoring{
+				Subscription:     "fast",
+				SamplingInterval: 100 * time.Millisecond,
+				QueueSize:        5,
+				DeadbandType:     ua.DeadbandTypeAbsolute,
+				DeadbandValue:    0.5,
+				Trigger:          ua.DataChangeTriggerStatusValueTimestamp,
+			},
+		},
+		{
+			name: "subscription by interval",
+			cols: []string{"500ms", "250ms"},
+			want: func() Monitoring {
+				m := DefaultMonitoring()
+				m.Subscription = "500ms"
+				m.SamplingInterval = 250 * time.Millisecond
+				return m
+			}(),
+		},
+		{name: "sampling interval", cols: []string{"", "fast"}, err: true},
+		{name: "queue size", cols: []string{"", "", "-1"}, err: true},
+		{name: "discard oldest", cols: []string{"", "", "", "maybe"}, err: true},
+		{name: "deadband type", cols: []string{"", "", "", "", "absolut"}, err: true},
+		{name: "deadband", cols: []string{"", "", "", "", "percent", "ten"}, err: true},
+		{name: "trigger", cols: []string{"", "", "", "", "", "", "always"}, err: true},
+	} {
+		m, err := ParseMonitoring(tc.cols)
+		if tc.err {
+			require.Error(t, err, tc.name)
+			continue
+		}
+		require.NoError(t, err, tc.name)
+		require.Equal(t, tc.want, m, tc.name)
+	}
+}
+
+func TestMonitoringParameters(t *testing.T) {
+	p := DefaultMonitoring().Parameters()
+	require.Nil(t, p.Filter)
+	require.Equal(t, uint32(10), p.QueueSize)
+	require.True(t, p.DiscardOldest)
+
+	m := DefaultMonitoring()
+	m.SamplingInterval = 250 * time.Millisecond
+	m.DeadbandType = ua.DeadbandTypePercent
+	m.DeadbandValue = 2
+	p = m.Parameters()
+	require.Equal(t, 250.0, p.SamplingInterval)
+	require.Equal(t, &ua.DataChangeFilter{
+		Trigger:       ua.DataChangeTriggerStatusValue,
+		DeadbandType:  uint32(ua.DeadbandTypePercent),
+		DeadbandValue: 2,
+	}, p.Filter.Value)
+
+	m = DefaultMonitoring()
+	m.Trigger = ua.DataChangeTriggerStatus
+	require.NotNil(t, m.Parameters().Filter)
+}
+
+func TestSubscriptionGroups(t *testing.T) {
+	tag := func(sub string) Tag {
+		m := DefaultMonitoring()
+		m.Subscription = sub
+		return Tag{Monitoring: m}
+	}
+	dvc := DeviceOPCUA{
+		Config: Config{PublishIntervals: map[string]time.Duration{"fast": 100 * time.Millisecond}},
+		Nodes:  []string{"a", "b", "c", "d", "e"},
+		Tags: map[string]Tag{
+			"a": tag(""),
+			"b": tag("fast"),
+			"c": tag("1s"),
+			"d": tag("default"),
+			"e": tag("fast"),
+		},
+	}
+	groups, err := dvc.SubscriptionGroups()
+	require.NoError(t, err)
+	require.Equal(t, []SubscriptionGroup{
+		{Name: "fast", Interval: 100 * time.Millisecond, Nodes: []string{"b", "e"}},
+		{Name: "1s", Interval: time.Second, Nodes: []string{"c"}},
+		{Name: "default", Interval: DefaultPublishInterval, Nodes: []string{"a", "d"}},
+	}, groups)
+
+	dvc.Tags["c"] = tag("slow")
+	_, err = dvc.SubscriptionGroups()
+	require.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package clientopcua
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/sirupsen/logrus"
+)
+
+// read modes of device
+const (
+	ModeSubscribe = "subscribe"
+	ModePoll      = "poll"
+)
+
+// DefaultPollInterval is cycle of polling, if not configured
+const DefaultPollInterval = time.Second
+
+// PollStats is diagnostics of polling
+type PollStats struct {
+	mu        sync.Mutex
+	Cycles    uint64
+	Overruns  uint64
+	Errors    uint64
+	LastCycle time.Duration
+	MaxCycle  time.Duration
+	LastError string
+}
+
+func (ps *PollStats) record(d, interval time.Duration, err error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.Cycles++
+	ps.LastCycle = d
+	if d > ps.MaxCycle {
+		ps.MaxCycle = d
+	}
+	if d > interval {
+		ps.Overruns++
+	}
+	if err != nil {
+		ps.Errors++
+		ps.LastError = err.Error()
+	}
+}
+
+// Snapshot is returns copy of stats
+func (ps *PollStats) Snapshot() PollStats {
+	if ps == nil {
+		return PollStats{}
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return PollStats{
+		Cycles:    ps.Cycles,
+		Overruns:  ps.Overruns,
+		Errors:    ps.Errors,
+		LastCycle: ps.LastCycle,
+		MaxCycle:  ps.MaxCycle,
+		LastError: ps.LastError,
+	}
+}
+
+// Poll is reading all nodes in batched Read calls every Config.PollInterval
+// (first cycle after interval, initial read is done by InitialRead),
+// handler is called for every node with result of any status (value of bad result may be nil)
+func (dvc *DeviceOPCUA) Poll(ctx context.Context, logg *logrus.Logger, handler func(node string, dv *ua.DataValue)) {
+	interval := dvc.Config.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	stats := dvc.pollStats()
+	batch := dvc.OperationLimits(ctx).ReadBatch()
+	logg.Debug(dvc.Config.Endpoint, " polling ", len(dvc.Nodes), " tags every ", interval, ", max nodes per read: ", batch)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		results, err := dvc.ReadNodes(ctx, dvc.Nodes, batch)
+		if err == nil {
+			for i, dv := range results {
+				if dv == nil {
+					continue
+				}
+				dvc.Results.Set(dvc.Nodes[i], dv)
+				handler(dvc.Nodes[i], dv)
+			}
+		} else {
+			logg.Debug(dvc.Config.Endpoint, " poll error: ", err)
+		}
+
+		d := time.Since(start)
+		stats.record(d, interval, err)
+		if d > interval {
+			logg.Debug(dvc.Config.Endpoint, " poll overrun: ", d, " > ", interval)
+		}
+	}
+}
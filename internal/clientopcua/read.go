@@ -0,0 +1,97 @@
+package clientopcua
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+// ReadNodes is reading values of nodes in batches of Read service calls,
+// results are in order of nodes (unresolved node has status BadNodeIdUnknown)
+func (dvc *DeviceOPCUA) ReadNodes(ctx context.Context, nodes []string, batch int) ([]*ua.DataValue, error) {
+	return dvc.readNodes(ctx, nodes, batch, dvc.Client.ReadWithContext)
+}
+
+// readNodes is ReadNodes with Read service call read
+func (dvc *DeviceOPCUA) readNodes(ctx context.Context, nodes []string, batch int,
+	read func(context.Context, *ua.ReadRequest) (*ua.ReadResponse, error)) ([]*ua.DataValue, error) {
+	if batch <= 0 {
+		batch = DefaultMaxNodesPerRead
+	}
+
+	results := make([]*ua.DataValue, len(nodes))
+	var idx []int
+	var ids []*ua.NodeID
+	for i, n := range nodes {
+		nid, err := dvc.NodeID(n)
+		if err != nil {
+			results[i] = &ua.DataValue{Status: ua.StatusBadNodeIDUnknown}
+			continue
+		}
+		idx = append(idx, i)
+		ids = append(ids, nid)
+	}
+
+	for start := 0; start < len(ids); start += batch {
+		end := start + batch
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		req := &ua.ReadRequest{
+			TimestampsToReturn: ua.TimestampsToReturnBoth,
+		}
+		for _, nid := range ids[start:end] {
+			req.NodesToRead = append(req.NodesToRead, &ua.ReadValueID{
+				NodeID:      nid,
+				AttributeID: ua.AttributeIDValue,
+			})
+		}
+
+		resp, err := read(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Results) != end-start {
+			return nil, fmt.Errorf("read response length mismatch")
+		}
+		for i, dv := range resp.Results {
+			results[idx[start+i]] = dv
+		}
+	}
+
+	return results, nil
+}
+
+// InitialRead is reading all nodes of device once (on session established or restored),
+// handler is called for every node with result of any status, returns number of good nodes.
+// Nodes which do not exist on server are stored in BadNodes.
+func (dvc *DeviceOPCUA) InitialRead(ctx context.Context, handler func(node string, dv *ua.DataValue)) (int, error) {
+	results, err := dvc.ReadNodes(ctx, dvc.Nodes, dvc.OperationLimits(ctx).ReadBatch())
+	if err != nil {
+		return 0, err
+	}
+
+	good := 0
+	bad := map[string]ua.StatusCode{}
+	for i, dv := range results {
+		if dv == nil {
+			continue
+		}
+		dvc.Results.Set(dvc.Nodes[i], dv)
+		handler(dvc.Nodes[i], dv)
+		switch dv.Status {
+		case ua.StatusOK:
+			good++
+		case ua.StatusBadNodeIDUnknown, ua.StatusBadNodeIDInvalid, ua.StatusBadAttributeIDInvalid:
+			bad[dvc.Nodes[i]] = dv.Status
+		}
+	}
+
+	mu := dvc.lock()
+	mu.Lock()
+	dvc.BadNodes = bad
+	mu.Unlock()
+	return good, nil
+}
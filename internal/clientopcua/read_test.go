@@ -0,0 +1,79 @@
+package clientopcua
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRead is Read service returning node id as value, batch sizes are recorded
+func fakeRead(batches *[]int) func(context.Context, *ua.ReadRequest) (*ua.ReadResponse, error) {
+	return func(_ context.Context, req *ua.ReadRequest) (*ua.ReadResponse, error) {
+		*batches = append(*batches, len(req.NodesToRead))
+		resp := &ua.ReadResponse{}
+		for _, rv := range req.NodesToRead {
+			resp.Results = append(resp.Results, &ua.DataValue{Value: ua.MustVariant(rv.NodeID.String()), Status: ua.StatusOK})
+		}
+		return resp, nil
+	}
+}
+
+func TestReadNodes(t *testing.T) {
+	dvc := DeviceOPCUA{ResolveErrors: map[string]error{"Objects/PLC1/T": errors.New("no match")}}
+	nodes := []string{"ns=3;s=A", "Objects/PLC1/T", "ns=3;s=B", "ns=x;i=1", "ns=3;s=C", "i=2258"}
+
+	for _, tc := range []struct {
+		batch   int
+		batches []int
+	}{
+		{batch: 1, batches: []int{1, 1, 1, 1}},
+		{batch: 3, batches: []int{3, 1}},
+		{batch: 4, batches: []int{4}},
+		{batch: 0, batches: []int{4}}, // DefaultMaxNodesPerRead
+	} {
+		var batches []int
+		results, err := dvc.readNodes(context.Background(), nodes, tc.batch, fakeRead(&batches))
+		require.NoError(t, err)
+		require.Equal(t, tc.batches, batches, tc.batch)
+		require.Len(t, results, len(nodes))
+		for i, want := range []string{"ns=3;s=A", "", "ns=3;s=B", "", "ns=3;s=C", "i=2258"} {
+			if want == "" {
+				require.Equal(t, ua.StatusBadNodeIDUnknown, results[i].Status, nodes[i])
+				continue
+			}
+			require.Equal(t, want, results[i].Value.Value(), nodes[i])
+		}
+	}
+
+	// response length mismatch & error of Read
+	_, err := dvc.readNodes(context.Background(), nodes, 2, func(context.Context, *ua.ReadRequest) (*ua.ReadResponse, error) {
+		return &ua.ReadResponse{Results: []*ua.DataValue{{}}}, nil
+	})
+	require.Error(t, err)
+	_, err = dvc.readNodes(context.Background(), nodes, 2, func(context.Context, *ua.ReadRequest) (*ua.ReadResponse, error) {
+		return nil, ua.StatusBadTooManyOperations
+	})
+	require.ErrorIs(t, err, ua.StatusBadTooManyOperations)
+}
+
+func TestPollStats(t *testing.T) {
+	var ps *PollStats
+	require.Equal(t, PollStats{}, ps.Snapshot())
+
+	ps = &PollStats{}
+	ps.record(50*time.Millisecond, 100*time.Millisecond, nil)
+	ps.record(150*time.Millisecond, 100*time.Millisecond, errors.New("timeout"))
+	ps.record(80*time.Millisecond, 100*time.Millisecond, nil)
+	require.Equal(t, PollStats{
+		Cycles:    3,
+		Overruns:  1,
+		Errors:    1,
+		LastCycle: 80 * time.Millisecond,
+		MaxCycle:  150 * time.Millisecond,
+		LastError: "timeout",
+	}, ps.Snapshot())
+}
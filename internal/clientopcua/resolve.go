@@ -0,0 +1,273 @@
+package clientopcua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// Node of tag is addressed by:
+//
+//	ns=3;s=DB10.Temperature         node id
+//	nsu=urn:plc:app;s=DB10.Temp     node id with namespace uri (resolved by NamespaceArray of server)
+//	Objects/PLC1/DB10/Temperature   browse path from Root, Objects (default), Types or Views,
+//	Objects/3:PLC1/DB10             segment with namespace index; segment without index
+//	                                has namespace of previous segment or is found by name
+
+// startNodes is start nodes of browse paths
+var startNodes = map[string]uint32{
+	"Root":    id.RootFolder,
+	"Objects": id.ObjectsFolder,
+	"Types":   id.TypesFolder,
+	"Views":   id.ViewsFolder,
+}
+
+// IsBrowsePath is checking that tag is addressed by browse path
+func IsBrowsePath(node string) bool {
+	for _, p := range []string{"ns=", "nsu=", "i=", "s=", "g=", "b="} {
+		if strings.HasPrefix(node, p) {
+			return false
+		}
+	}
+	return strings.Contains(node, "/")
+}
+
+// pathSegment is element of browse path
+type pathSegment struct {
+	name      string
+	ns        uint16
+	qualified bool // namespace index is set in path
+}
+
+// parseBrowsePath is parsing browse path into start node & segments
+func parseBrowsePath(path string) (*ua.NodeID, []pathSegment, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	start := ua.NewNumericNodeID(0, id.ObjectsFolder)
+	if n, ok := startNodes[parts[0]]; ok {
+		start = ua.NewNumericNodeID(0, n)
+		parts = parts[1:]
+	}
+	if len(parts) == 0 {
+		return nil, nil, fmt.Errorf("empty browse path %q", path)
+	}
+
+	var segs []pathSegment
+	var ns uint16
+	for _, p := range parts {
+		if p == "" {
+			return nil, nil, fmt.Errorf("empty segment in browse path %q", path)
+		}
+		seg := pathSegment{name: p, ns: ns}
+		if i := strings.Index(p, ":"); i > 0 {
+			if n, err := strconv.ParseUint(p[:i], 10, 16); err == nil {
+				seg = pathSegment{name: p[i+1:], ns: uint16(n), qualified: true}
+			}
+		}
+		ns = seg.ns
+		segs = append(segs, seg)
+	}
+	return start, segs, nil
+}
+
+// ResolveNodes is resolving tags addressed by namespace uri or browse path into node ids,
+// must be called after every connect (namespace indexes may change). Returns errors by tag.
+func (dvc *DeviceOPCUA) ResolveNodes(ctx context.Context) map[string]error {
+	res := resolvedNodes{nodeIDs: map[string]*ua.NodeID{}, tagNodes: map[string]string{}}
+	errs := map[string]error{}
+
+	var nsArray []string
+	var paths []string
+	for _, node := range dvc.Nodes {
+		switch {
+		case strings.HasPrefix(node, "nsu="):
+			if nsArray == nil {
+				var err error
+				if nsArray, err = dvc.Client.NamespaceArrayWithContext(ctx); err != nil {
+					errs[node] = fmt.Errorf("namespace array: %w", err)
+					continue
+				}
+			}
+			eid, err := ua.ParseExpandedNodeID(node, nsArray)
+			if err != nil {
+				errs[node] = err
+				continue
+			}
+			res.set(node, eid.NodeID)
+		case IsBrowsePath(node):
+			paths = append(paths, node)
+		default:
+			nid, err := ua.ParseNodeID(node)
+			if err != nil {
+				errs[node] = err
+				continue
+			}
+			res.set(node, nid)
+		}
+	}
+
+	for node, err := range dvc.translatePaths(ctx, paths, res) {
+		errs[node] = err
+	}
+
+	mu := dvc.lock()
+	mu.Lock()
+	dvc.nodeIDs = res.nodeIDs
+	dvc.tagNodes = res.tagNodes
+	dvc.ResolveErrors = errs
+	mu.Unlock()
+	return errs
+}
+
+// resolvedNodes is node ids resolved by tag & tags by resolved node id
+type resolvedNodes struct {
+	nodeIDs  map[string]*ua.NodeID
+	tagNodes map[string]string
+}
+
+func (r resolvedNodes) set(node string, nid *ua.NodeID) {
+	r.nodeIDs[node] = nid
+	r.tagNodes[nid.String()] = node
+}
+
+// translatePaths is resolving browse paths by TranslateBrowsePathsToNodeIds in batches,
+// paths with segments without namespace index, not matched by server, are resolved by Browse
+func (dvc *DeviceOPCUA) translatePaths(ctx context.Context, paths []string, resolved resolvedNodes) map[string]error {
+	errs := map[string]error{}
+	type item struct {
+		node  string
+		start *ua.NodeID
+		segs  []pathSegment
+	}
+	var items []item
+	for _, p := range paths {
+		start, segs, err := parseBrowsePath(p)
+		if err != nil {
+			errs[p] = err
+			continue
+		}
+		items = append(items, item{p, start, segs})
+	}
+
+	batch := DefaultMaxNodesPerRead
+	for begin := 0; begin < len(items); begin += batch {
+		end := begin + batch
+		if end > len(items) {
+			end = len(items)
+		}
+
+		req := &ua.TranslateBrowsePathsToNodeIDsRequest{}
+		for _, it := range items[begin:end] {
+			rp := &ua.RelativePath{}
+			for _, s := range it.segs {
+				rp.Elements = append(rp.Elements, &ua.RelativePathElement{
+					ReferenceTypeID: ua.NewTwoByteNodeID(id.HierarchicalReferences),
+					IncludeSubtypes: true,
+					TargetName:      &ua.QualifiedName{NamespaceIndex: s.ns, Name: s.name},
+				})
+			}
+			req.BrowsePaths = append(req.BrowsePaths, &ua.BrowsePath{StartingNode: it.start, RelativePath: rp})
+		}
+
+		var resp *ua.TranslateBrowsePathsToNodeIDsResponse
+		err := dvc.Client.SendWithContext(ctx, req, func(v interface{}) error {
+			r, ok := v.(*ua.TranslateBrowsePathsToNodeIDsResponse)
+			if !ok {
+				return ua.StatusBadUnexpectedError
+			}
+			resp = r
+			return nil
+		})
+		if err == nil && len(resp.Results) != end-begin {
+			err = errors.New("translate browse paths response length mismatch")
+		}
+
+		for i, it := range items[begin:end] {
+			if err != nil {
+				errs[it.node] = err
+				continue
+			}
+			res := resp.Results[i]
+			if res.StatusCode == ua.StatusOK && len(res.Targets) > 0 {
+				resolved.set(it.node, res.Targets[0].TargetID.NodeID)
+				continue
+			}
+			if res.StatusCode == ua.StatusOK {
+				res.StatusCode = ua.StatusBadNoMatch
+			}
+			if nid, berr := dvc.browsePath(ctx, it.start, it.segs); berr == nil {
+				resolved.set(it.node, nid)
+			} else {
+				errs[it.node] = fmt.Errorf("%s: %w", res.StatusCode, berr)
+			}
+		}
+	}
+	return errs
+}
+
+// browsePath is walking browse path by names of child nodes (namespace of unqualified segment is ignored)
+func (dvc *DeviceOPCUA) browsePath(ctx context.Context, start *ua.NodeID, segs []pathSegment) (*ua.NodeID, error) {
+	cur := start
+	for _, s := range segs {
+		resp, err := dvc.Client.BrowseWithContext(ctx, &ua.BrowseRequest{
+			NodesToBrowse: []*ua.BrowseDescription{{
+				NodeID:          cur,
+				BrowseDirection: ua.BrowseDirectionForward,
+				ReferenceTypeID: ua.NewTwoByteNodeID(id.HierarchicalReferences),
+				IncludeSubtypes: true,
+				ResultMask:      uint32(ua.BrowseResultMaskBrowseName),
+			}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Results) != 1 || resp.Results[0].StatusCode != ua.StatusOK {
+			return nil, fmt.Errorf("browse %s failed", cur)
+		}
+
+		var next *ua.NodeID
+		for _, ref := range resp.Results[0].References {
+			bn := ref.BrowseName
+			if bn == nil || bn.Name != s.name || (s.qualified && bn.NamespaceIndex != s.ns) {
+				continue
+			}
+			next = ref.NodeID.NodeID
+			break
+		}
+		if next == nil {
+			return nil, fmt.Errorf("%q not found in %s", s.name, cur)
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// NodeID is returns node id of tag (resolved on connect or parsed)
+func (dvc *DeviceOPCUA) NodeID(node string) (*ua.NodeID, error) {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	if nid, ok := dvc.nodeIDs[node]; ok {
+		return nid, nil
+	}
+	if err, ok := dvc.ResolveErrors[node]; ok {
+		return nil, err
+	}
+	return ua.ParseNodeID(node)
+}
+
+// TagNode is returns tag (as in tags file) of node id in notification
+func (dvc *DeviceOPCUA) TagNode(nid *ua.NodeID) string {
+	s := nid.String()
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	if node, ok := dvc.tagNodes[s]; ok {
+		return node
+	}
+	return s
+}
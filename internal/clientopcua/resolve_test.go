@@ -0,0 +1,107 @@
+package clientopcua
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsBrowsePath(t *testing.T) {
+	for node, want := range map[string]bool{
+		"Objects/PLC1/Temperature":               true,
+		"PLC1/DB10/Temp":                         true,
+		"/Objects/3:PLC1":                        true,
+		"ns=3;s=DB10/Temperature":                false,
+		"nsu=urn:plc:app;s=DB10/T":               false,
+		"i=2258":                                 false,
+		"s=Temperature":                          false,
+		"g=09087e75-8e5e-499b-954f-f2a9603db28a": false,
+		"Temperature":                            false,
+	} {
+		require.Equal(t, want, IsBrowsePath(node), node)
+	}
+}
+
+func TestParseBrowsePath(t *testing.T) {
+	objects := ua.NewNumericNodeID(0, id.ObjectsFolder)
+	for _, tc := range []struct {
+		path  string
+		start *ua.NodeID
+		segs  []pathSegment
+		err   bool
+	}{
+		{
+			path:  "Objects/PLC1/Temperature",
+			start: objects,
+			segs:  []pathSegment{{name: "PLC1"}, {name: "Temperature"}},
+		},
+		{
+			path:  "PLC1/Temperature",
+			start: objects,
+			segs:  []pathSegment{{name: "PLC1"}, {name: "Temperature"}},
+		},
+		{
+			path:  "/Root/Objects/Server/",
+			start: ua.NewNumericNodeID(0, id.RootFolder),
+			segs:  []pathSegment{{name: "Objects"}, {name: "Server"}},
+		},
+		{
+			path:  "Types/0:ObjectTypes",
+			start: ua.NewNumericNodeID(0, id.TypesFolder),
+			segs:  []pathSegment{{name: "ObjectTypes", qualified: true}},
+		},
+		{
+			// unqualified segment has namespace of previous segment
+			path:  "Objects/3:PLC1/DB10/2:Temp/Value",
+			start: objects,
+			segs: []pathSegment{
+				{name: "PLC1", ns: 3, qualified: true},
+				{name: "DB10", ns: 3},
+				{name: "Temp", ns: 2, qualified: true},
+				{name: "Value", ns: 2},
+			},
+		},
+		{
+			// not a namespace index
+			path:  "Views/x:View1/:a",
+			start: ua.NewNumericNodeID(0, id.ViewsFolder),
+			segs:  []pathSegment{{name: "x:View1"}, {name: ":a"}},
+		},
+		{path: "Objects", err: true},
+		{path: "Objects//Temperature", err: true},
+	} {
+		start, segs, err := parseBrowsePath(tc.path)
+		if tc.err {
+			require.Error(t, err, tc.path)
+			continue
+		}
+		require.NoError(t, err, tc.path)
+		require.Equal(t, tc.start, start, tc.path)
+		require.Equal(t, tc.segs, segs, tc.path)
+	}
+}
+
+func TestNodeID(t *testing.T) {
+	res := resolvedNodes{nodeIDs: map[string]*ua.NodeID{}, tagNodes: map[string]string{}}
+	res.set("Objects/PLC1/Temp", ua.NewStringNodeID(3, "PLC1.Temp"))
+	dvc := DeviceOPCUA{
+		nodeIDs:       res.nodeIDs,
+		tagNodes:      res.tagNodes,
+		ResolveErrors: map[string]error{"Objects/PLC1/Missing": errors.New("no match")},
+	}
+
+	nid, err := dvc.NodeID("Objects/PLC1/Temp")
+	require.NoError(t, err)
+	require.Equal(t, "ns=3;s=PLC1.Temp", nid.String())
+	_, err = dvc.NodeID("Objects/PLC1/Missing")
+	require.Error(t, err)
+	nid, err = dvc.NodeID("ns=2;i=7")
+	require.NoError(t, err)
+	require.Equal(t, "ns=2;i=7", nid.String())
+
+	require.Equal(t, "Objects/PLC1/Temp", dvc.TagNode(ua.NewStringNodeID(3, "PLC1.Temp")))
+	require.Equal(t, "ns=2;i=7", dvc.TagNode(ua.NewNumericNodeID(2, 7)))
+}
@@ -0,0 +1,118 @@
+package clientopcua
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+// NodeResult is last value of node received from server
+type NodeResult struct {
+	Value      interface{}
+	Status     ua.StatusCode
+	SourceTime time.Time
+	ServerTime time.Time
+	Updated    time.Time // time of receiving by gateway
+}
+
+// Results is last values of nodes of device (by tag)
+type Results struct {
+	mu    sync.RWMutex
+	nodes map[string]NodeResult
+}
+
+// NewResults is creating store of last values of nodes
+func NewResults() *Results {
+	return &Results{nodes: map[string]NodeResult{}}
+}
+
+// Set is storing data value of node (nil results - not stored)
+func (r *Results) Set(node string, dv *ua.DataValue) {
+	if r == nil || dv == nil {
+		return
+	}
+	res := NodeResult{
+		Status:     dv.Status,
+		SourceTime: dv.SourceTimestamp,
+		ServerTime: dv.ServerTimestamp,
+		Updated:    time.Now(),
+	}
+	if dv.Value != nil {
+		res.Value = dv.Value.Value()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nodes[node] = res
+}
+
+// Get is returns last value of node
+func (r *Results) Get(node string) (NodeResult, bool) {
+	if r == nil {
+		return NodeResult{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res, ok := r.nodes[node]
+	return res, ok
+}
+
+// Snapshot is returns copy of last values of nodes
+func (r *Results) Snapshot() map[string]NodeResult {
+	res := map[string]NodeResult{}
+	if r == nil {
+		return res
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for n, v := range r.nodes {
+		res[n] = v
+	}
+	return res
+}
+
+// Quality is returns quality of status code: good, uncertain or bad
+func Quality(sc ua.StatusCode) string {
+	switch {
+	case sc&0x80000000 != 0:
+		return "bad"
+	case sc&0x40000000 != 0:
+		return "uncertain"
+	default:
+		return "good"
+	}
+}
+
+// StatusName is returns symbolic name of status code, e.g. BadNodeIDUnknown
+func StatusName(sc ua.StatusCode) string {
+	if sc == ua.StatusOK {
+		return "Good"
+	}
+	if d, ok := ua.StatusCodes[sc]; ok {
+		return strings.TrimPrefix(d.Name, "Status")
+	}
+	return fmt.Sprintf("0x%08X", uint32(sc))
+}
+
+// JSONValue is returns value which can be encoded in JSON (NaN and Inf as strings)
+func JSONValue(v interface{}) interface{} {
+	switch f := v.(type) {
+	case float32:
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return fmt.Sprint(f)
+		}
+	case float64:
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Sprint(f)
+		}
+	case time.Time:
+		return f.UTC()
+	case *ua.NodeID:
+		return f.String()
+	}
+	return v
+}
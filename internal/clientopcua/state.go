@@ -0,0 +1,229 @@
+package clientopcua
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// State is copy of status, error, failovers & current endpoint of device (for HTTP API, metrics, dashboard)
+type State struct {
+	Status    Status
+	Error     string
+	Failovers int
+	Endpoint  string
+}
+
+// locks is guarding creation of lock of device
+var locks sync.Mutex
+
+// lock is returns lock of state of device: Status, Error, Failovers, Subscrip, BadNodes,
+// TagIssues, ResolveErrors, resolved node ids, endpoint (on failover), Limits, PollStats & Clock
+// are changed by goroutines of device
+// and read by HTTP handlers. Lock is created on first use, copies of device share it.
+func (dvc *DeviceOPCUA) lock() *sync.RWMutex {
+	locks.Lock()
+	defer locks.Unlock()
+	if dvc.mu == nil {
+		dvc.mu = &sync.RWMutex{}
+	}
+	return dvc.mu
+}
+
+// State is returns copy of status, error, failovers & current endpoint of device
+func (dvc *DeviceOPCUA) State() State {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	return State{Status: dvc.Status, Error: dvc.Error, Failovers: dvc.Failovers, Endpoint: dvc.Config.Endpoint}
+}
+
+// SetStatus is setting status of device
+func (dvc *DeviceOPCUA) SetStatus(s Status) {
+	mu := dvc.lock()
+	mu.Lock()
+	dvc.Status = s
+	mu.Unlock()
+}
+
+// SetError is setting last error of device
+func (dvc *DeviceOPCUA) SetError(e string) {
+	mu := dvc.lock()
+	mu.Lock()
+	dvc.Error = e
+	mu.Unlock()
+}
+
+// ConfigSnapshot is returns copy of configuration of device (endpoint is changed on failover)
+func (dvc *DeviceOPCUA) ConfigSnapshot() Config {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	return dvc.Config
+}
+
+// LimitsSnapshot is returns OperationLimits of server, false if they are not read
+func (dvc *DeviceOPCUA) LimitsSnapshot() (OperationLimits, bool) {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	if dvc.Limits == nil {
+		return OperationLimits{}, false
+	}
+	return *dvc.Limits, true
+}
+
+// PollSnapshot is returns copy of PollStats, false if device is not polled
+func (dvc *DeviceOPCUA) PollSnapshot() (PollStats, bool) {
+	mu := dvc.lock()
+	mu.RLock()
+	ps := dvc.PollStats
+	mu.RUnlock()
+	if ps == nil {
+		return PollStats{}, false
+	}
+	return ps.Snapshot(), true
+}
+
+// ClockSnapshot is returns copy of Clock, false if server time is not read
+func (dvc *DeviceOPCUA) ClockSnapshot() (ClockSnapshot, bool) {
+	mu := dvc.lock()
+	mu.RLock()
+	c := dvc.Clock
+	mu.RUnlock()
+	if c == nil {
+		return ClockSnapshot{}, false
+	}
+	return c.Snapshot(), true
+}
+
+// pollStats is returns PollStats of device, created on first use
+func (dvc *DeviceOPCUA) pollStats() *PollStats {
+	mu := dvc.lock()
+	mu.Lock()
+	defer mu.Unlock()
+	if dvc.PollStats == nil {
+		dvc.PollStats = &PollStats{}
+	}
+	return dvc.PollStats
+}
+
+// clock is returns Clock of device, created on first use
+func (dvc *DeviceOPCUA) clock() *Clock {
+	mu := dvc.lock()
+	mu.Lock()
+	defer mu.Unlock()
+	if dvc.Clock == nil {
+		dvc.Clock = &Clock{}
+	}
+	return dvc.Clock
+}
+
+// SetClient is setting client of device on connect
+func (dvc *DeviceOPCUA) SetClient(c *opcua.Client) {
+	mu := dvc.lock()
+	mu.Lock()
+	dvc.Client = c
+	mu.Unlock()
+}
+
+// client is returns client of device for requests of other goroutines (writes of masters,
+// REST API, method calls), nil - not connected
+func (dvc *DeviceOPCUA) client() *opcua.Client {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	return dvc.Client
+}
+
+// AddSubscription is adding subscription of device
+func (dvc *DeviceOPCUA) AddSubscription(sub *Subscription) {
+	mu := dvc.lock()
+	mu.Lock()
+	dvc.Subscrip = append(dvc.Subscrip, sub)
+	mu.Unlock()
+}
+
+// TakeSubscriptions is removing subscriptions of device, returns them for unsubscribe
+func (dvc *DeviceOPCUA) TakeSubscriptions() []*Subscription {
+	mu := dvc.lock()
+	mu.Lock()
+	defer mu.Unlock()
+	subs := dvc.Subscrip
+	dvc.Subscrip = nil
+	return subs
+}
+
+// SubscriptionsSnapshot is returns copy of list of subscriptions of device
+func (dvc *DeviceOPCUA) SubscriptionsSnapshot() []*Subscription {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]*Subscription(nil), dvc.Subscrip...)
+}
+
+// BadNodesSnapshot is returns copy of BadNodes
+func (dvc *DeviceOPCUA) BadNodesSnapshot() map[string]ua.StatusCode {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	m := make(map[string]ua.StatusCode, len(dvc.BadNodes))
+	for n, sc := range dvc.BadNodes {
+		m[n] = sc
+	}
+	return m
+}
+
+// TagIssuesSnapshot is returns copy of TagIssues
+func (dvc *DeviceOPCUA) TagIssuesSnapshot() map[string]string {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	m := make(map[string]string, len(dvc.TagIssues))
+	for n, msg := range dvc.TagIssues {
+		m[n] = msg
+	}
+	return m
+}
+
+// ResolveErrorsSnapshot is returns copy of ResolveErrors
+func (dvc *DeviceOPCUA) ResolveErrorsSnapshot() map[string]error {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	m := make(map[string]error, len(dvc.ResolveErrors))
+	for n, err := range dvc.ResolveErrors {
+		m[n] = err
+	}
+	return m
+}
+
+// StartRun is marking reading of device as started, false if it is started already
+func (dvc *DeviceOPCUA) StartRun() bool {
+	return atomic.CompareAndSwapInt32(&dvc.running, 0, 1)
+}
+
+// StopRun is marking reading of device as stopped
+func (dvc *DeviceOPCUA) StopRun() {
+	atomic.StoreInt32(&dvc.running, 0)
+}
+
+// badNode is returns status of node unknown to server
+func (dvc *DeviceOPCUA) badNode(node string) (ua.StatusCode, bool) {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	sc, ok := dvc.BadNodes[node]
+	return sc, ok
+}
+
+// tagIssue is returns validation issue of tag
+func (dvc *DeviceOPCUA) tagIssue(node string) (string, bool) {
+	mu := dvc.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+	msg, ok := dvc.TagIssues[node]
+	return msg, ok
+}
@@ -0,0 +1,88 @@
+package clientopcua
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateSnapshots(t *testing.T) {
+	dvc := &DeviceOPCUA{
+		Config:    Config{Endpoints: []string{"opc.tcp://a:4840", "opc.tcp://b:4840"}, Endpoint: "opc.tcp://a:4840"},
+		BadNodes:  map[string]ua.StatusCode{"ns=3;s=X": ua.StatusBadNodeIDUnknown},
+		TagIssues: map[string]string{"ns=3;s=T": "node is not readable"},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			dvc.SetStatus(Polling)
+			dvc.SetError("error subscribe")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = dvc.State()
+			_ = dvc.BadNodesSnapshot()
+		}
+	}()
+	wg.Wait()
+	require.Equal(t, State{Status: Polling, Error: "error subscribe", Endpoint: "opc.tcp://a:4840"}, dvc.State())
+
+	bad := dvc.BadNodesSnapshot()
+	issues := dvc.TagIssuesSnapshot()
+	dvc.NextEndpoint()
+	require.Len(t, bad, 1, "snapshot is copy")
+	require.Empty(t, dvc.BadNodesSnapshot())
+	issues["ns=3;s=T"] = "changed"
+	require.Equal(t, "node is not readable", dvc.TagIssuesSnapshot()["ns=3;s=T"])
+	require.Equal(t, State{Status: ReadTags, Error: "error subscribe", Failovers: 1, Endpoint: "opc.tcp://b:4840"}, dvc.State())
+
+	require.Empty(t, dvc.SubscriptionsSnapshot())
+	require.Empty(t, dvc.ResolveErrorsSnapshot())
+}
+
+func TestStartRun(t *testing.T) {
+	dvc := &DeviceOPCUA{}
+	require.True(t, dvc.StartRun())
+	require.False(t, dvc.StartRun(), "started already")
+	dvc.StopRun()
+	require.True(t, dvc.StartRun())
+}
+
+func TestStatsSnapshots(t *testing.T) {
+	dvc := &DeviceOPCUA{}
+	_, ok := dvc.PollSnapshot()
+	require.False(t, ok)
+	_, ok = dvc.ClockSnapshot()
+	require.False(t, ok)
+	_, ok = dvc.LimitsSnapshot()
+	require.False(t, ok)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		dvc.pollStats().record(time.Millisecond, time.Second, nil)
+		dvc.clock()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = dvc.PollSnapshot()
+		_, _ = dvc.ClockSnapshot()
+	}()
+	wg.Wait()
+
+	ps, ok := dvc.PollSnapshot()
+	require.True(t, ok)
+	require.Equal(t, uint64(1), ps.Cycles)
+	_, ok = dvc.ClockSnapshot()
+	require.True(t, ok)
+	require.Same(t, dvc.pollStats(), dvc.PollStats, "created once")
+}
@@ -0,0 +1,179 @@
+package clientopcua
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// DataHandler is handler of data changes of tags
+type DataHandler func(node string, dv *ua.DataValue)
+
+// Subscription is subscription to data changes of tags. Monitored items are created
+// by own CreateMonitoredItems calls, so status of every item is checked and
+// only created items are tracked (client handle of item -> tag).
+type Subscription struct {
+	sub     *opcua.Subscription
+	notify  chan *opcua.PublishNotificationData
+	closed  chan struct{}
+	handler DataHandler
+	onError func(error)
+	// monitor is sending CreateMonitoredItems request of subscription
+	monitor func(ctx context.Context, items ...*ua.MonitoredItemCreateRequest) (*ua.CreateMonitoredItemsResponse, error)
+
+	mu         sync.RWMutex
+	nodes      map[uint32]string
+	nextHandle uint32
+	delivered  uint64
+	dropped    uint64
+}
+
+// notifyLength is length of channel of notifications of subscription
+const notifyLength = 100
+
+// Subscribe is creating subscription of device, handler is called for data changes of tags,
+// onError for errors of notifications. Notifications are handled until ctx is done or Unsubscribe.
+func (dvc *DeviceOPCUA) Subscribe(ctx context.Context, params *opcua.SubscriptionParameters, handler DataHandler, onError func(error)) (*Subscription, error) {
+	s := newSubscription(handler, onError)
+	sub, err := dvc.Client.SubscribeWithContext(ctx, params, s.notify)
+	if err != nil {
+		return nil, err
+	}
+	s.sub = sub
+	s.monitor = func(ctx context.Context, items ...*ua.MonitoredItemCreateRequest) (*ua.CreateMonitoredItemsResponse, error) {
+		return sub.MonitorWithContext(ctx, ua.TimestampsToReturnBoth, items...)
+	}
+	go s.run(ctx)
+	return s, nil
+}
+
+func newSubscription(handler DataHandler, onError func(error)) *Subscription {
+	return &Subscription{
+		notify:  make(chan *opcua.PublishNotificationData, notifyLength),
+		closed:  make(chan struct{}),
+		handler: handler,
+		onError: onError,
+		nodes:   map[uint32]string{},
+	}
+}
+
+// SubscriptionID is returns id of subscription on server
+func (s *Subscription) SubscriptionID() uint32 {
+	if s.sub == nil {
+		return 0
+	}
+	return s.sub.SubscriptionID
+}
+
+// Subscribed is returns number of created monitored items
+func (s *Subscription) Subscribed() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.nodes)
+}
+
+// Delivered is returns number of data changes passed to handler
+func (s *Subscription) Delivered() uint64 {
+	return atomic.LoadUint64(&s.delivered)
+}
+
+// Dropped is returns number of data changes of unknown monitored items
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe is stopping handling of notifications and deleting subscription on server
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	close(s.closed)
+	return s.sub.Cancel(ctx)
+}
+
+// create is creating monitored items of tags in one CreateMonitoredItems call,
+// returns errors by tag: error of call for all tags or status of item
+func (s *Subscription) create(ctx context.Context, nodes []string, items []*ua.MonitoredItemCreateRequest) map[string]error {
+	errs := map[string]error{}
+	// handles are known before request: notifications may come before response
+	handles := make([]uint32, len(items))
+	s.mu.Lock()
+	for i, item := range items {
+		s.nextHandle++
+		handles[i] = s.nextHandle
+		item.RequestedParameters.ClientHandle = s.nextHandle
+		s.nodes[s.nextHandle] = nodes[i]
+	}
+	s.mu.Unlock()
+
+	res, err := s.monitor(ctx, items...)
+	switch {
+	case err != nil:
+	case res.ResponseHeader != nil && res.ResponseHeader.ServiceResult != ua.StatusOK:
+		err = res.ResponseHeader.ServiceResult
+	case len(res.Results) != len(items):
+		err = fmt.Errorf("%d results of %d monitored items", len(res.Results), len(items))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, h := range handles {
+		switch {
+		case err != nil:
+			errs[nodes[i]] = err
+		case res.Results[i] == nil:
+			errs[nodes[i]] = fmt.Errorf("no result of monitored item")
+		case res.Results[i].StatusCode != ua.StatusOK:
+			errs[nodes[i]] = res.Results[i].StatusCode
+		default:
+			continue
+		}
+		delete(s.nodes, h)
+	}
+	return errs
+}
+
+// run is handling notifications until ctx is done or subscription is closed
+func (s *Subscription) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.closed:
+			return
+		case msg := <-s.notify:
+			s.deliver(msg)
+		}
+	}
+}
+
+// deliver is passing data changes of notification to handler by client handles of items
+func (s *Subscription) deliver(msg *opcua.PublishNotificationData) {
+	if msg.Error != nil {
+		s.error(msg.Error)
+		return
+	}
+	dc, ok := msg.Value.(*ua.DataChangeNotification)
+	if !ok {
+		s.error(fmt.Errorf("unknown notification %T", msg.Value))
+		return
+	}
+	for _, item := range dc.MonitoredItems {
+		s.mu.RLock()
+		node, ok := s.nodes[item.ClientHandle]
+		s.mu.RUnlock()
+		if !ok || item.Value == nil {
+			atomic.AddUint64(&s.dropped, 1)
+			continue
+		}
+		s.handler(node, item.Value)
+		atomic.AddUint64(&s.delivered, 1)
+	}
+}
+
+func (s *Subscription) error(err error) {
+	if s.onError != nil {
+		s.onError(fmt.Errorf("subscription %d: %w", s.SubscriptionID(), err))
+	}
+}
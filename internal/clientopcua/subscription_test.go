@@ -0,0 +1,56 @@
+package clientopcua
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddMonitoredItems(t *testing.T) {
+	dvc := &DeviceOPCUA{Tags: map[string]Tag{
+		"ns=3;s=A":       {Monitoring: DefaultMonitoring()},
+		"ns=3;s=Missing": {Monitoring: DefaultMonitoring()},
+		"ns=3;s=B":       {Monitoring: DefaultMonitoring()},
+		"ns=3;s=C":       {Monitoring: DefaultMonitoring()},
+	}}
+	got := map[string]*ua.DataValue{}
+	sub := newSubscription(func(node string, dv *ua.DataValue) { got[node] = dv }, nil)
+	var handles []uint32
+	sub.monitor = func(ctx context.Context, items ...*ua.MonitoredItemCreateRequest) (*ua.CreateMonitoredItemsResponse, error) {
+		res := &ua.CreateMonitoredItemsResponse{ResponseHeader: &ua.ResponseHeader{ServiceResult: ua.StatusOK}}
+		for _, item := range items {
+			handles = append(handles, item.RequestedParameters.ClientHandle)
+			st := ua.StatusOK
+			if item.ItemToMonitor.NodeID.String() == "ns=3;s=Missing" {
+				st = ua.StatusBadNodeIDUnknown
+			}
+			res.Results = append(res.Results, &ua.MonitoredItemCreateResult{StatusCode: st})
+		}
+		if len(items) == 1 {
+			return nil, errors.New("timeout")
+		}
+		return res, nil
+	}
+
+	// bad item of batch is reported only for its tag, error of call - for all tags of batch
+	calls, errs := dvc.AddMonitoredItems(context.Background(), sub, []string{"ns=3;s=A", "ns=3;s=Missing", "ns=3;s=B", "ns=3;s=C"}, 3)
+	require.Equal(t, 2, calls)
+	require.Len(t, errs, 2)
+	require.ErrorIs(t, errs["ns=3;s=Missing"], ua.StatusBadNodeIDUnknown)
+	require.ErrorContains(t, errs["ns=3;s=C"], "timeout")
+	require.Equal(t, 2, sub.Subscribed())
+
+	sub.deliver(&opcua.PublishNotificationData{Value: &ua.DataChangeNotification{MonitoredItems: []*ua.MonitoredItemNotification{
+		{ClientHandle: handles[0], Value: &ua.DataValue{Status: ua.StatusOK}},
+		{ClientHandle: handles[1], Value: &ua.DataValue{Status: ua.StatusOK}},
+		{ClientHandle: handles[2], Value: &ua.DataValue{Status: ua.StatusBadNoCommunication}},
+	}}})
+	require.Len(t, got, 2)
+	require.Equal(t, ua.StatusBadNoCommunication, got["ns=3;s=B"].Status)
+	require.Equal(t, uint64(2), sub.Delivered())
+	require.Equal(t, uint64(1), sub.Dropped(), "item not created")
+}
@@ -0,0 +1,191 @@
+package clientopcua
+
+import (
+	"context"
+	"fmt"
+	"opcuaModbus/internal/modbus"
+	"strings"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// dataTypes is built-in DataType of node by type of tag
+var dataTypes = map[string]uint32{
+	"bool":    id.Boolean,
+	"boolean": id.Boolean,
+	"int8":    id.SByte,
+	"sbyte":   id.SByte,
+	"uint8":   id.Byte,
+	"byte":    id.Byte,
+	"int16":   id.Int16,
+	"uint16":  id.UInt16,
+	"word":    id.UInt16,
+	"int32":   id.Int32,
+	"dint":    id.Int32,
+	"uint32":  id.UInt32,
+	"dword":   id.UInt32,
+	"int64":   id.Int64,
+	"uint64":  id.UInt64,
+	"float32": id.Float,
+	"float":   id.Float,
+	"real":    id.Float,
+	"float64": id.Double,
+	"double":  id.Double,
+	"lreal":   id.Double,
+}
+
+// dataTypeNames is names of built-in DataType
+var dataTypeNames = map[uint32]string{
+	id.Boolean:  "Boolean",
+	id.SByte:    "SByte",
+	id.Byte:     "Byte",
+	id.Int16:    "Int16",
+	id.UInt16:   "UInt16",
+	id.Int32:    "Int32",
+	id.UInt32:   "UInt32",
+	id.Int64:    "Int64",
+	id.UInt64:   "UInt64",
+	id.Float:    "Float",
+	id.Double:   "Double",
+	id.String:   "String",
+	id.DateTime: "DateTime",
+}
+
+// DataType is returns built-in DataType of tag: Boolean for coils & discrete inputs,
+// else by type of tag (0 - unknown type)
+func (tg Tag) DataType() uint32 {
+	if tg.MBfunc == modbus.ReadCoils || tg.MBfunc == modbus.ReadDiscreteInputs {
+		return id.Boolean
+	}
+	return dataTypes[strings.ToLower(strings.TrimSpace(tg.TypeData))]
+}
+
+// ValidateTags is reading DataType, ValueRank and AccessLevel of tag nodes and checking
+// them against tags config: type, scalar value, readable node and writeable ModBus mapping.
+// Issues are stored in TagIssues by tag.
+func (dvc *DeviceOPCUA) ValidateTags(ctx context.Context) (map[string]string, error) {
+	attrs := []ua.AttributeID{ua.AttributeIDDataType, ua.AttributeIDValueRank, ua.AttributeIDAccessLevel}
+
+	var nodes []string
+	var ids []*ua.NodeID
+	for _, n := range dvc.Nodes {
+		nid, err := dvc.NodeID(n)
+		if err != nil {
+			continue // reported by resolving
+		}
+		nodes = append(nodes, n)
+		ids = append(ids, nid)
+	}
+
+	issues := map[string]string{}
+	batch := dvc.OperationLimits(ctx).ReadBatch() / len(attrs)
+	if batch < 1 {
+		batch = 1
+	}
+	for start := 0; start < len(ids); start += batch {
+		end := start + batch
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		req := &ua.ReadRequest{}
+		for _, nid := range ids[start:end] {
+			for _, a := range attrs {
+				req.NodesToRead = append(req.NodesToRead, &ua.ReadValueID{NodeID: nid, AttributeID: a})
+			}
+		}
+		resp, err := dvc.Client.ReadWithContext(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Results) != len(req.NodesToRead) {
+			return nil, fmt.Errorf("read response length mismatch")
+		}
+
+		for i, node := range nodes[start:end] {
+			r := resp.Results[i*len(attrs) : (i+1)*len(attrs)]
+			if msg := dvc.Tags[node].check(r[0], r[1], r[2]); msg != "" {
+				issues[node] = msg
+			}
+		}
+	}
+
+	mu := dvc.lock()
+	mu.Lock()
+	dvc.TagIssues = issues
+	mu.Unlock()
+	return issues, nil
+}
+
+// check is comparing attributes of node with tag, returns description of mismatches
+func (tg Tag) check(dataType, valueRank, accessLevel *ua.DataValue) string {
+	var msgs []string
+
+	if dataType != nil && dataType.Status == ua.StatusOK && dataType.Value != nil {
+		if dt, ok := dataType.Value.Value().(*ua.NodeID); ok {
+			if msg := tg.checkType(dt); msg != "" {
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+
+	if valueRank != nil && valueRank.Status == ua.StatusOK && valueRank.Value != nil {
+		if vr, ok := valueRank.Value.Value().(int32); ok && vr >= 0 {
+			msgs = append(msgs, fmt.Sprintf("node is array (ValueRank %d)", vr))
+		}
+	}
+
+	if accessLevel != nil && accessLevel.Status == ua.StatusOK && accessLevel.Value != nil {
+		if al, ok := accessLevel.Value.Value().(byte); ok {
+			if al&byte(ua.AccessLevelTypeCurrentRead) == 0 {
+				msgs = append(msgs, "node is not readable")
+			}
+			if tg.Writable() && al&byte(ua.AccessLevelTypeCurrentWrite) == 0 {
+				msgs = append(msgs, "writeable ModBus mapping on read-only node")
+			}
+		}
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (tg Tag) checkType(dt *ua.NodeID) string {
+	if dt.Namespace() != 0 {
+		return "" // not built-in type, can't check
+	}
+	name, builtin := dataTypeNames[dt.IntID()]
+	if !builtin {
+		return ""
+	}
+
+	boolean := tg.MBfunc == modbus.ReadCoils || tg.MBfunc == modbus.ReadDiscreteInputs
+	if boolean {
+		// type of tag is not used by bit mapping
+		if dt.IntID() != id.Boolean {
+			return fmt.Sprintf("ModBus bit mapping of %s node", name)
+		}
+		return ""
+	}
+	if dt.IntID() == id.String || dt.IntID() == id.DateTime {
+		return fmt.Sprintf("node type %s is not supported", name)
+	}
+
+	want, ok := dataTypes[strings.ToLower(strings.TrimSpace(tg.TypeData))]
+	if !ok {
+		return fmt.Sprintf("unknown tag type %q, node is %s", tg.TypeData, name)
+	}
+	if want != dt.IntID() {
+		return fmt.Sprintf("tag type %s, node is %s", tg.TypeData, name)
+	}
+	return ""
+}
+
+// Refused is checking that tag is not mapped to ModBus because of validation issue
+func (dvc *DeviceOPCUA) Refused(node string) bool {
+	if !dvc.Config.RefuseInvalidTags {
+		return false
+	}
+	_, ok := dvc.tagIssue(node)
+	return ok
+}
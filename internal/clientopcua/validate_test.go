@@ -0,0 +1,111 @@
+package clientopcua
+
+import (
+	"opcuaModbus/internal/modbus"
+	"testing"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagDataType(t *testing.T) {
+	for _, tc := range []struct {
+		tag  Tag
+		want uint32
+	}{
+		{tag: Tag{TypeData: "float32", MBfunc: modbus.ReadInputRegisters}, want: id.Float},
+		{tag: Tag{TypeData: " REAL ", MBfunc: modbus.ReadHoldingRegisters}, want: id.Float},
+		{tag: Tag{TypeData: "lreal", MBfunc: modbus.ReadHoldingRegisters}, want: id.Double},
+		{tag: Tag{TypeData: "dint", MBfunc: modbus.ReadHoldingRegisters}, want: id.Int32},
+		{tag: Tag{TypeData: "word", MBfunc: modbus.ReadInputRegisters}, want: id.UInt16},
+		{tag: Tag{TypeData: "int16", MBfunc: modbus.ReadCoils}, want: id.Boolean},
+		{tag: Tag{TypeData: "", MBfunc: modbus.ReadDiscreteInputs}, want: id.Boolean},
+		{tag: Tag{TypeData: "string", MBfunc: modbus.ReadHoldingRegisters}, want: 0},
+	} {
+		require.Equal(t, tc.want, tc.tag.DataType(), tc.tag.TypeData)
+	}
+}
+
+func TestTagCheck(t *testing.T) {
+	value := func(v interface{}) *ua.DataValue {
+		return &ua.DataValue{Status: ua.StatusOK, Value: ua.MustVariant(v)}
+	}
+	dataType := func(n uint32) *ua.DataValue { return value(ua.NewNumericNodeID(0, n)) }
+	scalar := value(int32(-1))
+	rw := value(byte(ua.AccessLevelTypeCurrentRead | ua.AccessLevelTypeCurrentWrite))
+	ro := value(byte(ua.AccessLevelTypeCurrentRead))
+
+	for _, tc := range []struct {
+		name                        string
+		tag                         Tag
+		dataType, valueRank, access *ua.DataValue
+		want                        string
+	}{
+		{
+			name: "match", tag: Tag{TypeData: "float32", MBfunc: modbus.ReadHoldingRegisters},
+			dataType: dataType(id.Float), valueRank: scalar, access: rw,
+		},
+		{
+			name: "attributes not read", tag: Tag{TypeData: "float32", MBfunc: modbus.ReadHoldingRegisters},
+			dataType: &ua.DataValue{Status: ua.StatusBadAttributeIDInvalid}, valueRank: nil, access: &ua.DataValue{Status: ua.StatusBadNotReadable},
+		},
+		{
+			name: "type", tag: Tag{TypeData: "int16", MBfunc: modbus.ReadInputRegisters},
+			dataType: dataType(id.Float), valueRank: scalar, access: ro,
+			want: "tag type int16, node is Float",
+		},
+		{
+			name: "unknown tag type", tag: Tag{TypeData: "bcd", MBfunc: modbus.ReadInputRegisters},
+			dataType: dataType(id.UInt16), valueRank: scalar, access: ro,
+			want: `unknown tag type "bcd", node is UInt16`,
+		},
+		{
+			name: "bit mapping", tag: Tag{TypeData: "bool", MBfunc: modbus.ReadDiscreteInputs},
+			dataType: dataType(id.Int32), valueRank: scalar, access: ro,
+			want: "ModBus bit mapping of Int32 node",
+		},
+		{
+			name: "coil of boolean", tag: Tag{MBfunc: modbus.ReadCoils},
+			dataType: dataType(id.Boolean), valueRank: scalar, access: rw,
+		},
+		{
+			name: "string node", tag: Tag{TypeData: "int16", MBfunc: modbus.ReadInputRegisters},
+			dataType: dataType(id.String), valueRank: scalar, access: ro,
+			want: "node type String is not supported",
+		},
+		{
+			name: "not built-in type", tag: Tag{TypeData: "int16", MBfunc: modbus.ReadInputRegisters},
+			dataType: value(ua.NewNumericNodeID(3, 3002)), valueRank: scalar, access: ro,
+		},
+		{
+			name: "array", tag: Tag{TypeData: "float32", MBfunc: modbus.ReadInputRegisters},
+			dataType: dataType(id.Float), valueRank: value(int32(1)), access: ro,
+			want: "node is array (ValueRank 1)",
+		},
+		{
+			name: "not readable", tag: Tag{TypeData: "float32", MBfunc: modbus.ReadInputRegisters},
+			dataType: dataType(id.Float), valueRank: scalar, access: value(byte(0)),
+			want: "node is not readable",
+		},
+		{
+			name: "read-only node", tag: Tag{TypeData: "float32", MBfunc: modbus.ReadHoldingRegisters, Write: true},
+			dataType: dataType(id.Double), valueRank: scalar, access: ro,
+			want: "tag type float32, node is Double; writeable ModBus mapping on read-only node",
+		},
+		{
+			name: "holding register of read-only node", tag: Tag{TypeData: "float32", MBfunc: modbus.ReadHoldingRegisters},
+			dataType: dataType(id.Float), valueRank: scalar, access: ro,
+		},
+	} {
+		require.Equal(t, tc.want, tc.tag.check(tc.dataType, tc.valueRank, tc.access), tc.name)
+	}
+}
+
+func TestRefused(t *testing.T) {
+	dvc := DeviceOPCUA{TagIssues: map[string]string{"ns=3;s=T": "node is array (ValueRank 1)"}}
+	require.False(t, dvc.Refused("ns=3;s=T"))
+	dvc.Config.RefuseInvalidTags = true
+	require.True(t, dvc.Refused("ns=3;s=T"))
+	require.False(t, dvc.Refused("ns=3;s=Level"))
+}
@@ -0,0 +1,157 @@
+package clientopcua
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"opcuaModbus/internal/modbus"
+	"strconv"
+	"strings"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+// Writable is checking that writes are allowed for tag (Write) and tag is mapped to table
+// written by master (coils or holding registers)
+func (tg Tag) Writable() bool {
+	return tg.Write && (tg.MBfunc == modbus.ReadCoils || tg.MBfunc == modbus.ReadHoldingRegisters)
+}
+
+// Registers is returns number of ModBus registers (coils) of tag
+func (tg Tag) Registers() int {
+	if tg.MBfunc == modbus.ReadCoils || tg.MBfunc == modbus.ReadDiscreteInputs {
+		return 1
+	}
+	return RegisterCount(tg.TypeData)
+}
+
+// FindTag is returns tag by node or alias
+func (dvc *DeviceOPCUA) FindTag(name string) (string, Tag, bool) {
+	if tg, ok := dvc.Tags[name]; ok {
+		return name, tg, true
+	}
+	for _, n := range dvc.Nodes {
+		if tg := dvc.Tags[n]; tg.Alias != "" && tg.Alias == name {
+			return n, tg, true
+		}
+	}
+	return "", Tag{}, false
+}
+
+// ParseValue is converting JSON value (bool, number or string) to value of tag type
+func ParseValue(typ string, v interface{}) (interface{}, error) {
+	var s string
+	switch v := v.(type) {
+	case bool:
+		s = strconv.FormatBool(v)
+	case json.Number:
+		s = v.String()
+	case float64:
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		s = strings.TrimSpace(v)
+	default:
+		return nil, fmt.Errorf("unsupported value %v", v)
+	}
+
+	switch t := strings.ToLower(strings.TrimSpace(typ)); t {
+	case "bool", "boolean":
+		switch s {
+		case "1":
+			return true, nil
+		case "0":
+			return false, nil
+		}
+		return strconv.ParseBool(s)
+	case "float32", "float", "real":
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case "float64", "double", "lreal":
+		return strconv.ParseFloat(s, 64)
+	case "uint8", "byte", "uint16", "word", "uint32", "dword", "uint64":
+		u, err := strconv.ParseUint(s, 10, RegisterCount(t)*16)
+		if err != nil {
+			return nil, err
+		}
+		switch RegisterCount(t) {
+		case 1:
+			if t == "uint8" || t == "byte" {
+				if u > math.MaxUint8 {
+					return nil, fmt.Errorf("value %d out of range of %s", u, typ)
+				}
+				return byte(u), nil
+			}
+			return uint16(u), nil
+		case 2:
+			return uint32(u), nil
+		default:
+			return u, nil
+		}
+	case "int8", "sbyte", "int16", "int32", "dint", "int64":
+		i, err := strconv.ParseInt(s, 10, RegisterCount(t)*16)
+		if err != nil {
+			return nil, err
+		}
+		switch RegisterCount(t) {
+		case 1:
+			if t == "int8" || t == "sbyte" {
+				if i < math.MinInt8 || i > math.MaxInt8 {
+					return nil, fmt.Errorf("value %d out of range of %s", i, typ)
+				}
+				return int8(i), nil
+			}
+			return int16(i), nil
+		case 2:
+			return int32(i), nil
+		default:
+			return i, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported tag type %q", typ)
+	}
+}
+
+// WriteTag is writing value to node of writable tag (coil or holding register mapping)
+func (dvc *DeviceOPCUA) WriteTag(ctx context.Context, node string, v interface{}) error {
+	tg, ok := dvc.Tags[node]
+	switch {
+	case !ok:
+		return fmt.Errorf("unknown tag %s", node)
+	case !tg.Writable():
+		return fmt.Errorf("tag %s is not writable (%s, writable %t)", node, modbus.FunctionName(tg.MBfunc), tg.Write)
+	case dvc.Refused(node):
+		msg, _ := dvc.tagIssue(node)
+		return fmt.Errorf("tag %s refused: %s", node, msg)
+	}
+	client := dvc.client()
+	if client == nil {
+		return fmt.Errorf("not connected")
+	}
+	nid, err := dvc.NodeID(node)
+	if err != nil {
+		return err
+	}
+	val, err := ua.NewVariant(v)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.WriteWithContext(ctx, &ua.WriteRequest{
+		NodesToWrite: []*ua.WriteValue{{
+			NodeID:      nid,
+			AttributeID: ua.AttributeIDValue,
+			Value:       &ua.DataValue{EncodingMask: ua.DataValueValue, Value: val},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Results) != 1 {
+		return fmt.Errorf("write response length mismatch")
+	}
+	if resp.Results[0] != ua.StatusOK {
+		return resp.Results[0]
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package clientopcua
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseValue(t *testing.T) {
+	for _, tc := range []struct {
+		typ  string
+		in   interface{}
+		want interface{}
+		err  bool
+	}{
+		{typ: "bool", in: true, want: true},
+		{typ: "bool", in: "1", want: true},
+		{typ: "Boolean", in: json.Number("0"), want: false},
+		{typ: "bool", in: "false", want: false},
+		{typ: "bool", in: "yes", err: true},
+		{typ: "real", in: 21.5, want: float32(21.5)},
+		{typ: "float32", in: " 1e3 ", want: float32(1000)},
+		{typ: "lreal", in: json.Number("-0.125"), want: -0.125},
+		{typ: "float64", in: "warm", err: true},
+		{typ: "byte", in: json.Number("255"), want: byte(255)},
+		{typ: "uint8", in: 256.0, err: true},
+		{typ: "word", in: "65535", want: uint16(65535)},
+		{typ: "uint16", in: "65536", err: true},
+		{typ: "dword", in: json.Number("4294967295"), want: uint32(4294967295)},
+		{typ: "uint64", in: "18446744073709551615", want: uint64(18446744073709551615)},
+		{typ: "uint32", in: "-1", err: true},
+		{typ: "sbyte", in: -128.0, want: int8(-128)},
+		{typ: "int8", in: "128", err: true},
+		{typ: "int16", in: json.Number("-32768"), want: int16(-32768)},
+		{typ: "int16", in: 1.5, err: true},
+		{typ: "dint", in: "-2147483648", want: int32(-2147483648)},
+		{typ: "int64", in: "-9223372036854775808", want: int64(-9223372036854775808)},
+		{typ: "string", in: "abc", err: true},
+		{typ: "int16", in: nil, err: true},
+		{typ: "int16", in: []interface{}{1}, err: true},
+	} {
+		v, err := ParseValue(tc.typ, tc.in)
+		if tc.err {
+			require.Error(t, err, "%s %v", tc.typ, tc.in)
+			continue
+		}
+		require.NoError(t, err, "%s %v", tc.typ, tc.in)
+		require.Equal(t, tc.want, v, "%s %v", tc.typ, tc.in)
+	}
+}
+
+func TestFindTag(t *testing.T) {
+	dvc := DeviceOPCUA{
+		Nodes: []string{"ns=3;s=Temp", "ns=3;s=Level"},
+		Tags: map[string]Tag{
+			"ns=3;s=Temp":  {Alias: "temp"},
+			"ns=3;s=Level": {},
+		},
+	}
+	node, _, ok := dvc.FindTag("temp")
+	require.True(t, ok)
+	require.Equal(t, "ns=3;s=Temp", node)
+	node, _, ok = dvc.FindTag("ns=3;s=Level")
+	require.True(t, ok)
+	require.Equal(t, "ns=3;s=Level", node)
+	_, _, ok = dvc.FindTag("")
+	require.False(t, ok)
+}
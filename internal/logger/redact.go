@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// redactFormatter is hiding secret values in log records
+type redactFormatter struct {
+	logrus.Formatter
+	replacer *strings.Replacer
+}
+
+func (f *redactFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	b, err := f.Formatter.Format(e)
+	if err != nil {
+		return b, err
+	}
+	return []byte(f.replacer.Replace(string(b))), nil
+}
+
+// Redact is replacing secret values with "******" in all records of logger
+func Redact(logg *logrus.Logger, values ...string) {
+	var pairs []string
+	for _, v := range values {
+		if v != "" {
+			pairs = append(pairs, v, "******")
+		}
+	}
+	if len(pairs) == 0 {
+		return
+	}
+
+	f := logg.Formatter
+	if rf, ok := f.(*redactFormatter); ok {
+		f = rf.Formatter
+	}
+	logg.SetFormatter(&redactFormatter{
+		Formatter: f,
+		replacer:  strings.NewReplacer(pairs...),
+	})
+}
+
+// Redacted is replacing secret values of logger (see Redact) in s
+func Redacted(logg *logrus.Logger, s string) string {
+	if rf, ok := logg.Formatter.(*redactFormatter); ok {
+		return rf.replacer.Replace(s)
+	}
+	return s
+}
@@ -29,6 +29,9 @@ const (
 	IllegalDataAddress Exception = 0x02
 	IllegalDataValue   Exception = 0x03
 	SlaveDeviceFailure Exception = 0x04
+	// gateway exceptions of routes
+	GatewayPathUnavailable Exception = 0x0a
+	GatewayTargetFailed    Exception = 0x0b
 )
 
 // MBData is device ModBus registers data storage
@@ -71,6 +74,22 @@ func StringToUint8(s string) uint8 {
 	}
 }
 
+// FunctionName is converting numeric function ModBus to name (reverse StringToUint8)
+func FunctionName(f uint8) string {
+	switch f {
+	case ReadCoils:
+		return "coil"
+	case ReadDiscreteInputs:
+		return "discrete"
+	case ReadHoldingRegisters:
+		return "holding"
+	case ReadInputRegisters:
+		return "input"
+	default:
+		return ""
+	}
+}
+
 func (excp Exception) String() string {
 	switch excp {
 	case 0x00:
@@ -83,6 +102,10 @@ func (excp Exception) String() string {
 		return "IllegalDataValue"
 	case 0x04:
 		return "SlaveDeviceFailure"
+	case 0x0a:
+		return "GatewayPathUnavailable"
+	case 0x0b:
+		return "GatewayTargetFailed"
 	default:
 		return ""
 	}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -73,6 +74,37 @@ var tReadMBok = []ReadModbus{
 	},
 }
 
+var tWriteMB = []ReadModbus{
+	{request: []byte{0, 30, 0, 0, 0, 6, 3, 5, 1, 44, 255, 0},
+		want:        []byte{0, 30, 0, 0, 0, 6, 3, 5, 1, 44, 255, 0},
+		description: "write single Coil",
+	},
+	{request: []byte{0, 31, 0, 0, 0, 8, 3, 15, 1, 45, 0, 2, 1, 2},
+		want:        []byte{0, 31, 0, 0, 0, 6, 3, 15, 1, 45, 0, 2},
+		description: "write multiple Coils",
+	},
+	{request: []byte{0, 32, 0, 0, 0, 6, 3, 6, 1, 44, 18, 52},
+		want:        []byte{0, 32, 0, 0, 0, 6, 3, 6, 1, 44, 18, 52},
+		description: "write single Holding register",
+	},
+	{request: []byte{0, 33, 0, 0, 0, 11, 3, 16, 1, 45, 0, 2, 4, 0, 1, 0, 2},
+		want:        []byte{0, 33, 0, 0, 0, 6, 3, 16, 1, 45, 0, 2},
+		description: "write multiple Holding registers",
+	},
+	{request: []byte{0, 34, 0, 0, 0, 6, 3, 6, 0, 100, 0, 1},
+		want:        []byte{0, 34, 0, 0, 0, 3, 3, 134, 2},
+		description: "IllegalDataAddress (address not served by handler)",
+	},
+	{request: []byte{0, 35, 0, 0, 0, 6, 3, 5, 1, 44, 0, 1},
+		want:        []byte{0, 35, 0, 0, 0, 3, 3, 133, 3},
+		description: "IllegalDataValue (coil value)",
+	},
+	{request: []byte{0, 36, 0, 0, 0, 6, 4, 6, 0, 200, 0, 1},
+		want:        []byte{0, 36, 0, 0, 0, 3, 4, 134, 1},
+		description: "IllegalFunction (unit without write handler)",
+	},
+}
+
 var tReadMBexcept = []struct {
 	request     []byte
 	want        []byte
@@ -194,6 +226,19 @@ func TestMBServer(t *testing.T) {
 			t.Errorf("error deleting  device from ModBus Server structure")
 		}
 	})
+	t.Run("Ready", func(t *testing.T) {
+		if mbserver.Ready(1) {
+			t.Errorf("unit is ready before data")
+		}
+		mbserver.SetReady(1, true)
+		if !mbserver.Ready(1) {
+			t.Errorf("error set ready unit")
+		}
+		mbserver.SetReady(1, false)
+		if mbserver.Ready(1) {
+			t.Errorf("error reset ready unit")
+		}
+	})
 	t.Run("Listen", func(t *testing.T) {
 		go mbserver.Listen()
 		t1 := time.NewTimer(50 * time.Millisecond)
@@ -309,4 +354,224 @@ func TestMBServer(t *testing.T) {
 			}
 		}
 	})
+	t.Run("Write", func(t *testing.T) {
+		mbserver.AddWriteHandler(3, func(function uint8, address uint16, values []uint16) Exception {
+			if address < 300 {
+				return IllegalDataAddress
+			}
+			for i, v := range values {
+				if function == WriteSingleCoil || function == WriteMultipleCoils {
+					mbserver.WriteCoils(3, address+uint16(i), v == 1)
+				} else {
+					mbserver.WriteHoldingRegisters(3, address+uint16(i), v)
+				}
+			}
+			return Success
+		})
+
+		for _, mb := range tWriteMB {
+			client, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(mbPort))
+			if err != nil {
+				t.Fatal("failed connect to Test ModBus Server: ", err)
+			}
+			if _, err := client.Write(mb.request); err != nil {
+				t.Error("could not request to TCP server:", err)
+			}
+			buf := make([]byte, 1024)
+			b, _ := client.Read(buf)
+			client.Close()
+			if !bytes.Equal(buf[:b], mb.want) {
+				t.Errorf("error %s | got: %v, want: %v", mb.description, buf[:b], mb.want)
+			}
+		}
+
+		if !mbserver.Devices[3].Coils[300] || !mbserver.Devices[3].Coils[302] || mbserver.Devices[3].Coils[301] {
+			t.Error("error write Coils by master")
+		}
+		if mbserver.Devices[3].HoldingRegisters[300] != 0x1234 || mbserver.Devices[3].HoldingRegisters[302] != 2 {
+			t.Error("error write Holding registers by master")
+		}
+	})
+	t.Run("Status", func(t *testing.T) {
+		client, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(mbPort))
+		if err != nil {
+			t.Fatal("failed connect to Test ModBus Server: ", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if len(mbserver.Clients()) != 1 {
+			t.Errorf("error clients | got: %v", mbserver.Clients())
+		}
+		client.Close()
+
+		units := mbserver.Units()
+		for i := 1; i < len(units); i++ {
+			if units[i-1].UnitID >= units[i].UnitID {
+				t.Errorf("error units order | got: %v", units)
+			}
+		}
+		for _, u := range units {
+			if u.UnitID == 3 && (!u.Writable || u.Coils == 0) {
+				t.Errorf("error unit 3 | got: %+v", u)
+			}
+		}
+
+		st := mbserver.Stats()
+		if len(st.Requests) == 0 || len(st.Exceptions) == 0 {
+			t.Errorf("error stats | got: %+v", st)
+		}
+		var n uint64
+		for _, rc := range st.Requests {
+			n += rc.Count
+		}
+		if st.Latency.Count != n || st.Latency.Counts[len(st.Latency.Counts)-1] > n {
+			t.Errorf("error latency histogram | got: %+v, requests: %d", st.Latency, n)
+		}
+	})
+	t.Run("Route", func(t *testing.T) {
+		// downstream Modbus TCP device: unit 9
+		downstream := NewServer(logg, "127.0.0.1", mbPort+1)
+		downstream.AddDevice(9)
+		downstream.WriteHoldingRegisters(9, 10, 0x1234)
+		go downstream.Listen()
+
+		// downstream RTU device: unit 7, answers holding register 0 = 0x0102
+		rtu, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rtu.Close()
+		go func() {
+			conn, err := rtu.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			req := make([]byte, 8)
+			if _, err := io.ReadFull(conn, req); err != nil || crc16(req[:6]) != uint16(req[6])|uint16(req[7])<<8 {
+				return
+			}
+			resp := []byte{7, 0x03, 2, 0x01, 0x02}
+			crc := crc16(resp)
+			_, _ = conn.Write(append(resp, byte(crc), byte(crc>>8)))
+		}()
+
+		// device not answering
+		silent, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer silent.Close()
+		go func() {
+			for {
+				conn, err := silent.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		mbserver.AddRoute(Route{Unit: 20, Address: "127.0.0.1:" + strconv.Itoa(mbPort+1), TargetUnit: 9})
+		mbserver.AddRoute(Route{Unit: 21, Address: rtu.Addr().String(), Protocol: ProtocolRTU, TargetUnit: 7})
+		mbserver.AddRoute(Route{Unit: 22, Address: "127.0.0.1:1", Timeout: 100 * time.Millisecond})
+		mbserver.AddRoute(Route{Unit: 23, Address: silent.Addr().String(), Timeout: 100 * time.Millisecond})
+		mbserver.AddRoute(Route{Unit: 1, Address: "127.0.0.1:1"}) // unit is device of server
+		time.Sleep(50 * time.Millisecond)
+
+		for _, tc := range []struct {
+			description   string
+			request, want []byte
+		}{
+			{"tcp route", []byte{0, 0x21, 0, 0, 0, 6, 20, 0x03, 0, 10, 0, 1}, []byte{0, 0x21, 0, 0, 0, 5, 20, 0x03, 2, 0x12, 0x34}},
+			{"exception of device", []byte{0, 0x22, 0, 0, 0, 6, 20, 0x03, 0, 11, 0, 1}, []byte{0, 0x22, 0, 0, 0, 3, 20, 0x83, 0x02}},
+			{"rtu route", []byte{0, 0x23, 0, 0, 0, 6, 21, 0x03, 0, 0, 0, 1}, []byte{0, 0x23, 0, 0, 0, 5, 21, 0x03, 2, 0x01, 0x02}},
+			{"path unavailable", []byte{0, 0x24, 0, 0, 0, 6, 22, 0x03, 0, 0, 0, 1}, []byte{0, 0x24, 0, 0, 0, 3, 22, 0x83, 0x0a}},
+			{"target failed", []byte{0, 0x25, 0, 0, 0, 6, 23, 0x03, 0, 0, 0, 1}, []byte{0, 0x25, 0, 0, 0, 3, 23, 0x83, 0x0b}},
+			{"not routed", []byte{0, 0x26, 0, 0, 0, 6, 24, 0x03, 0, 0, 0, 1}, []byte{0, 0x26, 0, 0, 0, 3, 24, 0x83, 0x04}},
+		} {
+			client, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(mbPort))
+			if err != nil {
+				t.Fatal("failed connect to Test ModBus Server: ", err)
+			}
+			if _, err := client.Write(tc.request); err != nil {
+				t.Error("could not request to TCP server:", err)
+			}
+			buf := make([]byte, 1024)
+			b, _ := client.Read(buf)
+			client.Close()
+			if !bytes.Equal(buf[:b], tc.want) {
+				t.Errorf("error %s | got: %v, want: %v", tc.description, buf[:b], tc.want)
+			}
+		}
+
+		routes := mbserver.Routes()
+		if len(routes) != 5 || routes[1].Unit != 20 || routes[1].Forwarded != 2 || routes[3].Failures != 1 || routes[4].Failures != 1 {
+			t.Errorf("error routes | got: %+v", routes)
+		}
+		if routes[2].MaxConcurrent != 1 || routes[1].MaxConcurrent != DefaultRouteMaxConcurrent {
+			t.Errorf("error concurrency of routes | got: %+v", routes)
+		}
+
+		// all connections are busy
+		rt := &router{route: Route{Address: silent.Addr().String(), Timeout: 50 * time.Millisecond}, slots: make(chan struct{}, 1)}
+		rt.slots <- struct{}{}
+		if _, ex := rt.forward([]byte{0x03, 0, 0, 0, 1}); ex != GatewayPathUnavailable {
+			t.Errorf("error concurrency limit | got: %v", ex)
+		}
+
+		// device closing connection after each response
+		oneshot, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer oneshot.Close()
+		var accepted int32
+		go func() {
+			for {
+				conn, err := oneshot.Accept()
+				if err != nil {
+					return
+				}
+				atomic.AddInt32(&accepted, 1)
+				req := make([]byte, 12)
+				if _, err := io.ReadFull(conn, req); err == nil {
+					_, _ = conn.Write([]byte{req[0], req[1], 0, 0, 0, 5, req[6], 0x03, 2, 0x00, 0x2a})
+				}
+				conn.Close()
+			}
+		}()
+
+		rt = &router{route: Route{Address: oneshot.Addr().String(), Timeout: time.Second, IdleTimeout: time.Minute}, slots: make(chan struct{}, 1)}
+		for i := 0; i < 2; i++ {
+			if resp, ex := rt.forward([]byte{0x03, 0, 0, 0, 1}); ex != Success || !bytes.Equal(resp, []byte{0x03, 2, 0x00, 0x2a}) {
+				t.Errorf("error stale connection %d | got: %v %v", i, resp, ex)
+			}
+		}
+		if n := atomic.LoadInt32(&accepted); n != 2 {
+			t.Errorf("error redial of stale connection | got connections: %d, want: 2", n)
+		}
+
+		// idle connection is expired
+		rt = &router{route: Route{Address: oneshot.Addr().String(), Timeout: time.Second, IdleTimeout: 50 * time.Millisecond}, slots: make(chan struct{}, 1)}
+		if _, ex := rt.forward([]byte{0x03, 0, 0, 0, 1}); ex != Success {
+			t.Errorf("error forward | got: %v", ex)
+		}
+		time.Sleep(150 * time.Millisecond)
+		rt.mu.Lock()
+		idle := len(rt.idle)
+		rt.mu.Unlock()
+		if idle != 0 {
+			t.Errorf("error idle timeout | got idle connections: %d, want: 0", idle)
+		}
+
+		// pool is closed on shutdown
+		rt = &router{route: Route{Address: oneshot.Addr().String(), Timeout: time.Second, IdleTimeout: time.Minute}, slots: make(chan struct{}, 1)}
+		if _, ex := rt.forward([]byte{0x03, 0, 0, 0, 1}); ex != Success {
+			t.Errorf("error forward | got: %v", ex)
+		}
+		rt.close()
+		if _, ex := rt.forward([]byte{0x03, 0, 0, 0, 1}); ex != Success || len(rt.idle) != 0 {
+			t.Errorf("error closed pool | got: %v, idle: %d", ex, len(rt.idle))
+		}
+	})
 }
@@ -0,0 +1,372 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// protocols of downstream devices of routes
+const (
+	ProtocolTCP = "tcp" // Modbus TCP
+	ProtocolRTU = "rtu" // RTU frames over TCP (serial device server)
+)
+
+// defaults of Route
+const (
+	DefaultRouteTimeout       = time.Second
+	DefaultRouteMaxConcurrent = 4
+	DefaultRouteIdleTimeout   = 30 * time.Second
+)
+
+// Route is forwarding of requests to unit, which is not device of server, to downstream device
+type Route struct {
+	Unit          UnitID
+	Address       string // host:port of downstream device
+	Protocol      string // ProtocolTCP (default) or ProtocolRTU
+	TargetUnit    UnitID // unit id in requests to downstream device
+	Timeout       time.Duration
+	MaxConcurrent int // max requests in progress (connections), RTU - always 1
+	// IdleTimeout is time after which unused connection is closed
+	IdleTimeout time.Duration
+}
+
+// RouteStatus is state & counters of route
+type RouteStatus struct {
+	Route
+	Forwarded uint64 // responses relayed (including exception responses of device)
+	Failures  uint64 // requests answered with GatewayPathUnavailable or GatewayTargetFailed
+	InFlight  int
+}
+
+// router is forwarding requests of route over pool of connections
+type router struct {
+	route Route
+	slots chan struct{} // concurrency limit
+
+	mu        sync.Mutex
+	idle      []idleConn // oldest first
+	expiry    *time.Timer
+	closed    bool
+	tid       uint16
+	forwarded uint64
+	failures  uint64
+}
+
+// idleConn is unused connection of pool
+type idleConn struct {
+	net.Conn
+	since time.Time
+}
+
+// AddRoute is adding route of unit, requests to unit are forwarded if unit is not device of server
+func (server *MBServer) AddRoute(r Route) {
+	if r.Protocol == "" {
+		r.Protocol = ProtocolTCP
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = DefaultRouteTimeout
+	}
+	if r.MaxConcurrent <= 0 {
+		r.MaxConcurrent = DefaultRouteMaxConcurrent
+	}
+	if r.IdleTimeout <= 0 {
+		r.IdleTimeout = DefaultRouteIdleTimeout
+	}
+	if r.Protocol == ProtocolRTU {
+		r.MaxConcurrent = 1
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.routes == nil {
+		server.routes = map[UnitID]*router{}
+	}
+	server.routes[r.Unit] = &router{route: r, slots: make(chan struct{}, r.MaxConcurrent)}
+	server.logg.Info("modbus server add route: unit ", r.Unit, " -> ", r.Protocol, "://", r.Address, " unit ", r.TargetUnit)
+}
+
+// Routes is returns state of routes sorted by unit
+func (server *MBServer) Routes() []RouteStatus {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	routes := make([]RouteStatus, 0, len(server.routes))
+	for _, rt := range server.routes {
+		rt.mu.Lock()
+		routes = append(routes, RouteStatus{Route: rt.route, Forwarded: rt.forwarded, Failures: rt.failures, InFlight: len(rt.slots)})
+		rt.mu.Unlock()
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Unit < routes[j].Unit })
+	return routes
+}
+
+// CloseRoutes is closing unused connections of routes (on shutdown), later connections are not pooled
+func (server *MBServer) CloseRoutes() {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	for _, rt := range server.routes {
+		rt.close()
+	}
+}
+
+// router is returns route of unit which is not device of server (nil - not routed)
+func (server *MBServer) router(id UnitID) *router {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	if _, ok := server.Devices[id]; ok {
+		return nil
+	}
+	return server.routes[id]
+}
+
+// forward is sending request PDU to downstream device and returns response PDU (or exception response of device).
+// No free connection within timeout or failed connect is GatewayPathUnavailable,
+// no valid response within timeout is GatewayTargetFailed.
+func (rt *router) forward(pdu []byte) ([]byte, Exception) {
+	deadline := time.Now().Add(rt.route.Timeout)
+	if rt.route.Protocol == ProtocolRTU && rtuResponseLength(pdu[0], nil) == 0 {
+		return nil, IllegalFunction
+	}
+
+	timer := time.NewTimer(rt.route.Timeout)
+	defer timer.Stop()
+	select {
+	case rt.slots <- struct{}{}:
+	case <-timer.C:
+		rt.fail()
+		return nil, GatewayPathUnavailable
+	}
+	defer func() { <-rt.slots }()
+
+	conn, reused, err := rt.conn(deadline)
+	if err != nil {
+		rt.fail()
+		return nil, GatewayPathUnavailable
+	}
+
+	resp, err := rt.exchange(conn, pdu, deadline)
+	if err != nil && reused && !timeout(err) {
+		// idle connection may be closed by device: new connection once
+		conn.Close()
+		if conn, err = net.DialTimeout("tcp", rt.route.Address, time.Until(deadline)); err != nil {
+			rt.fail()
+			return nil, GatewayPathUnavailable
+		}
+		resp, err = rt.exchange(conn, pdu, deadline)
+	}
+	if err != nil {
+		conn.Close()
+		rt.fail()
+		return nil, GatewayTargetFailed
+	}
+
+	rt.release(conn)
+	return resp, Success
+}
+
+// exchange is sending request to downstream device and reading response until deadline
+func (rt *router) exchange(conn net.Conn, pdu []byte, deadline time.Time) ([]byte, error) {
+	_ = conn.SetDeadline(deadline)
+	if rt.route.Protocol == ProtocolRTU {
+		return rt.exchangeRTU(conn, pdu)
+	}
+	return rt.exchangeTCP(conn, pdu)
+}
+
+// timeout is checking that error is timeout of connection
+func timeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// conn is returns idle connection (reused) or new connection to downstream device,
+// expired idle connections are closed
+func (rt *router) conn(deadline time.Time) (net.Conn, bool, error) {
+	expired := rt.expire()
+	for _, c := range expired {
+		c.Close()
+	}
+
+	rt.mu.Lock()
+	if n := len(rt.idle); n > 0 {
+		conn := rt.idle[n-1].Conn
+		rt.idle = rt.idle[:n-1]
+		rt.mu.Unlock()
+		return conn, true, nil
+	}
+	rt.mu.Unlock()
+	conn, err := net.DialTimeout("tcp", rt.route.Address, time.Until(deadline))
+	return conn, false, err
+}
+
+// release is returning connection to pool after successful request
+func (rt *router) release(conn net.Conn) {
+	rt.mu.Lock()
+	rt.forwarded++
+	if rt.closed {
+		rt.mu.Unlock()
+		conn.Close()
+		return
+	}
+	rt.idle = append(rt.idle, idleConn{Conn: conn, since: time.Now()})
+	if rt.expiry == nil && rt.route.IdleTimeout > 0 {
+		rt.expiry = time.AfterFunc(rt.route.IdleTimeout, rt.expireIdle)
+	}
+	rt.mu.Unlock()
+}
+
+// expire is removing idle connections unused longer than IdleTimeout from pool, returns them
+func (rt *router) expire() []net.Conn {
+	if rt.route.IdleTimeout <= 0 {
+		return nil
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	var expired []net.Conn
+	for len(rt.idle) > 0 && time.Since(rt.idle[0].since) >= rt.route.IdleTimeout {
+		expired = append(expired, rt.idle[0].Conn)
+		rt.idle = rt.idle[1:]
+	}
+	return expired
+}
+
+// expireIdle is closing expired idle connections by timer, timer is restarted while pool is not empty
+func (rt *router) expireIdle() {
+	for _, c := range rt.expire() {
+		c.Close()
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.expiry = nil
+	if len(rt.idle) > 0 && !rt.closed {
+		rt.expiry = time.AfterFunc(rt.route.IdleTimeout-time.Since(rt.idle[0].since), rt.expireIdle)
+	}
+}
+
+// close is closing idle connections, released connections are closed too
+func (rt *router) close() {
+	rt.mu.Lock()
+	idle := rt.idle
+	rt.idle = nil
+	rt.closed = true
+	if rt.expiry != nil {
+		rt.expiry.Stop()
+		rt.expiry = nil
+	}
+	rt.mu.Unlock()
+	for _, c := range idle {
+		c.Close()
+	}
+}
+
+func (rt *router) fail() {
+	rt.mu.Lock()
+	rt.failures++
+	rt.mu.Unlock()
+}
+
+// exchangeTCP is sending request with own transaction id, response of other transaction is error
+func (rt *router) exchangeTCP(conn net.Conn, pdu []byte) ([]byte, error) {
+	rt.mu.Lock()
+	rt.tid++
+	tid := rt.tid
+	rt.mu.Unlock()
+
+	adu := make([]byte, 7, 7+len(pdu))
+	binary.BigEndian.PutUint16(adu[0:], tid)
+	binary.BigEndian.PutUint16(adu[4:], uint16(len(pdu)+1))
+	adu[6] = byte(rt.route.TargetUnit)
+	adu = append(adu, pdu...)
+	if _, err := conn.Write(adu); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 3 || length > 254 {
+		return nil, fmt.Errorf("bad length of response: %d", length)
+	}
+	resp := make([]byte, length-1)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	if got := binary.BigEndian.Uint16(header[0:]); got != tid {
+		return nil, fmt.Errorf("transaction id of response %d, expected %d", got, tid)
+	}
+	return resp, nil
+}
+
+// exchangeRTU is sending RTU frame (unit, PDU, CRC) and reading response frame
+func (rt *router) exchangeRTU(conn net.Conn, pdu []byte) ([]byte, error) {
+	frame := append([]byte{byte(rt.route.TargetUnit)}, pdu...)
+	crc := crc16(frame)
+	frame = append(frame, byte(crc), byte(crc>>8))
+	if _, err := conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	// unit, function and first byte of data define length of response
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return nil, err
+	}
+	n := rtuResponseLength(head[1], head[2:])
+	if n == 0 {
+		return nil, fmt.Errorf("unexpected function of response %d", head[1])
+	}
+	resp := make([]byte, 1+n+2)
+	copy(resp, head)
+	if _, err := io.ReadFull(conn, resp[3:]); err != nil {
+		return nil, err
+	}
+	if crc := binary.LittleEndian.Uint16(resp[len(resp)-2:]); crc != crc16(resp[:len(resp)-2]) {
+		return nil, errors.New("bad crc of response")
+	}
+	if resp[0] != byte(rt.route.TargetUnit) {
+		return nil, fmt.Errorf("unit of response %d, expected %d", resp[0], rt.route.TargetUnit)
+	}
+	return resp[1 : len(resp)-2], nil
+}
+
+// rtuResponseLength is length of response PDU of function by first byte of data (nil - function is supported),
+// 0 - function is not supported over RTU
+func rtuResponseLength(function uint8, data []byte) int {
+	first := 0
+	if len(data) > 0 {
+		first = int(data[0])
+	}
+	switch {
+	case function&0x80 != 0:
+		return 2
+	case function == ReadCoils, function == ReadDiscreteInputs, function == ReadHoldingRegisters, function == ReadInputRegisters:
+		return 2 + first
+	case function == WriteSingleCoil, function == WriteSingleRegister, function == WriteMultipleCoils, function == WriteMultipleRegisters:
+		return 5
+	default:
+		return 0
+	}
+}
+
+// crc16 is CRC of RTU frame
+func crc16(b []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, c := range b {
+		crc ^= uint16(c)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
@@ -19,6 +19,11 @@ type MBServer struct {
 	IdleTimeout time.Duration
 	tcpListener net.Listener
 	Devices     map[UnitID]MBData
+	ready       map[UnitID]bool
+	writers     map[UnitID][]WriteHandler
+	routes      map[UnitID]*router   // routes of units which are not devices of server
+	clients     map[string]time.Time // connected masters by remote address
+	stats       *Stats
 	logg        *logrus.Logger
 }
 
@@ -35,6 +40,9 @@ func NewServer(logg *logrus.Logger, host string, port int) *MBServer {
 		Port:        prt,
 		IdleTimeout: 30 * time.Second,
 		Devices:     make(map[UnitID]MBData),
+		ready:       make(map[UnitID]bool),
+		clients:     make(map[string]time.Time),
+		stats:       newStats(),
 		logg:        logg,
 	}
 }
@@ -67,9 +75,29 @@ func (server *MBServer) DeletDevice(id UnitID) {
 		return
 	}
 	delete(server.Devices, id)
+	delete(server.ready, id)
+	delete(server.writers, id)
 	server.logg.Info("modbus server delete unit: ", id)
 }
 
+// SetReady is setting health of unit: registers are populated with data of device
+func (server *MBServer) SetReady(id UnitID, ready bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.ready[id] == ready {
+		return
+	}
+	server.ready[id] = ready
+	server.logg.Info("modbus server unit: ", id, " ready: ", ready)
+}
+
+// Ready is returns health of unit
+func (server *MBServer) Ready(id UnitID) bool {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	return server.ready[id]
+}
+
 // раскидать listen и accept
 func (server *MBServer) Listen() {
 	var err error
@@ -95,8 +123,15 @@ func (server *MBServer) Listen() {
 
 // handlerMB is request handler for ModBus Server
 func (server *MBServer) handlerMB(sock net.Conn) {
+	addr := sock.RemoteAddr().String()
+	server.mu.Lock()
+	server.clients[addr] = time.Now()
+	server.mu.Unlock()
 	defer func() {
 		server.logg.Debug("modbus server close socket: ", sock.RemoteAddr())
+		server.mu.Lock()
+		delete(server.clients, addr)
+		server.mu.Unlock()
 		sock.Close()
 	}()
 
@@ -113,6 +148,7 @@ func (server *MBServer) handlerMB(sock net.Conn) {
 			return
 		}
 
+		start := time.Now()
 		packet = packet[:bytesRead]
 		if len(packet) < 12 || len(packet) > 260 {
 			server.logg.Debug("modbus exception: bad len packet / ", sock.RemoteAddr())
@@ -133,6 +169,29 @@ func (server *MBServer) handlerMB(sock net.Conn) {
 			function:      function,
 		}
 
+		if rt := server.router(unitid); rt != nil {
+			length := int(binary.BigEndian.Uint16(packet[4:6]))
+			if length < 2 || 6+length > len(packet) {
+				server.logg.Debug("modbus exception: bad length of packet / ", sock.RemoteAddr())
+				return
+			}
+			resp, exception := rt.forward(packet[7 : 6+length])
+			if exception == Success && resp[0]&0x80 != 0 {
+				server.stats.record(unitid, function, Exception(resp[1]), time.Since(start))
+			} else {
+				server.stats.record(unitid, function, exception, time.Since(start))
+			}
+			if exception != Success {
+				response.sendExeption(sock, exception)
+				server.logg.Debug("modbus route unit ", unitid, " exception: ", exception, " / ", sock.RemoteAddr())
+				continue
+			}
+			response.function = resp[0]
+			response.Data = resp[1:]
+			response.sendData(sock)
+			continue
+		}
+
 		exception := Success
 		if unitid > 247 {
 			exception = SlaveDeviceFailure
@@ -170,17 +229,15 @@ func (server *MBServer) handlerMB(sock net.Conn) {
 				}
 				exception = server.readInputRegisters(response, startingAddress, quantity)
 
-				// TODO
-			case WriteSingleCoil:
-			case WriteMultipleCoils:
-			case WriteSingleRegister:
-			case WriteMultipleRegisters:
+			case WriteSingleCoil, WriteMultipleCoils, WriteSingleRegister, WriteMultipleRegisters:
+				exception = server.writeRequest(response, packet)
 
 			default:
 				exception = IllegalFunction
 			}
 		}
 
+		server.stats.record(unitid, function, exception, time.Since(start))
 		if exception != Success {
 			response.sendExeption(sock, exception)
 			server.logg.Debug("modbus send exception: ", exception, " / ", sock.RemoteAddr())
@@ -333,6 +390,57 @@ func (server *MBServer) readInputRegisters(r *mbResponse, startAddress, quantity
 	return Success
 }
 
+// Read is reading quantity of registers (ReadHoldingRegisters, ReadInputRegisters) or bits as 0/1
+// (ReadCoils, ReadDiscreteInputs) of unit, IllegalDataAddress - some address has no data yet
+func (server *MBServer) Read(id UnitID, function uint8, address, quantity uint16) ([]uint16, Exception) {
+	server.mu.RLock()
+	dvc, ok := server.Devices[id]
+	server.mu.RUnlock()
+	if !ok {
+		return nil, SlaveDeviceFailure
+	}
+	if quantity < 1 || uint32(address)+uint32(quantity) > 65536 {
+		return nil, IllegalDataValue
+	}
+
+	values := make([]uint16, quantity)
+	switch function {
+	case ReadCoils, ReadDiscreteInputs:
+		mu, bits := dvc.RWCoils, dvc.Coils
+		if function == ReadDiscreteInputs {
+			mu, bits = dvc.RWDiscreteInputs, dvc.DiscreteInputs
+		}
+		mu.RLock()
+		defer mu.RUnlock()
+		for i := range values {
+			b, ok := bits[address+uint16(i)]
+			if !ok {
+				return nil, IllegalDataAddress
+			}
+			if b {
+				values[i] = 1
+			}
+		}
+	case ReadHoldingRegisters, ReadInputRegisters:
+		mu, regs := dvc.RWHoldingRegisters, dvc.HoldingRegisters
+		if function == ReadInputRegisters {
+			mu, regs = dvc.RWInputRegisters, dvc.InputRegisters
+		}
+		mu.RLock()
+		defer mu.RUnlock()
+		for i := range values {
+			r, ok := regs[address+uint16(i)]
+			if !ok {
+				return nil, IllegalDataAddress
+			}
+			values[i] = r
+		}
+	default:
+		return nil, IllegalFunction
+	}
+	return values, Success
+}
+
 func (server *MBServer) WriteCoils(unitid UnitID, address uint16, value bool) {
 	server.Devices[unitid].RWCoils.Lock()
 	defer server.Devices[unitid].RWCoils.Unlock()
@@ -0,0 +1,104 @@
+package modbus
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets is upper bounds (seconds) of histogram of request latency
+var LatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1}
+
+// requestKey is unit & function of request
+type requestKey struct {
+	unit     UnitID
+	function uint8
+}
+
+// Stats is counters of requests of ModBus server
+type Stats struct {
+	mu         sync.Mutex
+	requests   map[requestKey]uint64
+	exceptions map[Exception]uint64
+	buckets    []uint64
+	sum        float64
+	count      uint64
+}
+
+// RequestCount is number of requests of unit & function
+type RequestCount struct {
+	Unit     UnitID
+	Function uint8
+	Count    uint64
+}
+
+// Histogram is cumulative histogram of request latency
+type Histogram struct {
+	Buckets []float64 // upper bounds, seconds
+	Counts  []uint64  // cumulative counts by bucket
+	Sum     float64
+	Count   uint64
+}
+
+// StatsSnapshot is copy of counters of ModBus server
+type StatsSnapshot struct {
+	Requests    []RequestCount
+	Exceptions  map[Exception]uint64
+	Connections int
+	Latency     Histogram
+}
+
+func newStats() *Stats {
+	return &Stats{
+		requests:   map[requestKey]uint64{},
+		exceptions: map[Exception]uint64{},
+		buckets:    make([]uint64, len(LatencyBuckets)),
+	}
+}
+
+// record is counting request
+func (s *Stats) record(unit UnitID, function uint8, ex Exception, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[requestKey{unit, function}]++
+	if ex != Success {
+		s.exceptions[ex]++
+	}
+	sec := d.Seconds()
+	for i, b := range LatencyBuckets {
+		if sec <= b {
+			s.buckets[i]++
+		}
+	}
+	s.sum += sec
+	s.count++
+}
+
+// Stats is returns counters of requests sorted by unit & function
+func (server *MBServer) Stats() StatsSnapshot {
+	s := server.stats
+	s.mu.Lock()
+	snap := StatsSnapshot{
+		Exceptions: make(map[Exception]uint64, len(s.exceptions)),
+		Latency: Histogram{
+			Buckets: LatencyBuckets,
+			Counts:  append([]uint64(nil), s.buckets...),
+			Sum:     s.sum,
+			Count:   s.count,
+		},
+	}
+	for k, n := range s.requests {
+		snap.Requests = append(snap.Requests, RequestCount{Unit: k.unit, Function: k.function, Count: n})
+	}
+	for ex, n := range s.exceptions {
+		snap.Exceptions[ex] = n
+	}
+	s.mu.Unlock()
+
+	sort.Slice(snap.Requests, func(i, j int) bool {
+		a, b := snap.Requests[i], snap.Requests[j]
+		return a.Unit < b.Unit || a.Unit == b.Unit && a.Function < b.Function
+	})
+	snap.Connections = len(server.Clients())
+	return snap
+}
@@ -0,0 +1,108 @@
+package modbus
+
+import (
+	"sort"
+	"time"
+)
+
+// UnitStatus is state of unit of ModBus server
+type UnitStatus struct {
+	UnitID           UnitID
+	Ready            bool
+	Coils            int
+	DiscreteInputs   int
+	HoldingRegisters int
+	InputRegisters   int
+	Writable         bool // unit has write handlers
+}
+
+// ClientStatus is connected ModBus master
+type ClientStatus struct {
+	Addr      string
+	Connected time.Time
+}
+
+// Units is returns state of units sorted by id
+func (server *MBServer) Units() []UnitStatus {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+
+	units := make([]UnitStatus, 0, len(server.Devices))
+	for id, d := range server.Devices {
+		u := UnitStatus{UnitID: id, Ready: server.ready[id], Writable: len(server.writers[id]) > 0}
+		d.RWCoils.RLock()
+		u.Coils = len(d.Coils)
+		d.RWCoils.RUnlock()
+		d.RWDiscreteInputs.RLock()
+		u.DiscreteInputs = len(d.DiscreteInputs)
+		d.RWDiscreteInputs.RUnlock()
+		d.RWHoldingRegisters.RLock()
+		u.HoldingRegisters = len(d.HoldingRegisters)
+		d.RWHoldingRegisters.RUnlock()
+		d.RWInputRegisters.RLock()
+		u.InputRegisters = len(d.InputRegisters)
+		d.RWInputRegisters.RUnlock()
+		units = append(units, u)
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].UnitID < units[j].UnitID })
+	return units
+}
+
+// Clients is returns connected ModBus masters sorted by time of connection
+func (server *MBServer) Clients() []ClientStatus {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+
+	clients := make([]ClientStatus, 0, len(server.clients))
+	for addr, t := range server.clients {
+		clients = append(clients, ClientStatus{Addr: addr, Connected: t})
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Connected.Before(clients[j].Connected) })
+	return clients
+}
+
+// UnitData is copy of coils & registers of unit
+type UnitData struct {
+	Coils            map[uint16]bool
+	DiscreteInputs   map[uint16]bool
+	HoldingRegisters map[uint16]uint16
+	InputRegisters   map[uint16]uint16
+}
+
+// Snapshot is returns copy of coils & registers of unit
+func (server *MBServer) Snapshot(id UnitID) (UnitData, bool) {
+	server.mu.RLock()
+	d, ok := server.Devices[id]
+	server.mu.RUnlock()
+	if !ok {
+		return UnitData{}, false
+	}
+
+	ud := UnitData{
+		Coils:            make(map[uint16]bool, len(d.Coils)),
+		DiscreteInputs:   make(map[uint16]bool, len(d.DiscreteInputs)),
+		HoldingRegisters: make(map[uint16]uint16, len(d.HoldingRegisters)),
+		InputRegisters:   make(map[uint16]uint16, len(d.InputRegisters)),
+	}
+	d.RWCoils.RLock()
+	for a, v := range d.Coils {
+		ud.Coils[a] = v
+	}
+	d.RWCoils.RUnlock()
+	d.RWDiscreteInputs.RLock()
+	for a, v := range d.DiscreteInputs {
+		ud.DiscreteInputs[a] = v
+	}
+	d.RWDiscreteInputs.RUnlock()
+	d.RWHoldingRegisters.RLock()
+	for a, v := range d.HoldingRegisters {
+		ud.HoldingRegisters[a] = v
+	}
+	d.RWHoldingRegisters.RUnlock()
+	d.RWInputRegisters.RLock()
+	for a, v := range d.InputRegisters {
+		ud.InputRegisters[a] = v
+	}
+	d.RWInputRegisters.RUnlock()
+	return ud, true
+}
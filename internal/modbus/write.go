@@ -0,0 +1,98 @@
+package modbus
+
+import (
+	"encoding/binary"
+)
+
+// WriteHandler is handler of writes of master to unit: function is WriteSingleCoil, WriteMultipleCoils
+// (values 0/1), WriteSingleRegister or WriteMultipleRegisters. Handler is updating registers itself
+// (WriteCoils, WriteHoldingRegisters) and returns IllegalDataAddress for addresses it does not serve.
+type WriteHandler func(function uint8, address uint16, values []uint16) Exception
+
+// AddWriteHandler is adding handler of writes to unit, handlers are called in order of adding
+// until one serves the address. Unit without handlers is read only.
+func (server *MBServer) AddWriteHandler(id UnitID, h WriteHandler) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.writers == nil {
+		server.writers = map[UnitID][]WriteHandler{}
+	}
+	server.writers[id] = append(server.writers[id], h)
+}
+
+// Write is writing to unit as master: calling write handlers of unit (see WriteHandler),
+// IllegalFunction - unit is read only
+func (server *MBServer) Write(id UnitID, function uint8, address uint16, values []uint16) Exception {
+	return server.write(id, function, address, values)
+}
+
+// write is calling write handlers of unit
+func (server *MBServer) write(id UnitID, function uint8, address uint16, values []uint16) Exception {
+	server.mu.RLock()
+	handlers := server.writers[id]
+	server.mu.RUnlock()
+	if len(handlers) == 0 {
+		return IllegalFunction
+	}
+	for _, h := range handlers {
+		if ex := h(function, address, values); ex != IllegalDataAddress {
+			return ex
+		}
+	}
+	return IllegalDataAddress
+}
+
+// writeRequest is parsing write request of master & calling write handlers,
+// response is echo of address and value/quantity
+func (server *MBServer) writeRequest(r *mbResponse, packet []byte) Exception {
+	address := binary.BigEndian.Uint16(packet[8:10])
+	var values []uint16
+
+	switch r.function {
+	case WriteSingleCoil:
+		switch binary.BigEndian.Uint16(packet[10:12]) {
+		case 0xFF00:
+			values = []uint16{1}
+		case 0x0000:
+			values = []uint16{0}
+		default:
+			return IllegalDataValue
+		}
+
+	case WriteSingleRegister:
+		values = []uint16{binary.BigEndian.Uint16(packet[10:12])}
+
+	case WriteMultipleCoils:
+		quantity := binary.BigEndian.Uint16(packet[10:12])
+		if quantity < 1 || quantity > 1968 || uint32(address)+uint32(quantity) > 65536 {
+			return IllegalDataValue
+		}
+		if len(packet) < 13 || int(packet[12]) != (int(quantity)+7)/8 || len(packet) < 13+int(packet[12]) {
+			return IllegalDataValue
+		}
+		for i := 0; i < int(quantity); i++ {
+			values = append(values, uint16(packet[13+i/8]>>(i%8)&1))
+		}
+
+	case WriteMultipleRegisters:
+		quantity := binary.BigEndian.Uint16(packet[10:12])
+		if quantity < 1 || quantity > 123 || uint32(address)+uint32(quantity) > 65536 {
+			return IllegalDataValue
+		}
+		if len(packet) < 13 || int(packet[12]) != 2*int(quantity) || len(packet) < 13+int(packet[12]) {
+			return IllegalDataValue
+		}
+		for i := 0; i < int(quantity); i++ {
+			values = append(values, binary.BigEndian.Uint16(packet[13+2*i:15+2*i]))
+		}
+
+	default:
+		return IllegalFunction
+	}
+
+	if ex := server.write(r.UnitID, r.function, address, values); ex != Success {
+		return ex
+	}
+	r.Data = append(r.Data, packet[8:12]...)
+	return Success
+}
@@ -0,0 +1,270 @@
+// Package mqtt is publishing data changes of devices to MQTT broker
+// with local store-and-forward buffer (memory or disk) while broker is unreachable
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"opcuaModbus/internal/secrets"
+	"opcuaModbus/internal/spool"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultTopic is pattern of topics of tags
+	DefaultTopic = "opcuamodbus/{device}/{tag}"
+	// DefaultStatusTopic is pattern of status (birth & last will) topic of device
+	DefaultStatusTopic = "opcuamodbus/{device}/status"
+	// DefaultBuffer is number of messages kept while broker is unreachable
+	DefaultBuffer = 10000
+	// publishTimeout is timeout of acknowledge of published message
+	publishTimeout = 10 * time.Second
+	// retryInterval is interval of connection retries
+	retryInterval = 5 * time.Second
+)
+
+// Status payloads of device
+const (
+	Online  = "online"
+	Offline = "offline"
+)
+
+// Config is configuration of MQTT publisher
+type Config struct {
+	Broker      string // tcp://host:1883, ssl://host:8883, ws://host:80
+	ClientID    string // prefix of client id, device name is appended
+	Username    string
+	Password    secrets.Secret
+	Topic       string       // pattern with {device}, {unit}, {tag}, {node}
+	StatusTopic string       // pattern with {device}, {unit}
+	QoS         byte         // 0 or 1
+	Retained    bool         // tag values are retained
+	Buffer      int          // store-and-forward buffer in memory (messages)
+	Overflow    string       // spool.DropOldest (default), spool.DropNewest
+	Spool       spool.Config // store-and-forward queue on disk (empty Dir - buffer in memory)
+}
+
+// Payload is JSON payload of value of tag
+type Payload struct {
+	Value      interface{} `json:"value"`
+	Quality    string      `json:"quality"`
+	Status     string      `json:"status"`
+	SourceTime *time.Time  `json:"source_time,omitempty"`
+	ServerTime *time.Time  `json:"server_time,omitempty"`
+	Timestamp  time.Time   `json:"timestamp"`
+}
+
+// Stats is counters of publisher
+type Stats struct {
+	Connected     bool
+	Published     uint64
+	Dropped       uint64 // dropped on overflow of buffer
+	Buffered      int
+	BufferedBytes int64 // bytes of buffered messages on disk
+	Segments      int   // segment files of queue on disk
+}
+
+// Publisher is publishing messages of device, messages are buffered while broker is unreachable
+// and sent in order after reconnect
+type Publisher struct {
+	conf   Config
+	device string
+	unit   string
+	logg   *logrus.Logger
+	client paho.Client
+
+	buffer spool.Buffer
+
+	mu        sync.Mutex
+	published uint64
+	wake      chan struct{}
+}
+
+// New is creating publisher of device, buffer is opened in subdirectory of device of conf.Spool.Dir
+// (buffered messages of previous run are sent) or kept in memory
+func New(conf Config, device, unit string, logg *logrus.Logger) (*Publisher, error) {
+	if conf.Topic == "" {
+		conf.Topic = DefaultTopic
+	}
+	if conf.StatusTopic == "" {
+		conf.StatusTopic = DefaultStatusTopic
+	}
+	if conf.Buffer <= 0 {
+		conf.Buffer = DefaultBuffer
+	}
+	if conf.QoS > 1 {
+		conf.QoS = 1
+	}
+	p := &Publisher{conf: conf, device: device, unit: unit, logg: logg, wake: make(chan struct{}, 1)}
+	var err error
+	if conf.Spool.Dir == "" {
+		p.buffer, err = spool.NewMemory(conf.Buffer, conf.Overflow)
+	} else {
+		sc := conf.Spool
+		sc.Dir = filepath.Join(sc.Dir, spoolDir(device))
+		sc.Overflow = conf.Overflow
+		p.buffer, err = spool.Open(sc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// spoolDir is directory name of device (characters except letters, digits, "." , "-" and "_" are replaced by "_")
+func spoolDir(device string) string {
+	b := []byte(device)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	if s := string(b); s != "" && s != "." && s != ".." {
+		return s
+	}
+	return "_"
+}
+
+// Topic is expanding pattern of topic: {device}, {unit}, {tag} and {node}
+// (MQTT wildcards & separators in names are replaced by "_")
+func Topic(pattern, device, unit, tag, node string) string {
+	return strings.NewReplacer(
+		"{device}", topicLevel(device),
+		"{unit}", topicLevel(unit),
+		"{tag}", topicLevel(tag),
+		"{node}", topicLevel(node),
+	).Replace(pattern)
+}
+
+func topicLevel(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+// StatusTopic is returns status topic of device
+func (p *Publisher) StatusTopic() string {
+	return Topic(p.conf.StatusTopic, p.device, p.unit, "", "")
+}
+
+// Start is connecting to broker (with retries & auto reconnect) and sending buffered messages
+// until ctx is done, then status "offline" is published
+func (p *Publisher) Start(ctx context.Context) {
+	opts := paho.NewClientOptions().
+		AddBroker(p.conf.Broker).
+		SetClientID(p.clientID()).
+		SetUsername(p.conf.Username).
+		SetPassword(p.conf.Password.Reveal()).
+		SetWill(p.StatusTopic(), Offline, 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(retryInterval).
+		SetOnConnectHandler(func(c paho.Client) {
+			p.logg.Info("mqtt ", p.device, " connected: ", p.conf.Broker)
+			c.Publish(p.StatusTopic(), 1, true, Online)
+			p.signal()
+		}).
+		SetConnectionLostHandler(func(c paho.Client, err error) {
+			p.logg.Warn("mqtt ", p.device, " connection lost: ", err)
+		})
+	p.mu.Lock()
+	p.client = paho.NewClient(opts)
+	p.mu.Unlock()
+	p.client.Connect()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if p.client.IsConnectionOpen() {
+				p.client.Publish(p.StatusTopic(), 1, true, Offline).WaitTimeout(time.Second)
+			}
+			p.client.Disconnect(250)
+			if err := p.buffer.Close(); err != nil {
+				p.logg.Error("mqtt ", p.device, " buffer close error: ", err)
+			}
+			return
+		case <-p.wake:
+		case <-time.After(retryInterval):
+		}
+		p.flush(ctx)
+	}
+}
+
+// Publish is adding value change of tag to buffer, on overflow message is dropped by policy
+// (spool.ErrFull - new message is dropped)
+func (p *Publisher) Publish(r spool.Record) error {
+	if err := p.buffer.Push(r); err != nil {
+		return err
+	}
+	p.signal()
+	return nil
+}
+
+// PublishValue is publishing payload of value of tag
+func (p *Publisher) PublishValue(tag, node string, v Payload) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return p.Publish(spool.Record{Time: v.Timestamp, Tag: tag, Node: node, Data: b})
+}
+
+// Stats is returns counters of publisher
+func (p *Publisher) Stats() Stats {
+	bs := p.buffer.Stats()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{
+		Connected:     p.client != nil && p.client.IsConnectionOpen(),
+		Published:     p.published,
+		Dropped:       bs.Dropped,
+		Buffered:      bs.Records,
+		BufferedBytes: bs.Bytes,
+		Segments:      bs.Segments,
+	}
+}
+
+// flush is sending buffered messages in order while broker is connected
+func (p *Publisher) flush(ctx context.Context) {
+	for ctx.Err() == nil && p.client.IsConnectionOpen() {
+		r, err := p.buffer.Peek()
+		if err != nil {
+			if !errors.Is(err, spool.ErrEmpty) {
+				p.logg.Error("mqtt ", p.device, " buffer error: ", err)
+			}
+			return
+		}
+
+		t := p.client.Publish(Topic(p.conf.Topic, p.device, p.unit, r.Tag, r.Node), p.conf.QoS, p.conf.Retained, r.Data)
+		if !t.WaitTimeout(publishTimeout) || t.Error() != nil {
+			p.logg.Debug("mqtt ", p.device, " publish error: ", t.Error())
+			return
+		}
+
+		// message could be dropped on overflow while publishing
+		p.buffer.Ack(r.Seq)
+		p.mu.Lock()
+		p.published++
+		p.mu.Unlock()
+	}
+}
+
+func (p *Publisher) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Publisher) clientID() string {
+	id := p.conf.ClientID
+	if id == "" {
+		id = "opcuamodbus"
+	}
+	return id + "-" + topicLevel(p.device)
+}
@@ -0,0 +1,179 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"opcuaModbus/internal/spool"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopic(t *testing.T) {
+	require.Equal(t, "plant/plc1/temp", Topic("plant/{device}/{tag}", "plc1", "3", "temp", "ns=3;s=Temp"))
+	require.Equal(t, "plant/3/ns=3;s=DB1_T__", Topic("plant/{unit}/{node}", "plc1", "3", "", "ns=3;s=DB1/T+#"))
+	require.Equal(t, "plant/3/Objects_PLC1_T", Topic("plant/{unit}/{node}", "plc1", "3", "", "Objects/PLC1/T"))
+}
+
+func TestBuffer(t *testing.T) {
+	p, err := New(Config{Buffer: 2}, "plc1", "1", logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, p.Publish(spool.Record{Tag: "a"}))
+	require.NoError(t, p.Publish(spool.Record{Tag: "b"}))
+	require.NoError(t, p.Publish(spool.Record{Tag: "c"}))
+
+	st := p.Stats()
+	require.False(t, st.Connected)
+	require.Equal(t, 2, st.Buffered)
+	require.Equal(t, uint64(1), st.Dropped)
+	r, err := p.buffer.Peek()
+	require.NoError(t, err)
+	require.Equal(t, "b", r.Tag)
+
+	p, err = New(Config{Buffer: 1, Overflow: spool.DropNewest}, "plc1", "1", logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, p.Publish(spool.Record{Tag: "a"}))
+	require.ErrorIs(t, p.Publish(spool.Record{Tag: "b"}), spool.ErrFull)
+
+	_, err = New(Config{Overflow: "drop_all"}, "plc1", "1", logrus.New())
+	require.Error(t, err)
+	require.Equal(t, "PLC_1_", spoolDir("PLC/1*"))
+	require.Equal(t, "_", spoolDir(".."))
+}
+
+// message is MQTT message received by broker
+type message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+// broker is fake MQTT broker recording published messages
+type broker struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	msgs []message
+}
+
+func (b *broker) serve(t *testing.T) {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *broker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		h, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		var n, shift int
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			n |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+
+		switch h >> 4 {
+		case 1: // CONNECT
+			_, _ = conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 3: // PUBLISH
+			qos := (h >> 1) & 3
+			tl := int(binary.BigEndian.Uint16(body))
+			m := message{Topic: string(body[2 : 2+tl]), Retained: h&1 == 1}
+			rest := body[2+tl:]
+			if qos > 0 {
+				_, _ = conn.Write([]byte{0x40, 0x02, rest[0], rest[1]})
+				rest = rest[2:]
+			}
+			m.Payload = rest
+			b.mu.Lock()
+			b.msgs = append(b.msgs, m)
+			b.mu.Unlock()
+		case 12: // PINGREQ
+			_, _ = conn.Write([]byte{0xd0, 0x00})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func (b *broker) messages() []message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]message(nil), b.msgs...)
+}
+
+func TestPublisher(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	b := &broker{ln: ln}
+	go b.serve(t)
+	defer ln.Close()
+
+	dir := t.TempDir()
+	conf := Config{Broker: "tcp://" + ln.Addr().String(), Topic: "plant/{device}/{tag}", QoS: 1, Retained: true, Spool: spool.Config{Dir: dir}}
+	// buffered on disk by previous run
+	p, err := New(conf, "plc1", "1", logrus.New())
+	require.NoError(t, err)
+	require.NoError(t, p.PublishValue("t0", "ns=3;s=T0", Payload{Value: 0, Quality: "good", Status: "Good"}))
+	require.NoError(t, p.buffer.Close())
+
+	p, err = New(conf, "plc1", "1", logrus.New())
+	require.NoError(t, err)
+	require.Equal(t, 1, p.Stats().Buffered)
+	// buffered before connect, sent in order
+	require.NoError(t, p.PublishValue("t1", "ns=3;s=T1", Payload{Value: 1.5, Quality: "good", Status: "Good"}))
+	require.NoError(t, p.PublishValue("t2", "ns=3;s=T2", Payload{Value: true, Quality: "good", Status: "Good"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Start(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return p.Stats().Published == 3 }, 5*time.Second, 20*time.Millisecond)
+	cancel()
+	<-done
+
+	var topics []string
+	for _, m := range b.messages() {
+		topics = append(topics, m.Topic)
+	}
+	require.Equal(t, []string{"opcuamodbus/plc1/status", "plant/plc1/t0", "plant/plc1/t1", "plant/plc1/t2", "opcuamodbus/plc1/status"}, topics)
+	msgs := b.messages()
+	require.Equal(t, Online, string(msgs[0].Payload))
+	require.True(t, msgs[2].Retained)
+	require.Contains(t, string(msgs[2].Payload), `"value":1.5`)
+	require.Equal(t, Offline, string(msgs[4].Payload))
+	require.Equal(t, 0, p.Stats().Buffered)
+
+	// acknowledged messages are not sent again
+	p, err = New(conf, "plc1", "1", logrus.New())
+	require.NoError(t, err)
+	require.Equal(t, 0, p.Stats().Buffered)
+	require.NoError(t, p.buffer.Close())
+}
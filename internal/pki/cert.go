@@ -0,0 +1,185 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // OPC UA thumbprint is SHA-1
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"opcuaModbus/internal/secrets"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ApplicationName is name of application in certificate & session
+const ApplicationName = "opcuaModbus"
+
+// CertValidity is validity period of generated application instance certificate
+var CertValidity = 5 * 365 * 24 * time.Hour
+
+// DefaultApplicationURI is returns ApplicationURI of the gateway on this host
+func DefaultApplicationURI() string {
+	host, _ := os.Hostname()
+	return "urn:" + host + ":" + ApplicationName
+}
+
+// LoadCertificate is reads certificate from PEM or DER file, returns DER
+func LoadCertificate(file string) ([]byte, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	if block, _ := pem.Decode(b); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, errors.New("failed to decode PEM certificate " + file)
+		}
+		return block.Bytes, nil
+	}
+	return b, nil
+}
+
+// EnsureCertificate is generating self-signed application instance certificate,
+// if certificate or private key file does not exist
+func EnsureCertificate(certFile, keyFile, appURI string, pass secrets.Secret) (generated bool, err error) {
+	_, errCert := os.Stat(certFile)
+	_, errKey := os.Stat(keyFile)
+	if errCert == nil && errKey == nil {
+		return false, nil
+	}
+
+	var key *rsa.PrivateKey
+	if errKey == nil {
+		key, err = LoadPrivateKey(keyFile, pass)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, RenewCertificate(certFile, keyFile, appURI, key, pass)
+}
+
+// RenewCertificate is writing new self-signed certificate (and new private key, if key is nil)
+func RenewCertificate(certFile, keyFile, appURI string, key *rsa.PrivateKey, pass secrets.Secret) error {
+	if key == nil {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+		if err := writeKey(keyFile, key, pass); err != nil {
+			return err
+		}
+	}
+
+	der, err := selfSigned(appURI, key)
+	if err != nil {
+		return err
+	}
+	return writePEM(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der}, 0644)
+}
+
+// selfSigned is creating application instance certificate with ApplicationURI & host in SAN
+func selfSigned(appURI string, key *rsa.PrivateKey) ([]byte, error) {
+	if appURI == "" {
+		appURI = DefaultApplicationURI()
+	}
+	uri, err := url.Parse(appURI)
+	if err != nil {
+		return nil, fmt.Errorf("bad application uri %s: %w", appURI, err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   ApplicationName + "@" + host,
+			Organization: []string{ApplicationName},
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(CertValidity),
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+			x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		URIs:                  []*url.URL{uri},
+	}
+	if host != "" {
+		tmpl.DNSNames = append(tmpl.DNSNames, host)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && !ipnet.IP.IsLinkLocalUnicast() {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ipnet.IP)
+			}
+		}
+	}
+
+	return x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+}
+
+func writeKey(file string, key *rsa.PrivateKey, pass secrets.Secret) error {
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if pass != "" {
+		var err error
+		//nolint:staticcheck // legacy PEM encryption is used by OPC UA tools
+		block, err = x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte(pass.Reveal()), x509.PEMCipherAES256)
+		if err != nil {
+			return err
+		}
+	}
+	return writePEM(file, block, 0600)
+}
+
+func writePEM(file string, block *pem.Block, perm os.FileMode) error {
+	if dir := filepath.Dir(file); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(file, pem.EncodeToMemory(block), perm)
+}
+
+// Thumbprint is returns SHA-1 thumbprint of certificate (hex)
+func Thumbprint(der []byte) string {
+	sum := sha1.Sum(der) //nolint:gosec
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Describe is returns human-readable description of certificate
+func Describe(der []byte) (string, error) {
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Subject:     %s\n", c.Subject)
+	fmt.Fprintf(&b, "Issuer:      %s\n", c.Issuer)
+	fmt.Fprintf(&b, "Serial:      %s\n", c.SerialNumber.Text(16))
+	fmt.Fprintf(&b, "Not before:  %s\n", c.NotBefore.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Not after:   %s\n", c.NotAfter.Format(time.RFC3339))
+	for _, u := range c.URIs {
+		fmt.Fprintf(&b, "URI:         %s\n", u)
+	}
+	for _, d := range c.DNSNames {
+		fmt.Fprintf(&b, "DNS:         %s\n", d)
+	}
+	for _, ip := range c.IPAddresses {
+		fmt.Fprintf(&b, "IP:          %s\n", ip)
+	}
+	fmt.Fprintf(&b, "Thumbprint:  %s\n", Thumbprint(der))
+	return b.String(), nil
+}
@@ -0,0 +1,43 @@
+package pki
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "pki", "cert.pem")
+	keyFile := filepath.Join(dir, "pki", "key.pem")
+	uri := "urn:test:opcuaModbus"
+
+	generated, err := EnsureCertificate(certFile, keyFile, uri, "secret")
+	require.NoError(t, err)
+	require.True(t, generated)
+
+	generated, err = EnsureCertificate(certFile, keyFile, uri, "secret")
+	require.NoError(t, err)
+	require.False(t, generated)
+
+	der, err := LoadCertificate(certFile)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	require.Len(t, cert.URIs, 1)
+	require.Equal(t, uri, cert.URIs[0].String())
+
+	_, err = LoadPrivateKey(keyFile, "wrong")
+	require.Error(t, err)
+	key, err := LoadPrivateKey(keyFile, "secret")
+	require.NoError(t, err)
+	require.Equal(t, key.PublicKey.N, cert.PublicKey.(*rsa.PublicKey).N)
+
+	require.NoError(t, RenewCertificate(certFile, keyFile, uri, key, "secret"))
+	renewed, err := LoadCertificate(certFile)
+	require.NoError(t, err)
+	require.NotEqual(t, Thumbprint(der), Thumbprint(renewed))
+}
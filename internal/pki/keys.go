@@ -0,0 +1,44 @@
+package pki
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"opcuaModbus/internal/secrets"
+	"os"
+)
+
+// LoadPrivateKey is reads RSA private key from PEM (optionally encrypted by passphrase) or DER file
+func LoadPrivateKey(file string, pass secrets.Secret) (*rsa.PrivateKey, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %w", err)
+	}
+
+	der := b
+	if block, _ := pem.Decode(b); block != nil {
+		der = block.Bytes
+		//nolint:staticcheck // legacy PEM encryption is used by OPC UA tools
+		if x509.IsEncryptedPEMBlock(block) {
+			der, err = x509.DecryptPEMBlock(block, []byte(pass.Reveal()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt private key %s: %w", file, err)
+			}
+		}
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %w", file, err)
+	}
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA " + file)
+	}
+	return key, nil
+}
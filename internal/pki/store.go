@@ -0,0 +1,293 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// directories of PKI store
+const (
+	Trusted  = "trusted"
+	Rejected = "rejected"
+	Issuers  = "issuers"
+	CRL      = "crl"
+)
+
+// ErrUntrusted is server certificate is not trusted (copied to rejected/)
+var ErrUntrusted = errors.New("server certificate is not trusted")
+
+// Store is trust store of server certificates:
+//
+//	trusted/   trusted server certificates and CA
+//	rejected/  unknown server certificates, move to trusted/ to allow
+//	issuers/   intermediate CA (not trusted themselves)
+//	crl/       certificate revocation lists
+type Store struct {
+	Dir string
+}
+
+// Entry is certificate in store
+type Entry struct {
+	File       string
+	Subject    string
+	Thumbprint string
+	NotAfter   time.Time
+}
+
+// NewStore is creating directories of trust store
+func NewStore(dir string) (*Store, error) {
+	for _, d := range []string{Trusted, Rejected, Issuers, CRL} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{Dir: dir}, nil
+}
+
+// Verify is checking server certificate: expiry, trust, hostname & revocation.
+// Untrusted certificate is copied to rejected/ (hostname is not checked then).
+// Hostname is not checked for certificate in trusted/: it is trusted by operator
+// (e.g. PLC addressed by IP without IP in SAN), only for certificates issued by trusted CA.
+func (s *Store) Verify(der []byte, host string) error {
+	if len(der) == 0 {
+		return errors.New("server has no certificate")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("bad server certificate: %w", err)
+	}
+
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("server certificate %q is not valid now (%s - %s)",
+			cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+	}
+
+	trusted, explicit, err := s.trusted(cert)
+	if err != nil {
+		return err
+	}
+	if !trusted {
+		file, err := s.reject(cert)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %q, move %s to %s/", ErrUntrusted, cert.Subject.CommonName, file, Trusted)
+	}
+	if host != "" && !explicit {
+		if err := cert.VerifyHostname(host); err != nil {
+			return fmt.Errorf("server certificate %q: %w", cert.Subject.CommonName, err)
+		}
+	}
+
+	if revoked, err := s.revoked(cert); err != nil {
+		return err
+	} else if revoked {
+		return fmt.Errorf("server certificate %q is revoked", cert.Subject.CommonName)
+	}
+	return nil
+}
+
+// trusted is checking that certificate is in trusted/ (explicit) or is issued by trusted CA
+func (s *Store) trusted(cert *x509.Certificate) (trusted, explicit bool, err error) {
+	certs, err := s.certs(Trusted)
+	if err != nil {
+		return false, false, err
+	}
+	roots := x509.NewCertPool()
+	for _, t := range certs {
+		if bytes.Equal(t.Raw, cert.Raw) {
+			return true, true, nil
+		}
+		if t.IsCA {
+			roots.AddCert(t)
+		}
+	}
+
+	issuers, err := s.certs(Issuers)
+	if err != nil {
+		return false, false, err
+	}
+	inter := x509.NewCertPool()
+	for _, c := range issuers {
+		inter.AddCert(c)
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: inter,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err == nil, false, nil
+}
+
+// revoked is checking certificate in CRLs of crl/
+func (s *Store) revoked(cert *x509.Certificate) (bool, error) {
+	files, err := os.ReadDir(filepath.Join(s.Dir, CRL))
+	if err != nil {
+		return false, err
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.Dir, CRL, f.Name()))
+		if err != nil {
+			return false, err
+		}
+		//nolint:staticcheck // ParseRevocationList requires go1.19
+		crl, err := x509.ParseCRL(b)
+		if err != nil {
+			continue
+		}
+		var issuer pkix.Name
+		issuer.FillFromRDNSequence(&crl.TBSCertList.Issuer)
+		if issuer.String() != cert.Issuer.String() {
+			continue
+		}
+		for _, rc := range crl.TBSCertList.RevokedCertificates {
+			if rc.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// reject is writing certificate to rejected/, returns file name
+func (s *Store) reject(cert *x509.Certificate) (string, error) {
+	file := filepath.Join(s.Dir, Rejected, fileName(cert))
+	if _, err := os.Stat(file); err == nil {
+		return file, nil
+	}
+	return file, os.WriteFile(file, cert.Raw, 0644)
+}
+
+// certs is reads certificates (DER or PEM) from directory of store
+func (s *Store) certs(sub string) ([]*x509.Certificate, error) {
+	entries, err := s.files(sub)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, file := range entries {
+		der, err := LoadCertificate(file)
+		if err != nil {
+			continue
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+func (s *Store) files(sub string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, sub))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			files = append(files, filepath.Join(s.Dir, sub, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// List is returns certificates of directory (trusted, rejected, issuers)
+func (s *Store) List(sub string) ([]Entry, error) {
+	files, err := s.files(sub)
+	if err != nil {
+		return nil, err
+	}
+	var list []Entry
+	for _, file := range files {
+		der, err := LoadCertificate(file)
+		if err != nil {
+			continue
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		list = append(list, Entry{
+			File:       file,
+			Subject:    c.Subject.String(),
+			Thumbprint: Thumbprint(der),
+			NotAfter:   c.NotAfter,
+		})
+	}
+	return list, nil
+}
+
+// Trust is moving certificate from rejected/ to trusted/ (by thumbprint prefix)
+func (s *Store) Trust(thumbprint string) (string, error) {
+	return s.move(Rejected, Trusted, thumbprint)
+}
+
+// Reject is moving certificate from trusted/ to rejected/ (by thumbprint prefix)
+func (s *Store) Reject(thumbprint string) (string, error) {
+	return s.move(Trusted, Rejected, thumbprint)
+}
+
+// Add is copying certificate file to trusted/
+func (s *Store) Add(file string) (string, error) {
+	der, err := LoadCertificate(file)
+	if err != nil {
+		return "", err
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(s.Dir, Trusted, fileName(c))
+	return dst, os.WriteFile(dst, der, 0644)
+}
+
+func (s *Store) move(from, to, thumbprint string) (string, error) {
+	thumbprint = strings.ToUpper(strings.TrimSpace(thumbprint))
+	if thumbprint == "" {
+		return "", errors.New("empty thumbprint")
+	}
+	list, err := s.List(from)
+	if err != nil {
+		return "", err
+	}
+
+	var found []Entry
+	for _, e := range list {
+		if strings.HasPrefix(e.Thumbprint, thumbprint) {
+			found = append(found, e)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("certificate %s not found in %s/", thumbprint, from)
+	case 1:
+	default:
+		return "", fmt.Errorf("thumbprint %s is ambiguous", thumbprint)
+	}
+
+	dst := filepath.Join(s.Dir, to, filepath.Base(found[0].File))
+	return dst, os.Rename(found[0].File, dst)
+}
+
+var badChars = regexp.MustCompile(`[^\w\-. ]`)
+
+// fileName is file name of certificate in store: "<CN> [<thumbprint>].der"
+func fileName(c *x509.Certificate) string {
+	cn := badChars.ReplaceAllString(c.Subject.CommonName, "_")
+	return fmt.Sprintf("%s [%s].der", cn, Thumbprint(c.Raw))
+}
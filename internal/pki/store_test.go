@@ -0,0 +1,83 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := selfSigned("urn:plc:server", key)
+	require.NoError(t, err)
+	host, _ := os.Hostname()
+
+	// unknown certificate with other host name is rejected
+	err = store.Verify(der, "plc.invalid")
+	require.True(t, errors.Is(err, ErrUntrusted), err)
+	rejected, err := store.List(Rejected)
+	require.NoError(t, err)
+	require.Len(t, rejected, 1)
+	require.Equal(t, Thumbprint(der), rejected[0].Thumbprint)
+
+	_, err = store.Trust(Thumbprint(der)[:8])
+	require.NoError(t, err)
+	require.NoError(t, store.Verify(der, host))
+	require.NoError(t, store.Verify(der, "192.168.0.10"), "certificate in trusted/ overrides host name")
+
+	_, err = store.Reject(Thumbprint(der))
+	require.NoError(t, err)
+	require.True(t, errors.Is(store.Verify(der, host), ErrUntrusted))
+}
+
+func TestStoreIssuedByCA(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "plant CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, Trusted, "ca.der"), caDER, 0644))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "plc1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		DNSNames:     []string{"plc1.plant"},
+	}, caTmpl, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	// host name is checked for certificates issued by trusted CA
+	require.NoError(t, store.Verify(der, "plc1.plant"))
+	err = store.Verify(der, "plc2.plant")
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrUntrusted), err)
+}
@@ -0,0 +1,136 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const redacted = "******"
+
+// Secret is value of password/passphrase, hidden when printed or marshaled
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString is hiding value for %#v
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+// MarshalJSON is hiding value in status API
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
+
+// MarshalText is hiding value in text encoders (toml/yaml)
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Reveal is returns real value of the secret
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// Resolver is resolving references to secrets:
+//
+//	env:NAME      - environment variable
+//	file:/path    - file contents (Docker/Kubernetes secret mounts)
+//	vault:name    - encrypted vault file unlocked by master key
+//
+// any other value is used as is.
+type Resolver struct {
+	VaultFile     string
+	MasterKeyFile string
+	vault         map[string]string
+	values        []string
+}
+
+// MasterKeyEnv is environment variable with master key of vault
+const MasterKeyEnv = "OPCUAMODBUS_MASTER_KEY"
+
+// Resolve is resolving reference to Secret
+func (r *Resolver) Resolve(ref string) (Secret, error) {
+	ref = strings.TrimSpace(ref)
+
+	var (
+		val string
+		err error
+	)
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret env %s not set", name)
+		}
+		val = v
+	case strings.HasPrefix(ref, "file:"):
+		b, e := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if e != nil {
+			return "", fmt.Errorf("secret file: %w", e)
+		}
+		val = strings.TrimRight(string(b), "\r\n")
+	case strings.HasPrefix(ref, "vault:"):
+		val, err = r.fromVault(strings.TrimPrefix(ref, "vault:"))
+		if err != nil {
+			return "", err
+		}
+	default:
+		val = ref
+	}
+
+	if val != "" {
+		r.values = append(r.values, val)
+	}
+	return Secret(val), nil
+}
+
+// Values is returns all resolved secret values (for redaction in logs)
+func (r *Resolver) Values() []string {
+	return r.values
+}
+
+func (r *Resolver) fromVault(name string) (string, error) {
+	if r.vault == nil {
+		if r.VaultFile == "" {
+			return "", errors.New("secret vault not configured")
+		}
+		key, err := MasterKey(r.MasterKeyFile)
+		if err != nil {
+			return "", err
+		}
+		r.vault, err = OpenVault(r.VaultFile, key)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	v, ok := r.vault[name]
+	if !ok {
+		return "", fmt.Errorf("secret %s not found in vault", name)
+	}
+	return v, nil
+}
+
+// MasterKey is reads master key of vault from file, if defined, else from OPCUAMODBUS_MASTER_KEY
+func MasterKey(file string) (string, error) {
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("master key: %w", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	if k := os.Getenv(MasterKeyEnv); k != "" {
+		return k, nil
+	}
+	return "", errors.New("master key not set: " + MasterKeyEnv)
+}
@@ -0,0 +1,53 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pass")
+	require.NoError(t, os.WriteFile(file, []byte("from-file\n"), 0600))
+	t.Setenv("OPCUA_TEST_PASS", "from-env")
+	t.Setenv(MasterKeyEnv, "master")
+
+	vault := filepath.Join(dir, "secrets.vault")
+	require.NoError(t, SaveVault(vault, "master", map[string]string{"plc1": "from-vault"}))
+
+	r := &Resolver{VaultFile: vault}
+	for ref, want := range map[string]string{
+		"plain":               "plain",
+		"env:OPCUA_TEST_PASS": "from-env",
+		"file:" + file:        "from-file",
+		"vault:plc1":          "from-vault",
+		"":                    "",
+	} {
+		s, err := r.Resolve(ref)
+		require.NoError(t, err, ref)
+		require.Equal(t, want, s.Reveal(), ref)
+	}
+	require.Len(t, r.Values(), 4)
+
+	_, err := r.Resolve("env:OPCUA_TEST_NOT_SET")
+	require.Error(t, err)
+	_, err = r.Resolve("vault:none")
+	require.Error(t, err)
+
+	_, err = OpenVault(vault, "wrong")
+	require.Error(t, err)
+}
+
+func TestSecretRedacted(t *testing.T) {
+	s := Secret("password")
+	require.Equal(t, "****** ****** ******", fmt.Sprintf("%v %s %#v", s, s, s))
+
+	b, err := json.Marshal(struct{ Password Secret }{s})
+	require.NoError(t, err)
+	require.Equal(t, `{"Password":"******"}`, string(b))
+}
@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// vault file: salt(16) | nonce(12) | AES-256-GCM(json map name->value)
+const (
+	saltLen  = 16
+	nonceLen = 12
+)
+
+// OpenVault is decrypting vault file by master key
+func OpenVault(path, masterKey string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	if len(data) < saltLen+nonceLen {
+		return nil, errors.New("vault: bad file " + path)
+	}
+
+	gcm, err := newGCM(masterKey, data[:saltLen])
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, data[saltLen:saltLen+nonceLen], data[saltLen+nonceLen:], nil)
+	if err != nil {
+		return nil, errors.New("vault: wrong master key or corrupted file")
+	}
+
+	vault := map[string]string{}
+	if err := json.Unmarshal(plain, &vault); err != nil {
+		return nil, err
+	}
+	return vault, nil
+}
+
+// SaveVault is encrypting vault by master key and writing to file
+func SaveVault(path, masterKey string, vault map[string]string) error {
+	plain, err := json.Marshal(vault)
+	if err != nil {
+		return err
+	}
+
+	head := make([]byte, saltLen+nonceLen)
+	if _, err := rand.Read(head); err != nil {
+		return err
+	}
+	gcm, err := newGCM(masterKey, head[:saltLen])
+	if err != nil {
+		return err
+	}
+	data := gcm.Seal(head, head[saltLen:], plain, nil)
+
+	return os.WriteFile(path, data, 0600)
+}
+
+func newGCM(masterKey string, salt []byte) (cipher.AEAD, error) {
+	if masterKey == "" {
+		return nil, errors.New("vault: empty master key")
+	}
+	key, err := scrypt.Key([]byte(masterKey), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
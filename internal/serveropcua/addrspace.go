@@ -0,0 +1,382 @@
+package serveropcua
+
+import (
+	"fmt"
+	"opcuaModbus/internal/modbus"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+)
+
+// reference is forward reference of node
+type reference struct {
+	typeID uint32 // id.Organizes, id.HasComponent, id.HasProperty
+	target *node
+}
+
+// node is node of address space
+type node struct {
+	id          *ua.NodeID
+	class       ua.NodeClass
+	browseName  *ua.QualifiedName
+	displayName string
+	description string
+	typeDef     *node
+	refs        []reference
+	parent      *node
+	parentRef   uint32 // type of reference of parent to node
+
+	// variable
+	dataType  uint32
+	valueRank int32 // -1 scalar, 1 array
+	access    byte
+	value     func() *ua.DataValue
+	write     func(v *ua.Variant) ua.StatusCode // nil - read only
+}
+
+// addressSpace is nodes of server: standard nodes of Server object & folders of units with variables of tags
+type addressSpace struct {
+	srv     *Server
+	nodes   map[string]*node // by node id
+	objects *node
+	units   map[modbus.UnitID]*node
+	started time.Time
+}
+
+// superTypes is super type of reference types of address space
+var superTypes = map[uint32]uint32{
+	id.HierarchicalReferences:    id.References,
+	id.NonHierarchicalReferences: id.References,
+	id.HasChild:                  id.HierarchicalReferences,
+	id.Organizes:                 id.HierarchicalReferences,
+	id.Aggregates:                id.HasChild,
+	id.HasComponent:              id.Aggregates,
+	id.HasProperty:               id.Aggregates,
+	id.HasTypeDefinition:         id.NonHierarchicalReferences,
+}
+
+func newAddressSpace(srv *Server) *addressSpace {
+	s := &addressSpace{srv: srv, nodes: map[string]*node{}, units: map[modbus.UnitID]*node{}, started: time.Now()}
+
+	folderType := s.add(&node{id: ua.NewNumericNodeID(0, id.FolderType), class: ua.NodeClassObjectType, browseName: &ua.QualifiedName{Name: "FolderType"}})
+	serverType := s.add(&node{id: ua.NewNumericNodeID(0, id.ServerType), class: ua.NodeClassObjectType, browseName: &ua.QualifiedName{Name: "ServerType"}})
+	variableType := s.add(&node{id: ua.NewNumericNodeID(0, id.BaseDataVariableType), class: ua.NodeClassVariableType, browseName: &ua.QualifiedName{Name: "BaseDataVariableType"}})
+	propertyType := s.add(&node{id: ua.NewNumericNodeID(0, id.PropertyType), class: ua.NodeClassVariableType, browseName: &ua.QualifiedName{Name: "PropertyType"}})
+	statusType := s.add(&node{id: ua.NewNumericNodeID(0, id.ServerStatusType), class: ua.NodeClassVariableType, browseName: &ua.QualifiedName{Name: "ServerStatusType"}})
+
+	root := s.add(&node{id: ua.NewNumericNodeID(0, id.RootFolder), class: ua.NodeClassObject, browseName: &ua.QualifiedName{Name: "Root"}, typeDef: folderType})
+	s.objects = s.link(root, id.Organizes, &node{id: ua.NewNumericNodeID(0, id.ObjectsFolder), class: ua.NodeClassObject, browseName: &ua.QualifiedName{Name: "Objects"}, typeDef: folderType})
+
+	server := s.link(s.objects, id.Organizes, &node{id: ua.NewNumericNodeID(0, id.Server), class: ua.NodeClassObject, browseName: &ua.QualifiedName{Name: "Server"}, typeDef: serverType})
+	property := func(nid uint32, name string, dataType uint32, valueRank int32, value func() interface{}) *node {
+		return s.link(server, id.HasProperty, &node{id: ua.NewNumericNodeID(0, nid), class: ua.NodeClassVariable, browseName: &ua.QualifiedName{Name: name},
+			typeDef: propertyType, dataType: dataType, valueRank: valueRank, access: byte(ua.AccessLevelTypeCurrentRead), value: goodValue(value)})
+	}
+	property(id.Server_ServerArray, "ServerArray", id.String, 1, func() interface{} { return []string{srv.conf.ApplicationURI} })
+	property(id.Server_NamespaceArray, "NamespaceArray", id.String, 1, func() interface{} {
+		return []string{"http://opcfoundation.org/UA/", srv.conf.ApplicationURI}
+	})
+	property(id.Server_ServiceLevel, "ServiceLevel", id.Byte, -1, func() interface{} { return byte(255) })
+
+	status := s.link(server, id.HasComponent, &node{id: ua.NewNumericNodeID(0, id.Server_ServerStatus), class: ua.NodeClassVariable, browseName: &ua.QualifiedName{Name: "ServerStatus"},
+		typeDef: statusType, dataType: id.ServerStatusDataType, valueRank: -1, access: byte(ua.AccessLevelTypeCurrentRead), value: goodValue(func() interface{} {
+			return ua.NewExtensionObject(&ua.ServerStatusDataType{
+				StartTime:   s.started,
+				CurrentTime: time.Now(),
+				State:       ua.ServerStateRunning,
+				BuildInfo: &ua.BuildInfo{
+					ProductURI:  srv.conf.ApplicationURI,
+					ProductName: srv.conf.ApplicationName,
+				},
+				ShutdownReason: ua.NewLocalizedText(""),
+			})
+		})})
+	s.link(status, id.HasComponent, &node{id: ua.NewNumericNodeID(0, id.Server_ServerStatus_CurrentTime), class: ua.NodeClassVariable, browseName: &ua.QualifiedName{Name: "CurrentTime"},
+		typeDef: variableType, dataType: id.UtcTime, valueRank: -1, access: byte(ua.AccessLevelTypeCurrentRead), value: goodValue(func() interface{} { return time.Now() })})
+	s.link(status, id.HasComponent, &node{id: ua.NewNumericNodeID(0, id.Server_ServerStatus_State), class: ua.NodeClassVariable, browseName: &ua.QualifiedName{Name: "State"},
+		typeDef: variableType, dataType: id.ServerState, valueRank: -1, access: byte(ua.AccessLevelTypeCurrentRead), value: goodValue(func() interface{} { return int32(ua.ServerStateRunning) })})
+	return s
+}
+
+// add is adding node to address space
+func (s *addressSpace) add(n *node) *node {
+	if n.displayName == "" {
+		n.displayName = n.browseName.Name
+	}
+	s.nodes[n.id.String()] = n
+	return n
+}
+
+// link is adding node as target of reference of parent
+func (s *addressSpace) link(parent *node, refType uint32, n *node) *node {
+	s.add(n)
+	n.parent, n.parentRef = parent, refType
+	parent.refs = append(parent.refs, reference{typeID: refType, target: n})
+	return n
+}
+
+// unit is returns folder of unit, created on first use
+func (s *addressSpace) unit(u modbus.UnitID) *node {
+	if f, ok := s.units[u]; ok {
+		return f
+	}
+	name := fmt.Sprintf("Unit%d", u)
+	f := s.link(s.objects, id.Organizes, &node{
+		id:          ua.NewStringNodeID(Namespace, name),
+		class:       ua.NodeClassObject,
+		browseName:  &ua.QualifiedName{NamespaceIndex: Namespace, Name: name},
+		description: fmt.Sprintf("ModBus unit %d", u),
+		typeDef:     s.nodes[ua.NewNumericNodeID(0, id.FolderType).String()],
+	})
+	s.units[u] = f
+	return f
+}
+
+// addVariable is adding variable of tag (and property EngineeringUnits) to folder of unit
+func (s *addressSpace) addVariable(v Variable) error {
+	name := strings.TrimSpace(v.Name)
+	if name == "" {
+		return fmt.Errorf("unit %d: empty name of variable", v.Unit)
+	}
+	dataType := v.Tag.DataType()
+	if dataType == 0 || v.Tag.Registers() == 0 {
+		return fmt.Errorf("unit %d: variable %s: unsupported type %q", v.Unit, name, v.Tag.TypeData)
+	}
+	folder := s.unit(v.Unit)
+	nid := ua.NewStringNodeID(Namespace, folder.browseName.Name+"."+name)
+	if _, ok := s.nodes[nid.String()]; ok {
+		return fmt.Errorf("unit %d: duplicate variable %s", v.Unit, name)
+	}
+
+	access := byte(ua.AccessLevelTypeCurrentRead)
+	var write func(*ua.Variant) ua.StatusCode
+	if s.srv.conf.Writes && v.Tag.Writable() && !v.ReadOnly {
+		access |= byte(ua.AccessLevelTypeCurrentWrite)
+		write = func(val *ua.Variant) ua.StatusCode { return s.srv.writeVariable(v, val) }
+	}
+	vn := s.link(folder, id.HasComponent, &node{
+		id:          nid,
+		class:       ua.NodeClassVariable,
+		browseName:  &ua.QualifiedName{NamespaceIndex: Namespace, Name: name},
+		description: v.Description,
+		typeDef:     s.nodes[ua.NewNumericNodeID(0, id.BaseDataVariableType).String()],
+		dataType:    dataType,
+		valueRank:   -1,
+		access:      access,
+		value:       func() *ua.DataValue { return s.srv.readVariable(v) },
+		write:       write,
+	})
+
+	if units := strings.TrimSpace(v.Tag.Units); units != "" {
+		eu := ua.NewExtensionObject(&ua.EUInformation{
+			NamespaceURI: "http://www.opcfoundation.org/UA/units/un/cefact",
+			UnitID:       -1,
+			DisplayName:  ua.NewLocalizedText(units),
+			Description:  ua.NewLocalizedText(units),
+		})
+		s.link(vn, id.HasProperty, &node{
+			id:         ua.NewStringNodeID(Namespace, nid.StringID()+".EngineeringUnits"),
+			class:      ua.NodeClassVariable,
+			browseName: &ua.QualifiedName{Name: "EngineeringUnits"},
+			typeDef:    s.nodes[ua.NewNumericNodeID(0, id.PropertyType).String()],
+			dataType:   id.EUInformation,
+			valueRank:  -1,
+			access:     byte(ua.AccessLevelTypeCurrentRead),
+			value:      goodValue(func() interface{} { return eu }),
+		})
+	}
+	return nil
+}
+
+// goodValue is value of node with status Good
+func goodValue(v func() interface{}) func() *ua.DataValue {
+	return func() *ua.DataValue {
+		return &ua.DataValue{
+			EncodingMask:    ua.DataValueValue | ua.DataValueServerTimestamp,
+			Value:           ua.MustVariant(v()),
+			ServerTimestamp: time.Now(),
+		}
+	}
+}
+
+// read is reading attribute of node
+func (s *addressSpace) read(rv *ua.ReadValueID) *ua.DataValue {
+	if rv == nil || rv.NodeID == nil {
+		return statusValue(ua.StatusBadNodeIDUnknown)
+	}
+	n, ok := s.nodes[rv.NodeID.String()]
+	if !ok {
+		return statusValue(ua.StatusBadNodeIDUnknown)
+	}
+	variable := n.class == ua.NodeClassVariable
+	if rv.IndexRange != "" && rv.AttributeID == ua.AttributeIDValue {
+		return statusValue(ua.StatusBadIndexRangeInvalid)
+	}
+
+	var v interface{}
+	switch rv.AttributeID {
+	case ua.AttributeIDNodeID:
+		v = n.id
+	case ua.AttributeIDNodeClass:
+		v = int32(n.class)
+	case ua.AttributeIDBrowseName:
+		v = n.browseName
+	case ua.AttributeIDDisplayName:
+		v = ua.NewLocalizedText(n.displayName)
+	case ua.AttributeIDDescription:
+		v = ua.NewLocalizedText(n.description)
+	case ua.AttributeIDWriteMask, ua.AttributeIDUserWriteMask:
+		v = uint32(0)
+	case ua.AttributeIDIsAbstract:
+		if n.class == ua.NodeClassObjectType || n.class == ua.NodeClassVariableType {
+			v = false
+		}
+	case ua.AttributeIDEventNotifier:
+		if n.class == ua.NodeClassObject {
+			v = byte(0)
+		}
+	case ua.AttributeIDValue:
+		if variable {
+			atomic.AddUint64(&s.srv.reads, 1)
+			return n.value()
+		}
+	case ua.AttributeIDDataType:
+		if variable {
+			v = ua.NewNumericNodeID(0, n.dataType)
+		}
+	case ua.AttributeIDValueRank:
+		if variable {
+			v = n.valueRank
+		}
+	case ua.AttributeIDArrayDimensions:
+		if variable && n.valueRank == 1 {
+			v = []uint32{0}
+		}
+	case ua.AttributeIDAccessLevel, ua.AttributeIDUserAccessLevel:
+		if variable {
+			v = n.access
+		}
+	case ua.AttributeIDMinimumSamplingInterval:
+		if variable {
+			v = float64(0)
+		}
+	case ua.AttributeIDHistorizing:
+		if variable {
+			v = false
+		}
+	}
+	if v == nil {
+		return statusValue(ua.StatusBadAttributeIDInvalid)
+	}
+	return &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(v)}
+}
+
+// write is writing attribute of node, only Value of writable variables
+func (s *addressSpace) write(wv *ua.WriteValue) ua.StatusCode {
+	if wv == nil || wv.NodeID == nil {
+		return ua.StatusBadNodeIDUnknown
+	}
+	n, ok := s.nodes[wv.NodeID.String()]
+	if !ok {
+		return ua.StatusBadNodeIDUnknown
+	}
+	if wv.AttributeID != ua.AttributeIDValue {
+		return ua.StatusBadNotWritable
+	}
+	if n.write == nil {
+		return ua.StatusBadNotWritable
+	}
+	if wv.IndexRange != "" {
+		return ua.StatusBadWriteNotSupported
+	}
+	if wv.Value == nil || wv.Value.Value == nil || wv.Value.Value.Value() == nil {
+		return ua.StatusBadTypeMismatch
+	}
+	if wv.Value.Has(ua.DataValueStatusCode) && wv.Value.Status != ua.StatusOK {
+		return ua.StatusBadWriteNotSupported
+	}
+	if uint32(wv.Value.Value.Type()) != n.dataType || wv.Value.Value.ArrayLength() != 0 {
+		return ua.StatusBadTypeMismatch
+	}
+	return n.write(wv.Value.Value)
+}
+
+// browse is returns references of node by browse description
+func (s *addressSpace) browse(bd *ua.BrowseDescription) (ua.StatusCode, []*ua.ReferenceDescription) {
+	if bd == nil || bd.NodeID == nil {
+		return ua.StatusBadNodeIDUnknown, nil
+	}
+	n, ok := s.nodes[bd.NodeID.String()]
+	if !ok {
+		return ua.StatusBadNodeIDUnknown, nil
+	}
+	if bd.BrowseDirection > ua.BrowseDirectionBoth {
+		return ua.StatusBadBrowseDirectionInvalid, nil
+	}
+
+	var filter uint32
+	if bd.ReferenceTypeID != nil && bd.ReferenceTypeID.Namespace() == 0 {
+		filter = bd.ReferenceTypeID.IntID()
+	}
+	match := func(refType uint32, target *node) bool {
+		if bd.NodeClassMask != 0 && bd.NodeClassMask&uint32(target.class) == 0 {
+			return false
+		}
+		if filter == 0 {
+			return true
+		}
+		for t := refType; ; {
+			if t == filter {
+				return true
+			}
+			super, ok := superTypes[t]
+			if !bd.IncludeSubtypes || !ok {
+				return false
+			}
+			t = super
+		}
+	}
+
+	var refs []*ua.ReferenceDescription
+	forward := bd.BrowseDirection == ua.BrowseDirectionForward || bd.BrowseDirection == ua.BrowseDirectionBoth
+	inverse := bd.BrowseDirection == ua.BrowseDirectionInverse || bd.BrowseDirection == ua.BrowseDirectionBoth
+	if forward {
+		for _, r := range n.refs {
+			if match(r.typeID, r.target) {
+				refs = append(refs, r.target.reference(r.typeID, true))
+			}
+		}
+		if n.typeDef != nil && match(id.HasTypeDefinition, n.typeDef) {
+			refs = append(refs, n.typeDef.reference(id.HasTypeDefinition, true))
+		}
+	}
+	if inverse && n.parent != nil && match(n.parentRef, n.parent) {
+		refs = append(refs, n.parent.reference(n.parentRef, false))
+	}
+	return ua.StatusOK, refs
+}
+
+// reference is description of reference to node
+func (n *node) reference(refType uint32, forward bool) *ua.ReferenceDescription {
+	typeDef := ua.NewTwoByteExpandedNodeID(0)
+	if n.typeDef != nil {
+		typeDef = ua.NewExpandedNodeID(n.typeDef.id, "", 0)
+	}
+	return &ua.ReferenceDescription{
+		ReferenceTypeID: ua.NewNumericNodeID(0, refType),
+		IsForward:       forward,
+		NodeID:          ua.NewExpandedNodeID(n.id, "", 0),
+		BrowseName:      n.browseName,
+		DisplayName:     ua.NewLocalizedText(n.displayName),
+		NodeClass:       n.class,
+		TypeDefinition:  typeDef,
+	}
+}
+
+// statusValue is data value with bad status
+func statusValue(sc ua.StatusCode) *ua.DataValue {
+	return &ua.DataValue{EncodingMask: ua.DataValueStatusCode, Status: sc}
+}
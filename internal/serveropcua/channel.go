@@ -0,0 +1,373 @@
+package serveropcua
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/gopcua/opcua/uacp"
+	"github.com/gopcua/opcua/uasc"
+)
+
+// limits of secure channel
+const (
+	maxMessageSize  = 4 << 20
+	maxChunkCount   = 512
+	defaultLifetime = 3600000 // ms
+	chunkHeaderSize = 24      // message header, symmetric security header & sequence header
+	expireInterval  = time.Second
+)
+
+// conn is connection of client: secure channel with SecurityPolicy None and sessions created in it
+type conn struct {
+	srv  *Server
+	c    *uacp.Conn
+	ack  *uacp.Acknowledge
+	ctx  context.Context
+	stop context.CancelFunc
+
+	channelID uint32
+	tokenID   uint32
+	chunks    map[uint32][]byte // bodies of intermediate chunks by request id
+	buffered  int               // bytes of intermediate chunks of all requests
+
+	mu       sync.Mutex // sending of messages
+	seq      uint32
+	maxBody  uint32 // max body of chunk sent to client
+	maxCount uint32 // max chunks of message sent to client (0 - no limit)
+
+	smu      sync.Mutex          // sessions (expired by timeout in other goroutine)
+	sessions map[string]*session // by authentication token
+}
+
+// serve is serving connection of client until it is closed or ctx is done
+func (srv *Server) serve(ctx context.Context, sock *net.TCPConn) {
+	ack := *uacp.DefaultServerACK
+	c, err := uacp.NewConn(sock, &ack)
+	if err != nil {
+		sock.Close()
+		return
+	}
+	cn := &conn{srv: srv, c: c, ack: &ack, chunks: map[uint32][]byte{}, sessions: map[string]*session{}}
+	cn.ctx, cn.stop = context.WithCancel(ctx)
+	go func() {
+		<-cn.ctx.Done()
+		c.Close()
+	}()
+	defer cn.close()
+	go cn.expire()
+
+	if err := cn.hello(); err != nil {
+		srv.logg.Debug("opcua server hello error: ", err, " / ", sock.RemoteAddr())
+		return
+	}
+	for {
+		b, err := c.Receive()
+		if err != nil {
+			if cn.ctx.Err() == nil {
+				srv.logg.Debug("opcua server receive: ", err, " / ", sock.RemoteAddr())
+			}
+			return
+		}
+		switch string(b[:3]) {
+		case "OPN":
+			err = cn.open(b)
+		case "MSG":
+			err = cn.message(b)
+		case "CLO":
+			return
+		default:
+			c.SendError(ua.StatusBadTCPMessageTypeInvalid)
+			err = fmt.Errorf("invalid message type %q", b[:3])
+		}
+		if err != nil {
+			srv.logg.Debug("opcua server error: ", err, " / ", sock.RemoteAddr())
+			return
+		}
+	}
+}
+
+// close is closing sessions & connection
+func (cn *conn) close() {
+	cn.stop()
+	cn.smu.Lock()
+	defer cn.smu.Unlock()
+	for token := range cn.sessions {
+		cn.closeSession(token)
+	}
+}
+
+// expire is closing sessions without requests during session timeout until connection is closed
+func (cn *conn) expire() {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cn.ctx.Done():
+			return
+		case now := <-ticker.C:
+			cn.expireSessions(now)
+		}
+	}
+}
+
+// expireSessions is closing sessions timed out at now
+func (cn *conn) expireSessions(now time.Time) {
+	cn.smu.Lock()
+	defer cn.smu.Unlock()
+	for token, s := range cn.sessions {
+		if now.Sub(s.used) > s.timeout {
+			cn.srv.logg.Debug("opcua server session ", s.id, " timed out")
+			cn.closeSession(token)
+		}
+	}
+}
+
+// hello is handshake: any endpoint url of Hello is accepted, buffers are limited by buffers of client
+func (cn *conn) hello() error {
+	if err := cn.c.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return err
+	}
+	b, err := cn.c.Receive()
+	if err != nil {
+		return err
+	}
+	if err := cn.c.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+	if string(b[:4]) != "HELF" {
+		cn.c.SendError(ua.StatusBadTCPMessageTypeInvalid)
+		return fmt.Errorf("invalid handshake message %q", b[:4])
+	}
+	hel := new(uacp.Hello)
+	if _, err := hel.Decode(b[8:]); err != nil {
+		cn.c.SendError(ua.StatusBadTCPInternalError)
+		return err
+	}
+
+	// client uses buffer sizes of ACK for both directions
+	size := cn.ack.ReceiveBufSize
+	if hel.ReceiveBufSize < size {
+		size = hel.ReceiveBufSize
+	}
+	if hel.SendBufSize < size {
+		size = hel.SendBufSize
+	}
+	if size < 8192 {
+		cn.c.SendError(ua.StatusBadTCPInternalError)
+		return fmt.Errorf("buffer of client is too small: %d", size)
+	}
+	cn.ack.ReceiveBufSize, cn.ack.SendBufSize = size, size
+	cn.ack.MaxMessageSize, cn.ack.MaxChunkCount = maxMessageSize, maxChunkCount
+	cn.maxBody = size - chunkHeaderSize
+	cn.maxCount = hel.MaxChunkCount
+	return cn.c.Send("ACKF", cn.ack)
+}
+
+// open is OpenSecureChannel: issue of channel or renew of token
+func (cn *conn) open(b []byte) error {
+	m := new(uasc.MessageChunk)
+	if _, err := m.Decode(b); err != nil {
+		return err
+	}
+	if m.SecurityPolicyURI != ua.SecurityPolicyURINone {
+		cn.c.SendError(ua.StatusBadSecurityPolicyRejected)
+		return fmt.Errorf("security policy %s is not supported", m.SecurityPolicyURI)
+	}
+	seq := new(uasc.SequenceHeader)
+	n, err := seq.Decode(m.Data)
+	if err != nil {
+		return err
+	}
+	_, svc, err := ua.DecodeService(m.Data[n:])
+	if err != nil {
+		return err
+	}
+	req, ok := svc.(*ua.OpenSecureChannelRequest)
+	if !ok {
+		return fmt.Errorf("OPN with %T", svc)
+	}
+	if req.SecurityMode != ua.MessageSecurityModeNone {
+		cn.c.SendError(ua.StatusBadSecurityModeRejected)
+		return fmt.Errorf("security mode %s is not supported", req.SecurityMode)
+	}
+
+	switch req.RequestType {
+	case ua.SecurityTokenRequestTypeIssue:
+		if cn.channelID != 0 {
+			return fmt.Errorf("secure channel is already open")
+		}
+		cn.channelID = cn.srv.nextChannelID()
+	case ua.SecurityTokenRequestTypeRenew:
+		if cn.channelID == 0 || m.SecureChannelID != cn.channelID {
+			cn.c.SendError(ua.StatusBadSecureChannelIDInvalid)
+			return fmt.Errorf("renew of unknown secure channel %d", m.SecureChannelID)
+		}
+	}
+	cn.tokenID++
+
+	lifetime := req.RequestedLifetime
+	if lifetime == 0 {
+		lifetime = defaultLifetime
+	}
+	res := &ua.OpenSecureChannelResponse{
+		ResponseHeader: responseHeader(req.RequestHeader, ua.StatusOK),
+		SecurityToken: &ua.ChannelSecurityToken{
+			ChannelID:       cn.channelID,
+			TokenID:         cn.tokenID,
+			CreatedAt:       time.Now(),
+			RevisedLifetime: lifetime,
+		},
+		ServerNonce: []byte{},
+	}
+	msg := &uasc.Message{
+		MessageHeader: &uasc.MessageHeader{
+			Header:                   uasc.NewHeader("OPN", uasc.ChunkTypeFinal, cn.channelID),
+			AsymmetricSecurityHeader: uasc.NewAsymmetricSecurityHeader(ua.SecurityPolicyURINone, nil, nil),
+			SequenceHeader:           uasc.NewSequenceHeader(0, seq.RequestID),
+		},
+		TypeID:  ua.NewFourByteExpandedNodeID(0, ua.ServiceTypeID(res)),
+		Service: res,
+	}
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	cn.seq++
+	msg.SequenceHeader.SequenceNumber = cn.seq
+	chunks, err := msg.EncodeChunks(cn.maxBody)
+	if err != nil {
+		return err
+	}
+	_, err = cn.c.Write(chunks[0])
+	return err
+}
+
+// message is MSG chunk: request is handled when final chunk is received
+func (cn *conn) message(b []byte) error {
+	if len(b) < chunkHeaderSize {
+		return fmt.Errorf("message is too short")
+	}
+	if cn.channelID == 0 || binary.LittleEndian.Uint32(b[8:12]) != cn.channelID {
+		cn.c.SendError(ua.StatusBadSecureChannelIDInvalid)
+		return fmt.Errorf("message of unknown secure channel")
+	}
+	reqID := binary.LittleEndian.Uint32(b[20:24])
+	body := b[chunkHeaderSize:]
+
+	switch b[3] {
+	case uasc.ChunkTypeIntermediate:
+		if err := cn.buffer(reqID, body); err != nil {
+			cn.c.SendError(ua.StatusBadTCPMessageTooLarge)
+			return err
+		}
+		return nil
+	case uasc.ChunkTypeError:
+		cn.unbuffer(reqID)
+		return nil
+	}
+	if prev := cn.unbuffer(reqID); prev != nil {
+		body = append(prev, body...)
+	}
+
+	_, svc, err := ua.DecodeService(body)
+	if err != nil {
+		cn.srv.logg.Debug("opcua server decode request error: ", err)
+		return cn.send(reqID, &ua.ServiceFault{ResponseHeader: responseHeader(nil, ua.StatusBadServiceUnsupported)})
+	}
+	req, ok := svc.(ua.Request)
+	if !ok {
+		return cn.send(reqID, &ua.ServiceFault{ResponseHeader: responseHeader(nil, ua.StatusBadServiceUnsupported)})
+	}
+	res := cn.handle(reqID, req)
+	if res == nil {
+		return nil // response is sent later (Publish)
+	}
+	return cn.send(reqID, res)
+}
+
+// buffer is keeping body of intermediate chunk until final chunk of request,
+// error - limits of buffered chunks of connection are exceeded (channel is closed)
+func (cn *conn) buffer(reqID uint32, body []byte) error {
+	if _, ok := cn.chunks[reqID]; !ok && len(cn.chunks) >= maxChunkCount {
+		return fmt.Errorf("more than %d requests in chunks", maxChunkCount)
+	}
+	if cn.buffered+len(body) > maxMessageSize {
+		return fmt.Errorf("buffered chunks exceed %d bytes", maxMessageSize)
+	}
+	cn.chunks[reqID] = append(cn.chunks[reqID], body...)
+	cn.buffered += len(body)
+	return nil
+}
+
+// unbuffer is removing and returns buffered bodies of chunks of request
+func (cn *conn) unbuffer(reqID uint32) []byte {
+	body, ok := cn.chunks[reqID]
+	if !ok {
+		return nil
+	}
+	delete(cn.chunks, reqID)
+	cn.buffered -= len(body)
+	return body
+}
+
+// send is sending response in chunks, too large response is replaced with fault
+func (cn *conn) send(reqID uint32, res interface{}) error {
+	msg := &uasc.Message{
+		MessageHeader: &uasc.MessageHeader{
+			Header:                  uasc.NewHeader("MSG", uasc.ChunkTypeFinal, cn.channelID),
+			SymmetricSecurityHeader: uasc.NewSymmetricSecurityHeader(cn.tokenID),
+			SequenceHeader:          uasc.NewSequenceHeader(0, reqID),
+		},
+		TypeID:  ua.NewFourByteExpandedNodeID(0, ua.ServiceTypeID(res)),
+		Service: res,
+	}
+	chunks, err := msg.EncodeChunks(cn.maxBody)
+	if err != nil {
+		return err
+	}
+	if cn.maxCount > 0 && uint32(len(chunks)) > cn.maxCount {
+		var hdr *ua.ResponseHeader
+		if r, ok := res.(ua.Response); ok {
+			hdr = r.Header()
+		}
+		return cn.send(reqID, &ua.ServiceFault{ResponseHeader: faultHeader(hdr, ua.StatusBadResponseTooLarge)})
+	}
+
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	for _, ch := range chunks {
+		cn.seq++
+		binary.LittleEndian.PutUint32(ch[16:20], cn.seq)
+		if _, err := cn.c.Write(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// responseHeader is header of response to request
+func responseHeader(req *ua.RequestHeader, status ua.StatusCode) *ua.ResponseHeader {
+	h := &ua.ResponseHeader{
+		Timestamp:          time.Now(),
+		ServiceResult:      status,
+		ServiceDiagnostics: &ua.DiagnosticInfo{},
+		StringTable:        []string{},
+		AdditionalHeader:   ua.NewExtensionObject(nil),
+	}
+	if req != nil {
+		h.RequestHandle = req.RequestHandle
+	}
+	return h
+}
+
+// faultHeader is header of fault replacing response
+func faultHeader(hdr *ua.ResponseHeader, status ua.StatusCode) *ua.ResponseHeader {
+	h := responseHeader(nil, status)
+	if hdr != nil {
+		h.RequestHandle = hdr.RequestHandle
+	}
+	return h
+}
@@ -0,0 +1,239 @@
+// Package serveropcua is OPC UA server of gateway, address space is built from registers of ModBus
+// server: folder per unit (Objects/Unit<id>) and variable per tag with DataType and EngineeringUnits
+// of tag. Server supports SecurityPolicy None with anonymous sessions and services GetEndpoints,
+// CreateSession/ActivateSession/CloseSession, Browse, Read, Write and subscriptions to data changes.
+// Write of variable is write of master to unit (see modbus.WriteHandler), so only tags mapped to
+// coils & holding registers of units with write handlers are writable.
+package serveropcua
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+	"github.com/sirupsen/logrus"
+)
+
+// defaults of config
+const (
+	DefaultPort            = 4840
+	DefaultApplicationURI  = "urn:opcuaModbus:gateway"
+	DefaultApplicationName = "opcuaModbus gateway"
+)
+
+// Namespace is namespace index of nodes of units & tags
+const Namespace = 1
+
+// Config is configuration of OPC UA server
+type Config struct {
+	Host string
+	Port int
+	// EndpointURL is advertised endpoint, default opc.tcp://<host>:<port>
+	EndpointURL     string
+	ApplicationURI  string
+	ApplicationName string
+	// Writes is allowing Write of variables of writable tags, default false:
+	// variables are read only, Write is refused with BadUserAccessDenied
+	Writes bool
+}
+
+// Variable is tag of unit published as variable of address space
+type Variable struct {
+	Unit modbus.UnitID
+	// Name is browse name of variable (alias or node of tag), unique in unit
+	Name        string
+	Tag         clientopcua.Tag
+	Description string
+	// ReadOnly is variable of coil or holding register which is not writable, e.g. mapped to input of device
+	ReadOnly bool
+}
+
+// Stats is counters of server
+type Stats struct {
+	Sessions      int
+	Subscriptions int
+	Reads         uint64 // read values
+	Writes        uint64 // written values
+	WriteErrors   uint64
+	Publishes     uint64 // notification messages sent to clients
+}
+
+// Server is OPC UA server of ModBus registers
+type Server struct {
+	conf Config
+	mb   *modbus.MBServer
+	logg *logrus.Logger
+
+	space    *addressSpace
+	endpoint string
+
+	channelID uint32 // last id of secure channel
+	mu        sync.Mutex
+	stats     Stats
+	reads     uint64
+	writes    uint64
+	writeErrs uint64
+	publishes uint64
+}
+
+// New is creating OPC UA server of registers of ModBus server
+func New(conf Config, mb *modbus.MBServer, logg *logrus.Logger) *Server {
+	if conf.ApplicationURI == "" {
+		conf.ApplicationURI = DefaultApplicationURI
+	}
+	if conf.ApplicationName == "" {
+		conf.ApplicationName = DefaultApplicationName
+	}
+	srv := &Server{conf: conf, mb: mb, logg: logg}
+	srv.space = newAddressSpace(srv)
+	return srv
+}
+
+// AddVariable is adding variable of tag to folder of unit, before Start
+func (srv *Server) AddVariable(v Variable) error {
+	return srv.space.addVariable(v)
+}
+
+// Start is listening Config.Host:Config.Port (port 0 - any free port) and serving clients until ctx is done
+func (srv *Server) Start(ctx context.Context) error {
+	host := srv.conf.Host
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(srv.conf.Port)))
+	if err != nil {
+		return err
+	}
+	srv.endpoint = srv.conf.EndpointURL
+	if srv.endpoint == "" {
+		if srv.conf.Host == "" {
+			host = "localhost"
+		}
+		srv.endpoint = fmt.Sprintf("opc.tcp://%s", net.JoinHostPort(host, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)))
+	}
+	srv.logg.Info("opcua server listen: ", ln.Addr(), " endpoint: ", srv.endpoint)
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	go func() {
+		for {
+			sock, err := ln.Accept()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				srv.logg.Error("opcua server accept error: ", err)
+				continue
+			}
+			go srv.serve(ctx, sock.(*net.TCPConn))
+		}
+	}()
+	return nil
+}
+
+// Endpoint is returns endpoint url of server (after Start)
+func (srv *Server) Endpoint() string {
+	return srv.endpoint
+}
+
+// Stats is returns counters of server
+func (srv *Server) Stats() Stats {
+	srv.mu.Lock()
+	st := srv.stats
+	srv.mu.Unlock()
+	st.Reads = atomic.LoadUint64(&srv.reads)
+	st.Writes = atomic.LoadUint64(&srv.writes)
+	st.WriteErrors = atomic.LoadUint64(&srv.writeErrs)
+	st.Publishes = atomic.LoadUint64(&srv.publishes)
+	return st
+}
+
+// count is changing number of sessions & subscriptions
+func (srv *Server) count(sessions, subscriptions int) {
+	srv.mu.Lock()
+	srv.stats.Sessions += sessions
+	srv.stats.Subscriptions += subscriptions
+	srv.mu.Unlock()
+}
+
+// nextChannelID is returns id of new secure channel
+func (srv *Server) nextChannelID() uint32 {
+	return atomic.AddUint32(&srv.channelID, 1)
+}
+
+// readVariable is reading value of tag from registers of unit: BadWaitingForInitialData - registers
+// have no data yet, UncertainLastUsableValue - unit is not ready (device is disconnected)
+func (srv *Server) readVariable(v Variable) *ua.DataValue {
+	regs, ex := srv.mb.Read(v.Unit, v.Tag.MBfunc, v.Tag.MBaddr, uint16(v.Tag.Registers()))
+	if ex == modbus.IllegalDataAddress {
+		return &ua.DataValue{EncodingMask: ua.DataValueStatusCode | ua.DataValueServerTimestamp, Status: ua.StatusBadWaitingForInitialData, ServerTimestamp: time.Now()}
+	}
+	if ex != modbus.Success {
+		return &ua.DataValue{EncodingMask: ua.DataValueStatusCode | ua.DataValueServerTimestamp, Status: ua.StatusBadNoCommunication, ServerTimestamp: time.Now()}
+	}
+
+	var val interface{}
+	if v.Tag.MBfunc == modbus.ReadCoils || v.Tag.MBfunc == modbus.ReadDiscreteInputs {
+		val = regs[0] != 0
+	} else {
+		var err error
+		if val, err = clientopcua.FromRegisters(v.Tag.TypeData, regs); err != nil {
+			return &ua.DataValue{EncodingMask: ua.DataValueStatusCode, Status: ua.StatusBadTypeMismatch}
+		}
+	}
+	dv := &ua.DataValue{
+		EncodingMask:    ua.DataValueValue | ua.DataValueServerTimestamp,
+		Value:           ua.MustVariant(val),
+		ServerTimestamp: time.Now(),
+	}
+	if !srv.mb.Ready(v.Unit) {
+		dv.EncodingMask |= ua.DataValueStatusCode
+		dv.Status = ua.StatusUncertainLastUsableValue
+	}
+	return dv
+}
+
+// writeVariable is writing value of tag to unit as master (by write handlers of unit)
+func (srv *Server) writeVariable(v Variable, val *ua.Variant) ua.StatusCode {
+	var function uint8
+	var regs []uint16
+	if v.Tag.MBfunc == modbus.ReadCoils {
+		function, regs = modbus.WriteSingleCoil, []uint16{0}
+		if val.Bool() {
+			regs[0] = 1
+		}
+	} else {
+		var err error
+		if regs, err = clientopcua.ToRegisters(v.Tag.TypeData, val.Value()); err != nil {
+			return ua.StatusBadTypeMismatch
+		}
+		function = modbus.WriteMultipleRegisters
+	}
+
+	ex := srv.mb.Write(v.Unit, function, v.Tag.MBaddr, regs)
+	if ex != modbus.Success {
+		atomic.AddUint64(&srv.writeErrs, 1)
+		srv.logg.Debug("opcua server write unit ", v.Unit, "/", v.Name, " exception: ", ex)
+	}
+	switch ex {
+	case modbus.Success:
+		atomic.AddUint64(&srv.writes, 1)
+		srv.logg.Info("opcua server unit ", v.Unit, "/", v.Name, " written: ", val.Value())
+		return ua.StatusOK
+	case modbus.IllegalFunction, modbus.IllegalDataAddress:
+		return ua.StatusBadNotWritable
+	case modbus.IllegalDataValue:
+		return ua.StatusBadOutOfRange
+	default:
+		return ua.StatusBadCommunicationError
+	}
+}
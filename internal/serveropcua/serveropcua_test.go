@@ -0,0 +1,229 @@
+package serveropcua
+
+import (
+	"context"
+	"net"
+	"opcuaModbus/internal/clientopcua"
+	"opcuaModbus/internal/modbus"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"github.com/gopcua/opcua/uacp"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// server is OPC UA server of unit 5: temperature (input, float32, °C), setpoint (holding, int16)
+// and run (coil), writes of setpoint are stored in registers of unit (if writes are enabled)
+func server(t *testing.T, writes bool) (*Server, *modbus.MBServer, *opcua.Client) {
+	mb := modbus.NewServer(logrus.New(), "127.0.0.1", 0)
+	mb.AddDevice(5)
+	mb.SetReady(5, true)
+	mb.WriteInputRegisters(5, 0, 0x41AC) // 21.5
+	mb.WriteInputRegisters(5, 1, 0x0000)
+	mb.WriteHoldingRegisters(5, 10, 0xFFFE) // -2
+	mb.AddWriteHandler(5, func(function uint8, address uint16, values []uint16) modbus.Exception {
+		if function != modbus.WriteMultipleRegisters {
+			return modbus.IllegalFunction
+		}
+		for i, v := range values {
+			mb.WriteHoldingRegisters(5, address+uint16(i), v)
+		}
+		return modbus.Success
+	})
+
+	srv := New(Config{Host: "127.0.0.1", Writes: writes}, mb, logrus.New())
+	require.NoError(t, srv.AddVariable(Variable{Unit: 5, Name: "temperature", Description: "boiler",
+		Tag: clientopcua.Tag{TypeData: "float32", MBfunc: modbus.ReadInputRegisters, MBaddr: 0, Units: "°C"}}))
+	require.NoError(t, srv.AddVariable(Variable{Unit: 5, Name: "setpoint",
+		Tag: clientopcua.Tag{TypeData: "int16", MBfunc: modbus.ReadHoldingRegisters, MBaddr: 10, Write: true}}))
+	require.NoError(t, srv.AddVariable(Variable{Unit: 5, Name: "run",
+		Tag: clientopcua.Tag{TypeData: "bool", MBfunc: modbus.ReadCoils, MBaddr: 3, Write: true}}))
+	require.Error(t, srv.AddVariable(Variable{Unit: 5, Name: "run",
+		Tag: clientopcua.Tag{TypeData: "bool", MBfunc: modbus.ReadCoils, MBaddr: 4}}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	require.NoError(t, srv.Start(ctx))
+
+	c := opcua.NewClient(srv.Endpoint(), opcua.SecurityMode(ua.MessageSecurityModeNone), opcua.AutoReconnect(false))
+	require.NoError(t, c.Connect(ctx))
+	t.Cleanup(func() { c.Close() })
+	return srv, mb, c
+}
+
+func TestRead(t *testing.T) {
+	_, _, c := server(t, false)
+	res, err := c.Read(&ua.ReadRequest{NodesToRead: []*ua.ReadValueID{
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.temperature"), AttributeID: ua.AttributeIDValue},
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.setpoint"), AttributeID: ua.AttributeIDValue},
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.run"), AttributeID: ua.AttributeIDValue},
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.temperature"), AttributeID: ua.AttributeIDDataType},
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.temperature.EngineeringUnits"), AttributeID: ua.AttributeIDValue},
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.unknown"), AttributeID: ua.AttributeIDValue},
+	}})
+	require.NoError(t, err)
+	require.Len(t, res.Results, 6)
+	require.Equal(t, float32(21.5), res.Results[0].Value.Value())
+	require.Equal(t, int16(-2), res.Results[1].Value.Value())
+	require.Equal(t, ua.StatusBadWaitingForInitialData, res.Results[2].Status)
+	require.Equal(t, uint32(id.Float), res.Results[3].Value.Value().(*ua.NodeID).IntID())
+	eu, ok := res.Results[4].Value.Value().(*ua.ExtensionObject).Value.(*ua.EUInformation)
+	require.True(t, ok)
+	require.Equal(t, "°C", eu.DisplayName.Text)
+	require.Equal(t, ua.StatusBadNodeIDUnknown, res.Results[5].Status)
+}
+
+func TestBrowse(t *testing.T) {
+	_, _, c := server(t, false)
+	units, err := c.Node(ua.NewNumericNodeID(0, id.ObjectsFolder)).Children(id.Organizes, ua.NodeClassObject)
+	require.NoError(t, err)
+	var names []string
+	for _, u := range units {
+		names = append(names, u.ID.String())
+	}
+	require.Contains(t, names, "ns=1;s=Unit5")
+
+	vars, err := c.Node(ua.MustParseNodeID("ns=1;s=Unit5")).Children(id.HasComponent, ua.NodeClassVariable)
+	require.NoError(t, err)
+	names = nil
+	for _, v := range vars {
+		names = append(names, v.ID.String())
+	}
+	require.ElementsMatch(t, []string{"ns=1;s=Unit5.temperature", "ns=1;s=Unit5.setpoint", "ns=1;s=Unit5.run"}, names)
+}
+
+func TestWrite(t *testing.T) {
+	srv, mb, c := server(t, true)
+	res, err := c.Write(&ua.WriteRequest{NodesToWrite: []*ua.WriteValue{
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.setpoint"), AttributeID: ua.AttributeIDValue,
+			Value: &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(int16(300))}},
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.setpoint"), AttributeID: ua.AttributeIDValue,
+			Value: &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(float32(1))}},
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.temperature"), AttributeID: ua.AttributeIDValue,
+			Value: &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(float32(1))}},
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.run"), AttributeID: ua.AttributeIDValue,
+			Value: &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(true)}},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []ua.StatusCode{ua.StatusOK, ua.StatusBadTypeMismatch, ua.StatusBadNotWritable, ua.StatusBadNotWritable}, res.Results)
+
+	regs, ex := mb.Read(5, modbus.ReadHoldingRegisters, 10, 1)
+	require.Equal(t, modbus.Success, ex)
+	require.Equal(t, []uint16{300}, regs)
+	st := srv.Stats()
+	require.Equal(t, uint64(1), st.Writes)
+	require.Equal(t, uint64(1), st.WriteErrors)
+	require.Equal(t, 1, st.Sessions)
+}
+
+func TestWritesDisabled(t *testing.T) {
+	srv, mb, c := server(t, false)
+	res, err := c.Write(&ua.WriteRequest{NodesToWrite: []*ua.WriteValue{
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.setpoint"), AttributeID: ua.AttributeIDValue,
+			Value: &ua.DataValue{EncodingMask: ua.DataValueValue, Value: ua.MustVariant(int16(300))}},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []ua.StatusCode{ua.StatusBadUserAccessDenied}, res.Results)
+
+	regs, ex := mb.Read(5, modbus.ReadHoldingRegisters, 10, 1)
+	require.Equal(t, modbus.Success, ex)
+	require.Equal(t, []uint16{0xFFFE}, regs)
+	require.Equal(t, uint64(0), srv.Stats().Writes)
+
+	rd, err := c.Read(&ua.ReadRequest{NodesToRead: []*ua.ReadValueID{
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.setpoint"), AttributeID: ua.AttributeIDAccessLevel},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, byte(ua.AccessLevelTypeCurrentRead), rd.Results[0].Value.Value())
+}
+
+func TestSubscription(t *testing.T) {
+	srv, mb, c := server(t, false)
+	ch := make(chan *opcua.PublishNotificationData, 10)
+	sub, err := c.Subscribe(&opcua.SubscriptionParameters{Interval: 100 * time.Millisecond}, ch)
+	require.NoError(t, err)
+	res, err := sub.Monitor(ua.TimestampsToReturnBoth,
+		opcua.NewMonitoredItemCreateRequestWithDefaults(ua.MustParseNodeID("ns=1;s=Unit5.setpoint"), ua.AttributeIDValue, 42),
+		opcua.NewMonitoredItemCreateRequestWithDefaults(ua.MustParseNodeID("ns=1;s=Unit5.unknown"), ua.AttributeIDValue, 43))
+	require.NoError(t, err)
+	require.Equal(t, ua.StatusOK, res.Results[0].StatusCode)
+	require.Equal(t, ua.StatusBadNodeIDUnknown, res.Results[1].StatusCode)
+
+	next := func() *ua.MonitoredItemNotification {
+		select {
+		case n := <-ch:
+			require.NoError(t, n.Error)
+			dc, ok := n.Value.(*ua.DataChangeNotification)
+			require.True(t, ok)
+			require.Len(t, dc.MonitoredItems, 1)
+			return dc.MonitoredItems[0]
+		case <-time.After(5 * time.Second):
+			t.Fatal("no data change")
+			return nil
+		}
+	}
+	item := next()
+	require.Equal(t, uint32(42), item.ClientHandle)
+	require.Equal(t, int16(-2), item.Value.Value.Value())
+
+	mb.WriteHoldingRegisters(5, 10, 7)
+	require.Equal(t, int16(7), next().Value.Value.Value())
+	require.Equal(t, 1, srv.Stats().Subscriptions)
+	require.NotZero(t, srv.Stats().Publishes)
+}
+
+func TestChunkLimits(t *testing.T) {
+	cn := &conn{chunks: map[uint32][]byte{}}
+	require.NoError(t, cn.buffer(1, make([]byte, maxMessageSize/2)))
+	require.NoError(t, cn.buffer(1, make([]byte, 10)))
+	// limit is total of all requests of connection
+	require.Error(t, cn.buffer(2, make([]byte, maxMessageSize/2)))
+	require.Len(t, cn.unbuffer(1), maxMessageSize/2+10)
+	require.Zero(t, cn.buffered)
+
+	for id := uint32(0); id < maxChunkCount; id++ {
+		require.NoError(t, cn.buffer(id, nil))
+	}
+	require.Error(t, cn.buffer(maxChunkCount, nil), "too many requests")
+	require.NoError(t, cn.buffer(0, []byte{1}), "next chunk of buffered request")
+}
+
+func TestSessionTimeout(t *testing.T) {
+	srv, _, c := server(t, false)
+	require.Equal(t, 1, srv.Stats().Sessions)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	sock, err := net.DialTCP("tcp", nil, l.Addr().(*net.TCPAddr))
+	require.NoError(t, err)
+	uc, err := uacp.NewConn(sock, uacp.DefaultServerACK)
+	require.NoError(t, err)
+	defer uc.Close()
+
+	cn := &conn{srv: srv, c: uc, ctx: context.Background(), sessions: map[string]*session{}}
+	res, ok := cn.createSession(&ua.CreateSessionRequest{RequestedSessionTimeout: 1}).(*ua.CreateSessionResponse)
+	require.True(t, ok)
+	require.Equal(t, float64(minSessionTimeout/time.Millisecond), res.RevisedSessionTimeout)
+	require.Equal(t, 2, srv.Stats().Sessions)
+
+	cn.expireSessions(time.Now().Add(minSessionTimeout / 2))
+	require.NotNil(t, cn.session(res.AuthenticationToken))
+	// request of session is postponing timeout
+	cn.sessions[res.AuthenticationToken.String()].used = time.Now().Add(-2 * minSessionTimeout)
+	require.NotNil(t, cn.session(res.AuthenticationToken))
+	cn.expireSessions(time.Now().Add(minSessionTimeout / 2))
+	require.NotNil(t, cn.session(res.AuthenticationToken))
+	cn.expireSessions(time.Now().Add(minSessionTimeout * 2))
+	require.Nil(t, cn.session(res.AuthenticationToken))
+	require.Equal(t, 1, srv.Stats().Sessions)
+
+	_, err = c.Read(&ua.ReadRequest{NodesToRead: []*ua.ReadValueID{
+		{NodeID: ua.MustParseNodeID("ns=1;s=Unit5.setpoint"), AttributeID: ua.AttributeIDValue},
+	}})
+	require.NoError(t, err, "session of client is used")
+}
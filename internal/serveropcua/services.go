@@ -0,0 +1,374 @@
+package serveropcua
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+// limits of sessions
+const (
+	maxSessions        = 10 // per connection
+	minSessionTimeout  = 10 * time.Second
+	maxSessionTimeout  = time.Hour
+	anonymousPolicyID  = "anonymous"
+	transportProfile   = "http://opcfoundation.org/UA-Profile/Transport/uatcp-uasc-uabinary"
+	maxContinuations   = 10 // continuation points of Browse per session
+	maxBrowsePathDepth = 32
+)
+
+// lastSessionID is last numeric id of session
+var lastSessionID uint32
+
+// session is session of client in secure channel
+type session struct {
+	id        *ua.NodeID
+	activated bool
+	timeout   time.Duration           // revised session timeout
+	used      time.Time               // last request of session, cn.smu is locked
+	cps       map[string]continuation // continuation points of Browse
+	subs      *subscriptions
+}
+
+// continuation is rest of references of browsed node
+type continuation struct {
+	refs []*ua.ReferenceDescription
+	max  int
+}
+
+// close is deleting subscriptions of session
+func (s *session) close() {
+	s.subs.deleteAll()
+}
+
+// session is returns session of authentication token, last request of session is now
+func (cn *conn) session(token *ua.NodeID) *session {
+	if token == nil {
+		return nil
+	}
+	cn.smu.Lock()
+	defer cn.smu.Unlock()
+	s := cn.sessions[token.String()]
+	if s != nil {
+		s.used = time.Now()
+	}
+	return s
+}
+
+// closeSession is closing session of authentication token, cn.smu is locked
+func (cn *conn) closeSession(token string) {
+	s, ok := cn.sessions[token]
+	if !ok {
+		return
+	}
+	s.close()
+	delete(cn.sessions, token)
+	cn.srv.count(-1, 0)
+}
+
+// handle is handling request of client, nil - response is sent later
+func (cn *conn) handle(reqID uint32, req ua.Request) interface{} {
+	hdr := req.Header()
+	switch r := req.(type) {
+	case *ua.GetEndpointsRequest:
+		return &ua.GetEndpointsResponse{ResponseHeader: responseHeader(hdr, ua.StatusOK), Endpoints: cn.endpoints(r.EndpointURL)}
+	case *ua.FindServersRequest:
+		return &ua.FindServersResponse{ResponseHeader: responseHeader(hdr, ua.StatusOK), Servers: []*ua.ApplicationDescription{cn.application()}}
+	case *ua.CreateSessionRequest:
+		return cn.createSession(r)
+	case *ua.ActivateSessionRequest:
+		return cn.activateSession(r)
+	}
+
+	var s *session
+	if hdr != nil {
+		s = cn.session(hdr.AuthenticationToken)
+	}
+	switch {
+	case s == nil:
+		return fault(hdr, ua.StatusBadSessionIDInvalid)
+	case !s.activated:
+		return fault(hdr, ua.StatusBadSessionNotActivated)
+	}
+
+	switch r := req.(type) {
+	case *ua.CloseSessionRequest:
+		cn.smu.Lock()
+		cn.closeSession(hdr.AuthenticationToken.String())
+		cn.smu.Unlock()
+		return &ua.CloseSessionResponse{ResponseHeader: responseHeader(hdr, ua.StatusOK)}
+	case *ua.ReadRequest:
+		return cn.read(r)
+	case *ua.WriteRequest:
+		return cn.write(r)
+	case *ua.BrowseRequest:
+		return cn.browse(s, r)
+	case *ua.BrowseNextRequest:
+		return cn.browseNext(s, r)
+	case *ua.TranslateBrowsePathsToNodeIDsRequest:
+		return cn.translate(r)
+	case *ua.CreateSubscriptionRequest:
+		return s.subs.create(r)
+	case *ua.ModifySubscriptionRequest:
+		return s.subs.modify(r)
+	case *ua.SetPublishingModeRequest:
+		return s.subs.setPublishingMode(r)
+	case *ua.DeleteSubscriptionsRequest:
+		return s.subs.delete(r)
+	case *ua.CreateMonitoredItemsRequest:
+		return s.subs.createItems(r)
+	case *ua.DeleteMonitoredItemsRequest:
+		return s.subs.deleteItems(r)
+	case *ua.SetMonitoringModeRequest:
+		return s.subs.setMonitoringMode(r)
+	case *ua.PublishRequest:
+		return s.subs.publish(reqID, r)
+	case *ua.RepublishRequest:
+		return fault(hdr, ua.StatusBadMessageNotAvailable)
+	default:
+		return fault(hdr, ua.StatusBadServiceUnsupported)
+	}
+}
+
+// fault is ServiceFault response
+func fault(hdr *ua.RequestHeader, status ua.StatusCode) *ua.ServiceFault {
+	return &ua.ServiceFault{ResponseHeader: responseHeader(hdr, status)}
+}
+
+// application is description of server
+func (cn *conn) application() *ua.ApplicationDescription {
+	return &ua.ApplicationDescription{
+		ApplicationURI:  cn.srv.conf.ApplicationURI,
+		ProductURI:      cn.srv.conf.ApplicationURI,
+		ApplicationName: ua.NewLocalizedText(cn.srv.conf.ApplicationName),
+		ApplicationType: ua.ApplicationTypeServer,
+		DiscoveryURLs:   []string{cn.srv.endpoint},
+	}
+}
+
+// endpoints is single endpoint: SecurityPolicy None, anonymous user;
+// url is endpoint requested by client (as client knows host of server) or configured endpoint
+func (cn *conn) endpoints(url string) []*ua.EndpointDescription {
+	if url == "" {
+		url = cn.srv.endpoint
+	}
+	return []*ua.EndpointDescription{{
+		EndpointURL:       url,
+		Server:            cn.application(),
+		SecurityMode:      ua.MessageSecurityModeNone,
+		SecurityPolicyURI: ua.SecurityPolicyURINone,
+		UserIdentityTokens: []*ua.UserTokenPolicy{{
+			PolicyID:  anonymousPolicyID,
+			TokenType: ua.UserTokenTypeAnonymous,
+		}},
+		TransportProfileURI: transportProfile,
+	}}
+}
+
+func (cn *conn) createSession(r *ua.CreateSessionRequest) interface{} {
+	cn.smu.Lock()
+	defer cn.smu.Unlock()
+	if len(cn.sessions) >= maxSessions {
+		return fault(r.RequestHeader, ua.StatusBadTooManySessions)
+	}
+	token := make([]byte, 16)
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return fault(r.RequestHeader, ua.StatusBadInternalError)
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return fault(r.RequestHeader, ua.StatusBadInternalError)
+	}
+	timeout := time.Duration(r.RequestedSessionTimeout) * time.Millisecond
+	if timeout < minSessionTimeout {
+		timeout = minSessionTimeout
+	}
+	if timeout > maxSessionTimeout {
+		timeout = maxSessionTimeout
+	}
+
+	s := &session{
+		id:      ua.NewNumericNodeID(Namespace, atomic.AddUint32(&lastSessionID, 1)),
+		cps:     map[string]continuation{},
+		timeout: timeout,
+		used:    time.Now(),
+	}
+	s.subs = newSubscriptions(cn)
+	auth := ua.NewByteStringNodeID(0, token)
+	cn.sessions[auth.String()] = s
+	cn.srv.count(1, 0)
+	cn.srv.logg.Debug("opcua server session ", s.id, " ", r.SessionName, " / ", cn.c.RemoteAddr())
+
+	return &ua.CreateSessionResponse{
+		ResponseHeader:        responseHeader(r.RequestHeader, ua.StatusOK),
+		SessionID:             s.id,
+		AuthenticationToken:   auth,
+		RevisedSessionTimeout: float64(timeout / time.Millisecond),
+		ServerNonce:           nonce,
+		ServerEndpoints:       cn.endpoints(r.EndpointURL),
+		ServerSignature:       &ua.SignatureData{},
+		MaxRequestMessageSize: maxMessageSize,
+	}
+}
+
+func (cn *conn) activateSession(r *ua.ActivateSessionRequest) interface{} {
+	var s *session
+	if r.RequestHeader != nil {
+		s = cn.session(r.RequestHeader.AuthenticationToken)
+	}
+	if s == nil {
+		return fault(r.RequestHeader, ua.StatusBadSessionIDInvalid)
+	}
+	if r.UserIdentityToken != nil && r.UserIdentityToken.Value != nil {
+		if _, ok := r.UserIdentityToken.Value.(*ua.AnonymousIdentityToken); !ok {
+			return fault(r.RequestHeader, ua.StatusBadIdentityTokenRejected)
+		}
+	}
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return fault(r.RequestHeader, ua.StatusBadInternalError)
+	}
+	s.activated = true
+	return &ua.ActivateSessionResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), ServerNonce: nonce}
+}
+
+func (cn *conn) read(r *ua.ReadRequest) interface{} {
+	if len(r.NodesToRead) == 0 {
+		return fault(r.RequestHeader, ua.StatusBadNothingToDo)
+	}
+	if r.TimestampsToReturn >= ua.TimestampsToReturnInvalid {
+		return fault(r.RequestHeader, ua.StatusBadTimestampsToReturnInvalid)
+	}
+	results := make([]*ua.DataValue, len(r.NodesToRead))
+	for i, rv := range r.NodesToRead {
+		results[i] = cn.srv.space.read(rv)
+		if r.TimestampsToReturn == ua.TimestampsToReturnSource || r.TimestampsToReturn == ua.TimestampsToReturnNeither {
+			results[i].EncodingMask &^= ua.DataValueServerTimestamp
+		}
+	}
+	return &ua.ReadResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), Results: results}
+}
+
+func (cn *conn) write(r *ua.WriteRequest) interface{} {
+	if len(r.NodesToWrite) == 0 {
+		return fault(r.RequestHeader, ua.StatusBadNothingToDo)
+	}
+	results := make([]ua.StatusCode, len(r.NodesToWrite))
+	for i, wv := range r.NodesToWrite {
+		if !cn.srv.conf.Writes {
+			results[i] = ua.StatusBadUserAccessDenied
+			continue
+		}
+		results[i] = cn.srv.space.write(wv)
+	}
+	return &ua.WriteResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), Results: results}
+}
+
+func (cn *conn) browse(s *session, r *ua.BrowseRequest) interface{} {
+	if len(r.NodesToBrowse) == 0 {
+		return fault(r.RequestHeader, ua.StatusBadNothingToDo)
+	}
+	if r.View != nil && r.View.ViewID != nil && (r.View.ViewID.Namespace() != 0 || r.View.ViewID.IntID() != 0) {
+		return fault(r.RequestHeader, ua.StatusBadViewIDUnknown)
+	}
+	results := make([]*ua.BrowseResult, len(r.NodesToBrowse))
+	for i, bd := range r.NodesToBrowse {
+		status, refs := cn.srv.space.browse(bd)
+		results[i] = s.page(status, refs, int(r.RequestedMaxReferencesPerNode))
+	}
+	return &ua.BrowseResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), Results: results}
+}
+
+func (cn *conn) browseNext(s *session, r *ua.BrowseNextRequest) interface{} {
+	if len(r.ContinuationPoints) == 0 {
+		return fault(r.RequestHeader, ua.StatusBadNothingToDo)
+	}
+	results := make([]*ua.BrowseResult, len(r.ContinuationPoints))
+	for i, cp := range r.ContinuationPoints {
+		c, ok := s.cps[string(cp)]
+		delete(s.cps, string(cp))
+		switch {
+		case !ok:
+			results[i] = &ua.BrowseResult{StatusCode: ua.StatusBadContinuationPointInvalid}
+		case r.ReleaseContinuationPoints:
+			results[i] = &ua.BrowseResult{StatusCode: ua.StatusOK}
+		default:
+			results[i] = s.page(ua.StatusOK, c.refs, c.max)
+		}
+	}
+	return &ua.BrowseNextResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), Results: results}
+}
+
+// page is result of browse with max references (0 - all), rest is stored as continuation point
+func (s *session) page(status ua.StatusCode, refs []*ua.ReferenceDescription, max int) *ua.BrowseResult {
+	res := &ua.BrowseResult{StatusCode: status, References: refs}
+	if max <= 0 || len(refs) <= max {
+		return res
+	}
+	if len(s.cps) >= maxContinuations {
+		return &ua.BrowseResult{StatusCode: ua.StatusBadNoContinuationPoints}
+	}
+	cp := make([]byte, 8)
+	if _, err := rand.Read(cp); err != nil {
+		return &ua.BrowseResult{StatusCode: ua.StatusBadInternalError}
+	}
+	cp = []byte(hex.EncodeToString(cp))
+	s.cps[string(cp)] = continuation{refs: refs[max:], max: max}
+	res.References, res.ContinuationPoint = refs[:max], cp
+	return res
+}
+
+// translate is TranslateBrowsePathsToNodeIDs by browse names of hierarchical forward references
+func (cn *conn) translate(r *ua.TranslateBrowsePathsToNodeIDsRequest) interface{} {
+	if len(r.BrowsePaths) == 0 {
+		return fault(r.RequestHeader, ua.StatusBadNothingToDo)
+	}
+	results := make([]*ua.BrowsePathResult, len(r.BrowsePaths))
+	for i, bp := range r.BrowsePaths {
+		results[i] = cn.srv.space.translate(bp)
+	}
+	return &ua.TranslateBrowsePathsToNodeIDsResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), Results: results}
+}
+
+// translate is following browse path from starting node
+func (s *addressSpace) translate(bp *ua.BrowsePath) *ua.BrowsePathResult {
+	if bp == nil || bp.StartingNode == nil {
+		return &ua.BrowsePathResult{StatusCode: ua.StatusBadNodeIDUnknown}
+	}
+	n, ok := s.nodes[bp.StartingNode.String()]
+	if !ok {
+		return &ua.BrowsePathResult{StatusCode: ua.StatusBadNodeIDUnknown}
+	}
+	if bp.RelativePath == nil || len(bp.RelativePath.Elements) == 0 || len(bp.RelativePath.Elements) > maxBrowsePathDepth {
+		return &ua.BrowsePathResult{StatusCode: ua.StatusBadNothingToDo}
+	}
+	for _, el := range bp.RelativePath.Elements {
+		if el == nil || el.TargetName == nil || el.TargetName.Name == "" {
+			return &ua.BrowsePathResult{StatusCode: ua.StatusBadBrowseNameInvalid}
+		}
+		var next *node
+		if el.IsInverse {
+			if n.parent != nil && n.parent.browseName.Name == el.TargetName.Name {
+				next = n.parent
+			}
+		} else {
+			for _, ref := range n.refs {
+				if ref.target.browseName.Name == el.TargetName.Name && ref.target.browseName.NamespaceIndex == el.TargetName.NamespaceIndex {
+					next = ref.target
+					break
+				}
+			}
+		}
+		if next == nil {
+			return &ua.BrowsePathResult{StatusCode: ua.StatusBadNoMatch}
+		}
+		n = next
+	}
+	return &ua.BrowsePathResult{
+		StatusCode: ua.StatusOK,
+		Targets:    []*ua.BrowsePathTarget{{TargetID: ua.NewExpandedNodeID(n.id, "", 0), RemainingPathIndex: 0xFFFFFFFF}},
+	}
+}
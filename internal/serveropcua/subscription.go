@@ -0,0 +1,444 @@
+package serveropcua
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gopcua/opcua/ua"
+)
+
+// limits of subscriptions
+const (
+	maxSubscriptions       = 10   // per session
+	maxMonitoredItems      = 1000 // per subscription
+	maxPublishRequests     = 10   // queued per session
+	maxNotifications       = 1000 // queued per subscription, oldest are dropped
+	minPublishingInterval  = 100 * time.Millisecond
+	maxPublishingInterval  = time.Hour
+	defaultPublishInterval = time.Second
+	defaultKeepAliveCount  = 10
+)
+
+// lastSubscriptionID is last id of subscription
+var lastSubscriptionID uint32
+
+// pending is Publish request waiting for notifications
+type pending struct {
+	reqID uint32
+	req   *ua.PublishRequest
+}
+
+// subscriptions is subscriptions of session with queue of Publish requests
+type subscriptions struct {
+	cn      *conn
+	mu      sync.Mutex
+	subs    map[uint32]*subscription
+	pending chan pending
+}
+
+// subscription is sampling monitored items each publishing interval and sending data changes
+// (or keep-alive) in response to queued Publish
+type subscription struct {
+	id     uint32
+	owner  *subscriptions
+	ticker *time.Ticker
+	stop   context.CancelFunc
+
+	mu        sync.Mutex
+	interval  time.Duration
+	keepAlive uint32
+	lifetime  uint32
+	enabled   bool
+	items     map[uint32]*monitoredItem
+	lastItem  uint32
+	queue     []*ua.MonitoredItemNotification
+	seq       uint32 // sequence number of last notification message
+	idle      uint32 // publishing intervals without notification message
+}
+
+// monitoredItem is attribute of node monitored for changes
+type monitoredItem struct {
+	id     uint32
+	handle uint32
+	rv     *ua.ReadValueID
+	mode   ua.MonitoringMode
+	ts     ua.TimestampsToReturn
+	last   *ua.DataValue
+}
+
+func newSubscriptions(cn *conn) *subscriptions {
+	return &subscriptions{cn: cn, subs: map[uint32]*subscription{}, pending: make(chan pending, maxPublishRequests)}
+}
+
+// get is returns subscription by id
+func (ss *subscriptions) get(id uint32) *subscription {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.subs[id]
+}
+
+// revise is revising parameters of subscription requested by client
+func revise(interval float64, lifetime, keepAlive uint32) (time.Duration, uint32, uint32) {
+	d := time.Duration(interval * float64(time.Millisecond))
+	switch {
+	case d <= 0:
+		d = defaultPublishInterval
+	case d < minPublishingInterval:
+		d = minPublishingInterval
+	case d > maxPublishingInterval:
+		d = maxPublishingInterval
+	}
+	if keepAlive == 0 {
+		keepAlive = defaultKeepAliveCount
+	}
+	if lifetime < 3*keepAlive {
+		lifetime = 3 * keepAlive
+	}
+	return d, lifetime, keepAlive
+}
+
+func (ss *subscriptions) create(r *ua.CreateSubscriptionRequest) interface{} {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if len(ss.subs) >= maxSubscriptions {
+		return fault(r.RequestHeader, ua.StatusBadTooManySubscriptions)
+	}
+	sub := &subscription{
+		id:      atomic.AddUint32(&lastSubscriptionID, 1),
+		owner:   ss,
+		enabled: r.PublishingEnabled,
+		items:   map[uint32]*monitoredItem{},
+	}
+	sub.interval, sub.lifetime, sub.keepAlive = revise(r.RequestedPublishingInterval, r.RequestedLifetimeCount, r.RequestedMaxKeepAliveCount)
+	sub.ticker = time.NewTicker(sub.interval)
+	var ctx context.Context
+	ctx, sub.stop = context.WithCancel(ss.cn.ctx)
+	ss.subs[sub.id] = sub
+	ss.cn.srv.count(0, 1)
+	go sub.run(ctx)
+
+	return &ua.CreateSubscriptionResponse{
+		ResponseHeader:            responseHeader(r.RequestHeader, ua.StatusOK),
+		SubscriptionID:            sub.id,
+		RevisedPublishingInterval: float64(sub.interval / time.Millisecond),
+		RevisedLifetimeCount:      sub.lifetime,
+		RevisedMaxKeepAliveCount:  sub.keepAlive,
+	}
+}
+
+func (ss *subscriptions) modify(r *ua.ModifySubscriptionRequest) interface{} {
+	sub := ss.get(r.SubscriptionID)
+	if sub == nil {
+		return fault(r.RequestHeader, ua.StatusBadSubscriptionIDInvalid)
+	}
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.interval, sub.lifetime, sub.keepAlive = revise(r.RequestedPublishingInterval, r.RequestedLifetimeCount, r.RequestedMaxKeepAliveCount)
+	sub.ticker.Reset(sub.interval)
+	return &ua.ModifySubscriptionResponse{
+		ResponseHeader:            responseHeader(r.RequestHeader, ua.StatusOK),
+		RevisedPublishingInterval: float64(sub.interval / time.Millisecond),
+		RevisedLifetimeCount:      sub.lifetime,
+		RevisedMaxKeepAliveCount:  sub.keepAlive,
+	}
+}
+
+func (ss *subscriptions) setPublishingMode(r *ua.SetPublishingModeRequest) interface{} {
+	if len(r.SubscriptionIDs) == 0 {
+		return fault(r.RequestHeader, ua.StatusBadNothingToDo)
+	}
+	results := make([]ua.StatusCode, len(r.SubscriptionIDs))
+	for i, id := range r.SubscriptionIDs {
+		sub := ss.get(id)
+		if sub == nil {
+			results[i] = ua.StatusBadSubscriptionIDInvalid
+			continue
+		}
+		sub.mu.Lock()
+		sub.enabled = r.PublishingEnabled
+		sub.mu.Unlock()
+	}
+	return &ua.SetPublishingModeResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), Results: results}
+}
+
+func (ss *subscriptions) delete(r *ua.DeleteSubscriptionsRequest) interface{} {
+	if len(r.SubscriptionIDs) == 0 {
+		return fault(r.RequestHeader, ua.StatusBadNothingToDo)
+	}
+	results := make([]ua.StatusCode, len(r.SubscriptionIDs))
+	ss.mu.Lock()
+	for i, id := range r.SubscriptionIDs {
+		sub, ok := ss.subs[id]
+		if !ok {
+			results[i] = ua.StatusBadSubscriptionIDInvalid
+			continue
+		}
+		sub.stop()
+		delete(ss.subs, id)
+		ss.cn.srv.count(0, -1)
+	}
+	empty := len(ss.subs) == 0
+	ss.mu.Unlock()
+	if empty {
+		ss.reject()
+	}
+	return &ua.DeleteSubscriptionsResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), Results: results}
+}
+
+// deleteAll is deleting subscriptions of closed session
+func (ss *subscriptions) deleteAll() {
+	ss.mu.Lock()
+	for id, sub := range ss.subs {
+		sub.stop()
+		delete(ss.subs, id)
+		ss.cn.srv.count(0, -1)
+	}
+	ss.mu.Unlock()
+	ss.reject()
+}
+
+// reject is answering queued Publish requests with BadNoSubscription
+func (ss *subscriptions) reject() {
+	for {
+		select {
+		case p := <-ss.pending:
+			if ss.cn.ctx.Err() == nil {
+				ss.cn.send(p.reqID, fault(p.req.RequestHeader, ua.StatusBadNoSubscription))
+			}
+		default:
+			return
+		}
+	}
+}
+
+// publish is queueing Publish request, response is sent by subscription
+func (ss *subscriptions) publish(reqID uint32, r *ua.PublishRequest) interface{} {
+	ss.mu.Lock()
+	empty := len(ss.subs) == 0
+	ss.mu.Unlock()
+	if empty {
+		return fault(r.RequestHeader, ua.StatusBadNoSubscription)
+	}
+	select {
+	case ss.pending <- pending{reqID: reqID, req: r}:
+		return nil
+	default:
+		return fault(r.RequestHeader, ua.StatusBadTooManyPublishRequests)
+	}
+}
+
+func (ss *subscriptions) createItems(r *ua.CreateMonitoredItemsRequest) interface{} {
+	sub := ss.get(r.SubscriptionID)
+	if sub == nil {
+		return fault(r.RequestHeader, ua.StatusBadSubscriptionIDInvalid)
+	}
+	if len(r.ItemsToCreate) == 0 {
+		return fault(r.RequestHeader, ua.StatusBadNothingToDo)
+	}
+	if r.TimestampsToReturn >= ua.TimestampsToReturnInvalid {
+		return fault(r.RequestHeader, ua.StatusBadTimestampsToReturnInvalid)
+	}
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	results := make([]*ua.MonitoredItemCreateResult, len(r.ItemsToCreate))
+	for i, ic := range r.ItemsToCreate {
+		res := &ua.MonitoredItemCreateResult{
+			RevisedSamplingInterval: float64(sub.interval / time.Millisecond),
+			RevisedQueueSize:        1,
+			FilterResult:            ua.NewExtensionObject(nil),
+		}
+		results[i] = res
+		if res.StatusCode = sub.validate(ic); res.StatusCode != ua.StatusOK {
+			continue
+		}
+		if len(sub.items) >= maxMonitoredItems {
+			res.StatusCode = ua.StatusBadTooManyMonitoredItems
+			continue
+		}
+		sub.lastItem++
+		item := &monitoredItem{id: sub.lastItem, rv: ic.ItemToMonitor, mode: ic.MonitoringMode, ts: r.TimestampsToReturn}
+		if ic.RequestedParameters != nil {
+			item.handle = ic.RequestedParameters.ClientHandle
+		}
+		sub.items[item.id] = item
+		res.MonitoredItemID = item.id
+	}
+	return &ua.CreateMonitoredItemsResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), Results: results}
+}
+
+// validate is checking item to create: node & attribute exist, monitoring mode, filter (only DataChangeFilter)
+func (sub *subscription) validate(ic *ua.MonitoredItemCreateRequest) ua.StatusCode {
+	if ic == nil || ic.ItemToMonitor == nil {
+		return ua.StatusBadNodeIDUnknown
+	}
+	if ic.MonitoringMode > ua.MonitoringModeReporting {
+		return ua.StatusBadMonitoringModeInvalid
+	}
+	if ic.RequestedParameters != nil && ic.RequestedParameters.Filter != nil && ic.RequestedParameters.Filter.Value != nil {
+		if _, ok := ic.RequestedParameters.Filter.Value.(*ua.DataChangeFilter); !ok {
+			return ua.StatusBadMonitoredItemFilterUnsupported
+		}
+	}
+	n, ok := sub.owner.cn.srv.space.nodes[ic.ItemToMonitor.NodeID.String()]
+	if !ok {
+		return ua.StatusBadNodeIDUnknown
+	}
+	if ic.ItemToMonitor.AttributeID == ua.AttributeIDValue && n.class != ua.NodeClassVariable {
+		return ua.StatusBadAttributeIDInvalid
+	}
+	if ic.ItemToMonitor.AttributeID != ua.AttributeIDValue {
+		if dv := sub.owner.cn.srv.space.read(ic.ItemToMonitor); dv.Status == ua.StatusBadAttributeIDInvalid {
+			return ua.StatusBadAttributeIDInvalid
+		}
+	}
+	return ua.StatusOK
+}
+
+func (ss *subscriptions) deleteItems(r *ua.DeleteMonitoredItemsRequest) interface{} {
+	sub := ss.get(r.SubscriptionID)
+	if sub == nil {
+		return fault(r.RequestHeader, ua.StatusBadSubscriptionIDInvalid)
+	}
+	if len(r.MonitoredItemIDs) == 0 {
+		return fault(r.RequestHeader, ua.StatusBadNothingToDo)
+	}
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	results := make([]ua.StatusCode, len(r.MonitoredItemIDs))
+	for i, id := range r.MonitoredItemIDs {
+		if _, ok := sub.items[id]; !ok {
+			results[i] = ua.StatusBadMonitoredItemIDInvalid
+			continue
+		}
+		delete(sub.items, id)
+	}
+	return &ua.DeleteMonitoredItemsResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), Results: results}
+}
+
+// run is sampling items & publishing until subscription is deleted
+func (sub *subscription) run(ctx context.Context) {
+	defer sub.ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.ticker.C:
+		}
+		sub.sample()
+		sub.tick(ctx)
+	}
+}
+
+// sample is reading monitored items in reporting mode and queueing changed values
+func (sub *subscription) sample() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	for _, item := range sub.items {
+		if item.mode != ua.MonitoringModeReporting {
+			continue
+		}
+		dv := sub.owner.cn.srv.space.read(item.rv)
+		if !changed(item.last, dv) {
+			continue
+		}
+		item.last = dv
+		if item.ts == ua.TimestampsToReturnSource || item.ts == ua.TimestampsToReturnNeither {
+			copied := *dv
+			copied.EncodingMask &^= ua.DataValueServerTimestamp
+			dv = &copied
+		}
+		if len(sub.queue) >= maxNotifications {
+			sub.queue = sub.queue[1:]
+		}
+		sub.queue = append(sub.queue, &ua.MonitoredItemNotification{ClientHandle: item.handle, Value: dv})
+	}
+}
+
+// changed is true if value or status of sample differs from last sample
+func changed(last, dv *ua.DataValue) bool {
+	if last == nil {
+		return true
+	}
+	if last.Status != dv.Status {
+		return true
+	}
+	if last.Value == nil || dv.Value == nil {
+		return last.Value != dv.Value
+	}
+	return !reflect.DeepEqual(last.Value.Value(), dv.Value.Value())
+}
+
+// tick is sending queued notifications or keep-alive (after max keep-alive count of idle intervals)
+// if Publish request is queued
+func (sub *subscription) tick(ctx context.Context) {
+	sub.mu.Lock()
+	notify := sub.enabled && len(sub.queue) > 0
+	if !notify {
+		sub.idle++
+		if sub.idle < sub.keepAlive {
+			sub.mu.Unlock()
+			return
+		}
+	}
+	sub.mu.Unlock()
+
+	var p pending
+	select {
+	case p = <-sub.owner.pending:
+	case <-ctx.Done():
+		return
+	default:
+		return // no Publish request: notifications stay in queue
+	}
+
+	sub.mu.Lock()
+	msg := &ua.NotificationMessage{SequenceNumber: sub.seq + 1, PublishTime: time.Now()}
+	if notify {
+		sub.seq++
+		msg.NotificationData = []*ua.ExtensionObject{ua.NewExtensionObject(&ua.DataChangeNotification{MonitoredItems: sub.queue})}
+		sub.queue = nil
+	}
+	sub.idle = 0
+	sub.mu.Unlock()
+
+	res := &ua.PublishResponse{
+		ResponseHeader:      responseHeader(p.req.RequestHeader, ua.StatusOK),
+		SubscriptionID:      sub.id,
+		NotificationMessage: msg,
+		Results:             make([]ua.StatusCode, len(p.req.SubscriptionAcknowledgements)),
+	}
+	if err := sub.owner.cn.send(p.reqID, res); err != nil {
+		sub.owner.cn.srv.logg.Debug("opcua server publish error: ", err)
+		return
+	}
+	atomic.AddUint64(&sub.owner.cn.srv.publishes, 1)
+}
+
+func (ss *subscriptions) setMonitoringMode(r *ua.SetMonitoringModeRequest) interface{} {
+	sub := ss.get(r.SubscriptionID)
+	if sub == nil {
+		return fault(r.RequestHeader, ua.StatusBadSubscriptionIDInvalid)
+	}
+	if r.MonitoringMode > ua.MonitoringModeReporting {
+		return fault(r.RequestHeader, ua.StatusBadMonitoringModeInvalid)
+	}
+	if len(r.MonitoredItemIDs) == 0 {
+		return fault(r.RequestHeader, ua.StatusBadNothingToDo)
+	}
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	results := make([]ua.StatusCode, len(r.MonitoredItemIDs))
+	for i, id := range r.MonitoredItemIDs {
+		item, ok := sub.items[id]
+		if !ok {
+			results[i] = ua.StatusBadMonitoredItemIDInvalid
+			continue
+		}
+		item.mode = r.MonitoringMode
+		item.last = nil // current value is reported when reporting is enabled
+	}
+	return &ua.SetMonitoringModeResponse{ResponseHeader: responseHeader(r.RequestHeader, ua.StatusOK), Results: results}
+}
@@ -0,0 +1,322 @@
+// Package sparkplug is Sparkplug B edge node: devices of gateway are Sparkplug devices,
+// tags are metrics (birth/death certificates, data and commands)
+package sparkplug
+
+import (
+	"context"
+	"opcuaModbus/internal/secrets"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Namespace is Sparkplug B topic namespace
+	Namespace = "spBv1.0"
+	// RebirthMetric is metric of node command requesting rebirth
+	RebirthMetric = "Node Control/Rebirth"
+	// retryInterval is interval of connection retries
+	retryInterval = 5 * time.Second
+)
+
+// Config is configuration of edge node
+type Config struct {
+	Broker     string
+	ClientID   string
+	Username   string
+	Password   secrets.Secret
+	GroupID    string
+	EdgeNodeID string
+}
+
+// CommandHandler is handler of device command (DCMD) with metrics resolved to definitions of device
+type CommandHandler func(device string, metrics []Metric)
+
+// device is Sparkplug device
+type device struct {
+	id      string
+	defs    []Metric          // definitions: name, alias & data type
+	byName  map[string]Metric // definitions by name
+	values  map[uint64]Metric // last values by alias
+	online  bool
+	command CommandHandler
+}
+
+// Stats is counters of edge node
+type Stats struct {
+	Connected bool
+	BdSeq     uint64
+	Births    uint64
+	Messages  uint64
+	Commands  uint64
+}
+
+// EdgeNode is Sparkplug B edge node
+type EdgeNode struct {
+	conf   Config
+	logg   *logrus.Logger
+	client paho.Client
+
+	mu       sync.Mutex
+	devices  map[string]*device
+	order    []string
+	seq      uint64
+	bdSeq    uint64
+	births   uint64
+	messages uint64
+	commands uint64
+}
+
+// New is creating edge node
+func New(conf Config, logg *logrus.Logger) *EdgeNode {
+	return &EdgeNode{conf: conf, logg: logg, devices: map[string]*device{}}
+}
+
+// DeviceID is returns valid device id: MQTT wildcards & separators are replaced by "_"
+func DeviceID(name string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(name)
+}
+
+// Topic is returns topic of message type of node (device is empty) or device
+func (en *EdgeNode) Topic(msgType, dev string) string {
+	t := Namespace + "/" + en.conf.GroupID + "/" + msgType + "/" + en.conf.EdgeNodeID
+	if dev != "" {
+		t += "/" + dev
+	}
+	return t
+}
+
+// AddDevice is adding device with metric definitions (name, alias & data type), before Start
+func (en *EdgeNode) AddDevice(id string, defs []Metric, command CommandHandler) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	d := &device{id: id, defs: defs, byName: map[string]Metric{}, values: map[uint64]Metric{}, command: command}
+	for _, m := range defs {
+		d.byName[m.Name] = m
+	}
+	if _, ok := en.devices[id]; !ok {
+		en.order = append(en.order, id)
+	}
+	en.devices[id] = d
+}
+
+// Start is connecting to broker (with retries & auto reconnect) until ctx is done.
+// bdSeq is incremented on every connection, NDEATH with it is last will.
+func (en *EdgeNode) Start(ctx context.Context) {
+	opts := paho.NewClientOptions().
+		AddBroker(en.conf.Broker).
+		SetClientID(en.clientID()).
+		SetUsername(en.conf.Username).
+		SetPassword(en.conf.Password.Reveal()).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(retryInterval).
+		SetReconnectingHandler(func(c paho.Client, o *paho.ClientOptions) {
+			en.mu.Lock()
+			en.bdSeq = (en.bdSeq + 1) % 256
+			o.SetBinaryWill(en.Topic("NDEATH", ""), en.death(), 1, false)
+			en.mu.Unlock()
+		}).
+		SetOnConnectHandler(func(c paho.Client) {
+			en.logg.Info("sparkplug ", en.conf.EdgeNodeID, " connected: ", en.conf.Broker)
+			c.Subscribe(en.Topic("NCMD", ""), 1, en.nodeCommand)
+			c.Subscribe(en.Topic("DCMD", "+"), 1, en.deviceCommand)
+			en.mu.Lock()
+			en.birth()
+			en.mu.Unlock()
+		}).
+		SetConnectionLostHandler(func(c paho.Client, err error) {
+			en.logg.Warn("sparkplug ", en.conf.EdgeNodeID, " connection lost: ", err)
+		})
+	opts.SetBinaryWill(en.Topic("NDEATH", ""), en.death(), 1, false)
+
+	en.mu.Lock()
+	en.client = paho.NewClient(opts)
+	en.mu.Unlock()
+	en.client.Connect()
+
+	<-ctx.Done()
+	en.mu.Lock()
+	if en.client.IsConnectionOpen() {
+		for _, id := range en.order {
+			if d := en.devices[id]; d.online {
+				en.publish("DDEATH", id, Payload{})
+			}
+		}
+		en.client.Publish(en.Topic("NDEATH", ""), 1, false, en.death()).WaitTimeout(time.Second)
+	}
+	en.mu.Unlock()
+	en.client.Disconnect(250)
+}
+
+// Birth is publishing DBIRTH of device with last values (device is online)
+func (en *EdgeNode) Birth(id string) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	d, ok := en.devices[id]
+	if !ok {
+		return
+	}
+	d.online = true
+	en.deviceBirth(d)
+}
+
+// Death is publishing DDEATH of device (device is offline)
+func (en *EdgeNode) Death(id string) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	d, ok := en.devices[id]
+	if !ok || !d.online {
+		return
+	}
+	d.online = false
+	en.publish("DDEATH", id, Payload{})
+}
+
+// Data is storing values of metrics (by name) and publishing DDATA if device is online
+func (en *EdgeNode) Data(id string, metrics ...Metric) {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	d, ok := en.devices[id]
+	if !ok {
+		return
+	}
+	var data []Metric
+	for _, m := range metrics {
+		def, ok := d.byName[m.Name]
+		if !ok {
+			continue
+		}
+		m.Alias, m.DataType = def.Alias, def.DataType
+		d.values[def.Alias] = m
+		m.Name = "" // DDATA by alias
+		data = append(data, m)
+	}
+	if d.online && len(data) > 0 {
+		en.publish("DDATA", id, Payload{Metrics: data})
+	}
+}
+
+// Stats is returns counters of edge node
+func (en *EdgeNode) Stats() Stats {
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	return Stats{
+		Connected: en.client != nil && en.client.IsConnectionOpen(),
+		BdSeq:     en.bdSeq,
+		Births:    en.births,
+		Messages:  en.messages,
+		Commands:  en.commands,
+	}
+}
+
+// birth is publishing NBIRTH (seq 0) and DBIRTH of online devices, en.mu is locked
+func (en *EdgeNode) birth() {
+	en.seq = 0
+	en.births++
+	en.publish("NBIRTH", "", Payload{Metrics: []Metric{
+		{Name: "bdSeq", DataType: UInt64, Value: en.bdSeq},
+		{Name: RebirthMetric, DataType: Boolean, Value: false},
+	}})
+	for _, id := range en.order {
+		if d := en.devices[id]; d.online {
+			en.deviceBirth(d)
+		}
+	}
+}
+
+// deviceBirth is publishing DBIRTH with all metrics (name, alias, type and last value), en.mu is locked
+func (en *EdgeNode) deviceBirth(d *device) {
+	metrics := make([]Metric, 0, len(d.defs))
+	for _, def := range d.defs {
+		m := def
+		if v, ok := d.values[def.Alias]; ok {
+			m.Value, m.Timestamp, m.Quality = v.Value, v.Timestamp, v.Quality
+		}
+		metrics = append(metrics, m)
+	}
+	en.publish("DBIRTH", d.id, Payload{Metrics: metrics})
+}
+
+// publish is publishing message with next sequence number (QoS 0, not retained), en.mu is locked
+func (en *EdgeNode) publish(msgType, dev string, p Payload) {
+	if en.client == nil || !en.client.IsConnectionOpen() {
+		return
+	}
+	seq := en.seq
+	p.Seq = &seq
+	p.Timestamp = time.Now()
+	en.seq = (en.seq + 1) % 256
+	en.messages++
+	en.client.Publish(en.Topic(msgType, dev), 0, false, p.Encode())
+}
+
+// death is NDEATH payload with bdSeq of current connection
+func (en *EdgeNode) death() []byte {
+	return Payload{Metrics: []Metric{{Name: "bdSeq", DataType: UInt64, Value: en.bdSeq}}}.Encode()
+}
+
+// nodeCommand is handler of NCMD: rebirth
+func (en *EdgeNode) nodeCommand(c paho.Client, msg paho.Message) {
+	p, err := Decode(msg.Payload())
+	if err != nil {
+		en.logg.Error("sparkplug NCMD error: ", err)
+		return
+	}
+	for _, m := range p.Metrics {
+		if m.Name == RebirthMetric && m.Value == true {
+			en.logg.Info("sparkplug ", en.conf.EdgeNodeID, " rebirth requested")
+			en.mu.Lock()
+			en.commands++
+			en.birth()
+			en.mu.Unlock()
+		}
+	}
+}
+
+// deviceCommand is handler of DCMD: metrics are resolved by name or alias and passed to command handler of device
+func (en *EdgeNode) deviceCommand(c paho.Client, msg paho.Message) {
+	parts := strings.Split(msg.Topic(), "/")
+	id := parts[len(parts)-1]
+	p, err := Decode(msg.Payload())
+	if err != nil {
+		en.logg.Error("sparkplug DCMD ", id, " error: ", err)
+		return
+	}
+
+	en.mu.Lock()
+	d, ok := en.devices[id]
+	var metrics []Metric
+	if ok {
+		en.commands++
+		for _, m := range p.Metrics {
+			for _, def := range d.defs {
+				if (m.Name != "" && m.Name == def.Name) || (m.Name == "" && m.Alias == def.Alias) {
+					m.Name, m.Alias = def.Name, def.Alias
+					metrics = append(metrics, m)
+					break
+				}
+			}
+		}
+	}
+	en.mu.Unlock()
+
+	if !ok || d.command == nil {
+		en.logg.Warn("sparkplug DCMD for unknown device ", id)
+		return
+	}
+	if len(metrics) > 0 {
+		go d.command(id, metrics)
+	}
+}
+
+func (en *EdgeNode) clientID() string {
+	if en.conf.ClientID != "" {
+		return en.conf.ClientID
+	}
+	return "opcuamodbus-" + en.conf.GroupID + "-" + en.conf.EdgeNodeID
+}
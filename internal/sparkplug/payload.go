@@ -0,0 +1,392 @@
+package sparkplug
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DataType is Sparkplug B data type of metric
+type DataType uint32
+
+// Sparkplug B data types
+const (
+	Int8     DataType = 1
+	Int16    DataType = 2
+	Int32    DataType = 3
+	Int64    DataType = 4
+	UInt8    DataType = 5
+	UInt16   DataType = 6
+	UInt32   DataType = 7
+	UInt64   DataType = 8
+	Float    DataType = 9
+	Double   DataType = 10
+	Boolean  DataType = 11
+	String   DataType = 12
+	DateTime DataType = 13
+	Text     DataType = 14
+)
+
+// Quality codes of "Quality" property of metric
+const (
+	QualityBad       int32 = 0
+	QualityUncertain int32 = 64
+	QualityGood      int32 = 192
+)
+
+// TypeOf is returns data type of metric by type of tag (0 - unsupported)
+func TypeOf(typ string) DataType {
+	switch strings.ToLower(strings.TrimSpace(typ)) {
+	case "bool", "boolean":
+		return Boolean
+	case "int8", "sbyte":
+		return Int8
+	case "uint8", "byte":
+		return UInt8
+	case "int16":
+		return Int16
+	case "uint16", "word":
+		return UInt16
+	case "int32", "dint":
+		return Int32
+	case "uint32", "dword":
+		return UInt32
+	case "int64":
+		return Int64
+	case "uint64":
+		return UInt64
+	case "float32", "float", "real":
+		return Float
+	case "float64", "double", "lreal":
+		return Double
+	default:
+		return 0
+	}
+}
+
+// Metric is metric of Sparkplug B payload
+type Metric struct {
+	Name      string
+	Alias     uint64 // 0 - not set
+	Timestamp time.Time
+	DataType  DataType
+	Value     interface{} // nil - null value
+	Quality   *int32      // "Quality" property (nil - not set)
+}
+
+// Payload is Sparkplug B payload
+type Payload struct {
+	Timestamp time.Time
+	Metrics   []Metric
+	Seq       *uint64 // nil - without sequence number (NDEATH)
+}
+
+// Encode is encoding payload in protobuf
+func (p Payload) Encode() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, millis(p.Timestamp))
+	for _, m := range p.Metrics {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.encode())
+	}
+	if p.Seq != nil {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, *p.Seq)
+	}
+	return b
+}
+
+func (m Metric) encode() []byte {
+	var b []byte
+	if m.Name != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, m.Name)
+	}
+	if m.Alias != 0 {
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, m.Alias)
+	}
+	if !m.Timestamp.IsZero() {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, millis(m.Timestamp))
+	}
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(m.DataType))
+
+	if m.Quality != nil {
+		// PropertySet{keys: ["Quality"], values: [{type: Int32, int_value: quality}]}
+		var pv []byte
+		pv = protowire.AppendTag(pv, 1, protowire.VarintType)
+		pv = protowire.AppendVarint(pv, uint64(Int32))
+		pv = protowire.AppendTag(pv, 3, protowire.VarintType)
+		pv = protowire.AppendVarint(pv, uint64(uint32(*m.Quality)))
+		var ps []byte
+		ps = protowire.AppendTag(ps, 1, protowire.BytesType)
+		ps = protowire.AppendString(ps, "Quality")
+		ps = protowire.AppendTag(ps, 2, protowire.BytesType)
+		ps = protowire.AppendBytes(ps, pv)
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, ps)
+	}
+
+	v, ok := convert(m.DataType, m.Value)
+	if !ok {
+		b = protowire.AppendTag(b, 7, protowire.VarintType)
+		return protowire.AppendVarint(b, 1)
+	}
+	switch m.DataType {
+	case Int8, Int16, Int32:
+		b = protowire.AppendTag(b, 10, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(uint32(int32(v.(int64)))))
+	case UInt8, UInt16, UInt32:
+		b = protowire.AppendTag(b, 10, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(uint32(v.(uint64))))
+	case Int64:
+		b = protowire.AppendTag(b, 11, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v.(int64)))
+	case UInt64, DateTime:
+		b = protowire.AppendTag(b, 11, protowire.VarintType)
+		b = protowire.AppendVarint(b, v.(uint64))
+	case Float:
+		b = protowire.AppendTag(b, 12, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(float32(v.(float64))))
+	case Double:
+		b = protowire.AppendTag(b, 13, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v.(float64)))
+	case Boolean:
+		b = protowire.AppendTag(b, 14, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v.(bool)))
+	case String, Text:
+		b = protowire.AppendTag(b, 15, protowire.BytesType)
+		b = protowire.AppendString(b, v.(string))
+	}
+	return b
+}
+
+// convert is converting value to int64, uint64, float64, bool or string by data type
+func convert(dt DataType, v interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	var f float64
+	var isNum bool
+	switch n := v.(type) {
+	case bool:
+		switch dt {
+		case Boolean:
+			return n, true
+		case String, Text:
+			return fmt.Sprint(n), true
+		}
+		if n {
+			f = 1
+		}
+		isNum = true
+	case string:
+		if dt == String || dt == Text {
+			return n, true
+		}
+		return nil, false
+	case time.Time:
+		if dt == DateTime {
+			return uint64(millis(n)), true
+		}
+		return nil, false
+	case int8:
+		f, isNum = float64(n), true
+	case int16:
+		f, isNum = float64(n), true
+	case int32:
+		f, isNum = float64(n), true
+	case int64:
+		if dt == Int64 {
+			return n, true
+		}
+		f, isNum = float64(n), true
+	case int:
+		f, isNum = float64(n), true
+	case uint8:
+		f, isNum = float64(n), true
+	case uint16:
+		f, isNum = float64(n), true
+	case uint32:
+		f, isNum = float64(n), true
+	case uint64:
+		if dt == UInt64 || dt == DateTime {
+			return n, true
+		}
+		f, isNum = float64(n), true
+	case float32:
+		f, isNum = float64(n), true
+	case float64:
+		f, isNum = n, true
+	}
+	if !isNum {
+		return nil, false
+	}
+
+	switch dt {
+	case Int8, Int16, Int32, Int64:
+		return int64(f), true
+	case UInt8, UInt16, UInt32, UInt64, DateTime:
+		return uint64(f), true
+	case Float, Double:
+		return f, true
+	case Boolean:
+		return f != 0, true
+	case String, Text:
+		return fmt.Sprint(v), true
+	}
+	return nil, false
+}
+
+// Decode is decoding protobuf payload (metrics with name, alias, timestamp, data type and value)
+func Decode(b []byte) (Payload, error) {
+	var p Payload
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return p, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return p, protowire.ParseError(n)
+			}
+			p.Timestamp = time.UnixMilli(int64(v))
+			b = b[n:]
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return p, protowire.ParseError(n)
+			}
+			m, err := decodeMetric(v)
+			if err != nil {
+				return p, err
+			}
+			p.Metrics = append(p.Metrics, m)
+			b = b[n:]
+		case num == 3 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return p, protowire.ParseError(n)
+			}
+			p.Seq = &v
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return p, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return p, nil
+}
+
+func decodeMetric(b []byte) (Metric, error) {
+	var m Metric
+	var raw uint64
+	var rawField protowire.Number
+	var str string
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return m, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return m, protowire.ParseError(n)
+			}
+			b = b[n:]
+			switch num {
+			case 2:
+				m.Alias = v
+			case 3:
+				m.Timestamp = time.UnixMilli(int64(v))
+			case 4:
+				m.DataType = DataType(v)
+			case 10, 11, 14:
+				raw, rawField = v, num
+			}
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(b)
+			if n < 0 {
+				return m, protowire.ParseError(n)
+			}
+			b = b[n:]
+			if num == 12 {
+				raw, rawField = uint64(v), num
+			}
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return m, protowire.ParseError(n)
+			}
+			b = b[n:]
+			if num == 13 {
+				raw, rawField = v, num
+			}
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return m, protowire.ParseError(n)
+			}
+			b = b[n:]
+			switch num {
+			case 1:
+				m.Name = string(v)
+			case 15:
+				str, rawField = string(v), num
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return m, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+
+	switch rawField {
+	case 10:
+		switch m.DataType {
+		case Int8, Int16, Int32:
+			m.Value = int64(int32(uint32(raw)))
+		default:
+			m.Value = uint64(uint32(raw))
+		}
+	case 11:
+		if m.DataType == Int64 {
+			m.Value = int64(raw)
+		} else {
+			m.Value = raw
+		}
+	case 12:
+		m.Value = float64(math.Float32frombits(uint32(raw)))
+	case 13:
+		m.Value = math.Float64frombits(raw)
+	case 14:
+		m.Value = raw != 0
+	case 15:
+		m.Value = str
+	}
+	return m, nil
+}
+
+func millis(t time.Time) uint64 {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return uint64(t.UnixMilli())
+}
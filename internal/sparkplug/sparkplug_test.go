@@ -0,0 +1,196 @@
+package sparkplug
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayload(t *testing.T) {
+	seq := uint64(7)
+	q := QualityGood
+	ts := time.UnixMilli(1700000000123)
+	p := Payload{Timestamp: ts, Seq: &seq, Metrics: []Metric{
+		{Name: "temp", Alias: 1, DataType: Float, Value: float32(21.5), Quality: &q},
+		{Name: "count", Alias: 2, DataType: Int16, Value: int16(-5)},
+		{Name: "total", Alias: 3, DataType: UInt64, Value: uint64(math.MaxUint64)},
+		{Name: "run", Alias: 4, DataType: Boolean, Value: true},
+		{Name: "level", Alias: 5, DataType: Double, Value: 0.125, Timestamp: ts},
+		{Name: "name", Alias: 6, DataType: String, Value: "line 1"},
+		{Name: "missing", Alias: 7, DataType: Int32},
+	}}
+
+	d, err := Decode(p.Encode())
+	require.NoError(t, err)
+	require.Equal(t, ts, d.Timestamp)
+	require.Equal(t, uint64(7), *d.Seq)
+	require.Len(t, d.Metrics, 7)
+	require.Equal(t, 21.5, d.Metrics[0].Value)
+	require.Equal(t, uint64(1), d.Metrics[0].Alias)
+	require.Equal(t, int64(-5), d.Metrics[1].Value)
+	require.Equal(t, uint64(math.MaxUint64), d.Metrics[2].Value)
+	require.Equal(t, true, d.Metrics[3].Value)
+	require.Equal(t, 0.125, d.Metrics[4].Value)
+	require.Equal(t, ts, d.Metrics[4].Timestamp)
+	require.Equal(t, "line 1", d.Metrics[5].Value)
+	require.Nil(t, d.Metrics[6].Value)
+
+	require.Equal(t, Int32, TypeOf("dint"))
+	require.Equal(t, DataType(0), TypeOf("string"))
+	require.Equal(t, "plc_1", DeviceID("plc/1"))
+
+	_, err = Decode([]byte{0x12, 0x05})
+	require.Error(t, err)
+}
+
+// message is message received by fake broker
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// broker is fake MQTT broker recording published messages
+type broker struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	msgs []message
+}
+
+func (b *broker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *broker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		h, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		var n, shift int
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			n |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+
+		switch h >> 4 {
+		case 1: // CONNECT
+			_, _ = conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 3: // PUBLISH
+			qos := (h >> 1) & 3
+			tl := int(binary.BigEndian.Uint16(body))
+			m := message{topic: string(body[2 : 2+tl])}
+			rest := body[2+tl:]
+			if qos > 0 {
+				_, _ = conn.Write([]byte{0x40, 0x02, rest[0], rest[1]})
+				rest = rest[2:]
+			}
+			m.payload = rest
+			b.mu.Lock()
+			b.msgs = append(b.msgs, m)
+			b.mu.Unlock()
+		case 8: // SUBSCRIBE
+			_, _ = conn.Write([]byte{0x90, 0x03, body[0], body[1], 0x01})
+		case 12: // PINGREQ
+			_, _ = conn.Write([]byte{0xd0, 0x00})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func (b *broker) messages() []message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]message(nil), b.msgs...)
+}
+
+func TestEdgeNode(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	b := &broker{ln: ln}
+	go b.serve()
+	defer ln.Close()
+
+	en := New(Config{Broker: "tcp://" + ln.Addr().String(), GroupID: "plant", EdgeNodeID: "gw1"}, logrus.New())
+	en.AddDevice("plc1", []Metric{{Name: "temp", Alias: 1, DataType: Float}}, nil)
+	// device is not born: value is stored for DBIRTH
+	en.Data("plc1", Metric{Name: "temp", Value: float32(20)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		en.Start(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return en.Stats().Births == 1 }, 5*time.Second, 20*time.Millisecond)
+
+	en.Birth("plc1")
+	en.Data("plc1", Metric{Name: "temp", Value: float32(21)}, Metric{Name: "unknown", Value: 1})
+	en.Death("plc1")
+	require.Eventually(t, func() bool { return len(b.messages()) == 4 }, 5*time.Second, 20*time.Millisecond)
+	cancel()
+	<-done
+
+	msgs := b.messages()
+	topics := make([]string, len(msgs))
+	for i, m := range msgs {
+		topics[i] = m.topic
+	}
+	require.Equal(t, []string{
+		"spBv1.0/plant/NBIRTH/gw1",
+		"spBv1.0/plant/DBIRTH/gw1/plc1",
+		"spBv1.0/plant/DDATA/gw1/plc1",
+		"spBv1.0/plant/DDEATH/gw1/plc1",
+		"spBv1.0/plant/NDEATH/gw1",
+	}, topics)
+
+	for i, m := range msgs[:4] {
+		p, err := Decode(m.payload)
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), *p.Seq)
+		switch i {
+		case 0:
+			require.Equal(t, "bdSeq", p.Metrics[0].Name)
+			require.Equal(t, RebirthMetric, p.Metrics[1].Name)
+		case 1:
+			require.Equal(t, "temp", p.Metrics[0].Name)
+			require.Equal(t, float64(20), p.Metrics[0].Value)
+		case 2:
+			require.Len(t, p.Metrics, 1)
+			require.Equal(t, uint64(1), p.Metrics[0].Alias)
+			require.Equal(t, float64(21), p.Metrics[0].Value)
+		}
+	}
+	death, err := Decode(msgs[4].payload)
+	require.NoError(t, err)
+	require.Nil(t, death.Seq)
+	require.Equal(t, uint64(0), death.Metrics[0].Value)
+}
@@ -0,0 +1,78 @@
+package spool
+
+import "sync"
+
+// Memory is buffer of max records in memory
+type Memory struct {
+	max      int
+	overflow string
+
+	mu    sync.Mutex
+	queue []Record
+	seq   uint64
+	stats Stats
+}
+
+// NewMemory is creating buffer of max records with overflow policy (DropOldest, DropNewest)
+func NewMemory(max int, policy string) (*Memory, error) {
+	policy, err := overflow(policy)
+	if err != nil {
+		return nil, err
+	}
+	if max < 1 {
+		max = 1
+	}
+	return &Memory{max: max, overflow: policy}, nil
+}
+
+// Push is adding record
+func (m *Memory) Push(r Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.queue) >= m.max {
+		m.stats.Dropped++
+		if m.overflow == DropNewest {
+			return ErrFull
+		}
+		m.queue = m.queue[1:]
+	}
+	m.seq++
+	r.Seq = m.seq
+	m.queue = append(m.queue, r)
+	m.stats.Written++
+	return nil
+}
+
+// Peek is returns oldest record
+func (m *Memory) Peek() (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.queue) == 0 {
+		return Record{}, ErrEmpty
+	}
+	return m.queue[0], nil
+}
+
+// Ack is removing oldest record with sequence number seq
+func (m *Memory) Ack(seq uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.queue) > 0 && m.queue[0].Seq == seq {
+		m.queue = m.queue[1:]
+		m.stats.Acked++
+	}
+}
+
+// Stats is returns counters of buffer
+func (m *Memory) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.stats
+	st.Records = len(m.queue)
+	return st
+}
+
+// Close is doing nothing, records are lost
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,464 @@
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// files of queue
+const (
+	segmentExt  = ".seg"
+	cursorFile  = "cursor" // sequence number of last acknowledged record
+	frameHeader = 8        // length & CRC-32 of payload
+)
+
+// segment is segment file: records in order of sequence numbers
+type segment struct {
+	id    uint64
+	size  int64 // bytes of valid records
+	count int   // records not acknowledged
+}
+
+// Queue is queue of records in segment files of directory: records are appended to last segment,
+// new segment is started when last one is full, segment is deleted when all its records are
+// acknowledged or dropped on overflow. Sequence number of last acknowledged record is kept in cursor
+// file, so records are replayed after restart from first not acknowledged (at least once).
+type Queue struct {
+	conf Config
+
+	mu      sync.Mutex
+	segs    []*segment
+	lastID  uint64   // id of last created segment
+	w       *os.File // writer of last segment
+	r       *os.File // reader of first segment
+	roff    int64    // read offset in first segment
+	head    *Record  // record at roff
+	headLen int64
+	cursor  *os.File
+	seq     uint64 // last sequence number
+	size    int64  // bytes of segment files
+	timer   *time.Timer
+	closed  bool
+	stats   Stats
+}
+
+// Open is opening queue in conf.Dir (directory is created), records not acknowledged are kept;
+// torn record at end of segment (crash while writing) is truncated
+func Open(conf Config) (*Queue, error) {
+	if err := conf.Check(); err != nil {
+		return nil, err
+	}
+	if conf.Dir == "" {
+		return nil, errors.New("spool dir is empty")
+	}
+	if err := os.MkdirAll(conf.Dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &Queue{conf: conf}
+
+	cursor, err := os.OpenFile(filepath.Join(conf.Dir, cursorFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	q.cursor = cursor
+	var acked uint64
+	b := make([]byte, 8)
+	if n, _ := cursor.ReadAt(b, 0); n == 8 {
+		acked = binary.LittleEndian.Uint64(b)
+	}
+	q.seq = acked
+
+	ids, err := segmentIDs(conf.Dir)
+	if err != nil {
+		cursor.Close()
+		return nil, err
+	}
+	for _, id := range ids {
+		q.lastID = id
+		s := &segment{id: id}
+		offset, last, err := q.scan(s, acked)
+		if err != nil {
+			q.Close()
+			return nil, err
+		}
+		if last > q.seq {
+			q.seq = last
+		}
+		if s.count == 0 {
+			if err := os.Remove(q.path(id)); err != nil {
+				q.Close()
+				return nil, err
+			}
+			continue
+		}
+		if len(q.segs) == 0 {
+			q.roff = offset
+		}
+		q.segs = append(q.segs, s)
+		q.size += s.size
+	}
+	return q, nil
+}
+
+// segmentIDs is returns ids of segment files of directory in order
+func segmentIDs(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// scan is reading records of segment: valid size, count of records after acked, offset of first of them
+// and last sequence number; segment is truncated after last valid record
+func (q *Queue) scan(s *segment, acked uint64) (offset int64, last uint64, err error) {
+	data, err := os.ReadFile(q.path(s.id))
+	if err != nil {
+		return 0, 0, err
+	}
+	offset = -1
+	var pos int64
+	for {
+		r, n, ok := decodeFrame(data[pos:])
+		if !ok {
+			break
+		}
+		if r.Seq > acked {
+			if offset < 0 {
+				offset = pos
+			}
+			s.count++
+		}
+		last = r.Seq
+		pos += n
+	}
+	s.size = pos
+	if pos < int64(len(data)) {
+		if err := os.Truncate(q.path(s.id), pos); err != nil {
+			return 0, 0, err
+		}
+	}
+	return offset, last, nil
+}
+
+func (q *Queue) path(id uint64) string {
+	return filepath.Join(q.conf.Dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// Push is appending record to last segment, on overflow oldest segment is dropped (DropOldest)
+// or record is dropped (DropNewest, ErrFull)
+func (q *Queue) Push(r Record) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errors.New("spool is closed")
+	}
+	r.Seq = q.seq + 1
+	frame := encodeFrame(r)
+	n := int64(len(frame))
+	if n > q.conf.SegmentSize {
+		return fmt.Errorf("record of %d bytes is larger than segment", n)
+	}
+
+	for q.size+n > q.conf.MaxSize {
+		if q.conf.Overflow == DropNewest {
+			q.stats.Dropped++
+			return ErrFull
+		}
+		if len(q.segs) == 1 {
+			// last segment is dropped only after new segment is started
+			if err := q.newSegment(); err != nil {
+				return err
+			}
+		}
+		if err := q.removeFirst(); err != nil {
+			return err
+		}
+	}
+	if len(q.segs) == 0 || q.w == nil || q.segs[len(q.segs)-1].size+n > q.conf.SegmentSize {
+		if err := q.newSegment(); err != nil {
+			return err
+		}
+	}
+
+	last := q.segs[len(q.segs)-1]
+	if _, err := q.w.Write(frame); err != nil {
+		// torn record is truncated on next open
+		return err
+	}
+	last.size += n
+	last.count++
+	q.size += n
+	q.seq = r.Seq
+	q.stats.Written++
+	q.synced(q.w)
+	return nil
+}
+
+// Peek is returns first record not acknowledged
+func (q *Queue) Peek() (Record, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Record{}, errors.New("spool is closed")
+	}
+	if q.head != nil {
+		return *q.head, nil
+	}
+	for {
+		if len(q.segs) == 0 {
+			return Record{}, ErrEmpty
+		}
+		s := q.segs[0]
+		if q.roff < s.size {
+			break
+		}
+		if len(q.segs) == 1 {
+			return Record{}, ErrEmpty
+		}
+		if err := q.removeFirst(); err != nil {
+			return Record{}, err
+		}
+	}
+
+	if q.r == nil {
+		r, err := os.Open(q.path(q.segs[0].id))
+		if err != nil {
+			return Record{}, err
+		}
+		q.r = r
+	}
+	hdr := make([]byte, frameHeader)
+	if _, err := q.r.ReadAt(hdr, q.roff); err != nil {
+		return Record{}, err
+	}
+	frame := make([]byte, frameHeader+int(binary.LittleEndian.Uint32(hdr)))
+	if _, err := q.r.ReadAt(frame, q.roff); err != nil {
+		return Record{}, err
+	}
+	r, n, ok := decodeFrame(frame)
+	if !ok {
+		return Record{}, fmt.Errorf("corrupted record in segment %d at %d", q.segs[0].id, q.roff)
+	}
+	q.head, q.headLen = &r, n
+	return r, nil
+}
+
+// Ack is removing first record if it has sequence number seq
+func (q *Queue) Ack(seq uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || q.head == nil || q.head.Seq != seq {
+		return
+	}
+	q.roff += q.headLen
+	q.segs[0].count--
+	q.head = nil
+	q.stats.Acked++
+
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, seq)
+	if _, err := q.cursor.WriteAt(b, 0); err == nil {
+		q.synced(q.cursor)
+	}
+	// last segment is kept for writes, it is deleted on rollover
+	if q.roff >= q.segs[0].size && len(q.segs) > 1 {
+		_ = q.removeFirst()
+	}
+}
+
+// Stats is returns counters of queue
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := q.stats
+	for _, s := range q.segs {
+		st.Records += s.count
+	}
+	st.Bytes = q.size - q.roff
+	st.Segments = len(q.segs)
+	return st
+}
+
+// Close is syncing and closing files
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	if q.timer != nil {
+		q.timer.Stop()
+	}
+	var errs []error
+	for _, f := range []*os.File{q.w, q.cursor} {
+		if f == nil {
+			continue
+		}
+		if q.conf.Sync != SyncNever {
+			errs = append(errs, f.Sync())
+		}
+		errs = append(errs, f.Close())
+	}
+	if q.r != nil {
+		errs = append(errs, q.r.Close())
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSegment is starting new last segment
+func (q *Queue) newSegment() error {
+	q.lastID++
+	w, err := os.OpenFile(q.path(q.lastID), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if q.w != nil {
+		if q.conf.Sync != SyncNever {
+			_ = q.w.Sync()
+		}
+		q.w.Close()
+	}
+	q.w = w
+	q.segs = append(q.segs, &segment{id: q.lastID})
+	if q.conf.Sync == SyncAlways {
+		syncDir(q.conf.Dir)
+	}
+	// first segment could be read completely
+	if len(q.segs) > 1 && q.roff >= q.segs[0].size {
+		return q.removeFirst()
+	}
+	return nil
+}
+
+// removeFirst is deleting first segment, records not acknowledged are dropped
+func (q *Queue) removeFirst() error {
+	s := q.segs[0]
+	q.stats.Dropped += uint64(s.count)
+	if q.r != nil {
+		q.r.Close()
+		q.r = nil
+	}
+	if len(q.segs) == 1 && q.w != nil {
+		q.w.Close()
+		q.w = nil
+	}
+	q.segs = q.segs[1:]
+	q.size -= s.size
+	q.roff, q.head = 0, nil
+	return os.Remove(q.path(s.id))
+}
+
+// synced is syncing file by policy: now (SyncAlways) or by timer (SyncInterval)
+func (q *Queue) synced(f *os.File) {
+	switch q.conf.Sync {
+	case SyncAlways:
+		_ = f.Sync()
+	case SyncInterval:
+		if q.timer == nil {
+			q.timer = time.AfterFunc(q.conf.SyncInterval, q.sync)
+		}
+	}
+}
+
+// sync is syncing last segment and cursor by timer
+func (q *Queue) sync() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.timer = nil
+	if q.closed {
+		return
+	}
+	if q.w != nil {
+		_ = q.w.Sync()
+	}
+	_ = q.cursor.Sync()
+}
+
+// syncDir is syncing directory entries (created segment files)
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	d.Close()
+}
+
+// encodeFrame is frame of record: length & CRC-32 of payload, payload is sequence number, time,
+// tag, node (uvarint length & bytes) and data
+func encodeFrame(r Record) []byte {
+	b := make([]byte, frameHeader+16, frameHeader+16+2*binary.MaxVarintLen64+len(r.Tag)+len(r.Node)+len(r.Data))
+	binary.LittleEndian.PutUint64(b[frameHeader:], r.Seq)
+	binary.LittleEndian.PutUint64(b[frameHeader+8:], uint64(r.Time.UnixNano()))
+	for _, s := range []string{r.Tag, r.Node} {
+		var n [binary.MaxVarintLen64]byte
+		b = append(b, n[:binary.PutUvarint(n[:], uint64(len(s)))]...)
+		b = append(b, s...)
+	}
+	b = append(b, r.Data...)
+	binary.LittleEndian.PutUint32(b, uint32(len(b)-frameHeader))
+	binary.LittleEndian.PutUint32(b[4:], crc32.ChecksumIEEE(b[frameHeader:]))
+	return b
+}
+
+// decodeFrame is decoding record of frame at start of b, returns length of frame,
+// false - frame is incomplete or corrupted
+func decodeFrame(b []byte) (Record, int64, bool) {
+	if len(b) < frameHeader {
+		return Record{}, 0, false
+	}
+	n := int64(binary.LittleEndian.Uint32(b))
+	if n < 16 || int64(len(b)) < frameHeader+n {
+		return Record{}, 0, false
+	}
+	p := b[frameHeader : frameHeader+n]
+	if crc32.ChecksumIEEE(p) != binary.LittleEndian.Uint32(b[4:]) {
+		return Record{}, 0, false
+	}
+	r := Record{
+		Seq:  binary.LittleEndian.Uint64(p),
+		Time: time.Unix(0, int64(binary.LittleEndian.Uint64(p[8:]))),
+	}
+	p = p[16:]
+	var fields [2]string
+	for i := range fields {
+		l, k := binary.Uvarint(p)
+		if k <= 0 || uint64(len(p)-k) < l {
+			return Record{}, 0, false
+		}
+		fields[i] = string(p[k : k+int(l)])
+		p = p[k+int(l):]
+	}
+	r.Tag, r.Node = fields[0], fields[1]
+	r.Data = append([]byte(nil), p...)
+	return r, frameHeader + n, true
+}
@@ -0,0 +1,121 @@
+// Package spool is store-and-forward buffer of value changes of tags: records are queued while sink
+// (MQTT broker) is unavailable and replayed in order when it returns. Queue is kept on disk in
+// segment files (bounded total size, fsync policy) and survives restart of gateway, Memory is
+// bounded buffer in memory.
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sync policies of segment files
+const (
+	SyncAlways   = "always"   // fsync after every record and acknowledge
+	SyncInterval = "interval" // fsync not later than Config.SyncInterval after write
+	SyncNever    = "never"    // fsync by OS
+)
+
+// Overflow policies
+const (
+	DropOldest = "drop_oldest" // oldest records (segment) are dropped for new record
+	DropNewest = "drop_newest" // new record is dropped
+)
+
+// defaults of Config
+const (
+	DefaultSegmentSize  = 4 << 20
+	DefaultMaxSize      = 256 << 20
+	DefaultSyncInterval = time.Second
+)
+
+var (
+	// ErrEmpty is returned by Peek of empty buffer
+	ErrEmpty = errors.New("spool is empty")
+	// ErrFull is returned by Push when record is dropped by overflow policy DropNewest
+	ErrFull = errors.New("spool is full")
+)
+
+// Record is value change of tag
+type Record struct {
+	Seq  uint64 // sequence number, assigned by Push
+	Time time.Time
+	Tag  string // alias or node of tag
+	Node string
+	Data []byte // payload, e.g. JSON
+}
+
+// Stats is counters of buffer
+type Stats struct {
+	Records  int   // backlog: records not acknowledged
+	Bytes    int64 // backlog: bytes of records in segment files (0 - memory)
+	Segments int
+	Written  uint64 // records pushed
+	Acked    uint64 // records acknowledged by sink
+	Dropped  uint64 // records dropped on overflow
+}
+
+// Buffer is store-and-forward buffer: records are pushed by producer, read in order by sink
+// and removed when acknowledged
+type Buffer interface {
+	// Push is adding record, ErrFull - record is dropped (DropNewest)
+	Push(r Record) error
+	// Peek is returns oldest record, ErrEmpty - buffer is empty
+	Peek() (Record, error)
+	// Ack is removing oldest record if it has sequence number seq (record could be dropped on overflow)
+	Ack(seq uint64)
+	Stats() Stats
+	Close() error
+}
+
+// Config is configuration of disk queue
+type Config struct {
+	Dir          string // directory of segment files, empty - buffer in memory
+	SegmentSize  int64  // max size of segment file, bytes
+	MaxSize      int64  // max size of all segment files, bytes
+	Sync         string // SyncAlways, SyncInterval (default), SyncNever
+	SyncInterval time.Duration
+	Overflow     string // DropOldest (default), DropNewest
+}
+
+// Check is validating config and setting defaults
+func (c *Config) Check() error {
+	if c.SegmentSize <= 0 {
+		c.SegmentSize = DefaultSegmentSize
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = DefaultMaxSize
+	}
+	if c.MaxSize < 2*c.SegmentSize {
+		return fmt.Errorf("spool max size %d: must be at least 2 segments (%d)", c.MaxSize, 2*c.SegmentSize)
+	}
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = DefaultSyncInterval
+	}
+	c.Sync = strings.ToLower(strings.TrimSpace(c.Sync))
+	switch c.Sync {
+	case "":
+		c.Sync = SyncInterval
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return fmt.Errorf("spool sync %q: must be always, interval or never", c.Sync)
+	}
+	var err error
+	c.Overflow, err = overflow(c.Overflow)
+	return err
+}
+
+// overflow is checking overflow policy, default DropOldest
+func overflow(p string) (string, error) {
+	p = strings.ToLower(strings.TrimSpace(p))
+	switch p {
+	case "":
+		return DropOldest, nil
+	case DropOldest, DropNewest:
+		return p, nil
+	default:
+		return "", fmt.Errorf("spool overflow %q: must be drop_oldest or drop_newest", p)
+	}
+}
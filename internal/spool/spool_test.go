@@ -0,0 +1,166 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// drain is reading & acknowledging all records of buffer
+func drain(t *testing.T, b Buffer) []Record {
+	var rs []Record
+	for {
+		r, err := b.Peek()
+		if err == ErrEmpty {
+			return rs
+		}
+		require.NoError(t, err)
+		rs = append(rs, r)
+		b.Ack(r.Seq)
+	}
+}
+
+func tags(rs []Record) []string {
+	var ts []string
+	for _, r := range rs {
+		ts = append(ts, r.Tag)
+	}
+	return ts
+}
+
+func TestConfig(t *testing.T) {
+	c := Config{}
+	require.NoError(t, c.Check())
+	require.Equal(t, Config{SegmentSize: DefaultSegmentSize, MaxSize: DefaultMaxSize, Sync: SyncInterval, SyncInterval: DefaultSyncInterval, Overflow: DropOldest}, c)
+	require.Error(t, (&Config{SegmentSize: 100, MaxSize: 150}).Check())
+	require.Error(t, (&Config{Sync: "sometimes"}).Check())
+	require.Error(t, (&Config{Overflow: "drop_all"}).Check())
+	c = Config{Sync: " Always ", Overflow: "DROP_NEWEST"}
+	require.NoError(t, c.Check())
+	require.Equal(t, SyncAlways, c.Sync)
+	require.Equal(t, DropNewest, c.Overflow)
+}
+
+func TestMemory(t *testing.T) {
+	m, err := NewMemory(2, "")
+	require.NoError(t, err)
+	for _, tag := range []string{"a", "b", "c"} {
+		require.NoError(t, m.Push(Record{Tag: tag}))
+	}
+	require.Equal(t, Stats{Records: 2, Written: 3, Dropped: 1}, m.Stats())
+	require.Equal(t, []string{"b", "c"}, tags(drain(t, m)))
+
+	m, err = NewMemory(1, DropNewest)
+	require.NoError(t, err)
+	require.NoError(t, m.Push(Record{Tag: "a"}))
+	require.Equal(t, ErrFull, m.Push(Record{Tag: "b"}))
+	r, err := m.Peek()
+	require.NoError(t, err)
+	m.Ack(r.Seq + 1) // not first record
+	require.Equal(t, []string{"a"}, tags(drain(t, m)))
+}
+
+func TestQueue(t *testing.T) {
+	dir := t.TempDir()
+	conf := Config{Dir: dir, Sync: SyncAlways}
+	q, err := Open(conf)
+	require.NoError(t, err)
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 123, time.UTC)
+	for _, tag := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Push(Record{Time: ts, Tag: tag, Node: "ns=3;s=" + tag, Data: []byte(`{"value":1}`)}))
+	}
+	r, err := q.Peek()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), r.Seq)
+	require.True(t, ts.Equal(r.Time))
+	require.Equal(t, "ns=3;s=a", r.Node)
+	require.Equal(t, `{"value":1}`, string(r.Data))
+	q.Ack(r.Seq)
+	st := q.Stats()
+	require.Equal(t, 2, st.Records)
+	require.Equal(t, 1, st.Segments)
+	require.Equal(t, uint64(1), st.Acked)
+	require.NoError(t, q.Close())
+
+	// not acknowledged records are replayed after reopen
+	q, err = Open(conf)
+	require.NoError(t, err)
+	require.Equal(t, 2, q.Stats().Records)
+	rs := drain(t, q)
+	require.Equal(t, []string{"b", "c"}, tags(rs))
+	require.Equal(t, uint64(3), rs[1].Seq)
+	require.NoError(t, q.Push(Record{Tag: "d"}))
+	require.NoError(t, q.Close())
+
+	q, err = Open(conf)
+	require.NoError(t, err)
+	rs = drain(t, q)
+	require.Equal(t, []string{"d"}, tags(rs))
+	require.Equal(t, uint64(4), rs[0].Seq)
+	require.Equal(t, int64(0), q.Stats().Bytes)
+	require.NoError(t, q.Close())
+}
+
+func TestQueueOverflow(t *testing.T) {
+	frame := int64(len(encodeFrame(Record{Tag: "t00"})))
+	conf := Config{Dir: t.TempDir(), SegmentSize: 2 * frame, MaxSize: 4 * frame, Sync: SyncNever}
+	q, err := Open(conf)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, q.Push(Record{Tag: "t0" + string(rune('0'+i))}))
+	}
+	st := q.Stats()
+	require.Equal(t, 4, st.Records)
+	require.Equal(t, uint64(6), st.Dropped)
+	require.Equal(t, 2, st.Segments)
+	require.Equal(t, 4*frame, st.Bytes)
+
+	// segments are deleted when read
+	require.Equal(t, []string{"t06", "t07", "t08", "t09"}, tags(drain(t, q)))
+	files, err := filepath.Glob(filepath.Join(conf.Dir, "*"+segmentExt))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.NoError(t, q.Close())
+
+	conf = Config{Dir: t.TempDir(), SegmentSize: 2 * frame, MaxSize: 4 * frame, Overflow: DropNewest}
+	q, err = Open(conf)
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, q.Push(Record{Tag: "t0" + string(rune('0'+i))}))
+	}
+	require.Equal(t, ErrFull, q.Push(Record{Tag: "t04"}))
+	require.Error(t, q.Push(Record{Tag: "t05", Data: make([]byte, 2*frame)}))
+	require.Equal(t, []string{"t00", "t01", "t02", "t03"}, tags(drain(t, q)))
+	require.Equal(t, uint64(1), q.Stats().Dropped)
+	require.NoError(t, q.Close())
+}
+
+func TestQueueRecovery(t *testing.T) {
+	conf := Config{Dir: t.TempDir()}
+	q, err := Open(conf)
+	require.NoError(t, err)
+	require.NoError(t, q.Push(Record{Tag: "a"}))
+	require.NoError(t, q.Push(Record{Tag: "b"}))
+	require.NoError(t, q.Close())
+
+	// torn record at end of segment
+	files, err := filepath.Glob(filepath.Join(conf.Dir, "*"+segmentExt))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write(encodeFrame(Record{Seq: 3, Tag: "c"})[:10])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	q, err = Open(conf)
+	require.NoError(t, err)
+	require.NoError(t, q.Push(Record{Tag: "d"}))
+	rs := drain(t, q)
+	require.Equal(t, []string{"a", "b", "d"}, tags(rs))
+	require.Equal(t, uint64(3), rs[2].Seq)
+	require.NoError(t, q.Close())
+}